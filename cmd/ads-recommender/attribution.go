@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/infrastructure"
+)
+
+// decodedToken is a line of the attribution command output
+type decodedToken struct {
+	Token       string              `json:"token"`
+	Attribution *domain.Attribution `json:"attribution,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// attribution verifies the attribution tokens given as arguments, or one
+// per line on the standard input, and writes their attribution as ndjson.
+// Expired tokens are decoded with their error so late events can be studied.
+// Usage: ads-recommender attribution [token...]
+func attribution(env commandEnv, args []string) error {
+	flags := flag.NewFlagSet("attribution", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	tokens := infrastructure.NewAttributionTokens(env.conf.AttributionConf.Secrets, env.conf.AttributionConf.MaxAge)
+	if !tokens.Enabled() {
+		return errors.New("no attribution secrets configured on ATTRIBUTION_SECRETS")
+	}
+	output := json.NewEncoder(os.Stdout)
+	decode := func(token string) error {
+		decoded := decodedToken{Token: token}
+		attribution, err := tokens.Verify(token)
+		if err == nil || errors.Is(err, infrastructure.ErrExpiredToken) {
+			decoded.Attribution = &attribution
+		}
+		if err != nil {
+			decoded.Error = err.Error()
+		}
+		return output.Encode(decoded)
+	}
+	if flags.NArg() > 0 {
+		for _, token := range flags.Args() {
+			if err := decode(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if token := strings.TrimSpace(scanner.Text()); token != "" {
+			if err := decode(token); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/infrastructure"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+)
+
+// commandEnv holds what subcommands run with
+type commandEnv struct {
+	conf   infrastructure.Config
+	logger loggers.Logger
+	// events counts the index changes results
+	events   infrastructure.MetricsEvents
+	shutdown *infrastructure.ShutdownSequence
+}
+
+// command is a subcommand of the service binary
+type command func(env commandEnv, args []string) error
+
+// commands are the subcommands by name, without one the service is started
+var commands = map[string]command{ // nolint: gochecknoglobals
+	"bootstrap":   bootstrap,
+	"reindex":     reindex,
+	"consume":     consume,
+	"attribution": attribution,
+	"coview":      coview,
+}
+
+// bootstrap creates a new version of the index with the configured settings
+// and mapping, loads the ads file on it and points the index alias to it.
+// Usage: ads-recommender bootstrap [-ads resources/fixtures/ads.json]
+func bootstrap(env commandEnv, args []string) error {
+	flags := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	adsPath := flags.String("ads", "resources/fixtures/ads.json", "ndjson or json array file with the ads to load")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	index, err := newIndexBootstrap(env).Run(
+		env.conf.ElasticSearchConf.Index,
+		env.conf.ElasticSearchConf.IndexSettings,
+		env.conf.ElasticSearchConf.IndexMapping,
+		*adsPath,
+	)
+	if err != nil {
+		return err
+	}
+	env.logger.Info("Index %s bootstrapped", index)
+	return nil
+}
+
+// reindex creates a new version of the index with the configured settings
+// and mapping, copying the current version or loading an ads file, and
+// moves the index alias to it once the documents are verified.
+// Usage: ads-recommender reindex [-ads file] [-keep 1]
+func reindex(env commandEnv, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	adsPath := flags.String("ads", "", "ndjson or json array file with the ads to load, by default the current index is copied")
+	keep := flags.Int("keep", -1, "previous index versions to keep, older ones are deleted. Negative keeps every version")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	index, err := newIndexBootstrap(env).Reindex(infrastructure.ReindexRequest{
+		Alias:        env.conf.ElasticSearchConf.Index,
+		SettingsPath: env.conf.ElasticSearchConf.IndexSettings,
+		MappingPath:  env.conf.ElasticSearchConf.IndexMapping,
+		AdsPath:      *adsPath,
+		Keep:         *keep,
+	})
+	if err != nil {
+		return err
+	}
+	env.logger.Info("Index %s reindexed", index)
+	return nil
+}
+
+// newIndexBootstrap returns an index bootstrap on the configured cluster
+func newIndexBootstrap(env commandEnv) *infrastructure.IndexBootstrap {
+	elasticHandler := newElasticHandler(env.conf, env.logger)
+	elasticHandler.SetReindexTimeout(env.conf.ElasticSearchConf.ReindexTimeout)
+	indexBootstrap := infrastructure.NewIndexBootstrap(elasticHandler, env.logger)
+	indexBootstrap.SetMetrics(env.events)
+	return indexBootstrap
+}
+
+// newElasticHandler returns the elasticsearch handler for the configured cluster
+func newElasticHandler(conf infrastructure.Config, logger loggers.Logger) *infrastructure.ElasticHandler {
+	return infrastructure.NewElasticHandlerHandler(
+		conf.ElasticSearchConf.MaxIdleConns,
+		conf.ElasticSearchConf.MaxIdleConnsPerHost,
+		conf.ElasticSearchConf.MaxConnsPerHost,
+		conf.ElasticSearchConf.IdleConnTimeout,
+		conf.ElasticSearchConf.BatchSize,
+		conf.ElasticSearchConf.SearchTimeout,
+		conf.ElasticSearchConf.Host+":"+conf.ElasticSearchConf.Port,
+		conf.ElasticSearchConf.Username,
+		conf.ElasticSearchConf.Password,
+		logger,
+	)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/infrastructure"
+)
+
+// consume applies ad lifecycle events on the index alias until the events
+// are exhausted or the service is interrupted. Events that cannot be
+// applied are appended to the dead letter file.
+// Usage: ads-recommender consume [-events -] [-dead-letter file]
+func consume(env commandEnv, args []string) error {
+	flags := flag.NewFlagSet("consume", flag.ContinueOnError)
+	eventsPath := flags.String("events", "-", "ndjson file with the ad events, - reads the standard input")
+	deadLetterPath := flags.String("dead-letter", env.conf.AdUpdatesConf.DeadLetter,
+		"ndjson file where the events that cannot be applied are appended")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var events io.Reader = os.Stdin
+	if *eventsPath != "-" {
+		file, err := os.Open(filepath.Clean(*eventsPath))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		events = file
+	}
+	deadLetter, err := os.OpenFile(filepath.Clean(*deadLetterPath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer deadLetter.Close()
+	consumer := infrastructure.NewAdUpdatesConsumer(
+		newElasticHandler(env.conf, env.logger),
+		env.conf.ElasticSearchConf.Index,
+		env.conf.AdUpdatesConf,
+		deadLetter,
+		env.logger,
+	)
+	consumer.SetMetrics(env.events)
+	env.shutdown.Push(consumer)
+	env.logger.Info("Consuming ad events from %s on %s", *eventsPath, env.conf.ElasticSearchConf.Index)
+	return consumer.Run(infrastructure.NewNDJSONAdEventSource(events))
+}
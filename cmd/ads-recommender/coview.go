@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/infrastructure"
+)
+
+// coview builds the co-view neighbours store from an ndjson views log, one
+// {"userId": "...", "deviceId": "...", "listId": 123} line per view. The
+// store replaces the configured one, running services load it on their
+// next reload.
+// Usage: ads-recommender coview -views views.ndjson [-out path] [-top 50]
+func coview(env commandEnv, args []string) error {
+	conf := env.conf.CoviewConf
+	flags := flag.NewFlagSet("coview", flag.ContinueOnError)
+	viewsPath := flags.String("views", "", "ndjson file with the views, one per line")
+	out := flags.String("out", conf.Path, "store file to write")
+	builder := infrastructure.CoviewBuilder{}
+	flags.IntVar(&builder.TopN, "top", conf.TopN, "neighbours kept for each ad")
+	flags.IntVar(&builder.MinCoviews, "min-coviews", conf.MinCoviews, "users that must view both ads")
+	flags.IntVar(&builder.MaxUserViews, "max-user-views", conf.MaxUserViews, "users viewing more ads are ignored")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *viewsPath == "" {
+		return errors.New("the views file is required on -views")
+	}
+	views, err := os.Open(filepath.Clean(*viewsPath))
+	if err != nil {
+		return err
+	}
+	defer views.Close() // nolint: errcheck
+	neighbours, stats, err := builder.Build(views)
+	if err != nil {
+		return err
+	}
+	if err := infrastructure.WriteCoviewStore(*out, neighbours); err != nil {
+		return err
+	}
+	env.logger.Info("Coview store %s written: %+v", *out, stats)
+	return nil
+}
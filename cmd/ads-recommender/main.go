@@ -47,6 +47,18 @@ func main() { //nolint: funlen
 	}
 
 	shutdownSequence.Push(prometheus)
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		indexEvents := prometheus.NewEventsCollector(
+			"ads-recommender_index_events_total",
+			"elasticsearch index bootstrap, reindex and ad updates results",
+		)
+		env := commandEnv{conf: conf, logger: logger, events: &indexEvents, shutdown: shutdownSequence}
+		if err := commands[os.Args[1]](env, os.Args[2:]); err != nil {
+			logger.Error("error running %s: %+v", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
 	logger.Info("Initializing resources")
 	regions, errorRegions := infrastructure.NewRconf(
 		conf.EtcdConf.Host,
@@ -82,18 +94,30 @@ func main() { //nolint: funlen
 	getSuggestionsLogger := loggers.MakeGetSuggestionsLogger(logger)
 
 	// Infrastructure
-	elasticHandler := infrastructure.NewElasticHandlerHandler(
-		conf.ElasticSearchConf.MaxIdleConns,
-		conf.ElasticSearchConf.MaxIdleConnsPerHost,
-		conf.ElasticSearchConf.MaxConnsPerHost,
-		conf.ElasticSearchConf.IdleConnTimeout,
-		conf.ElasticSearchConf.BatchSize,
-		conf.ElasticSearchConf.SearchTimeout,
-		conf.ElasticSearchConf.Host+":"+conf.ElasticSearchConf.Port,
-		conf.ElasticSearchConf.Username,
-		conf.ElasticSearchConf.Password,
-		logger,
+	elasticHandler := newElasticHandler(conf, logger)
+	searchEvents := prometheus.NewEventsCollector(
+		"ads-recommender_elasticsearch_events_total",
+		"elasticsearch timed out searches, shard failures and errors",
+	)
+	elasticHandler.SetMetrics(
+		prometheus.NewHistogramCollector(
+			"ads-recommender_elasticsearch_took_seconds",
+			"time elasticsearch reports searches took",
+			[]float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+			"index",
+		),
+		&searchEvents,
 	)
+	var searchHandler repository.ElasticSearchHandler = elasticHandler
+	if conf.ElasticSearchConf.Fixture != "" {
+		memoryHandler, err := infrastructure.NewMemoryElasticHandler(conf.ElasticSearchConf.Fixture)
+		if err != nil {
+			logger.Error("error loading elasticsearch fixture: %+v", err)
+			panic(err)
+		}
+		logger.Info("Serving searches in memory from fixture %s", conf.ElasticSearchConf.Fixture)
+		searchHandler = memoryHandler
+	}
 	HTTPHandler := infrastructure.NewHTTPHandler(logger)
 
 	// httpCachedIndicatorHandler
@@ -101,7 +125,7 @@ func main() { //nolint: funlen
 
 	// Repos
 	adsRepository := repository.NewAdsRepository(
-		elasticHandler,
+		searchHandler,
 		regions,
 		queryTemplates,
 		conf.AdConf.ImageServerURL,
@@ -110,10 +134,28 @@ func main() { //nolint: funlen
 		conf.ElasticSearchConf.SearchResultPage,
 	)
 	adContactRepo := repository.NewAdContactRepository(HTTPHandler, conf.AdConf.ContactPath)
+	indicatorsStore, err := infrastructure.NewIndicatorsFileStore(conf.IndicatorsConf.StorePath)
+	if err != nil {
+		logger.Error("error loading stored indicators: %+v", err)
+	}
+	if conf.IndicatorsConf.TablePath != "" {
+		if err := indicatorsStore.LoadTable(conf.IndicatorsConf.TablePath); err != nil {
+			logger.Error("error loading indicators table: %+v", err)
+		}
+	}
 	indicatorsRepository := repository.NewIndicatorsRepository(
 		httpCachedIndicatorHandler,
-		conf.IndicatorsConf.UFPath,
-		conf.IndicatorsConf.DefaultValue,
+		conf.IndicatorsConf.GetAPIPath(),
+		conf.IndicatorsConf.GetDefaultValues(),
+		indicatorsStore,
+		prometheus.NewGaugeCollector(
+			"ads-recommender_indicator_value_age_seconds",
+			"age of the indicator values served by ads-recommender service",
+			"code",
+		),
+		conf.IndicatorsConf.StaleAfter,
+		conf.IndicatorsConf.Offline,
+		loggers.MakeIndicatorsLogger(logger),
 	)
 
 	if err := infrastructure.LoadJSONFromFile(
@@ -123,6 +165,57 @@ func main() { //nolint: funlen
 		panic(fmt.Sprintf("error loading allowed message text file: %s", err.Error()))
 	}
 
+	var communesRepository usecases.CommunesRepository
+	if conf.ResourcesConf.CommunesCoordinates != "" {
+		communes, err := infrastructure.NewFileDataMapping(conf.ResourcesConf.CommunesCoordinates)
+		if err != nil {
+			logger.Error("error loading communes coordinates: %+v", err)
+		} else {
+			communesRepository = repository.NewCommunesRepository(communes)
+		}
+	} else if conf.EtcdConf.CommunesPath != "" {
+		communes, err := infrastructure.NewRconf(
+			conf.EtcdConf.Host,
+			conf.EtcdConf.CommunesPath,
+			conf.EtcdConf.Prefix,
+			logger,
+		)
+		if err != nil {
+			logger.Error("error loading communes coordinates from etcd")
+		} else {
+			communesRepository = repository.NewCommunesRepository(communes)
+		}
+	}
+
+	var experiments usecases.Experiments
+	if err := infrastructure.LoadJSONFromFile(conf.ResourcesConf.Experiments, &experiments); err != nil {
+		logger.Error("error loading experiments: %+v", err)
+	}
+	if err := experiments.Validate(conf.AdConf.SuggestionsParams); err != nil {
+		logger.Error("experiments are disabled: %+v", err)
+		experiments = nil
+	}
+	var interleavings usecases.Interleavings
+	if err := infrastructure.LoadJSONFromFile(conf.ResourcesConf.Interleavings, &interleavings); err != nil {
+		logger.Error("error loading interleavings: %+v", err)
+	}
+	if err := interleavings.Validate(conf.AdConf.SuggestionsParams); err != nil {
+		logger.Error("interleavings are disabled: %+v", err)
+		interleavings = nil
+	}
+
+	var campaigns []repository.SponsoredCampaign
+	if err := infrastructure.LoadJSONFromFile(conf.ResourcesConf.SponsoredAds, &campaigns); err != nil {
+		logger.Error("error loading sponsored ads: %+v", err)
+	}
+
+	coviewStore := infrastructure.NewCoviewStore(
+		conf.CoviewConf.Path,
+		conf.CoviewConf.ReloadInterval,
+		logger,
+	)
+	shutdownSequence.Push(coviewStore)
+
 	// Interactors
 	getSuggestions := usecases.GetSuggestions{
 		SuggestionsRepo:      adsRepository,
@@ -133,6 +226,92 @@ func main() { //nolint: funlen
 		SuggestionsParams:    conf.AdConf.SuggestionsParams,
 		Logger:               getSuggestionsLogger,
 		IndicatorsRepository: indicatorsRepository,
+		DefaultRates:         conf.IndicatorsConf.GetDefaultValues(),
+		CommunesRepo:         communesRepository,
+		Experiments:          experiments,
+		Interleavings:        interleavings,
+		CoviewRepo:           repository.NewCoviewRepository(coviewStore),
+		FrequencyCaps: repository.NewFrequencyCapRepository(
+			infrastructure.NewMemoryFrequencyCounter(conf.SponsoredConf.CapWindow, conf.SponsoredConf.MaxKeys),
+		),
+	}
+	// sponsored slots are only filled when there are campaigns
+	if len(campaigns) > 0 {
+		getSuggestions.SponsoredRepo = repository.NewSponsoredAdsRepository(campaigns)
+	}
+	var feedLayout usecases.FeedLayout
+	if err := infrastructure.LoadJSONFromFile(conf.ResourcesConf.FeedLayout, &feedLayout); err != nil {
+		logger.Error("error loading feed layout: %+v", err)
+	}
+	getFeed := usecases.GetFeed{
+		Suggestions: &getSuggestions,
+		Layout:      feedLayout,
+		Logger:      loggers.MakeGetFeedLogger(logger),
+	}
+	eventsWriter, err := infrastructure.NewRotatingFileWriter(
+		conf.EventsConf.Path,
+		conf.EventsConf.MaxFileSize,
+		conf.EventsConf.MaxFileAge,
+	)
+	if err != nil {
+		logger.Error("error opening events file: %+v", err)
+		panic(err)
+	}
+	eventsSink := infrastructure.NewBufferedEventsSink(
+		eventsWriter,
+		conf.EventsConf.BufferSize,
+		conf.EventsConf.BatchSize,
+		conf.EventsConf.FlushInterval,
+		logger,
+	)
+	trackEvents := usecases.TrackEvents{
+		Repository: repository.NewTrackingEventsRepository(
+			eventsSink,
+			prometheus.NewCounterCollector(
+				"ads-recommender_tracking_events_total",
+				"impressions, clicks and replies of recommended ads",
+				"carousel", "type",
+			),
+			getSuggestions.Carousels(),
+		),
+		Logger: loggers.MakeTrackEventsLogger(logger),
+	}
+	// recently viewed ads are only stored when enabled
+	var recentlyViewed handlers.ViewedAdsMerger // nolint: typecheck
+	if conf.ViewedConf.Enabled {
+		viewed := &usecases.RecentlyViewed{
+			Repository: repository.NewViewedAdsRepository(
+				infrastructure.NewMemoryViewedAdsStore(conf.ViewedConf.TTL, conf.ViewedConf.MaxKeys),
+				conf.ViewedConf.MaxViewed,
+			),
+			Logger: loggers.MakeRecentlyViewedLogger(logger),
+		}
+		recentlyViewed = viewed
+		trackEvents.RecentlyViewed = viewed
+	}
+	// hidden ads are kept in memory or also on a file to survive restarts
+	var hiddenAdsStore repository.HiddenAdsStore = infrastructure.NewMemoryHiddenAdsStore(conf.HiddenConf.MaxKeys)
+	if conf.HiddenConf.Store == "file" {
+		fileStore, err := infrastructure.NewFileHiddenAdsStore(conf.HiddenConf.Path, conf.HiddenConf.MaxKeys)
+		if err != nil {
+			logger.Error("error opening hidden ads file: %+v", err)
+			panic(err)
+		}
+		hiddenAdsStore = fileStore
+		// hidden ads are written until the server stops receiving them
+		shutdownSequence.Push(fileStore)
+	}
+	hideAds := usecases.HideAds{
+		Repository: repository.NewHiddenAdsRepository(hiddenAdsStore, conf.HiddenConf.MaxHidden),
+		AdsRepo:    adsRepository,
+		Logger:     loggers.MakeHideAdsLogger(logger),
+	}
+	// attribution tokens are only signed when secrets are configured
+	var attribution *handlers.Attribution // nolint: typecheck
+	tokens := infrastructure.NewAttributionTokens(conf.AttributionConf.Secrets, conf.AttributionConf.MaxAge)
+	if tokens.Enabled() {
+		attribution = &handlers.Attribution{Signer: tokens, Versions: &getSuggestions}
+		trackEvents.Tokens = tokens
 	}
 	// HealthHandler
 	var healthHandler handlers.HealthHandler // nolint: typecheck
@@ -143,6 +322,40 @@ func main() { //nolint: funlen
 		UnitOfAccountSymbol: conf.AdConf.UnitOfAccountSymbol,
 		Regions:             regions,
 		Categories:          categories,
+		Attribution:         attribution,
+		Experiments:         experiments,
+		RecentlyViewed:      recentlyViewed,
+		HiddenAds:           &hideAds,
+		Sponsored:           &getSuggestions,
+	}
+	getMultiSuggestionsHandler := handlers.GetMultiSuggestionsHandler{ // nolint: typecheck
+		Interactor:          &getSuggestions,
+		CurrencySymbol:      conf.AdConf.CurrencySymbol,
+		UnitOfAccountSymbol: conf.AdConf.UnitOfAccountSymbol,
+		Regions:             regions,
+		Categories:          categories,
+		Attribution:         attribution,
+		Experiments:         experiments,
+		HiddenAds:           &hideAds,
+	}
+
+	getFeedHandler := handlers.GetFeedHandler{ // nolint: typecheck
+		Interactor:          &getFeed,
+		CurrencySymbol:      conf.AdConf.CurrencySymbol,
+		UnitOfAccountSymbol: conf.AdConf.UnitOfAccountSymbol,
+		Regions:             regions,
+		Categories:          categories,
+		Attribution:         attribution,
+		RecentlyViewed:      recentlyViewed,
+		HiddenAds:           &hideAds,
+	}
+
+	trackEventsHandler := handlers.TrackEventsHandler{ // nolint: typecheck
+		Interactor: &trackEvents,
+	}
+
+	hideAdsHandler := handlers.HideAdsHandler{ // nolint: typecheck
+		Interactor: &hideAds,
 	}
 
 	useBrowserCache := infrastructure.InBrowserCache{
@@ -175,6 +388,32 @@ func main() { //nolint: funlen
 						Handler:      &getSuggestionsHandler,
 						UseCache:     true,
 						RequestCache: conf.AdsRecommenderClientConf.DefaultCacheTTL},
+					{
+						Name:         "Get recommendations for a specific ad using several carousels",
+						Method:       "GET",
+						Pattern:      "/recommendations/{listID:\\d+}",
+						Handler:      &getMultiSuggestionsHandler,
+						UseCache:     true,
+						RequestCache: conf.AdsRecommenderClientConf.DefaultCacheTTL},
+					{
+						Name:         "Get the feed of a specific ad",
+						Method:       "GET",
+						Pattern:      "/feed/{listID:\\d+}",
+						Handler:      &getFeedHandler,
+						UseCache:     true,
+						RequestCache: conf.AdsRecommenderClientConf.DefaultCacheTTL},
+					{
+						Name:    "Track impressions, clicks and replies of recommended ads",
+						Method:  "POST",
+						Pattern: "/events",
+						Handler: &trackEventsHandler,
+					},
+					{
+						Name:    "Hide an ad or its seller from the recommendations of a device",
+						Method:  "POST",
+						Pattern: "/hidden",
+						Handler: &hideAdsHandler,
+					},
 				},
 			},
 		},
@@ -187,6 +426,8 @@ func main() { //nolint: funlen
 		router,
 		logger,
 	)
+	// events are written once the server stops receiving them
+	shutdownSequence.Push(eventsSink)
 	shutdownSequence.Push(server)
 	logger.Info("Starting request serving")
 
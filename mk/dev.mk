@@ -7,7 +7,21 @@ start: build-dev docker-compose-up
 ## Stop running services
 stop: docker-compose-down
 
-.PHONY: run start stop
+## Create a new version of the elasticsearch index loaded with the fixture ads
+bootstrap: build-dev
+	docker-compose -f docker/docker-compose.yml \
+		--project-name ${APPNAME} \
+		--project-directory . \
+		run --rm ads-recommender go run ./cmd/${APPNAME} bootstrap
+
+## Create a new version of the elasticsearch index copying the current one
+reindex: build-dev
+	docker-compose -f docker/docker-compose.yml \
+		--project-name ${APPNAME} \
+		--project-directory . \
+		run --rm ads-recommender go run ./cmd/${APPNAME} reindex
+
+.PHONY: run start stop bootstrap reindex
 
 ## Build develoment docker image
 build-dev: docker-compose-build
@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -32,7 +34,12 @@ type Ad struct {
 	URL              string
 	Image            Image
 	PublisherType    PublisherType
-	AdParams         map[string]string
+	AdParams         map[string]AdParam
+	// Source is the carousel configuration that recommended the ad when
+	// the results of several configurations are interleaved
+	Source string
+	// Sponsored tells the ad is served on a paid slot
+	Sponsored bool
 }
 
 // GetFieldsMapString returns a map with all fields and values
@@ -63,12 +70,121 @@ func (ad *Ad) GetFieldsMapString() (output map[string]string) {
 	for key, val := range ad.AdParams {
 		key = strings.ToLower(key)
 		if output[key] == "" {
-			output[key] = val
+			output[key] = val.String()
 		}
 	}
 	return output
 }
 
+// GetParam returns the ad param with the given name, ignoring case
+func (ad *Ad) GetParam(name string) (AdParam, bool) {
+	if param, ok := ad.AdParams[name]; ok {
+		return param, true
+	}
+	for key, param := range ad.AdParams {
+		if strings.EqualFold(key, name) {
+			return param, true
+		}
+	}
+	return AdParam{}, false
+}
+
+// SetParam sets an ad param, initializing the params map if needed
+func (ad *Ad) SetParam(name string, param AdParam) {
+	if ad.AdParams == nil {
+		ad.AdParams = make(map[string]AdParam)
+	}
+	ad.AdParams[name] = param
+}
+
+// ParamType describes the kind of value an ad param holds
+type ParamType string
+
+// Supported ad param types
+const (
+	IntParam    ParamType = "int"
+	FloatParam  ParamType = "float"
+	StringParam ParamType = "string"
+	ArrayParam  ParamType = "array"
+	LabelParam  ParamType = "label"
+)
+
+// AdParam represents a typed ad param value. Label params hold a raw value
+// along with its translated label, ex: estate type "1" labeled "Departamento"
+type AdParam struct {
+	Type   ParamType
+	Int    int64
+	Float  float64
+	Text   string
+	Values []string
+	Label  string
+}
+
+// NewIntParam returns an int ad param
+func NewIntParam(value int64) AdParam {
+	return AdParam{Type: IntParam, Int: value}
+}
+
+// NewFloatParam returns a float ad param
+func NewFloatParam(value float64) AdParam {
+	return AdParam{Type: FloatParam, Float: value}
+}
+
+// NewStringParam returns a string ad param
+func NewStringParam(value string) AdParam {
+	return AdParam{Type: StringParam, Text: value}
+}
+
+// NewArrayParam returns an array ad param
+func NewArrayParam(values []string) AdParam {
+	return AdParam{Type: ArrayParam, Values: values}
+}
+
+// NewLabelParam returns a param holding a raw value and its translated label
+func NewLabelParam(value, label string) AdParam {
+	return AdParam{Type: LabelParam, Text: value, Label: label}
+}
+
+// String returns the param raw value as string, the value used on queries.
+// Array values are joined by commas
+func (p AdParam) String() string {
+	switch p.Type {
+	case IntParam:
+		return strconv.FormatInt(p.Int, 10)
+	case FloatParam:
+		return strconv.FormatFloat(p.Float, 'f', -1, 64)
+	case ArrayParam:
+		return strings.Join(p.Values, ",")
+	default:
+		return p.Text
+	}
+}
+
+// Display returns the param value to be shown to users, the translated
+// label when the param has one
+func (p AdParam) Display() string {
+	if p.Type == LabelParam && p.Label != "" {
+		return p.Label
+	}
+	return p.String()
+}
+
+// Number returns the param numeric value. It returns false when the param
+// is not numeric
+func (p AdParam) Number() (float64, bool) {
+	switch p.Type {
+	case IntParam:
+		return float64(p.Int), true
+	case FloatParam:
+		return p.Float, true
+	case LabelParam:
+		value, err := strconv.ParseFloat(p.Text, 64)
+		return value, err == nil
+	default:
+		return 0, false
+	}
+}
+
 // Image struct that defines the internal structure of ad images
 type Image struct {
 	Full   string
@@ -76,6 +192,32 @@ type Image struct {
 	Small  string
 }
 
+// earthRadiusKm is the mean earth radius used to calculate distances
+const earthRadiusKm = 6371.0
+
+// GeoPoint represents a geographic location
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// String returns the point in the "lat,lon" format used by elasticsearch
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+// DistanceTo returns the distance in kilometers to the given point
+// using the haversine formula
+func (p GeoPoint) DistanceTo(other GeoPoint) float64 {
+	lat1 := p.Lat * math.Pi / 180
+	lat2 := other.Lat * math.Pi / 180
+	deltaLat := (other.Lat - p.Lat) * math.Pi / 180
+	deltaLon := (other.Lon - p.Lon) * math.Pi / 180
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+	return 2 * earthRadiusKm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
 // PublisherType describes publisher user
 type PublisherType string
 
@@ -84,3 +226,150 @@ const (
 	Pro PublisherType = "pro"
 	Pri PublisherType = "private"
 )
+
+// TrackingEventType is the user interaction with a recommended ad
+type TrackingEventType string
+
+// Tracked interactions, an ad is shown, opened and replied
+const (
+	ImpressionEvent TrackingEventType = "impression"
+	ClickEvent      TrackingEventType = "click"
+	ReplyEvent      TrackingEventType = "reply"
+)
+
+// TrackingEvent is an interaction with an ad recommended on a carousel
+// for the source ad, at the given position of the response identified by
+// RequestID. Token is the attribution token the ad was recommended with,
+// Attributed is set once it is verified. DeviceID is the device the event
+// happened on, when known
+type TrackingEvent struct {
+	Type          TrackingEventType
+	Carousel      string
+	SourceListID  int64
+	ListID        int64
+	Position      int
+	RequestID     string
+	Time          time.Time
+	Token         string
+	ConfigVersion string
+	Variant       string
+	Attributed    bool
+	DeviceID      string
+}
+
+// Attribution describes how a recommended ad was produced: the carousel
+// and configuration version, the source ad, its position on the response,
+// the experiment variant, if any, and when it was recommended
+type Attribution struct {
+	Carousel      string
+	ConfigVersion string
+	SourceListID  int64
+	ListID        int64
+	Position      int
+	Variant       string
+	Time          time.Time
+}
+
+// Neighbour is an ad viewed by the users that viewed another one, scored
+// by how often both ads are viewed together
+type Neighbour struct {
+	ListID int64
+	Score  float64
+}
+
+// SponsoredAd is a paid placement of an ad on the carousels, ads with a
+// higher priority are placed first. FrequencyCap is how many times it is
+// served to the same user or device on the cap window, zero is uncapped
+type SponsoredAd struct {
+	ListID       int64
+	Priority     int
+	FrequencyCap int
+}
+
+// Exclusions are the ads and the sellers, by user id, never suggested to
+// a user, as the ones hidden on a device
+type Exclusions struct {
+	ListIDs []int64
+	UserIDs []int64
+}
+
+// ErrorKind classifies errors so every layer can report them consistently
+type ErrorKind int
+
+// Supported error kinds
+const (
+	UnknownError ErrorKind = iota
+	NotFoundError
+	InvalidInputError
+	UnavailableError
+	TimeoutError
+)
+
+// Stable error codes that clients can branch on
+const (
+	ErrCodeAdNotFound        = "AD_NOT_FOUND"
+	ErrCodeInvalidCarousel   = "INVALID_CAROUSEL"
+	ErrCodeInvalidCursor     = "INVALID_CURSOR"
+	ErrCodeInvalidInput      = "INVALID_INPUT"
+	ErrCodeSearchUnavailable = "SEARCH_UNAVAILABLE"
+	ErrCodeSearchTimeout     = "SEARCH_TIMEOUT"
+	ErrCodeSearchQuery       = "SEARCH_QUERY_ERROR"
+	ErrCodeEventsUnavailable = "EVENTS_UNAVAILABLE"
+	ErrCodeHiddenUnavailable = "HIDDEN_UNAVAILABLE"
+	ErrCodeInternal          = "INTERNAL_ERROR"
+)
+
+// Error is a typed error with a stable machine readable code.
+// The wrapped error, if any, keeps the original cause
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+// NewError returns a typed error
+func NewError(kind ErrorKind, code, message string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+// Error returns the error message followed by its cause
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorKindOf returns the kind of err, UnknownError when it is not typed
+func ErrorKindOf(err error) ErrorKind {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+	return UnknownError
+}
+
+// ErrorMessageOf returns the message of err without its cause, which may
+// carry upstream details. Untyped errors get a generic message
+func ErrorMessageOf(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) && typed.Message != "" {
+		return typed.Message
+	}
+	return "internal error"
+}
+
+// ErrorCodeOf returns the code of err, ErrCodeInternal when it is not typed
+func ErrorCodeOf(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) && typed.Code != "" {
+		return typed.Code
+	}
+	return ErrCodeInternal
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -71,9 +73,13 @@ func TestGetFieldsMapStringWithAdParamsOK(t *testing.T) {
 		Currency:      "peso",
 		ListTime:      timeT,
 		PublisherType: Pro,
-		AdParams: map[string]string{
-			"Test": "test",
-			"Type": "Duplicated"},
+		AdParams: map[string]AdParam{
+			"Test":   NewStringParam("test"),
+			"Type":   NewStringParam("Duplicated"),
+			"Rooms":  NewIntParam(3),
+			"Size":   NewFloatParam(45.5),
+			"Extra":  NewArrayParam([]string{"pool", "gym"}),
+			"Estate": NewLabelParam("1", "Departamento")},
 	}
 	expected := map[string]string{
 		"listid":           "1",
@@ -98,7 +104,73 @@ func TestGetFieldsMapStringWithAdParamsOK(t *testing.T) {
 		"url":              "",
 		"publishertype":    "pro",
 		"test":             "test",
+		"rooms":            "3",
+		"size":             "45.5",
+		"extra":            "pool,gym",
+		"estate":           "1",
 	}
 	result := ad.GetFieldsMapString()
 	assert.Equal(t, expected, result)
 }
+
+func TestAdParamDisplay(t *testing.T) {
+	assert.Equal(t, "Departamento", NewLabelParam("1", "Departamento").Display())
+	assert.Equal(t, "1", NewLabelParam("1", "").Display())
+	assert.Equal(t, "3", NewIntParam(3).Display())
+}
+
+func TestAdParamNumber(t *testing.T) {
+	cases := []struct {
+		param    AdParam
+		expected float64
+		ok       bool
+	}{
+		{NewIntParam(3), 3, true},
+		{NewFloatParam(45.5), 45.5, true},
+		{NewLabelParam("2", "2 dormitorios"), 2, true},
+		{NewLabelParam("a", "A"), 0, false},
+		{NewStringParam("3"), 0, false},
+		{NewArrayParam([]string{"1"}), 0, false},
+	}
+	for _, c := range cases {
+		value, ok := c.param.Number()
+		assert.Equal(t, c.expected, value)
+		assert.Equal(t, c.ok, ok)
+	}
+}
+
+func TestAdGetParamIgnoresCase(t *testing.T) {
+	ad := Ad{}
+	ad.SetParam("Rooms", NewIntParam(2))
+	param, ok := ad.GetParam("rooms")
+	assert.True(t, ok)
+	assert.Equal(t, NewIntParam(2), param)
+	_, ok = ad.GetParam("mileage")
+	assert.False(t, ok)
+}
+
+func TestGeoPointDistanceTo(t *testing.T) {
+	santiago := GeoPoint{Lat: -33.4489, Lon: -70.6693}
+	valparaiso := GeoPoint{Lat: -33.0472, Lon: -71.6127}
+	assert.InDelta(t, 98.4, santiago.DistanceTo(valparaiso), 0.1)
+	assert.Equal(t, 0.0, santiago.DistanceTo(santiago))
+}
+
+func TestGeoPointString(t *testing.T) {
+	point := GeoPoint{Lat: -33.4489, Lon: -70.6693}
+	assert.Equal(t, "-33.4489,-70.6693", point.String())
+}
+
+func TestErrorKindAndCode(t *testing.T) {
+	cause := fmt.Errorf("connection refused")
+	err := NewError(UnavailableError, ErrCodeSearchUnavailable, "search unavailable", cause)
+	wrapped := fmt.Errorf("getting ads: %w", err)
+	assert.EqualError(t, err, "search unavailable: connection refused")
+	assert.Equal(t, UnavailableError, ErrorKindOf(wrapped))
+	assert.Equal(t, ErrCodeSearchUnavailable, ErrorCodeOf(wrapped))
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, UnknownError, ErrorKindOf(cause))
+	assert.Equal(t, ErrCodeInternal, ErrorCodeOf(cause))
+	assert.Equal(t, "search unavailable", ErrorMessageOf(wrapped))
+	assert.Equal(t, "internal error", ErrorMessageOf(cause))
+}
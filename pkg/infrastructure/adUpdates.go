@@ -0,0 +1,385 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+)
+
+// AdEventType is the lifecycle change of an ad
+type AdEventType string
+
+const (
+	// AdCreated is sent when an ad is published
+	AdCreated AdEventType = "created"
+	// AdEdited is sent when a published ad changes
+	AdEdited AdEventType = "edited"
+	// AdDeleted is sent when an ad is deleted by its owner or moderation
+	AdDeleted AdEventType = "deleted"
+	// AdSold is sent when an ad is marked as sold
+	AdSold AdEventType = "sold"
+)
+
+// AdEvent is a lifecycle change of an ad, ex:
+// {"type": "edited", "adId": 1, "ad": {"adId": 1, "listId": 101, ...}}
+// Created and edited events carry the whole ad document
+type AdEvent struct {
+	Type AdEventType     `json:"type"`
+	AdID json.Number     `json:"adId"`
+	Ad   json.RawMessage `json:"ad,omitempty"`
+}
+
+// validate checks the event can be applied
+func (e AdEvent) validate() error {
+	if e.AdID == "" {
+		return errors.New("event has no adId")
+	}
+	switch e.Type {
+	case AdCreated, AdEdited:
+		if len(e.Ad) == 0 || bytes.Equal(e.Ad, []byte("null")) {
+			return fmt.Errorf("%s event of ad %s has no ad", e.Type, e.AdID)
+		}
+	case AdDeleted, AdSold:
+	default:
+		return fmt.Errorf("unknown event type %q of ad %s", e.Type, e.AdID)
+	}
+	return nil
+}
+
+// action returns the bulk action applying the event, sold ads are removed
+// from the index as deleted ones so they are not recommended anymore
+func (e AdEvent) action() string {
+	if e.Type == AdDeleted || e.Type == AdSold {
+		return "delete"
+	}
+	return "index"
+}
+
+// AdEventSource is a stream of ad events. Read blocks until the next event
+// is available and returns io.EOF once there are no more events. Events
+// that cannot be read are returned as *InvalidAdEventError, the source can
+// still be read after them
+type AdEventSource interface {
+	Read() (AdEvent, error)
+}
+
+// InvalidAdEventError is returned by sources for events that cannot be
+// decoded or applied
+type InvalidAdEventError struct {
+	Line int
+	Raw  string
+	Err  error
+}
+
+func (e *InvalidAdEventError) Error() string {
+	return fmt.Sprintf("invalid ad event on line %d: %s", e.Line, e.Err)
+}
+
+func (e *InvalidAdEventError) Unwrap() error {
+	return e.Err
+}
+
+// NDJSONAdEventSource reads ad events from a ndjson stream, one event per
+// line, as a file or the standard input
+type NDJSONAdEventSource struct {
+	reader *bufio.Reader
+	line   int
+}
+
+// NewNDJSONAdEventSource returns a source reading events from reader
+func NewNDJSONAdEventSource(reader io.Reader) *NDJSONAdEventSource {
+	return &NDJSONAdEventSource{reader: bufio.NewReader(reader)}
+}
+
+// Read returns the next event, blank lines are skipped
+func (s *NDJSONAdEventSource) Read() (AdEvent, error) {
+	for {
+		raw, err := s.reader.ReadBytes('\n')
+		if len(raw) == 0 && err != nil {
+			return AdEvent{}, err
+		}
+		s.line++
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		var event AdEvent
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&event); err != nil {
+			return AdEvent{}, &InvalidAdEventError{Line: s.line, Raw: string(raw), Err: err}
+		}
+		if err := event.validate(); err != nil {
+			return AdEvent{}, &InvalidAdEventError{Line: s.line, Raw: string(raw), Err: err}
+		}
+		return event, nil
+	}
+}
+
+// AdIndexer applies bulk actions on an index
+type AdIndexer interface {
+	Bulk(collection []ElasticItem, index, action string) error
+}
+
+// AdUpdatesConsumer keeps the index fresh applying ad lifecycle events.
+// Events are applied in batches, failed ones are retried with exponential
+// backoff when elasticsearch is overloaded or unavailable and written to
+// the dead letter once retries run out or when they are rejected
+type AdUpdatesConsumer struct {
+	indexer       AdIndexer
+	index         string
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+	deadLetter    *json.Encoder
+	logger        loggers.Logger
+	// events is optional, it counts applied, retried and dead letter events
+	events  MetricsEvents
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// deadLetterEntry is a line of the dead letter, events can be replayed
+// from it selecting the event field of each line
+type deadLetterEntry struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	Event *AdEvent  `json:"event,omitempty"`
+	// Line is the raw event when it could not be decoded
+	Line string `json:"line,omitempty"`
+}
+
+// readResult is an event read from the source
+type readResult struct {
+	event AdEvent
+	err   error
+}
+
+// NewAdUpdatesConsumer returns a consumer applying events on index,
+// writing the events that cannot be applied as ndjson on deadLetter
+func NewAdUpdatesConsumer(
+	indexer AdIndexer, index string, conf AdUpdatesConf, deadLetter io.Writer, logger loggers.Logger,
+) *AdUpdatesConsumer {
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &AdUpdatesConsumer{
+		indexer:       indexer,
+		index:         index,
+		batchSize:     batchSize,
+		flushInterval: conf.FlushInterval,
+		maxRetries:    conf.MaxRetries,
+		retryBackoff:  conf.RetryBackoff,
+		deadLetter:    json.NewEncoder(deadLetter),
+		logger:        logger,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// SetMetrics enables counting events by result: applied, retried and
+// dead_letter
+func (c *AdUpdatesConsumer) SetMetrics(events MetricsEvents) {
+	c.events = events
+}
+
+// Run applies the source events until it is exhausted or the consumer is
+// closed. A batch is applied once it has batchSize ads or every
+// flushInterval. Only the last event of each ad on a batch is applied
+func (c *AdUpdatesConsumer) Run(source AdEventSource) error {
+	defer close(c.stopped)
+	results := make(chan readResult)
+	go func() {
+		for {
+			event, err := source.Read()
+			select {
+			case results <- readResult{event: event, err: err}:
+			case <-c.done:
+				return
+			}
+			var invalid *InvalidAdEventError
+			if err != nil && !errors.As(err, &invalid) {
+				return
+			}
+		}
+	}()
+	var flush <-chan time.Time
+	if c.flushInterval > 0 {
+		ticker := time.NewTicker(c.flushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	batch := newAdEventBatch()
+	for {
+		select {
+		case result := <-results:
+			var invalid *InvalidAdEventError
+			switch {
+			case errors.As(result.err, &invalid):
+				c.logger.Error("%s", invalid)
+				c.writeDeadLetter(deadLetterEntry{Error: invalid.Err.Error(), Line: invalid.Raw})
+			case result.err == io.EOF:
+				c.apply(batch)
+				return nil
+			case result.err != nil:
+				c.apply(batch)
+				return result.err
+			default:
+				batch.add(result.event)
+				if batch.len() >= c.batchSize {
+					c.apply(batch)
+					batch = newAdEventBatch()
+				}
+			}
+		case <-flush:
+			if batch.len() > 0 {
+				c.apply(batch)
+				batch = newAdEventBatch()
+			}
+		case <-c.done:
+			c.apply(batch)
+			return nil
+		}
+	}
+}
+
+// Close stops the consumer, returning once the pending events are applied
+func (c *AdUpdatesConsumer) Close() error {
+	c.once.Do(func() { close(c.done) })
+	<-c.stopped
+	return nil
+}
+
+// adEventBatch holds the last event of each ad in arrival order
+type adEventBatch struct {
+	events    []AdEvent
+	positions map[string]int
+}
+
+func newAdEventBatch() *adEventBatch {
+	return &adEventBatch{positions: make(map[string]int)}
+}
+
+// add adds the event, replacing the previous one of the same ad
+func (b *adEventBatch) add(event AdEvent) {
+	if position, ok := b.positions[event.AdID.String()]; ok {
+		b.events[position] = event
+		return
+	}
+	b.positions[event.AdID.String()] = len(b.events)
+	b.events = append(b.events, event)
+}
+
+func (b *adEventBatch) len() int {
+	return len(b.events)
+}
+
+// apply applies the batch events, grouped by bulk action
+func (c *AdUpdatesConsumer) apply(batch *adEventBatch) {
+	if batch.len() == 0 {
+		return
+	}
+	byAction := make(map[string][]AdEvent)
+	for _, event := range batch.events {
+		byAction[event.action()] = append(byAction[event.action()], event)
+	}
+	for _, action := range []string{"index", "delete"} {
+		if events := byAction[action]; len(events) > 0 {
+			c.applyAction(events, action)
+		}
+	}
+}
+
+// applyAction applies events with the bulk action, retrying the failed
+// ones that can be retried
+func (c *AdUpdatesConsumer) applyAction(events []AdEvent, action string) {
+	pending := make(map[string]AdEvent, len(events))
+	for _, event := range events {
+		pending[event.AdID.String()] = event
+	}
+	for attempt := 0; ; attempt++ {
+		items := make([]ElasticItem, 0, len(events))
+		for _, event := range events {
+			item := ElasticItem{ID: event.AdID.String()}
+			if action != "delete" {
+				item.Data = event.Ad
+			}
+			items = append(items, item)
+		}
+		failed := bulkFailures(items, c.indexer.Bulk(items, c.index, action))
+		c.collectEvent("applied", len(items)-len(failed))
+		var retry []AdEvent
+		for _, failure := range failed {
+			event := pending[failure.ID]
+			if !retryableBulkItem(failure) || attempt >= c.maxRetries {
+				reason := fmt.Sprintf("[%d] %s: %s", failure.Status, failure.Type, failure.Reason)
+				c.logger.Error("error applying %s event of ad %s: %s", event.Type, failure.ID, reason)
+				c.writeDeadLetter(deadLetterEntry{Error: reason, Event: &event})
+				continue
+			}
+			retry = append(retry, event)
+		}
+		if len(retry) == 0 {
+			return
+		}
+		c.collectEvent("retried", len(retry))
+		backoff := c.retryBackoff << uint(attempt)
+		c.logger.Info("Retrying %d %s actions on %s in %s", len(retry), action, c.index, backoff)
+		time.Sleep(backoff)
+		events = retry
+	}
+}
+
+// bulkFailures returns the items that failed on a bulk. Errors other than
+// a *BulkError fail every item as unavailable
+func bulkFailures(items []ElasticItem, err error) []BulkItemError {
+	if err == nil {
+		return nil
+	}
+	var bulkErr *BulkError
+	if errors.As(err, &bulkErr) {
+		return bulkErr.Failed
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return failBulkItems(ids, &ElasticError{Status: http.StatusServiceUnavailable, Type: "bulk_error", Reason: err.Error()})
+}
+
+// retryableBulkItem tells whether the item failed because elasticsearch
+// was overloaded or unavailable, rejected items will fail again
+func retryableBulkItem(failure BulkItemError) bool {
+	return failure.Status == http.StatusTooManyRequests || failure.Status >= http.StatusInternalServerError
+}
+
+// writeDeadLetter writes the entry on the dead letter, failures to write
+// it are logged since there is nowhere else to keep the event
+func (c *AdUpdatesConsumer) writeDeadLetter(entry deadLetterEntry) {
+	entry.Time = time.Now()
+	c.collectEvent("dead_letter", 1)
+	if err := c.deadLetter.Encode(entry); err != nil {
+		c.logger.Error("error writing dead letter %+v: %+v", entry, err)
+	}
+}
+
+// collectEvent counts events by result
+func (c *AdUpdatesConsumer) collectEvent(eventType string, count int) {
+	if c.events == nil {
+		return
+	}
+	for i := 0; i < count; i++ {
+		c.events.CollectEvent("elasticsearch", "ad_updates", eventType)
+	}
+}
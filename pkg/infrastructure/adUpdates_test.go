@@ -0,0 +1,207 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockAdIndexer struct {
+	mock.Mock
+}
+
+func (m *mockAdIndexer) Bulk(collection []ElasticItem, index, action string) error {
+	return m.Called(collection, index, action).Error(0)
+}
+
+// blockingAdEventSource returns its events and then blocks until closed
+type blockingAdEventSource struct {
+	events []AdEvent
+	closed chan struct{}
+}
+
+func (s *blockingAdEventSource) Read() (AdEvent, error) {
+	if len(s.events) == 0 {
+		<-s.closed
+		return AdEvent{}, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+func newTestAdUpdatesConsumer(indexer AdIndexer, deadLetter io.Writer, batchSize int) *AdUpdatesConsumer {
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Info").Maybe()
+	logger.On("Error").Maybe()
+	return NewAdUpdatesConsumer(indexer, "ads", AdUpdatesConf{
+		BatchSize:    batchSize,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}, deadLetter, logger)
+}
+
+// readDeadLetter decodes the dead letter lines
+func readDeadLetter(t *testing.T, deadLetter *bytes.Buffer) []deadLetterEntry {
+	var entries []deadLetterEntry
+	decoder := json.NewDecoder(deadLetter)
+	for decoder.More() {
+		var entry deadLetterEntry
+		assert.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestNDJSONAdEventSource(t *testing.T) {
+	source := NewNDJSONAdEventSource(strings.NewReader(`{"type": "created", "adId": 1, "ad": {"adId": 1}}
+
+{"type": "sold", "adId": "2"}
+{"type": "edited", "adId": 3}
+{"type": "expired", "adId": 4}
+{"type": "deleted"
+{"type": "deleted", "adId": 5}`))
+	event, err := source.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, AdEvent{Type: AdCreated, AdID: "1", Ad: json.RawMessage(`{"adId": 1}`)}, event)
+	event, err = source.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, AdEvent{Type: AdSold, AdID: "2"}, event)
+	for _, line := range []int{4, 5, 6} {
+		_, err = source.Read()
+		var invalid *InvalidAdEventError
+		if assert.True(t, errors.As(err, &invalid)) {
+			assert.Equal(t, line, invalid.Line)
+		}
+	}
+	event, err = source.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, AdEvent{Type: AdDeleted, AdID: "5"}, event)
+	_, err = source.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAdUpdatesConsumerRun(t *testing.T) {
+	source := NewNDJSONAdEventSource(strings.NewReader(`{"type": "created", "adId": 1, "ad": {"adId": 1}}
+{"type": "created", "adId": 2, "ad": {"adId": 2}}
+{"type": "sold", "adId": 3}
+{"type": "edited", "adId": 1, "ad": {"adId": 1, "price": 10}}
+{"type": "deleted", "adId": 2}
+not json
+`))
+	indexer := &mockAdIndexer{}
+	// only the last event of each ad on a batch is applied
+	indexer.On("Bulk", []ElasticItem{
+		{ID: "1", Data: json.RawMessage(`{"adId": 1, "price": 10}`)},
+	}, "ads", "index").Return(nil).Once()
+	indexer.On("Bulk", []ElasticItem{{ID: "2"}, {ID: "3"}}, "ads", "delete").Return(nil).Once()
+	var deadLetter bytes.Buffer
+	events := &mockMetricsEvents{}
+	events.On("CollectEvent", "elasticsearch", "ad_updates", "applied").Times(3)
+	events.On("CollectEvent", "elasticsearch", "ad_updates", "dead_letter").Once()
+
+	consumer := newTestAdUpdatesConsumer(indexer, &deadLetter, 10)
+	consumer.SetMetrics(events)
+	assert.NoError(t, consumer.Run(source))
+	indexer.AssertExpectations(t)
+	events.AssertExpectations(t)
+	entries := readDeadLetter(t, &deadLetter)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "not json", entries[0].Line)
+		assert.Nil(t, entries[0].Event)
+	}
+	assert.NoError(t, consumer.Close())
+}
+
+func TestAdUpdatesConsumerBatches(t *testing.T) {
+	source := NewNDJSONAdEventSource(strings.NewReader(`{"type": "sold", "adId": 1}
+{"type": "sold", "adId": 2}
+{"type": "sold", "adId": 3}`))
+	indexer := &mockAdIndexer{}
+	indexer.On("Bulk", []ElasticItem{{ID: "1"}, {ID: "2"}}, "ads", "delete").Return(nil).Once()
+	indexer.On("Bulk", []ElasticItem{{ID: "3"}}, "ads", "delete").Return(nil).Once()
+
+	assert.NoError(t, newTestAdUpdatesConsumer(indexer, &bytes.Buffer{}, 2).Run(source))
+	indexer.AssertExpectations(t)
+}
+
+func TestAdUpdatesConsumerRetries(t *testing.T) {
+	source := NewNDJSONAdEventSource(strings.NewReader(`{"type": "created", "adId": 1, "ad": {"adId": 1}}
+{"type": "created", "adId": 2, "ad": {"adId": "two"}}
+{"type": "created", "adId": 3, "ad": {"adId": 3}}`))
+	indexer := &mockAdIndexer{}
+	indexer.On("Bulk", mock.Anything, "ads", "index").Return(&BulkError{Total: 3, Failed: []BulkItemError{
+		{ID: "1", Status: 429, Type: "es_rejected_execution_exception", Reason: "rejected"},
+		{ID: "2", Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse"},
+	}}).Once()
+	// ad 1 keeps failing until retries run out
+	indexer.On("Bulk", []ElasticItem{{ID: "1", Data: json.RawMessage(`{"adId": 1}`)}}, "ads", "index").
+		Return(errors.New("connection refused")).Twice()
+	var deadLetter bytes.Buffer
+	events := &mockMetricsEvents{}
+	events.On("CollectEvent", "elasticsearch", "ad_updates", "applied").Once()
+	events.On("CollectEvent", "elasticsearch", "ad_updates", "retried").Twice()
+	events.On("CollectEvent", "elasticsearch", "ad_updates", "dead_letter").Twice()
+
+	consumer := newTestAdUpdatesConsumer(indexer, &deadLetter, 10)
+	consumer.SetMetrics(events)
+	assert.NoError(t, consumer.Run(source))
+	indexer.AssertExpectations(t)
+	events.AssertExpectations(t)
+	entries := readDeadLetter(t, &deadLetter)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "2", entries[0].Event.AdID.String())
+		assert.Equal(t, "[400] mapper_parsing_exception: failed to parse", entries[0].Error)
+		assert.Equal(t, &AdEvent{Type: AdCreated, AdID: "1", Ad: json.RawMessage(`{"adId":1}`)}, entries[1].Event)
+		assert.Equal(t, "[503] bulk_error: connection refused", entries[1].Error)
+	}
+}
+
+func TestAdUpdatesConsumerFlushInterval(t *testing.T) {
+	source := &blockingAdEventSource{
+		events: []AdEvent{{Type: AdSold, AdID: "1"}},
+		closed: make(chan struct{}),
+	}
+	defer close(source.closed)
+	applied := make(chan struct{})
+	indexer := &mockAdIndexer{}
+	indexer.On("Bulk", []ElasticItem{{ID: "1"}}, "ads", "delete").Return(nil).Once().
+		Run(func(mock.Arguments) { close(applied) })
+
+	consumer := newTestAdUpdatesConsumer(indexer, &bytes.Buffer{}, 10)
+	consumer.flushInterval = time.Millisecond
+	go func() { _ = consumer.Run(source) }()
+	select {
+	case <-applied:
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not applied")
+	}
+	assert.NoError(t, consumer.Close())
+	indexer.AssertExpectations(t)
+}
+
+func TestAdUpdatesConsumerClose(t *testing.T) {
+	source := &blockingAdEventSource{
+		events: []AdEvent{{Type: AdSold, AdID: "1"}},
+		closed: make(chan struct{}),
+	}
+	defer close(source.closed)
+	indexer := &mockAdIndexer{}
+	indexer.On("Bulk", []ElasticItem{{ID: "1"}}, "ads", "delete").Return(nil).Once()
+
+	consumer := newTestAdUpdatesConsumer(indexer, &bytes.Buffer{}, 10)
+	done := make(chan error)
+	go func() { done <- consumer.Run(source) }()
+	time.Sleep(10 * time.Millisecond)
+	// pending events are applied on close
+	assert.NoError(t, consumer.Close())
+	assert.NoError(t, <-done)
+	indexer.AssertExpectations(t)
+}
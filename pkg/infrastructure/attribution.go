@@ -0,0 +1,135 @@
+package infrastructure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed or not signed
+// with any of the configured secrets
+var ErrInvalidToken = errors.New("invalid attribution token")
+
+// ErrExpiredToken is returned for tokens older than the max age
+var ErrExpiredToken = errors.New("expired attribution token")
+
+// attributionSignatureSize is the length the HMAC is truncated to, enough
+// to detect forged tokens while keeping them short
+const attributionSignatureSize = 16
+
+// AttributionTokens signs attributions as tokens and verifies them back.
+// Tokens are the base64url json payload and its HMAC-SHA256 joined by a
+// dot. The first secret signs tokens and every secret verifies them, so a
+// new secret can be rolled out before the old one is removed
+type AttributionTokens struct {
+	secrets [][]byte
+	maxAge  time.Duration
+	now     func() time.Time
+}
+
+// attributionPayload is the signed content of a token, short names keep
+// the responses small
+type attributionPayload struct {
+	Carousel      string `json:"c"`
+	ConfigVersion string `json:"v,omitempty"`
+	SourceListID  int64  `json:"s"`
+	ListID        int64  `json:"l"`
+	Position      int    `json:"p"`
+	Variant       string `json:"x,omitempty"`
+	Time          int64  `json:"t"`
+}
+
+// NewAttributionTokens returns tokens signed with the first of secrets,
+// empty secrets are ignored. Zero maxAge disables expiration
+func NewAttributionTokens(secrets []string, maxAge time.Duration) *AttributionTokens {
+	tokens := &AttributionTokens{maxAge: maxAge, now: time.Now}
+	for _, secret := range secrets {
+		if secret != "" {
+			tokens.secrets = append(tokens.secrets, []byte(secret))
+		}
+	}
+	return tokens
+}
+
+// Enabled tells whether there is a secret to sign tokens with
+func (a *AttributionTokens) Enabled() bool {
+	return len(a.secrets) > 0
+}
+
+// Sign returns the token of the attribution, empty when there are no secrets
+func (a *AttributionTokens) Sign(attribution domain.Attribution) string {
+	if !a.Enabled() {
+		return ""
+	}
+	payload, err := json.Marshal(attributionPayload{
+		Carousel:      attribution.Carousel,
+		ConfigVersion: attribution.ConfigVersion,
+		SourceListID:  attribution.SourceListID,
+		ListID:        attribution.ListID,
+		Position:      attribution.Position,
+		Variant:       attribution.Variant,
+		Time:          attribution.Time.Unix(),
+	})
+	if err != nil {
+		return ""
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.signature(a.secrets[0], encoded))
+}
+
+// Verify returns the attribution of a token signed with any of the secrets
+func (a *AttributionTokens) Verify(token string) (domain.Attribution, error) {
+	separator := strings.LastIndexByte(token, '.')
+	if separator < 0 {
+		return domain.Attribution{}, ErrInvalidToken
+	}
+	encoded := token[:separator]
+	signature, err := base64.RawURLEncoding.DecodeString(token[separator+1:])
+	if err != nil || !a.validSignature(encoded, signature) {
+		return domain.Attribution{}, ErrInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return domain.Attribution{}, ErrInvalidToken
+	}
+	var payload attributionPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return domain.Attribution{}, ErrInvalidToken
+	}
+	attribution := domain.Attribution{
+		Carousel:      payload.Carousel,
+		ConfigVersion: payload.ConfigVersion,
+		SourceListID:  payload.SourceListID,
+		ListID:        payload.ListID,
+		Position:      payload.Position,
+		Variant:       payload.Variant,
+		Time:          time.Unix(payload.Time, 0),
+	}
+	if a.maxAge > 0 && a.now().Sub(attribution.Time) > a.maxAge {
+		return attribution, ErrExpiredToken
+	}
+	return attribution, nil
+}
+
+// validSignature tells whether signature matches the payload for any secret
+func (a *AttributionTokens) validSignature(encoded string, signature []byte) bool {
+	for _, secret := range a.secrets {
+		if hmac.Equal(signature, a.signature(secret, encoded)) {
+			return true
+		}
+	}
+	return false
+}
+
+// signature returns the truncated HMAC of the encoded payload
+func (a *AttributionTokens) signature(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(encoded))
+	return mac.Sum(nil)[:attributionSignatureSize]
+}
@@ -0,0 +1,77 @@
+package infrastructure
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+func testAttribution() domain.Attribution {
+	return domain.Attribution{
+		Carousel:      "default",
+		ConfigVersion: "0a1b2c3d",
+		SourceListID:  1,
+		ListID:        2,
+		Position:      3,
+		Variant:       "b",
+		Time:          time.Unix(1620831600, 0),
+	}
+}
+
+func TestAttributionTokensSignVerify(t *testing.T) {
+	tokens := NewAttributionTokens([]string{"secret"}, time.Hour)
+	tokens.now = func() time.Time { return time.Unix(1620831600, 0).Add(time.Minute) }
+	token := tokens.Sign(testAttribution())
+	assert.NotEmpty(t, token)
+	attribution, err := tokens.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, testAttribution(), attribution)
+}
+
+func TestAttributionTokensRotation(t *testing.T) {
+	old := NewAttributionTokens([]string{"old"}, 0)
+	token := old.Sign(testAttribution())
+	rotated := NewAttributionTokens([]string{"new", "", "old"}, 0)
+	_, err := rotated.Verify(token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, rotated.Sign(testAttribution()))
+
+	_, err = NewAttributionTokens([]string{"new"}, 0).Verify(token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestAttributionTokensInvalid(t *testing.T) {
+	tokens := NewAttributionTokens([]string{"secret"}, 0)
+	token := tokens.Sign(testAttribution())
+	payload := token[:strings.LastIndexByte(token, '.')]
+	for _, invalid := range []string{
+		"",
+		"no-separator",
+		payload + ".",
+		payload + ".!!",
+		"x" + token,
+		token[:len(token)-1],
+	} {
+		_, err := tokens.Verify(invalid)
+		assert.Equal(t, ErrInvalidToken, err, invalid)
+	}
+}
+
+func TestAttributionTokensExpired(t *testing.T) {
+	tokens := NewAttributionTokens([]string{"secret"}, time.Hour)
+	tokens.now = func() time.Time { return time.Unix(1620831600, 0).Add(2 * time.Hour) }
+	attribution, err := tokens.Verify(tokens.Sign(testAttribution()))
+	assert.Equal(t, ErrExpiredToken, err)
+	assert.Equal(t, int64(2), attribution.ListID)
+}
+
+func TestAttributionTokensDisabled(t *testing.T) {
+	tokens := NewAttributionTokens([]string{""}, 0)
+	assert.False(t, tokens.Enabled())
+	assert.Empty(t, tokens.Sign(testAttribution()))
+	_, err := tokens.Verify("payload.signature")
+	assert.Equal(t, ErrInvalidToken, err)
+}
@@ -69,6 +69,8 @@ type EtcdConf struct {
 	Prefix     string `env:"PREFIX" envDefault:"/v2/keys"`
 	RegionPath string `env:"REGION_PATH" envDefault:"/public/location/regions.json"`
 	Categories string `env:"CATEGORIES" envDefault:"/public/categories.json"`
+	// CommunesPath is the optional etcd path of the communes coordinates
+	CommunesPath string `env:"COMMUNES_PATH" envDefault:""`
 }
 
 // AdConf configure how to get ads and how to fill some fields
@@ -86,6 +88,19 @@ type AdConf struct {
 // ResourcesConf resources path settings
 type ResourcesConf struct {
 	SuggestionsParams string `env:"SUGGESTIONS_PARAMS" envDefault:"resources/suggestion_params.json"`
+	// CommunesCoordinates is an optional json file with the communes coordinates,
+	// when set it is used instead of etcd
+	CommunesCoordinates string `env:"COMMUNES_COORDINATES" envDefault:""`
+	// FeedLayout is the json file with the ordered carousels of the feed
+	FeedLayout string `env:"FEED_LAYOUT" envDefault:"resources/feed_layout.json"`
+	// Experiments is the json file with the variants of the carousels on experiment
+	Experiments string `env:"EXPERIMENTS" envDefault:"resources/experiments.json"`
+	// Interleavings is the json file with the carousels whose results are
+	// interleaved from two configurations
+	Interleavings string `env:"INTERLEAVINGS" envDefault:"resources/interleavings.json"`
+	// SponsoredAds is the json file with the campaigns of the ads served on
+	// sponsored slots
+	SponsoredAds string `env:"SPONSORED_ADS" envDefault:"resources/sponsored_ads.json"`
 }
 
 // ElasticSearchConf configuration for the elastic search client
@@ -104,6 +119,107 @@ type ElasticSearchConf struct {
 	QueryTemplates      string        `env:"QUERY_TEMPLATES" envDefault:"resources/queries/"`
 	Username            string        `env:"USERNAME" envDefault:"user"`
 	Password            string        `env:"PASSWORD" envDefault:"password"`
+	// IndexSettings and IndexMapping are used by the bootstrap command to
+	// create new versions of the index
+	IndexSettings string `env:"INDEX_SETTINGS" envDefault:"resources/index/settings.json"`
+	IndexMapping  string `env:"INDEX_MAPPING" envDefault:"resources/index/mapping.json"`
+	// ReindexTimeout is how long the copy of the index is waited for by the
+	// reindex command, zero waits until it completes
+	ReindexTimeout time.Duration `env:"REINDEX_TIMEOUT" envDefault:"1h"`
+	// Fixture is a json file with ads, when set searches are served in memory
+	// from it instead of elasticsearch, for offline development
+	Fixture string `env:"FIXTURE" envDefault:""`
+}
+
+// AdUpdatesConf configures the consumer of ad lifecycle events
+type AdUpdatesConf struct {
+	// BatchSize is how many ads are applied on each bulk
+	BatchSize int `env:"BATCH_SIZE" envDefault:"500"`
+	// FlushInterval is how often a partial batch is applied
+	FlushInterval time.Duration `env:"FLUSH_INTERVAL" envDefault:"1s"`
+	MaxRetries    int           `env:"MAX_RETRIES" envDefault:"3"`
+	// RetryBackoff is the wait before the first retry, doubled on each one
+	RetryBackoff time.Duration `env:"RETRY_BACKOFF" envDefault:"500ms"`
+	// DeadLetter is the ndjson file where events that cannot be applied are appended
+	DeadLetter string `env:"DEAD_LETTER" envDefault:"/tmp/ad-updates-dead-letter.ndjson"`
+}
+
+// EventsConf configures how tracking events are buffered and stored
+type EventsConf struct {
+	// Path is the ndjson file events are written on, rotated files are
+	// kept next to it
+	Path string `env:"PATH" envDefault:"/tmp/events/events.ndjson"`
+	// BufferSize is how many events are kept in memory, events received
+	// when it is full are rejected
+	BufferSize    int           `env:"BUFFER_SIZE" envDefault:"10000"`
+	BatchSize     int           `env:"BATCH_SIZE" envDefault:"500"`
+	FlushInterval time.Duration `env:"FLUSH_INTERVAL" envDefault:"1s"`
+	// MaxFileSize in bytes and MaxFileAge trigger the file rotation
+	MaxFileSize int64         `env:"MAX_FILE_SIZE" envDefault:"104857600"`
+	MaxFileAge  time.Duration `env:"MAX_FILE_AGE" envDefault:"1h"`
+}
+
+// AttributionConf configures the tokens signed on recommended ads
+type AttributionConf struct {
+	// Secrets sign and verify tokens, the first one signs. Tokens are not
+	// added to responses when there are no secrets. They are left out of
+	// the logged config
+	Secrets []string `env:"SECRETS" envDefault:"" json:"-"`
+	// MaxAge is how long after the recommendation events are attributed
+	MaxAge time.Duration `env:"MAX_AGE" envDefault:"720h"`
+}
+
+// CoviewConf configures the co-view neighbours store and its builder
+type CoviewConf struct {
+	// Path is the store written by the coview command, co-view carousels
+	// fall back to content suggestions while it does not exist
+	Path string `env:"PATH" envDefault:"/tmp/coview/coview.bin"`
+	// ReloadInterval is how often the store file is checked for changes,
+	// zero disables reloading
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL" envDefault:"5m"`
+	// TopN is how many neighbours are kept for each ad
+	TopN int `env:"TOP_N" envDefault:"50"`
+	// MinCoviews is how many users must view both ads to be neighbours
+	MinCoviews int `env:"MIN_COVIEWS" envDefault:"2"`
+	// MaxUserViews ignores users viewing more ads, mostly crawlers
+	MaxUserViews int `env:"MAX_USER_VIEWS" envDefault:"500"`
+}
+
+// ViewedConf configures the store of the ads recently viewed on each device
+type ViewedConf struct {
+	// Enabled stores the ads clicked or replied on each device and merges
+	// them with the viewed ads sent on suggestion requests
+	Enabled bool `env:"ENABLED" envDefault:"false"`
+	// MaxViewed is how many ads are kept for each device
+	MaxViewed int `env:"MAX_VIEWED" envDefault:"20"`
+	// TTL is how long the ads of an inactive device are kept
+	TTL time.Duration `env:"TTL" envDefault:"24h"`
+	// MaxKeys is how many devices are kept, the least recently updated are
+	// evicted first
+	MaxKeys int `env:"MAX_KEYS" envDefault:"100000"`
+}
+
+// HiddenConf configures the store of the ads and sellers hidden on each device
+type HiddenConf struct {
+	// Store keeps the hidden ads in memory or, when it is file, also on
+	// Path so they survive restarts
+	Store string `env:"STORE" envDefault:"memory"`
+	Path  string `env:"PATH" envDefault:"/tmp/hidden/hidden.ndjson"`
+	// MaxHidden is how many ads, and how many sellers, are kept for each device
+	MaxHidden int `env:"MAX_HIDDEN" envDefault:"200"`
+	// MaxKeys is how many devices are kept, the least recently updated are
+	// evicted first
+	MaxKeys int `env:"MAX_KEYS" envDefault:"100000"`
+}
+
+// SponsoredConf configures the frequency caps of the sponsored ads
+type SponsoredConf struct {
+	// CapWindow is how long the sponsored ads served to a user or device
+	// are counted, counts start over once it ends
+	CapWindow time.Duration `env:"CAP_WINDOW" envDefault:"24h"`
+	// MaxKeys is how many users or devices are counted, the ones whose
+	// window started first are evicted first
+	MaxKeys int `env:"MAX_KEYS" envDefault:"100000"`
 }
 
 // GetHeaders return map of cors used
@@ -119,11 +235,68 @@ func (cc CorsConf) GetHeaders() map[string]string {
 	}
 }
 
+const (
+	// defaultIndicatorsAPIPath is the indicators api used when none is configured
+	defaultIndicatorsAPIPath = "https://mindicador.cl/api/"
+	// defaultIndicatorsValues are the indicators default values configured
+	// ones are added to
+	defaultIndicatorsValues = "uf:31955,dolar:850,utm:52631,euro:950"
+)
+
 // IndicatorsConf defines the configuration needed to communicate with indicators api
 type IndicatorsConf struct {
-	UFPath       string `env:"UF_PATH" envDefault:"https://mindicador.cl/api/uf/"`
-	CacheTTL     int    `env:"CACHE_TTL" envDefault:"600000"` // time in milliseconds
-	DefaultValue int    `env:"DEFAULT_VALUE" envDefault:"31955"`
+	// APIPath is the indicators api base path, https://mindicador.cl/api/
+	// when neither it nor UFPath are set
+	APIPath  string `env:"API_PATH" envDefault:""`
+	CacheTTL int    `env:"CACHE_TTL" envDefault:"600000"` // time in milliseconds
+	// DefaultValues are used when an indicator cannot be retrieved, ex: uf:31955,dolar:850.
+	// They are added to uf:31955,dolar:850,utm:52631,euro:950
+	DefaultValues []string `env:"DEFAULT_VALUES" envDefault:""`
+	// UFPath and DefaultValue are the uf endpoint and uf default value used
+	// before every indicator was supported. They are still read so existing
+	// deployments keep their values, API_PATH and DEFAULT_VALUES win over them
+	UFPath       string  `env:"UF_PATH" envDefault:""`
+	DefaultValue float64 `env:"DEFAULT_VALUE" envDefault:"0"`
+	// StorePath is the file where the last fetched values are persisted
+	StorePath string `env:"STORE_PATH" envDefault:"/tmp/indicators.json"`
+	// TablePath is an optional json or csv file with historical values
+	TablePath string `env:"TABLE_PATH" envDefault:""`
+	// Offline disables the indicators api, only stored values are used
+	Offline    bool          `env:"OFFLINE" envDefault:"false"`
+	StaleAfter time.Duration `env:"STALE_AFTER" envDefault:"72h"`
+}
+
+// GetAPIPath returns the indicators api base path, the indicator code is
+// appended to it
+func (ic IndicatorsConf) GetAPIPath() string {
+	switch {
+	case ic.APIPath != "":
+		return ic.APIPath
+	case ic.UFPath != "":
+		return strings.TrimSuffix(strings.TrimSuffix(ic.UFPath, "/"), "uf")
+	}
+	return defaultIndicatorsAPIPath
+}
+
+// GetDefaultValues returns the indicators default values indexed by indicator code
+func (ic IndicatorsConf) GetDefaultValues() map[string]float64 {
+	values := make(map[string]float64)
+	items := strings.Split(defaultIndicatorsValues, ",")
+	if ic.DefaultValue > 0 {
+		items = append(items, "uf:"+strconv.FormatFloat(ic.DefaultValue, 'f', -1, 64))
+	}
+	for _, item := range append(items, ic.DefaultValues...) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			continue
+		}
+		values[strings.ToLower(strings.TrimSpace(parts[0]))] = value
+	}
+	return values
 }
 
 // InBrowserCacheConf Used to handle browser cache
@@ -150,10 +323,17 @@ type Config struct {
 	CorsConf                 CorsConf                 `env:"CORS_"`
 	InBrowserCacheConf       InBrowserCacheConf       `env:"BROWSER_CACHE_"`
 	ElasticSearchConf        ElasticSearchConf        `env:"ELASTIC_"`
+	AdUpdatesConf            AdUpdatesConf            `env:"AD_UPDATES_"`
 	EtcdConf                 EtcdConf                 `env:"ETCD_"`
 	AdConf                   AdConf                   `env:"AD_"`
 	ResourcesConf            ResourcesConf            `env:"RESOURCES_"`
 	IndicatorsConf           IndicatorsConf           `env:"INDICATORS_"`
+	EventsConf               EventsConf               `env:"EVENTS_"`
+	AttributionConf          AttributionConf          `env:"ATTRIBUTION_"`
+	CoviewConf               CoviewConf               `env:"COVIEW_"`
+	ViewedConf               ViewedConf               `env:"VIEWED_"`
+	HiddenConf               HiddenConf               `env:"HIDDEN_"`
+	SponsoredConf            SponsoredConf            `env:"SPONSORED_"`
 }
 
 // LoadFromEnv loads the config data from the environment variables
@@ -1,6 +1,7 @@
 package infrastructure
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
 
@@ -49,3 +50,23 @@ func TestConfigLoad(t *testing.T) {
 
 	assert.Equal(t, expected, conf)
 }
+
+func TestIndicatorsConfPreviousVariables(t *testing.T) {
+	conf := IndicatorsConf{UFPath: "https://indicators.local/api/uf/", DefaultValue: 32000}
+	assert.Equal(t, "https://indicators.local/api/", conf.GetAPIPath())
+	assert.Equal(t, map[string]float64{"uf": 32000, "dolar": 850, "utm": 52631, "euro": 950}, conf.GetDefaultValues())
+
+	conf.APIPath = "https://mindicador.cl/api/"
+	conf.DefaultValues = []string{"uf:33000", "yen:7"}
+	assert.Equal(t, "https://mindicador.cl/api/", conf.GetAPIPath())
+	assert.Equal(t, map[string]float64{"uf": 33000, "dolar": 850, "utm": 52631, "euro": 950, "yen": 7},
+		conf.GetDefaultValues())
+	assert.Equal(t, "https://mindicador.cl/api/", IndicatorsConf{}.GetAPIPath())
+}
+
+func TestConfigJSONWithoutSecrets(t *testing.T) {
+	conf := Config{AttributionConf: AttributionConf{Secrets: []string{"signing-key"}}}
+	content, err := json.Marshal(conf)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "signing-key")
+}
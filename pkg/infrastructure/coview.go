@@ -0,0 +1,364 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+)
+
+// coviewMagic identifies co-view store files and their format version
+const coviewMagic = "COVIEW1\n"
+
+// ErrInvalidCoviewStore is returned when a file is not a co-view store
+var ErrInvalidCoviewStore = errors.New("invalid coview store")
+
+// CoviewView is a line of the views log read by the builder. Views without
+// user are attributed to the device
+type CoviewView struct {
+	UserID   string      `json:"userId"`
+	DeviceID string      `json:"deviceId"`
+	ListID   json.Number `json:"listId"`
+}
+
+// CoviewBuilder computes the co-view neighbours of every ad on a views log.
+// Two ads are neighbours when at least MinCoviews users viewed both, they
+// are scored with the cosine similarity of their viewers:
+// coviews / sqrt(viewers(a) * viewers(b)), so popular ads do not become
+// the neighbours of every ad
+type CoviewBuilder struct {
+	// TopN is how many neighbours are kept for each ad
+	TopN       int
+	MinCoviews int
+	// MaxUserViews ignores users viewing more ads, mostly crawlers, whose
+	// views are not related and make the build quadratic
+	MaxUserViews int
+}
+
+// CoviewStats summarizes a build
+type CoviewStats struct {
+	Views        int `json:"views"`
+	InvalidLines int `json:"invalidLines"`
+	Users        int `json:"users"`
+	SkippedUsers int `json:"skippedUsers"`
+	Ads          int `json:"ads"`
+}
+
+// Build reads the ndjson views log and returns the neighbours of each ad
+// by descending score. Lines that cannot be decoded are counted and skipped
+func (b CoviewBuilder) Build(views io.Reader) (map[int64][]domain.Neighbour, CoviewStats, error) {
+	var stats CoviewStats
+	userViews := make(map[string]map[int64]struct{})
+	scanner := bufio.NewScanner(views)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var view CoviewView
+		if err := json.Unmarshal(scanner.Bytes(), &view); err != nil {
+			stats.InvalidLines++
+			continue
+		}
+		unit := view.UserID
+		if unit == "" {
+			unit = view.DeviceID
+		}
+		listID, err := view.ListID.Int64()
+		if unit == "" || err != nil || listID <= 0 {
+			stats.InvalidLines++
+			continue
+		}
+		stats.Views++
+		if userViews[unit] == nil {
+			userViews[unit] = make(map[int64]struct{})
+		}
+		userViews[unit][listID] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, stats, err
+	}
+	viewers := make(map[int64]int)
+	coviews := make(map[[2]int64]int)
+	for _, viewed := range userViews {
+		if b.MaxUserViews > 0 && len(viewed) > b.MaxUserViews {
+			stats.SkippedUsers++
+			continue
+		}
+		stats.Users++
+		ads := make([]int64, 0, len(viewed))
+		for listID := range viewed {
+			ads = append(ads, listID)
+			viewers[listID]++
+		}
+		sort.Slice(ads, func(i, j int) bool { return ads[i] < ads[j] })
+		for i := range ads {
+			for j := i + 1; j < len(ads); j++ {
+				coviews[[2]int64{ads[i], ads[j]}]++
+			}
+		}
+	}
+	neighbours := make(map[int64][]domain.Neighbour)
+	for pair, count := range coviews {
+		if count < b.MinCoviews {
+			continue
+		}
+		score := float64(count) / math.Sqrt(float64(viewers[pair[0]])*float64(viewers[pair[1]]))
+		neighbours[pair[0]] = append(neighbours[pair[0]], domain.Neighbour{ListID: pair[1], Score: score})
+		neighbours[pair[1]] = append(neighbours[pair[1]], domain.Neighbour{ListID: pair[0], Score: score})
+	}
+	for listID, adNeighbours := range neighbours {
+		sortNeighbours(adNeighbours)
+		if b.TopN > 0 && len(adNeighbours) > b.TopN {
+			adNeighbours = adNeighbours[:b.TopN:b.TopN]
+		}
+		neighbours[listID] = adNeighbours
+	}
+	stats.Ads = len(neighbours)
+	return neighbours, stats, nil
+}
+
+// sortNeighbours sorts by descending score, ties by descending listID so
+// newer ads come first and builds are reproducible
+func sortNeighbours(neighbours []domain.Neighbour) {
+	sort.Slice(neighbours, func(i, j int) bool {
+		if neighbours[i].Score != neighbours[j].Score {
+			return neighbours[i].Score > neighbours[j].Score
+		}
+		return neighbours[i].ListID > neighbours[j].ListID
+	})
+}
+
+// WriteCoviewStore writes the neighbours on path, replacing the previous
+// store atomically so a running service never loads a partial file.
+// The format is the magic header, the number of ads and, sorted by listID,
+// each ad listID delta, its number of neighbours and for each of them the
+// delta from the ad listID as varint and its score as float32
+func WriteCoviewStore(path string, neighbours map[int64][]domain.Neighbour) error {
+	path = filepath.Clean(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // nolint: errcheck
+	writer := bufio.NewWriter(file)
+	if err := encodeCoviewStore(writer, neighbours); err != nil {
+		file.Close() // nolint: errcheck, gosec
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close() // nolint: errcheck, gosec
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// encodeCoviewStore writes the store format on writer
+func encodeCoviewStore(writer *bufio.Writer, neighbours map[int64][]domain.Neighbour) error {
+	ads := make([]int64, 0, len(neighbours))
+	for listID := range neighbours {
+		ads = append(ads, listID)
+	}
+	sort.Slice(ads, func(i, j int) bool { return ads[i] < ads[j] })
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(value uint64) error {
+		_, err := writer.Write(buf[:binary.PutUvarint(buf, value)])
+		return err
+	}
+	writeVarint := func(value int64) error {
+		_, err := writer.Write(buf[:binary.PutVarint(buf, value)])
+		return err
+	}
+	if _, err := writer.WriteString(coviewMagic); err != nil {
+		return err
+	}
+	if err := writeUvarint(uint64(len(ads))); err != nil {
+		return err
+	}
+	var previous int64
+	for _, listID := range ads {
+		if err := writeUvarint(uint64(listID - previous)); err != nil {
+			return err
+		}
+		previous = listID
+		if err := writeUvarint(uint64(len(neighbours[listID]))); err != nil {
+			return err
+		}
+		for _, neighbour := range neighbours[listID] {
+			if err := writeVarint(neighbour.ListID - listID); err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(neighbour.Score)))
+			if _, err := writer.Write(buf[:4]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadCoviewStore decodes a store written by WriteCoviewStore
+func ReadCoviewStore(reader io.Reader) (map[int64][]domain.Neighbour, error) {
+	buffered := bufio.NewReader(reader)
+	magic := make([]byte, len(coviewMagic))
+	if _, err := io.ReadFull(buffered, magic); err != nil || string(magic) != coviewMagic {
+		return nil, ErrInvalidCoviewStore
+	}
+	count, err := binary.ReadUvarint(buffered)
+	if err != nil {
+		return nil, invalidCoviewStore(err)
+	}
+	// sizes are not trusted to preallocate, a corrupted file could hold any
+	neighbours := make(map[int64][]domain.Neighbour)
+	var listID int64
+	score := make([]byte, 4)
+	for i := uint64(0); i < count; i++ {
+		delta, err := binary.ReadUvarint(buffered)
+		if err != nil {
+			return nil, invalidCoviewStore(err)
+		}
+		listID += int64(delta)
+		size, err := binary.ReadUvarint(buffered)
+		if err != nil {
+			return nil, invalidCoviewStore(err)
+		}
+		var adNeighbours []domain.Neighbour
+		for j := uint64(0); j < size; j++ {
+			offset, err := binary.ReadVarint(buffered)
+			if err != nil {
+				return nil, invalidCoviewStore(err)
+			}
+			if _, err := io.ReadFull(buffered, score); err != nil {
+				return nil, invalidCoviewStore(err)
+			}
+			adNeighbours = append(adNeighbours, domain.Neighbour{
+				ListID: listID + offset,
+				Score:  float64(math.Float32frombits(binary.LittleEndian.Uint32(score))),
+			})
+		}
+		neighbours[listID] = adNeighbours
+	}
+	return neighbours, nil
+}
+
+// invalidCoviewStore wraps a decoding error as ErrInvalidCoviewStore
+func invalidCoviewStore(err error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidCoviewStore, err)
+}
+
+// CoviewStore serves the neighbours of the store file from memory. The
+// file is reloaded in background when it changes, so the builder can
+// replace it while the service runs
+type CoviewStore struct {
+	path       string
+	logger     loggers.Logger
+	mutex      sync.RWMutex
+	neighbours map[int64][]domain.Neighbour
+	modTime    time.Time
+	done       chan struct{}
+	stopped    chan struct{}
+	once       sync.Once
+}
+
+// NewCoviewStore loads the store on path and checks it for changes every
+// reloadInterval, zero disables reloading. A missing or invalid file is
+// logged and leaves the store empty until a valid one is written
+func NewCoviewStore(path string, reloadInterval time.Duration, logger loggers.Logger) *CoviewStore {
+	store := &CoviewStore{
+		path:       path,
+		logger:     logger,
+		neighbours: make(map[int64][]domain.Neighbour),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	if err := store.reload(); os.IsNotExist(err) {
+		logger.Info("Coview store %s not found, co-view carousels use content suggestions", path)
+	} else if err != nil {
+		logger.Error("error loading coview store %s: %+v", path, err)
+	}
+	if reloadInterval <= 0 {
+		close(store.stopped)
+		return store
+	}
+	go store.run(reloadInterval)
+	return store
+}
+
+// Neighbours returns the neighbours of the ad by descending score
+func (s *CoviewStore) Neighbours(listID int64) []domain.Neighbour {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.neighbours[listID]
+}
+
+// Close stops reloading the store
+func (s *CoviewStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	<-s.stopped
+	return nil
+}
+
+// run reloads the store every interval until it is closed
+func (s *CoviewStore) run(interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.reload(); err != nil && !os.IsNotExist(err) {
+				s.logger.Error("error reloading coview store %s: %+v", s.path, err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// reload loads the file when it was modified since the last load, the
+// neighbours being served are kept when it cannot be read. An invalid file
+// is not read again until it is modified
+func (s *CoviewStore) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.mutex.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mutex.RUnlock()
+	if unchanged {
+		return nil
+	}
+	file, err := os.Open(filepath.Clean(s.path))
+	if err != nil {
+		return err
+	}
+	defer file.Close() // nolint: errcheck
+	neighbours, err := ReadCoviewStore(file)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.modTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+	s.neighbours = neighbours
+	s.logger.Info("Loaded coview store %s with %d ads", s.path, len(neighbours))
+	return nil
+}
@@ -0,0 +1,111 @@
+package infrastructure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+const coviewViews = `{"userId": "u1", "listId": 1}
+{"userId": "u1", "listId": 2}
+{"userId": "u1", "listId": 3}
+{"userId": "u2", "listId": 1}
+{"userId": "u2", "listId": 2}
+{"deviceId": "d1", "listId": 1}
+{"deviceId": "d1", "listId": 3}
+{"deviceId": "d1", "listId": 1}
+{"userId": "crawler", "listId": 1}
+{"userId": "crawler", "listId": 2}
+{"userId": "crawler", "listId": 3}
+{"userId": "crawler", "listId": 4}
+{"listId": 5}
+{"userId": "u3", "listId": "x"}
+not json
+
+`
+
+func TestCoviewBuilderBuild(t *testing.T) {
+	builder := CoviewBuilder{TopN: 1, MinCoviews: 2, MaxUserViews: 3}
+	neighbours, stats, err := builder.Build(strings.NewReader(coviewViews))
+	assert.NoError(t, err)
+	assert.Equal(t, CoviewStats{Views: 12, InvalidLines: 3, Users: 3, SkippedUsers: 1, Ads: 3}, stats)
+	// 1 and 2 are viewed by u1 and u2, 1 and 3 by u1 and d1, and 2 and 3
+	// only by u1. 1 is viewed by 3 users, 2 and 3 by 2 of them
+	score := 2 / math.Sqrt(6)
+	assert.Equal(t, map[int64][]domain.Neighbour{
+		1: {{ListID: 3, Score: score}},
+		2: {{ListID: 1, Score: score}},
+		3: {{ListID: 1, Score: score}},
+	}, neighbours)
+}
+
+func TestCoviewStoreEncoding(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "coview")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store", "coview.bin")
+	neighbours := map[int64][]domain.Neighbour{
+		1000: {{ListID: 998, Score: 0.5}, {ListID: 1500, Score: 0.25}},
+		10:   {{ListID: 1000, Score: 1}},
+	}
+	assert.NoError(t, WriteCoviewStore(path, neighbours))
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	read, err := ReadCoviewStore(file)
+	assert.NoError(t, err)
+	assert.Equal(t, neighbours, read)
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 1)
+}
+
+func TestReadCoviewStoreInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(coviewMagic)
+	buf.WriteByte(2)
+	for _, content := range []string{"", "COVIEW0\n", buf.String()} {
+		_, err := ReadCoviewStore(strings.NewReader(content))
+		assert.True(t, err != nil && strings.HasPrefix(err.Error(), ErrInvalidCoviewStore.Error()), content)
+	}
+}
+
+func TestCoviewStoreReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "coview")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "coview.bin")
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Info").Maybe()
+
+	store := NewCoviewStore(path, time.Millisecond, logger)
+	defer store.Close()
+	assert.Empty(t, store.Neighbours(1))
+
+	neighbours := []domain.Neighbour{{ListID: 2, Score: 0.5}}
+	assert.NoError(t, WriteCoviewStore(path, map[int64][]domain.Neighbour{1: neighbours}))
+	assert.Eventually(t, func() bool {
+		return len(store.Neighbours(1)) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, neighbours, store.Neighbours(1))
+	assert.NoError(t, store.Close())
+}
+
+func TestCoviewStoreInvalidFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "coview")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "coview.bin")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("invalid"), 0600))
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Error").Once()
+
+	store := NewCoviewStore(path, 0, logger)
+	assert.Empty(t, store.Neighbours(1))
+	assert.NoError(t, store.Close())
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,203 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// e2eSuggestionParams is a carousels configuration exercising the query
+// templates: match, more_like_this, query_string and decay functions
+const e2eSuggestionParams = `{
+	"default": {
+		"must": ["category.id,category.id"],
+		"should": ["location.regionId,location.regionId"],
+		"mustNot": ["listId,listId"],
+		"decayFunc": [{"name": "gauss", "field": "listTime", "origin": "now/1d", "offset": "1d", "scale": "60d"}]
+	},
+	"similar": {
+		"mustNot": ["listId,listId"],
+		"fields": ["subject", "body"],
+		"queryConf": [{"minTermFreq": "1", "minDocFreq": "5", "maxQueryTerms": "20"}]
+	},
+	"pro": {
+		"must": ["category.id,category.id"],
+		"mustNot": ["listId,listId"],
+		"queryString": [{"query": "(pro OR professional)", "defaultField": "publisherType"}]
+	}
+}`
+
+// newE2ERouter builds the service router over the memory elastic handler,
+// using the same query templates as the service
+func newE2ERouter(t *testing.T) http.Handler {
+	elasticHandler := newTestMemoryHandler(t)
+	queryTemplates := NewFileTools("../../resources/queries/", ".tmpl").LoadTemplatesFromFolder()
+	adsRepository := repository.NewAdsRepository(elasticHandler, &FileDataMapping{}, queryTemplates, "", "ads", 10, 0)
+
+	var suggestionsParams map[string]map[string][]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(e2eSuggestionParams), &suggestionsParams))
+	logger := &MockLoggerInfrastructure{}
+	for _, method := range []string{"Debug", "Info", "Warn", "Error", "Crit", "Success"} {
+		logger.On(method).Maybe()
+	}
+	getSuggestions := usecases.GetSuggestions{
+		SuggestionsRepo:   adsRepository,
+		MinDisplayedAds:   1,
+		RequestedAdsQty:   10,
+		MaxDisplayedAds:   10,
+		SuggestionsParams: suggestionsParams,
+		Logger:            loggers.MakeGetSuggestionsLogger(logger),
+	}
+	getFeed := usecases.GetFeed{
+		Suggestions: &getSuggestions,
+		Layout: usecases.FeedLayout{Sections: []usecases.FeedSection{
+			{Carousel: "similar", Size: 2},
+			{Carousel: "default", Size: 2},
+		}},
+		Logger: loggers.MakeGetFeedLogger(logger),
+	}
+	maker := RouterMaker{
+		Logger: logger,
+		Cors:   CorsConf{},
+		Routes: Routes{{Groups: []Route{
+			{
+				Method:  "GET",
+				Pattern: "/recommendations/{carousel:[a-z_-]+}/{listID:\\d+}",
+				Handler: &handlers.GetSuggestionsHandler{
+					Interactor: &getSuggestions, Regions: &FileDataMapping{}, Categories: &FileDataMapping{},
+				},
+			},
+			{
+				Method:  "GET",
+				Pattern: "/recommendations/{listID:\\d+}",
+				Handler: &handlers.GetMultiSuggestionsHandler{
+					Interactor: &getSuggestions, Regions: &FileDataMapping{}, Categories: &FileDataMapping{},
+				},
+			},
+			{
+				Method:  "GET",
+				Pattern: "/feed/{listID:\\d+}",
+				Handler: &handlers.GetFeedHandler{
+					Interactor: &getFeed, Regions: &FileDataMapping{}, Categories: &FileDataMapping{},
+				},
+			},
+		}}},
+	}
+	return maker.NewRouter()
+}
+
+// e2eGet requests path, decoding the json response body in out
+func e2eGet(t *testing.T, router http.Handler, path string, out interface{}) int {
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+	if resp.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), out), resp.Body.String())
+	}
+	return resp.Code
+}
+
+// adsListIDs returns the id of each ad on a response
+func adsListIDs(ads []map[string]interface{}) []string {
+	listIDs := []string{}
+	for _, ad := range ads {
+		listIDs = append(listIDs, ad["id"].(string))
+	}
+	return listIDs
+}
+
+func TestE2EGetSuggestions(t *testing.T) {
+	router := newE2ERouter(t)
+	var out struct {
+		Ads []map[string]interface{} `json:"ads"`
+	}
+	// same category first, scored up when on the same region and by recency
+	assert.Equal(t, http.StatusOK, e2eGet(t, router, "/recommendations/default/101", &out))
+	assert.Equal(t, []string{"105", "102", "103"}, adsListIDs(out.Ads))
+
+	assert.Equal(t, http.StatusOK, e2eGet(t, router, "/recommendations/similar/101?limit=1", &out))
+	assert.Equal(t, []string{"102"}, adsListIDs(out.Ads))
+
+	assert.Equal(t, http.StatusOK, e2eGet(t, router, "/recommendations/pro/102", &out))
+	assert.Equal(t, []string{"105", "101"}, adsListIDs(out.Ads))
+
+	assert.Equal(t, http.StatusNoContent, e2eGet(t, router, "/recommendations/default/104", &out))
+}
+
+func TestE2EGetMultiSuggestions(t *testing.T) {
+	router := newE2ERouter(t)
+	var out struct {
+		Carousels map[string]struct {
+			Ads []map[string]interface{} `json:"ads"`
+		} `json:"carousels"`
+	}
+	path := "/recommendations/101?carousels=default&carousels=similar&limit=2"
+	assert.Equal(t, http.StatusOK, e2eGet(t, router, path, &out))
+	assert.Equal(t, []string{"105", "102"}, adsListIDs(out.Carousels["default"].Ads))
+	assert.Equal(t, []string{"102", "103"}, adsListIDs(out.Carousels["similar"].Ads))
+}
+
+func TestE2EGetFeed(t *testing.T) {
+	router := newE2ERouter(t)
+	var out struct {
+		Sections []struct {
+			Carousel string                   `json:"carousel"`
+			Ads      []map[string]interface{} `json:"ads"`
+		} `json:"sections"`
+	}
+	assert.Equal(t, http.StatusOK, e2eGet(t, router, "/feed/101", &out))
+	assert.Len(t, out.Sections, 2)
+	assert.Equal(t, "similar", out.Sections[0].Carousel)
+	assert.Equal(t, []string{"102", "103"}, adsListIDs(out.Sections[0].Ads))
+	// ads on the previous section are not repeated
+	assert.Equal(t, "default", out.Sections[1].Carousel)
+	assert.Equal(t, []string{"105"}, adsListIDs(out.Sections[1].Ads))
+}
+
+func TestE2ETrackEvents(t *testing.T) {
+	writer := &memoryEventsWriter{}
+	sink := newTestEventsSink(writer, 10, 10, 0)
+	logger := &MockLoggerInfrastructure{}
+	for _, method := range []string{"Debug", "Info", "Warn", "Error", "Crit", "Success"} {
+		logger.On(method).Maybe()
+	}
+	maker := RouterMaker{
+		Logger: logger,
+		Cors:   CorsConf{},
+		Routes: Routes{{Groups: []Route{{
+			Method:  "POST",
+			Pattern: "/events",
+			Handler: &handlers.TrackEventsHandler{Interactor: &usecases.TrackEvents{
+				Repository: repository.NewTrackingEventsRepository(sink, nil, nil),
+				Logger:     loggers.MakeTrackEventsLogger(logger),
+			}},
+		}}}},
+	}
+	router := maker.NewRouter()
+	post := func(body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest("POST", "/events", strings.NewReader(body)))
+		return resp
+	}
+
+	resp := post(`{"events": [
+		{"type": "impression", "carousel": "default", "sourceListId": 101, "listId": "105", "position": 0, "requestId": "r1"},
+		{"type": "click", "carousel": "default", "sourceListId": "101", "listId": 105, "position": 0, "requestId": "r1"}
+	]}`)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"events": [{"type": "view"}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"events": `).Code)
+
+	assert.NoError(t, sink.Close())
+	if assert.Len(t, writer.batches, 1) && assert.Len(t, writer.batches[0], 2) {
+		record, _ := json.Marshal(writer.batches[0][1])
+		assert.Contains(t, string(record), `"type":"click","carousel":"default","sourceListId":101,"listId":105`)
+	}
+}
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
 )
 
 type ElasticItem struct {
@@ -23,30 +26,116 @@ type ElasticHandler struct {
 	batchSize     int
 	searchTimeout time.Duration
 	logger        loggers.Logger
+	// tookObserver and events are optional search metrics
+	tookObserver MetricsObserver
+	events       MetricsEvents
+	// taskPollInterval is how often the progress of reindex tasks is checked
+	taskPollInterval time.Duration
+	// reindexTimeout is how long reindex tasks are waited for, zero waits
+	// until they complete
+	reindexTimeout time.Duration
 }
-type BulkResponse struct {
-	Errors bool       `json:"errors"`
-	Items  []ItemBulk `json:"items"`
+
+// MetricsObserver allows to report observed values, ex: durations
+type MetricsObserver interface {
+	Observe(value float64, labels ...string)
+}
+
+// MetricsEvents allows to count events
+type MetricsEvents interface {
+	CollectEvent(entityName, eventName, eventType string)
+}
+
+// ElasticError represents an elasticsearch error response
+type ElasticError struct {
+	Status    int            `json:"status"`
+	Type      string         `json:"type"`
+	Reason    string         `json:"reason"`
+	RootCause []ElasticCause `json:"root_cause"`
+}
+
+// ElasticCause represents the cause of an elasticsearch error
+type ElasticCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
 }
-type ItemBulk struct {
-	Index IndexBulk `json:"index"`
+
+// Error returns the error status, type and reason along with its root cause
+func (e *ElasticError) Error() string {
+	msg := fmt.Sprintf("elasticsearch error [%d] %s: %s", e.Status, e.Type, e.Reason)
+	if len(e.RootCause) > 0 {
+		msg += fmt.Sprintf(" (root cause %s: %s)", e.RootCause[0].Type, e.RootCause[0].Reason)
+	}
+	return msg
+}
+
+// searchStats is the search response header, with the time the search
+// took in milliseconds, if it timed out and the shards that failed
+type searchStats struct {
+	Took     int  `json:"took"`
+	TimedOut bool `json:"timed_out"`
+	Shards   struct {
+		Total      int `json:"total"`
+		Successful int `json:"successful"`
+		Failed     int `json:"failed"`
+		Failures   []struct {
+			Index  string       `json:"index"`
+			Reason ElasticCause `json:"reason"`
+		} `json:"failures"`
+	} `json:"_shards"`
 }
+
+// BulkResponse is the bulk response, items are keyed by their action
+type BulkResponse struct {
+	Errors bool                   `json:"errors"`
+	Items  []map[string]IndexBulk `json:"items"`
+}
+
+// IndexBulk is the result of a bulk item
 type IndexBulk struct {
 	ID     string    `json:"_id"`
 	Result string    `json:"result"`
 	Status int       `json:"status"`
 	Error  ErrorBulk `json:"error"`
 }
+
+// ErrorBulk is the error of a failed bulk item
 type ErrorBulk struct {
 	Type   string    `json:"type"`
 	Reason string    `json:"reason"`
 	Cause  CauseBulk `json:"caused_by"`
 }
+
+// CauseBulk is the cause of a bulk item error
 type CauseBulk struct {
 	Type   string `json:"type"`
 	Reason string `json:"reason"`
 }
 
+// BulkError summarizes the documents a bulk insert failed to index
+type BulkError struct {
+	Total  int
+	Failed []BulkItemError
+}
+
+// BulkItemError is the error of a document that could not be indexed
+type BulkItemError struct {
+	ID     string
+	Status int
+	Type   string
+	Reason string
+}
+
+// Error returns how many documents failed along with the first error
+func (e *BulkError) Error() string {
+	msg := fmt.Sprintf("bulk failed on %d of %d documents", len(e.Failed), e.Total)
+	if len(e.Failed) > 0 {
+		first := e.Failed[0]
+		msg += fmt.Sprintf(", first error on %s [%d] %s: %s", first.ID, first.Status, first.Type, first.Reason)
+	}
+	return msg
+}
+
 // NewElasticHandlerHandler will create a new instance of a custom http request handler
 func NewElasticHandlerHandler(
 	maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost, idleConnTimeout, batchSize int,
@@ -69,13 +158,27 @@ func NewElasticHandlerHandler(
 	}
 	es7, _ := elasticsearch.NewClient(cfg)
 	return &ElasticHandler{
-		client:        es7,
-		batchSize:     batchSize,
-		searchTimeout: searchTimeout,
-		logger:        logger,
+		client:           es7,
+		batchSize:        batchSize,
+		searchTimeout:    searchTimeout,
+		logger:           logger,
+		taskPollInterval: 2 * time.Second,
 	}
 }
 
+// SetMetrics enables search metrics. The time searches took is observed in
+// seconds by index, timed out searches, shard failures and errors are counted
+func (es *ElasticHandler) SetMetrics(tookObserver MetricsObserver, events MetricsEvents) {
+	es.tookObserver = tookObserver
+	es.events = events
+}
+
+// SetReindexTimeout limits how long reindex tasks are waited for, zero
+// waits until they complete
+func (es *ElasticHandler) SetReindexTimeout(timeout time.Duration) {
+	es.reindexTimeout = timeout
+}
+
 // Info gets elastic cluster info
 func (es *ElasticHandler) Info() (interface{}, error) {
 	res, err := es.client.Info()
@@ -91,18 +194,10 @@ func (es *ElasticHandler) Info() (interface{}, error) {
 	return res, err
 }
 
-// Create generates a new elastic index
+// Create generates a new elastic index with the default settings, failing
+// when the index already exists
 func (es *ElasticHandler) Create(index string) error {
-	if _, err := es.client.Indices.Delete([]string{index}); err != nil {
-		return fmt.Errorf("cannot delete index: %s", err)
-	}
-	res, err := es.client.Indices.Create(index)
-	// issue: https://github.com/elastic/go-elasticsearch/issues/123
-	res.String() // nolint
-	if err != nil || res.IsError() {
-		return fmt.Errorf("cannot create index: %s", err)
-	}
-	return nil
+	return es.CreateIndex(index, nil)
 }
 
 // PutMapping put mapping on a index on elastic search
@@ -121,12 +216,275 @@ func (es *ElasticHandler) PutMapping(mapping []byte, index string) error {
 	return nil
 }
 
-// Search gets response from elastic using query
+// CreateIndex creates an index with the settings and mappings on body,
+// failing when the index already exists
+func (es *ElasticHandler) CreateIndex(index string, body []byte) error {
+	options := []func(*esapi.IndicesCreateRequest){}
+	if len(body) > 0 {
+		options = append(options, es.client.Indices.Create.WithBody(bytes.NewReader(body)))
+	}
+	res, err := es.client.Indices.Create(index, options...)
+	if err == nil {
+		defer res.Body.Close()
+	}
+	return adminError("create index "+index, res, err)
+}
+
+// ListIndices returns the names of the indices matching pattern, sorted
+func (es *ElasticHandler) ListIndices(pattern string) ([]string, error) {
+	res, err := es.client.Indices.Get(
+		[]string{pattern},
+		es.client.Indices.Get.WithAllowNoIndices(true),
+		es.client.Indices.Get.WithIgnoreUnavailable(true),
+	)
+	if err == nil {
+		defer res.Body.Close()
+	}
+	if err := adminError("list indices "+pattern, res, err); err != nil {
+		return nil, err
+	}
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("cannot list indices %s: %w", pattern, err)
+	}
+	return sortedKeys(indices), nil
+}
+
+// SetAlias points alias to index, removing it from any other index on the
+// same atomic request
+func (es *ElasticHandler) SetAlias(alias, index string) error {
+	current, err := es.AliasIndices(alias)
+	if err != nil {
+		return err
+	}
+	actions := make([]map[string]map[string]string, 0, len(current)+1)
+	for _, old := range current {
+		if old != index {
+			actions = append(actions, map[string]map[string]string{"remove": {"index": old, "alias": alias}})
+		}
+	}
+	actions = append(actions, map[string]map[string]string{"add": {"index": index, "alias": alias}})
+	body, _ := json.Marshal(map[string]interface{}{"actions": actions})
+	res, err := es.client.Indices.UpdateAliases(bytes.NewReader(body))
+	if err == nil {
+		defer res.Body.Close()
+	}
+	return adminError("set alias "+alias, res, err)
+}
+
+// AliasIndices returns the indices alias points to, sorted
+func (es *ElasticHandler) AliasIndices(alias string) ([]string, error) {
+	res, err := es.client.Indices.GetAlias(es.client.Indices.GetAlias.WithName(alias))
+	if err == nil {
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+	}
+	if err := adminError("get alias "+alias, res, err); err != nil {
+		return nil, err
+	}
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("cannot get alias %s: %w", alias, err)
+	}
+	return sortedKeys(indices), nil
+}
+
+// DeleteIndex deletes an index
+func (es *ElasticHandler) DeleteIndex(index string) error {
+	res, err := es.client.Indices.Delete([]string{index})
+	if err == nil {
+		defer res.Body.Close()
+	}
+	return adminError("delete index "+index, res, err)
+}
+
+// Count refreshes index and returns how many documents it has
+func (es *ElasticHandler) Count(index string) (int, error) {
+	if err := es.refresh(index); err != nil {
+		return 0, err
+	}
+	res, err := es.client.Count(es.client.Count.WithIndex(index))
+	if err == nil {
+		defer res.Body.Close()
+	}
+	if err := adminError("count index "+index, res, err); err != nil {
+		return 0, err
+	}
+	var count struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("cannot count index %s: %w", index, err)
+	}
+	return count.Count, nil
+}
+
+// ShardSettings returns the primary shards and replicas of index
+func (es *ElasticHandler) ShardSettings(index string) (ShardSettings, error) {
+	res, err := es.client.Indices.GetSettings(
+		es.client.Indices.GetSettings.WithIndex(index),
+		es.client.Indices.GetSettings.WithName("index.number_of_shards", "index.number_of_replicas"),
+	)
+	if err == nil {
+		defer res.Body.Close()
+	}
+	if err := adminError("get settings of index "+index, res, err); err != nil {
+		return ShardSettings{}, err
+	}
+	var indices map[string]struct {
+		Settings struct {
+			Index struct {
+				Shards   int `json:"number_of_shards,string"`
+				Replicas int `json:"number_of_replicas,string"`
+			} `json:"index"`
+		} `json:"settings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return ShardSettings{}, fmt.Errorf("cannot get settings of index %s: %w", index, err)
+	}
+	settings, ok := indices[index]
+	if !ok || settings.Settings.Index.Shards == 0 {
+		return ShardSettings{}, fmt.Errorf("cannot get settings of index %s: shards missing", index)
+	}
+	return ShardSettings{Shards: settings.Settings.Index.Shards, Replicas: settings.Settings.Index.Replicas}, nil
+}
+
+// refresh makes the documents indexed on index visible to searches
+func (es *ElasticHandler) refresh(index string) error {
+	res, err := es.client.Indices.Refresh(es.client.Indices.Refresh.WithIndex(index))
+	if err == nil {
+		defer res.Body.Close()
+	}
+	return adminError("refresh index "+index, res, err)
+}
+
+// reindexTask is the state of a reindex task
+type reindexTask struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status struct {
+			Total   int `json:"total"`
+			Created int `json:"created"`
+			Updated int `json:"updated"`
+		} `json:"status"`
+	} `json:"task"`
+	Error    json.RawMessage `json:"error"`
+	Response struct {
+		Failures []struct {
+			ID    string          `json:"id"`
+			Cause json.RawMessage `json:"cause"`
+		} `json:"failures"`
+	} `json:"response"`
+}
+
+// Reindex copies every document of source to dest on a background task,
+// logging its progress until it completes. It fails when the task does not
+// complete within the reindex timeout, the task is not cancelled
+func (es *ElasticHandler) Reindex(source, dest string) error {
+	body, _ := json.Marshal(map[string]map[string]string{"source": {"index": source}, "dest": {"index": dest}})
+	res, err := es.client.Reindex(bytes.NewReader(body), es.client.Reindex.WithWaitForCompletion(false))
+	if err == nil {
+		defer res.Body.Close()
+	}
+	action := fmt.Sprintf("reindex %s to %s", source, dest)
+	if err := adminError(action, res, err); err != nil {
+		return err
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil || started.Task == "" {
+		return fmt.Errorf("cannot %s: task not started", action)
+	}
+	deadline := time.Now().Add(es.reindexTimeout)
+	for {
+		task, err := es.reindexTask(started.Task)
+		if err != nil {
+			return fmt.Errorf("cannot %s: %w", action, err)
+		}
+		status := task.Task.Status
+		es.logger.Info("Reindex %s to %s: %d of %d documents", source, dest, status.Created+status.Updated, status.Total)
+		if task.Completed {
+			return reindexTaskError(action, task)
+		}
+		if es.reindexTimeout > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("cannot %s: task %s did not complete in %s", action, started.Task, es.reindexTimeout)
+		}
+		time.Sleep(es.taskPollInterval)
+	}
+}
+
+// reindexTask gets the state of a reindex task
+func (es *ElasticHandler) reindexTask(taskID string) (task reindexTask, err error) {
+	res, err := es.client.Tasks.Get(taskID)
+	if err == nil {
+		defer res.Body.Close()
+	}
+	if err = adminError("get task "+taskID, res, err); err != nil {
+		return
+	}
+	err = json.NewDecoder(res.Body).Decode(&task)
+	return
+}
+
+// reindexTaskError returns the error of a completed reindex task, which
+// is the task error or its first document failure
+func reindexTaskError(action string, task reindexTask) error {
+	if len(task.Error) > 0 {
+		return fmt.Errorf("cannot %s: %w", action, decodeElasticError(0, task.Error))
+	}
+	if failures := task.Response.Failures; len(failures) > 0 {
+		return fmt.Errorf("cannot %s: %d documents failed, first on %s: %w",
+			action, len(failures), failures[0].ID, decodeElasticError(0, failures[0].Cause))
+	}
+	return nil
+}
+
+// adminError returns the error of an index administration request,
+// parsing the body of error responses
+func adminError(action string, res *esapi.Response, err error) error {
+	if err != nil {
+		return fmt.Errorf("cannot %s: %w", action, err)
+	}
+	if res.IsError() {
+		raw, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("cannot %s: %w", action, parseElasticError(res.StatusCode, raw))
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a json object sorted
+func sortedKeys(object map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// searchFilterPath keeps only the search response fields that are used.
+// Error fields are kept so error responses can still be parsed
+var searchFilterPath = []string{ // nolint: gochecknoglobals
+	"took", "timed_out", "_shards", "hits.hits._source", "hits.hits.sort", "error", "status",
+}
+
+// searchEnvelope is the search response, hits are decoded in the value
+// given by the caller
+type searchEnvelope struct {
+	searchStats
+	Hits interface{} `json:"hits"`
+}
+
+// Search gets response from elastic using query, streaming its hits
 // index string with index name
 // query string with query string
 // size how many hits are returned
 // from in which item the search process begins
-func (es *ElasticHandler) Search(index, query string, size, from int) (string, error) {
+// hits pointer where the response hits object is decoded
+func (es *ElasticHandler) Search(index, query string, size, from int, hits interface{}) error {
 	if size <= 0 {
 		size = 10
 	}
@@ -136,113 +494,352 @@ func (es *ElasticHandler) Search(index, query string, size, from int) (string, e
 		es.client.Search.WithSize(size),
 		es.client.Search.WithFrom(from),
 		es.client.Search.WithTimeout(es.searchTimeout),
-		es.client.Search.WithPretty(),
+		es.client.Search.WithFilterPath(searchFilterPath...),
 	)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer res.Body.Close()
 	// Check response status
-	response, err := ioutil.ReadAll(res.Body)
+	if res.IsError() {
+		response, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		es.collectEvent("error")
+		return newSearchError(parseElasticError(res.StatusCode, response))
+	}
+	envelope := searchEnvelope{Hits: hits}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	return es.checkSearchStats(index, envelope.searchStats)
+}
 
-	return string(response), err
+// msearchResponse is one of the multi search responses, errors are
+// returned by search along with their status
+type msearchResponse struct {
+	searchEnvelope
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
 }
 
-// Bulk insert a data collection in elastic
-// collection items to be send
+// msearchFilterPath keeps only the used fields of every multi search
+// response, and the error of the whole request
+func msearchFilterPath() (filterPath []string) {
+	for _, field := range searchFilterPath {
+		filterPath = append(filterPath, "responses."+field)
+	}
+	return append(filterPath, "error", "status")
+}
+
+// MultiSearch sends every search on a single _msearch request
 // index string with index name
-// action string to indicate which action should be done, ex: index, update, ...
-func (es *ElasticHandler) Bulk(collection []ElasticItem, index, action string) error {
-	var blk *BulkResponse
-	var buf bytes.Buffer
-	var res *esapi.Response
-	var raw map[string]interface{}
-	numErrors, numIndexed, numItems, numBatches, currBatch := 0, 0, 0, 0, 0
-	count := len(collection)
-	if count%es.batchSize == 0 {
-		numBatches = (count / es.batchSize)
-	} else {
-		numBatches = (count / es.batchSize) + 1
-	}
-	// Loop over the collection
-	for i, item := range collection {
-		numItems++
-		currBatch = i / es.batchSize
-		if i == count-1 {
-			currBatch++
-		}
-		// Prepare the metadata payload
-		meta := []byte(fmt.Sprintf(`{ "%s" : { "_id" : "%s" } }%s`, action, item.ID, "\n"))
-		// Prepare the data payload: encode to JSON
-		data, err := json.Marshal(item.Data)
+// searches with the query, size and from of each search. Their hits are
+// streamed to the search Hits and their errors returned in the same order
+func (es *ElasticHandler) MultiSearch(index string, searches []repository.SearchRequest) ([]error, error) {
+	body, err := es.msearchBody(searches)
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.client.Msearch(
+		body,
+		es.client.Msearch.WithIndex(index),
+		es.client.Msearch.WithFilterPath(msearchFilterPath()...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		response, err := ioutil.ReadAll(res.Body)
 		if err != nil {
-			es.logger.Error("Cannot encode item %d: %s", item.ID, err)
+			return nil, err
+		}
+		es.collectEvent("error")
+		return nil, newSearchError(parseElasticError(res.StatusCode, response))
+	}
+	return es.decodeMultiSearch(index, json.NewDecoder(res.Body), searches)
+}
+
+// msearchBody returns the newline delimited multi search body. Each search
+// is sent on a single line, with its size, from and timeout on the query
+func (es *ElasticHandler) msearchBody(searches []repository.SearchRequest) (*bytes.Buffer, error) {
+	var body bytes.Buffer
+	for i, search := range searches {
+		var query bytes.Buffer
+		if err := json.Compact(&query, []byte(search.Query)); err != nil {
+			return nil, fmt.Errorf("invalid query on search %d: %w", i, err)
+		}
+		if query.Len() < 2 || query.Bytes()[0] != '{' {
+			return nil, fmt.Errorf("invalid query on search %d: not a json object", i)
+		}
+		size := search.Size
+		if size <= 0 {
+			size = 10
+		}
+		// index is set on the request path, so headers are empty
+		fmt.Fprintf(&body, "{}\n{\"size\":%d,\"from\":%d", size, search.From)
+		if es.searchTimeout > 0 {
+			fmt.Fprintf(&body, ",\"timeout\":\"%dms\"", es.searchTimeout.Milliseconds())
+		}
+		if query.Len() > 2 {
+			body.WriteByte(',')
+		}
+		body.Write(query.Bytes()[1:])
+		body.WriteByte('\n')
+	}
+	return &body, nil
+}
+
+// decodeMultiSearch streams the multi search responses, decoding the hits
+// of each one in its search Hits. Searches without response are failed
+func (es *ElasticHandler) decodeMultiSearch(
+	index string,
+	decoder *json.Decoder,
+	searches []repository.SearchRequest,
+) ([]error, error) {
+	errs := make([]error, len(searches))
+	decoded := 0
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "responses" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
 			continue
 		}
-		// Append newline to the data payload
-		data = append(data, "\n"...)
-		// Append payloads to the buffer (ignoring write errors)
-		buf.Grow(len(meta) + len(data))
-		buf.Write(meta)
-		buf.Write(data)
-		if i > 0 && i%es.batchSize == 0 || i == count-1 {
-			es.logger.Error("Bulk [%d de %d] ", currBatch, numBatches)
-			// execute bulk
-			res, err = es.client.Bulk(bytes.NewReader(buf.Bytes()), es.client.Bulk.WithIndex(index))
-			if err != nil {
-				es.logger.Error("ElasticSearch Bulk Fails: indexing batch %d: %s", currBatch, err)
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		for ; decoder.More(); decoded++ {
+			var response msearchResponse
+			if decoded < len(searches) {
+				response.Hits = searches[decoded].Hits
 			}
-			// If the whole request failed, print error and mark all documents as failed
-			// issue: https://github.com/elastic/go-elasticsearch/issues/123
-			res.String() // nolint
-			if res.IsError() {
-				numErrors += numItems
-				es.bulkError(res, raw)
-			} else {
-				numErrors, numIndexed = es.bulkOK(res, blk, numErrors, numIndexed)
+			if err := decoder.Decode(&response); err != nil {
+				return nil, err
 			}
-			res.Body.Close()
-			buf.Reset()
-			numItems = 0
+			if decoded < len(searches) {
+				errs[decoded] = es.checkMultiSearchResponse(index, response)
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
 		}
 	}
+	for i := decoded; i < len(searches); i++ {
+		errs[i] = newSearchError(&ElasticError{
+			Status: http.StatusServiceUnavailable,
+			Type:   "missing_response",
+			Reason: fmt.Sprintf("no response for search %d", i),
+		})
+	}
+	return errs, nil
+}
+
+// checkMultiSearchResponse returns the error of a multi search response,
+// successful responses are checked as single searches
+func (es *ElasticHandler) checkMultiSearchResponse(index string, response msearchResponse) error {
+	if len(response.Error) > 0 {
+		es.collectEvent("error")
+		return newSearchError(decodeElasticError(response.Status, response.Error))
+	}
+	return es.checkSearchStats(index, response.searchStats)
+}
+
+// checkSearchStats reports the search stats and returns an error when
+// every shard failed. Timed out searches and partial shard failures return
+// partial results, so they are only reported
+func (es *ElasticHandler) checkSearchStats(index string, stats searchStats) error {
+	if es.tookObserver != nil {
+		es.tookObserver.Observe(float64(stats.Took)/1000, index) // nolint: gomnd
+	}
+	if stats.TimedOut {
+		es.collectEvent("timed_out")
+		es.logger.Warn("ElasticSearch search on %s timed out after %dms, partial results returned", index, stats.Took)
+	}
+	if stats.Shards.Failed == 0 {
+		return nil
+	}
+	es.collectEvent("shard_failure")
+	elasticErr := &ElasticError{Status: http.StatusServiceUnavailable, Type: "shard_failure"}
+	for _, failure := range stats.Shards.Failures {
+		elasticErr.RootCause = append(elasticErr.RootCause, failure.Reason)
+	}
+	elasticErr.Reason = fmt.Sprintf("%d of %d shards failed", stats.Shards.Failed, stats.Shards.Total)
+	es.logger.Warn("ElasticSearch search on %s: %s", index, elasticErr)
+	if stats.Shards.Successful == 0 {
+		return newSearchError(elasticErr)
+	}
 	return nil
 }
 
-func (es *ElasticHandler) bulkError(res *esapi.Response, raw map[string]interface{}) {
-	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
-		es.logger.Error("Failure to to parse response body: %s", err)
-	} else {
-		es.logger.Error("  Error: [%d] %s: %s",
-			res.StatusCode,
-			raw["error"].(map[string]interface{})["type"],
-			raw["error"].(map[string]interface{})["reason"],
-		)
+// collectEvent counts a search event, when metrics are enabled
+func (es *ElasticHandler) collectEvent(eventType string) {
+	if es.events != nil {
+		es.events.CollectEvent("elasticsearch", "search", eventType)
+	}
+}
+
+// parseElasticError parses an elasticsearch error response body. Bodies
+// that are not json, or whose error is a plain string, are kept as reason
+func parseElasticError(status int, body []byte) *ElasticError {
+	elasticErr := &ElasticError{Status: status}
+	var raw struct {
+		Error  json.RawMessage `json:"error"`
+		Status int             `json:"status"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil || len(raw.Error) == 0 {
+		elasticErr.Reason = strings.TrimSpace(string(body))
+		return elasticErr
 	}
+	return decodeElasticError(status, raw.Error)
 }
 
-func (es *ElasticHandler) bulkOK(res *esapi.Response, blk *BulkResponse, numErrors, numIndexed int) (int, int) {
+// decodeElasticError decodes the error object of a response, an error
+// given as a plain string is kept as reason
+func decodeElasticError(status int, raw json.RawMessage) *ElasticError {
+	elasticErr := &ElasticError{}
+	if err := json.Unmarshal(raw, elasticErr); err != nil {
+		_ = json.Unmarshal(raw, &elasticErr.Reason)
+	}
+	elasticErr.Status = status
+	return elasticErr
+}
+
+// newSearchError wraps an elasticsearch error as a typed error according
+// to its status. Query errors are reported as internal errors
+func newSearchError(elasticErr *ElasticError) error {
+	switch {
+	case elasticErr.Status == http.StatusRequestTimeout || elasticErr.Status == http.StatusGatewayTimeout:
+		return domain.NewError(domain.TimeoutError, domain.ErrCodeSearchTimeout, "search timed out", elasticErr)
+	case elasticErr.Status == http.StatusNotFound ||
+		elasticErr.Status == http.StatusTooManyRequests ||
+		elasticErr.Status >= http.StatusInternalServerError:
+		return domain.NewError(domain.UnavailableError, domain.ErrCodeSearchUnavailable, "search unavailable", elasticErr)
+	default:
+		return domain.NewError(domain.UnknownError, domain.ErrCodeSearchQuery, "search failed", elasticErr)
+	}
+}
+
+// Bulk insert a data collection in elastic, sending batchSize items per request
+// collection items to be send
+// index string with index name
+// action string to indicate which action should be done, ex: index, update, delete...
+// It returns a *BulkError with the items that could not be indexed. Deleting
+// documents that are not on the index is not an error
+func (es *ElasticHandler) Bulk(collection []ElasticItem, index, action string) error {
+	bulkErr := &BulkError{Total: len(collection)}
+	batchSize := es.batchSize
+	if batchSize <= 0 {
+		batchSize = len(collection)
+	}
+	numBatches := 0
+	if batchSize > 0 {
+		numBatches = (len(collection) + batchSize - 1) / batchSize
+	}
+	for batch := 0; batch < numBatches; batch++ {
+		end := (batch + 1) * batchSize
+		if end > len(collection) {
+			end = len(collection)
+		}
+		body, ids := bulkBody(collection[batch*batchSize:end], action, bulkErr)
+		if len(ids) == 0 {
+			continue
+		}
+		es.logger.Info("Bulk [%d of %d] on %s", batch+1, numBatches, index)
+		bulkErr.Failed = append(bulkErr.Failed, es.sendBulk(index, body, ids)...)
+	}
+	es.logger.Info("Bulk indexed %d of %d documents on %s", bulkErr.Total-len(bulkErr.Failed), bulkErr.Total, index)
+	if len(bulkErr.Failed) > 0 {
+		return bulkErr
+	}
+	return nil
+}
+
+// bulkBody writes the items action and document lines, delete actions have
+// no document line. Items that cannot be encoded are added to the failed
+// ones. It returns the ids written
+func bulkBody(items []ElasticItem, action string, bulkErr *BulkError) (*bytes.Buffer, []string) {
+	var buf bytes.Buffer
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		var data []byte
+		if action != "delete" {
+			var err error
+			if data, err = json.Marshal(item.Data); err != nil {
+				bulkErr.Failed = append(bulkErr.Failed, BulkItemError{ID: item.ID, Type: "encoding_error", Reason: err.Error()})
+				continue
+			}
+		}
+		meta, _ := json.Marshal(map[string]map[string]string{action: {"_id": item.ID}})
+		buf.Write(meta)
+		buf.WriteByte('\n')
+		if data != nil {
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		ids = append(ids, item.ID)
+	}
+	return &buf, ids
+}
+
+// sendBulk sends a bulk request returning its failed items. When the whole
+// request fails every item is failed with the request error
+func (es *ElasticHandler) sendBulk(index string, body *bytes.Buffer, ids []string) []BulkItemError {
+	res, err := es.client.Bulk(body, es.client.Bulk.WithIndex(index))
+	if err != nil {
+		return failBulkItems(ids, &ElasticError{Status: http.StatusServiceUnavailable, Type: "request_error", Reason: err.Error()})
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		raw, _ := ioutil.ReadAll(res.Body)
+		return failBulkItems(ids, parseElasticError(res.StatusCode, raw))
+	}
+	var blk BulkResponse
 	if err := json.NewDecoder(res.Body).Decode(&blk); err != nil {
-		es.logger.Error("Failure to to parse response body: %s", err)
-	} else {
-		for _, d := range blk.Items {
-			// ... so for any HTTP status above 201 ...
-			if d.Index.Status > 201 {
-				// ... increment the error counter ...
-				numErrors++
-				// ... and print the response status and error information ...
-				es.logger.Error("  Error: [%d]: %s: %s: %s: %s",
-					d.Index.Status,
-					d.Index.Error.Type,
-					d.Index.Error.Reason,
-					d.Index.Error.Cause.Type,
-					d.Index.Error.Cause.Reason,
-				)
-			} else {
-				// ... otherwise increase the success counter.
-				numIndexed++
+		return failBulkItems(ids, &ElasticError{Status: res.StatusCode, Type: "invalid_response", Reason: err.Error()})
+	}
+	return bulkItemErrors(blk)
+}
+
+// bulkItemErrors returns the items of a bulk response that failed,
+// deletes of missing documents are not failures
+func bulkItemErrors(blk BulkResponse) (failed []BulkItemError) {
+	for _, item := range blk.Items {
+		for action, result := range item {
+			if result.Status < http.StatusMultipleChoices ||
+				(action == "delete" && result.Status == http.StatusNotFound) {
+				continue
+			}
+			reason := result.Error.Reason
+			if result.Error.Cause.Reason != "" {
+				reason += fmt.Sprintf(" (caused by %s: %s)", result.Error.Cause.Type, result.Error.Cause.Reason)
 			}
+			failed = append(failed, BulkItemError{
+				ID:     result.ID,
+				Status: result.Status,
+				Type:   result.Error.Type,
+				Reason: reason,
+			})
 		}
 	}
-	return numErrors, numIndexed
+	return
+}
+
+// failBulkItems fails every item with the same error
+func failBulkItems(ids []string, elasticErr *ElasticError) []BulkItemError {
+	failed := make([]BulkItemError, len(ids))
+	for i, id := range ids {
+		failed[i] = BulkItemError{ID: id, Status: elasticErr.Status, Type: elasticErr.Type, Reason: elasticErr.Reason}
+	}
+	return failed
 }
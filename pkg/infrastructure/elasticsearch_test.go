@@ -0,0 +1,458 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
+)
+
+type mockMetricsObserver struct {
+	mock.Mock
+}
+
+func (m *mockMetricsObserver) Observe(value float64, labels ...string) {
+	m.Called(value, labels)
+}
+
+type mockMetricsEvents struct {
+	mock.Mock
+}
+
+func (m *mockMetricsEvents) CollectEvent(entityName, eventName, eventType string) {
+	m.Called(entityName, eventName, eventType)
+}
+
+func decodeStats(t *testing.T, response string) searchStats {
+	var stats searchStats
+	assert.NoError(t, json.Unmarshal([]byte(response), &stats))
+	return stats
+}
+
+func TestParseElasticError(t *testing.T) {
+	body := `{
+		"error": {
+			"root_cause": [{"type": "index_not_found_exception", "reason": "no such index [ads]"}],
+			"type": "index_not_found_exception",
+			"reason": "no such index [ads]"
+		},
+		"status": 404
+	}`
+	expected := &ElasticError{
+		Status:    http.StatusNotFound,
+		Type:      "index_not_found_exception",
+		Reason:    "no such index [ads]",
+		RootCause: []ElasticCause{{Type: "index_not_found_exception", Reason: "no such index [ads]"}},
+	}
+	err := parseElasticError(http.StatusNotFound, []byte(body))
+	assert.Equal(t, expected, err)
+	assert.EqualError(t, err,
+		"elasticsearch error [404] index_not_found_exception: no such index [ads] "+
+			"(root cause index_not_found_exception: no such index [ads])")
+}
+
+func TestParseElasticErrorNotJSON(t *testing.T) {
+	err := parseElasticError(http.StatusTooManyRequests, []byte("Too Many Requests\n"))
+	assert.Equal(t, &ElasticError{Status: http.StatusTooManyRequests, Reason: "Too Many Requests"}, err)
+	err = parseElasticError(http.StatusBadRequest, []byte(`{"error": "bad query", "status": 400}`))
+	assert.Equal(t, &ElasticError{Status: http.StatusBadRequest, Reason: "bad query"}, err)
+}
+
+func TestNewSearchError(t *testing.T) {
+	cases := []struct {
+		status int
+		kind   domain.ErrorKind
+		code   string
+	}{
+		{http.StatusGatewayTimeout, domain.TimeoutError, domain.ErrCodeSearchTimeout},
+		{http.StatusNotFound, domain.UnavailableError, domain.ErrCodeSearchUnavailable},
+		{http.StatusTooManyRequests, domain.UnavailableError, domain.ErrCodeSearchUnavailable},
+		{http.StatusServiceUnavailable, domain.UnavailableError, domain.ErrCodeSearchUnavailable},
+		{http.StatusBadRequest, domain.UnknownError, domain.ErrCodeSearchQuery},
+	}
+	for _, c := range cases {
+		err := newSearchError(&ElasticError{Status: c.status})
+		assert.Equal(t, c.kind, domain.ErrorKindOf(err))
+		assert.Equal(t, c.code, domain.ErrorCodeOf(err))
+	}
+}
+
+func TestCheckSearchStatsOK(t *testing.T) {
+	mObserver := mockMetricsObserver{}
+	mObserver.On("Observe", 0.25, []string{"ads"})
+	es := ElasticHandler{tookObserver: &mObserver}
+	response := `{"took": 250, "timed_out": false, "_shards": {"total": 2, "successful": 2, "failed": 0}}`
+	assert.NoError(t, es.checkSearchStats("ads", decodeStats(t, response)))
+	mObserver.AssertExpectations(t)
+}
+
+func TestCheckSearchStatsPartialResults(t *testing.T) {
+	mLogger := MockLoggerInfrastructure{}
+	mEvents := mockMetricsEvents{}
+	mLogger.On("Warn")
+	mEvents.On("CollectEvent", "elasticsearch", "search", "timed_out")
+	mEvents.On("CollectEvent", "elasticsearch", "search", "shard_failure")
+	es := ElasticHandler{logger: &mLogger, events: &mEvents}
+	response := `{"took": 3000, "timed_out": true, "_shards": {"total": 2, "successful": 1, "failed": 1,
+		"failures": [{"index": "ads", "reason": {"type": "query_shard_exception", "reason": "failed"}}]}}`
+	assert.NoError(t, es.checkSearchStats("ads", decodeStats(t, response)))
+	mLogger.AssertNumberOfCalls(t, "Warn", 2)
+	mEvents.AssertExpectations(t)
+}
+
+func TestCheckSearchStatsAllShardsFailed(t *testing.T) {
+	mLogger := MockLoggerInfrastructure{}
+	mLogger.On("Warn")
+	es := ElasticHandler{logger: &mLogger}
+	response := `{"took": 5, "timed_out": false, "_shards": {"total": 1, "successful": 0, "failed": 1,
+		"failures": [{"index": "ads", "reason": {"type": "query_shard_exception", "reason": "failed"}}]}}`
+	err := es.checkSearchStats("ads", decodeStats(t, response))
+	assert.EqualError(t, err, "search unavailable: elasticsearch error [503] shard_failure: 1 of 1 shards failed "+
+		"(root cause query_shard_exception: failed)")
+	assert.Equal(t, domain.UnavailableError, domain.ErrorKindOf(err))
+	mLogger.AssertExpectations(t)
+}
+
+func TestSearchEnvelopeDecode(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/search_filtered.json")
+	assert.NoError(t, err)
+	var parsed repository.HitsParent
+	envelope := searchEnvelope{Hits: &parsed}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(body)).Decode(&envelope))
+	assert.Equal(t, 12, envelope.Took)
+	assert.Equal(t, 1, envelope.Shards.Successful)
+	assert.Len(t, parsed.Hits, 20)
+	assert.Equal(t, int64(4961100), parsed.Hits[0].Source.ListID)
+	assert.Empty(t, parsed.Hits[0].Source.Body)
+	assert.Len(t, parsed.Hits[0].Sort, 2)
+}
+
+// BenchmarkSearchDecodeFull decodes a recorded search response the way it
+// was done before filtering: the whole pretty response read in memory
+func BenchmarkSearchDecodeFull(b *testing.B) {
+	body, err := ioutil.ReadFile("testdata/search_full.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response, _ := ioutil.ReadAll(bytes.NewReader(body))
+		var parsed struct {
+			Hits repository.HitsParent `json:"hits"`
+		}
+		if err := json.Unmarshal([]byte(string(response)), &parsed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearchDecodeFiltered decodes the same response recorded with
+// _source filtering and filter_path, streaming it as Search does
+func BenchmarkSearchDecodeFiltered(b *testing.B) {
+	body, err := ioutil.ReadFile("testdata/search_filtered.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var parsed repository.HitsParent
+		envelope := searchEnvelope{Hits: &parsed}
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&envelope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMsearchBody(t *testing.T) {
+	es := ElasticHandler{searchTimeout: 500 * time.Millisecond}
+	body, err := es.msearchBody([]repository.SearchRequest{
+		{Query: "{\n  \"query\": {\"match_all\": {}}\n}", Size: 5, From: 10},
+		{Query: "{}"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"{}\n{\"size\":5,\"from\":10,\"timeout\":\"500ms\",\"query\":{\"match_all\":{}}}\n"+
+			"{}\n{\"size\":10,\"from\":0,\"timeout\":\"500ms\"}\n",
+		body.String())
+
+	_, err = es.msearchBody([]repository.SearchRequest{{Query: "[1]"}})
+	assert.EqualError(t, err, "invalid query on search 0: not a json object")
+}
+
+func TestDecodeMultiSearch(t *testing.T) {
+	mEvents := mockMetricsEvents{}
+	mEvents.On("CollectEvent", "elasticsearch", "search", "error")
+	es := ElasticHandler{events: &mEvents}
+	response := `{"took": 12, "responses": [
+		{"took": 5, "_shards": {"total": 1, "successful": 1}, "hits": {"hits": [{"_source": {"listId": 1}}]}, "status": 200},
+		{"error": {"type": "parsing_exception", "reason": "unknown query [mtch]"}, "status": 400}
+	]}`
+	var first, second, third repository.HitsParent
+	searches := []repository.SearchRequest{{Hits: &first}, {Hits: &second}, {Hits: &third}}
+	errs, err := es.decodeMultiSearch("ads", json.NewDecoder(strings.NewReader(response)), searches)
+	assert.NoError(t, err)
+	assert.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.Len(t, first.Hits, 1)
+	assert.Equal(t, int64(1), first.Hits[0].Source.ListID)
+	assert.EqualError(t, errs[1], "search failed: elasticsearch error [400] parsing_exception: unknown query [mtch]")
+	assert.Equal(t, domain.ErrCodeSearchQuery, domain.ErrorCodeOf(errs[1]))
+	assert.Equal(t, domain.UnavailableError, domain.ErrorKindOf(errs[2]))
+	mEvents.AssertExpectations(t)
+}
+
+// newTestElasticHandler returns an elastic handler sending its requests to
+// handle, which responds as an elasticsearch cluster
+func newTestElasticHandler(t *testing.T, batchSize int, handle http.HandlerFunc) *ElasticHandler {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Info").Maybe()
+	return NewElasticHandlerHandler(1, 1, 1, 1, batchSize, time.Second, server.URL, "", "", logger)
+}
+
+func TestBulkItemErrors(t *testing.T) {
+	var blk BulkResponse
+	assert.NoError(t, json.Unmarshal([]byte(`{"errors": true, "items": [
+		{"index": {"_id": "1", "status": 201, "result": "created"}},
+		{"index": {"_id": "2", "status": 400, "error": {
+			"type": "mapper_parsing_exception", "reason": "failed to parse field [price]",
+			"caused_by": {"type": "number_format_exception", "reason": "For input string: \"abc\""}
+		}}},
+		{"update": {"_id": "3", "status": 404, "error": {"type": "document_missing_exception", "reason": "[3]: document missing"}}}
+	]}`), &blk))
+	assert.Equal(t, []BulkItemError{
+		{
+			ID: "2", Status: 400, Type: "mapper_parsing_exception",
+			Reason: `failed to parse field [price] (caused by number_format_exception: For input string: "abc")`,
+		},
+		{ID: "3", Status: 404, Type: "document_missing_exception", Reason: "[3]: document missing"},
+	}, bulkItemErrors(blk))
+}
+
+func TestBulkOK(t *testing.T) {
+	var requests []string
+	handler := newTestElasticHandler(t, 2, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.URL.Path+"\n"+string(body))
+		_, _ = w.Write([]byte(`{"errors": false, "items": [{"index": {"_id": "1", "status": 201}}]}`))
+	})
+	err := handler.Bulk([]ElasticItem{
+		{ID: "1", Data: map[string]int{"adId": 1}},
+		{ID: "2", Data: map[string]int{"adId": 2}},
+		{ID: "3", Data: map[string]int{"adId": 3}},
+	}, "ads_v1", "index")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/ads_v1/_bulk\n" +
+			`{"index":{"_id":"1"}}` + "\n" + `{"adId":1}` + "\n" +
+			`{"index":{"_id":"2"}}` + "\n" + `{"adId":2}` + "\n",
+		"/ads_v1/_bulk\n" + `{"index":{"_id":"3"}}` + "\n" + `{"adId":3}` + "\n",
+	}, requests)
+}
+
+func TestBulkErrors(t *testing.T) {
+	batch := 0
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		batch++
+		switch batch {
+		case 1:
+			_, _ = w.Write([]byte(`{"errors": true, "items": [{"index": {"_id": "1", "status": 400,
+				"error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}]}`))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error": {"type": "es_rejected_execution_exception", "reason": "rejected"}, "status": 429}`))
+		}
+	})
+	err := handler.Bulk([]ElasticItem{
+		{ID: "1", Data: map[string]int{"adId": 1}},
+		{ID: "2", Data: map[string]int{"adId": 2}},
+		{ID: "3", Data: func() {}},
+	}, "ads_v1", "index")
+	var bulkErr *BulkError
+	if assert.True(t, errors.As(err, &bulkErr)) {
+		assert.Equal(t, 3, bulkErr.Total)
+		assert.Equal(t, []BulkItemError{
+			{ID: "1", Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse"},
+			{ID: "2", Status: 429, Type: "es_rejected_execution_exception", Reason: "rejected"},
+			{ID: "3", Type: "encoding_error", Reason: "json: unsupported type: func()"},
+		}, bulkErr.Failed)
+	}
+	assert.Equal(t, "bulk failed on 3 of 3 documents, first error on 1 [400] mapper_parsing_exception: failed to parse",
+		err.Error())
+}
+
+func TestSetAlias(t *testing.T) {
+	var updates []string
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"ads_v2": {"aliases": {"ads": {}}}, "ads_v1": {"aliases": {"ads": {}}}}`))
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			updates = append(updates, r.URL.Path+" "+string(body))
+			_, _ = w.Write([]byte(`{"acknowledged": true}`))
+		}
+	})
+	assert.NoError(t, handler.SetAlias("ads", "ads_v2"))
+	assert.Equal(t, []string{
+		`/_aliases {"actions":[{"remove":{"alias":"ads","index":"ads_v1"}},{"add":{"alias":"ads","index":"ads_v2"}}]}`,
+	}, updates)
+}
+
+func TestSetAliasNew(t *testing.T) {
+	var updates []string
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "alias [ads] missing", "status": 404}`))
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			updates = append(updates, string(body))
+			_, _ = w.Write([]byte(`{"acknowledged": true}`))
+		}
+	})
+	assert.NoError(t, handler.SetAlias("ads", "ads_v1"))
+	assert.Equal(t, []string{`{"actions":[{"add":{"alias":"ads","index":"ads_v1"}}]}`}, updates)
+}
+
+func TestCreateIndexError(t *testing.T) {
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": {"type": "resource_already_exists_exception",
+			"reason": "index [ads_v1/abc] already exists"}, "status": 400}`))
+	})
+	err := handler.CreateIndex("ads_v1", []byte(`{}`))
+	var elasticErr *ElasticError
+	if assert.True(t, errors.As(err, &elasticErr)) {
+		assert.Equal(t, "resource_already_exists_exception", elasticErr.Type)
+	}
+}
+
+func TestListIndices(t *testing.T) {
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ads_v*", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ads_v2": {}, "ads_v10": {}, "ads_v1": {}}`))
+	})
+	indices, err := handler.ListIndices("ads_v*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ads_v1", "ads_v10", "ads_v2"}, indices)
+}
+
+func TestReindex(t *testing.T) {
+	polls := 0
+	var reindexBody string
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_reindex":
+			body, _ := ioutil.ReadAll(r.Body)
+			reindexBody = r.URL.RawQuery + " " + string(body)
+			_, _ = w.Write([]byte(`{"task": "node:1"}`))
+		case "/_tasks/node:1":
+			polls++
+			_, _ = w.Write([]byte(`{"completed": ` + strconv.FormatBool(polls == 2) + `,
+				"task": {"status": {"total": 10, "created": 5}}, "response": {"failures": []}}`))
+		}
+	})
+	handler.taskPollInterval = time.Millisecond
+	assert.NoError(t, handler.Reindex("ads_v1", "ads_v2"))
+	assert.Equal(t, `wait_for_completion=false {"dest":{"index":"ads_v2"},"source":{"index":"ads_v1"}}`, reindexBody)
+	assert.Equal(t, 2, polls)
+}
+
+func TestReindexTimeout(t *testing.T) {
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_reindex":
+			_, _ = w.Write([]byte(`{"task": "node:1"}`))
+		default:
+			_, _ = w.Write([]byte(`{"completed": false, "task": {"status": {"total": 10, "created": 5}}}`))
+		}
+	})
+	handler.taskPollInterval = time.Millisecond
+	handler.SetReindexTimeout(5 * time.Millisecond)
+	err := handler.Reindex("ads_v1", "ads_v2")
+	assert.EqualError(t, err, "cannot reindex ads_v1 to ads_v2: task node:1 did not complete in 5ms")
+}
+
+func TestReindexFailures(t *testing.T) {
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_reindex":
+			_, _ = w.Write([]byte(`{"task": "node:1"}`))
+		default:
+			_, _ = w.Write([]byte(`{"completed": true, "response": {"failures": [
+				{"id": "7", "cause": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}
+			]}}`))
+		}
+	})
+	err := handler.Reindex("ads_v1", "ads_v2")
+	assert.EqualError(t, err, "cannot reindex ads_v1 to ads_v2: 1 documents failed, first on 7: "+
+		"elasticsearch error [0] mapper_parsing_exception: failed to parse")
+}
+
+func TestCount(t *testing.T) {
+	var paths []string
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"count": 42, "_shards": {}}`))
+	})
+	count, err := handler.Count("ads_v2")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, count)
+	assert.Equal(t, []string{"/ads_v2/_refresh", "/ads_v2/_count"}, paths)
+}
+
+func TestShardSettings(t *testing.T) {
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ads_v2/_settings/index.number_of_shards,index.number_of_replicas", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ads_v2": {"settings": {"index": {"number_of_shards": "3", "number_of_replicas": "2"}}}}`))
+	})
+	settings, err := handler.ShardSettings("ads_v2")
+	assert.NoError(t, err)
+	assert.Equal(t, ShardSettings{Shards: 3, Replicas: 2}, settings)
+}
+
+func TestCreateDoesNotDelete(t *testing.T) {
+	var methods []string
+	handler := newTestElasticHandler(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method+" "+r.URL.Path)
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	})
+	assert.NoError(t, handler.Create("ads_v1"))
+	assert.Equal(t, []string{"PUT /ads_v1"}, methods)
+}
+
+func TestBulkDelete(t *testing.T) {
+	var requests []string
+	handler := newTestElasticHandler(t, 10, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		_, _ = w.Write([]byte(`{"errors": false, "items": [
+			{"delete": {"_id": "1", "status": 200, "result": "deleted"}},
+			{"delete": {"_id": "2", "status": 404, "result": "not_found"}}
+		]}`))
+	})
+	err := handler.Bulk([]ElasticItem{{ID: "1"}, {ID: "2"}}, "ads", "delete")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"delete":{"_id":"1"}}` + "\n" + `{"delete":{"_id":"2"}}` + "\n"}, requests)
+}
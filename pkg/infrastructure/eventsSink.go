@@ -0,0 +1,248 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+)
+
+// ErrEventsBufferFull is returned when events arrive faster than they are written
+var ErrEventsBufferFull = errors.New("events buffer full")
+
+// ErrEventsSinkClosed is returned when events arrive once the sink is closed
+var ErrEventsSinkClosed = errors.New("events sink closed")
+
+// EventsWriter persists batches of records
+type EventsWriter interface {
+	WriteEvents(records []interface{}) error
+}
+
+// BufferedEventsSink keeps records in memory and writes them in batches
+// from a background goroutine, so requests do not wait on the writer.
+// Records that do not fit on the buffer are rejected
+type BufferedEventsSink struct {
+	writer        EventsWriter
+	records       chan interface{}
+	batchSize     int
+	flushInterval time.Duration
+	logger        loggers.Logger
+	done          chan struct{}
+	stopped       chan struct{}
+	once          sync.Once
+}
+
+// NewBufferedEventsSink returns a sink writing on writer every batchSize
+// records or every flushInterval, keeping up to bufferSize records
+func NewBufferedEventsSink(
+	writer EventsWriter, bufferSize, batchSize int, flushInterval time.Duration, logger loggers.Logger,
+) *BufferedEventsSink {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	sink := &BufferedEventsSink{
+		writer:        writer,
+		records:       make(chan interface{}, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        logger,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go sink.run()
+	return sink
+}
+
+// Write adds the records to the buffer. When it is full the remaining
+// records are dropped and ErrEventsBufferFull is returned
+func (s *BufferedEventsSink) Write(records []interface{}) error {
+	select {
+	case <-s.done:
+		return ErrEventsSinkClosed
+	default:
+	}
+	for i, record := range records {
+		select {
+		case s.records <- record:
+		default:
+			return fmt.Errorf("%w, %d of %d events dropped", ErrEventsBufferFull, len(records)-i, len(records))
+		}
+	}
+	return nil
+}
+
+// run writes the buffered records until the sink is closed, then the
+// remaining ones are written and the writer is closed
+func (s *BufferedEventsSink) run() {
+	defer close(s.stopped)
+	var flush <-chan time.Time
+	if s.flushInterval > 0 {
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	batch := make([]interface{}, 0, s.batchSize)
+	for {
+		select {
+		case record := <-s.records:
+			if batch = append(batch, record); len(batch) >= s.batchSize {
+				batch = s.flush(batch)
+			}
+		case <-flush:
+			batch = s.flush(batch)
+		case <-s.done:
+			for {
+				select {
+				case record := <-s.records:
+					if batch = append(batch, record); len(batch) >= s.batchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					if closer, ok := s.writer.(io.Closer); ok {
+						if err := closer.Close(); err != nil {
+							s.logger.Error("error closing events writer: %+v", err)
+						}
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the batch, records that cannot be written are dropped. It
+// returns the batch emptied
+func (s *BufferedEventsSink) flush(batch []interface{}) []interface{} {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := s.writer.WriteEvents(batch); err != nil {
+		s.logger.Error("error writing %d events, they are dropped: %+v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// Close stops accepting records, returning once the buffered ones are written
+func (s *BufferedEventsSink) Close() error {
+	s.once.Do(func() { close(s.done) })
+	<-s.stopped
+	return nil
+}
+
+// RotatingFileWriter writes records as ndjson on a file that is rotated
+// once it reaches maxSize bytes or is older than maxAge. Rotated files are
+// renamed with the time they were rotated at, ex:
+// events.ndjson.2021-05-12T15-00-00.000
+type RotatingFileWriter struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// NewRotatingFileWriter returns a writer appending to the file on path,
+// creating its folder when needed. Zero maxSize or maxAge disable that rotation
+func NewRotatingFileWriter(path string, maxSize int64, maxAge time.Duration) (*RotatingFileWriter, error) {
+	writer := &RotatingFileWriter{
+		path:    filepath.Clean(path),
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		now:     time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(writer.path), 0750); err != nil {
+		return nil, err
+	}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// WriteEvents writes a line for each record, rotating the file before
+// when needed
+func (w *RotatingFileWriter) WriteEvents(records []interface{}) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.mustRotate(int64(buf.Len())) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// Close closes the current file
+func (w *RotatingFileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// mustRotate tells whether the file must be rotated before writing size bytes.
+// Empty files are never rotated
+func (w *RotatingFileWriter) mustRotate(size int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	return (w.maxSize > 0 && w.size+size > w.maxSize) ||
+		(w.maxAge > 0 && w.now().Sub(w.openedAt) >= w.maxAge)
+}
+
+// rotate renames the current file and opens a new one, when it cannot be
+// renamed the current file is opened again
+func (w *RotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	rotated := w.path + "." + w.now().Format("2006-01-02T15-04-05.000")
+	errRename := os.Rename(w.path, rotated)
+	if err := w.open(); err != nil {
+		return err
+	}
+	return errRename
+}
+
+// open opens the file for appending
+func (w *RotatingFileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file, w.size, w.openedAt = file, info.Size(), w.now()
+	return nil
+}
@@ -0,0 +1,95 @@
+package infrastructure
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryEventsWriter keeps the written batches
+type memoryEventsWriter struct {
+	mutex   sync.Mutex
+	batches [][]interface{}
+	closed  bool
+	err     error
+}
+
+func (w *memoryEventsWriter) WriteEvents(records []interface{}) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.batches = append(w.batches, append([]interface{}{}, records...))
+	return w.err
+}
+
+func (w *memoryEventsWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func newTestEventsSink(writer EventsWriter, bufferSize, batchSize int, flushInterval time.Duration) *BufferedEventsSink {
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Error").Maybe()
+	return NewBufferedEventsSink(writer, bufferSize, batchSize, flushInterval, logger)
+}
+
+func TestBufferedEventsSinkBatches(t *testing.T) {
+	writer := &memoryEventsWriter{}
+	sink := newTestEventsSink(writer, 10, 2, 0)
+	assert.NoError(t, sink.Write([]interface{}{1, 2, 3}))
+	// pending records are written on close
+	assert.NoError(t, sink.Close())
+	assert.Equal(t, [][]interface{}{{1, 2}, {3}}, writer.batches)
+	assert.True(t, writer.closed)
+	assert.Equal(t, ErrEventsSinkClosed, sink.Write([]interface{}{4}))
+}
+
+func TestBufferedEventsSinkFlushInterval(t *testing.T) {
+	writer := &memoryEventsWriter{}
+	sink := newTestEventsSink(writer, 10, 100, time.Millisecond)
+	defer sink.Close()
+	assert.NoError(t, sink.Write([]interface{}{1}))
+	assert.Eventually(t, func() bool {
+		writer.mutex.Lock()
+		defer writer.mutex.Unlock()
+		return len(writer.batches) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestBufferedEventsSinkFull(t *testing.T) {
+	writer := &memoryEventsWriter{err: errors.New("disk full")}
+	sink := &BufferedEventsSink{writer: writer, records: make(chan interface{}, 2), done: make(chan struct{})}
+	err := sink.Write([]interface{}{1, 2, 3})
+	assert.True(t, errors.Is(err, ErrEventsBufferFull))
+	assert.EqualError(t, err, "events buffer full, 1 of 3 events dropped")
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "events.ndjson")
+	writer, err := NewRotatingFileWriter(path, 20, time.Hour)
+	assert.NoError(t, err)
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	writer.now = func() time.Time { return now }
+
+	assert.NoError(t, writer.WriteEvents([]interface{}{map[string]int{"listId": 1}}))
+	assert.NoError(t, writer.WriteEvents([]interface{}{map[string]int{"listId": 2}}))
+	now = now.Add(time.Second)
+	// rotated by age
+	writer.openedAt = now.Add(-time.Hour)
+	assert.NoError(t, writer.WriteEvents([]interface{}{map[string]int{"listId": 3}}))
+	assert.NoError(t, writer.Close())
+
+	current, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"listId\":3}\n", string(current))
+	files, err := filepath.Glob(path + ".*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path + ".2021-05-12T15-00-00.000", path + ".2021-05-12T15-00-01.000"}, files)
+	first, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"listId\":1}\n", string(first))
+}
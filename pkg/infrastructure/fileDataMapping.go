@@ -0,0 +1,28 @@
+package infrastructure
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/tidwall/gjson"
+)
+
+// FileDataMapping serves configuration params from a local json file using
+// the same key syntax as Rconf, so both can be used interchangeably
+type FileDataMapping struct {
+	content string
+}
+
+// NewFileDataMapping loads the json file in path
+func NewFileDataMapping(path string) (*FileDataMapping, error) {
+	content, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return &FileDataMapping{}, err
+	}
+	return &FileDataMapping{content: string(content)}, nil
+}
+
+// Get gets the value of the given key
+func (m *FileDataMapping) Get(key string) string {
+	return gjson.Get(m.content, key).String()
+}
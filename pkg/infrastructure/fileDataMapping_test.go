@@ -0,0 +1,30 @@
+package infrastructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDataMappingGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapping")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "communes.json")
+	content := `{"commune": {"295": {"lat": -33.4489, "lon": -70.6693}}}`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	mapping, err := NewFileDataMapping(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "-33.4489", mapping.Get("commune.295.lat"))
+	assert.Equal(t, "", mapping.Get("commune.1.lat"))
+}
+
+func TestFileDataMappingNotFound(t *testing.T) {
+	mapping, err := NewFileDataMapping("/not/found.json")
+	assert.Error(t, err)
+	assert.Equal(t, "", mapping.Get("commune.295.lat"))
+}
@@ -0,0 +1,95 @@
+package infrastructure
+
+import (
+	"sync"
+	"time"
+)
+
+// frequencyEntry is the counts of a key on the window started at start
+type frequencyEntry struct {
+	start  time.Time
+	counts map[int64]int
+}
+
+// MemoryFrequencyCounter counts ids by key on fixed windows in memory, so
+// counts are lost on restart and not shared between replicas. The counts
+// of a key are reset once its window, started by its first count, ends.
+// The keys whose window started first are evicted once there are maxKeys
+type MemoryFrequencyCounter struct {
+	window  time.Duration
+	maxKeys int
+	entries map[string]frequencyEntry
+	now     func() time.Time
+	mutex   sync.Mutex
+}
+
+// NewMemoryFrequencyCounter returns an empty counter, zero maxKeys
+// disables eviction
+func NewMemoryFrequencyCounter(window time.Duration, maxKeys int) *MemoryFrequencyCounter {
+	return &MemoryFrequencyCounter{
+		window:  window,
+		maxKeys: maxKeys,
+		entries: make(map[string]frequencyEntry),
+		now:     time.Now,
+	}
+}
+
+// Counts returns the count of each id of the key on the current window,
+// ids not counted are not included
+func (c *MemoryFrequencyCounter) Counts(key string, ids []int64) (map[int64]int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := make(map[int64]int)
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry) {
+		return counts, nil
+	}
+	for _, id := range ids {
+		if count := entry.counts[id]; count > 0 {
+			counts[id] = count
+		}
+	}
+	return counts, nil
+}
+
+// Add counts the ids once more for the key, starting a new window when
+// the key has none
+func (c *MemoryFrequencyCounter) Add(key string, ids []int64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry) {
+		if !ok && c.maxKeys > 0 && len(c.entries) >= c.maxKeys {
+			c.evict()
+		}
+		entry = frequencyEntry{start: c.now(), counts: make(map[int64]int)}
+	}
+	for _, id := range ids {
+		entry.counts[id]++
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+// evict removes the expired keys, or the one whose window started first
+// when none is
+func (c *MemoryFrequencyCounter) evict() {
+	var oldest string
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || entry.start.Before(c.entries[oldest].start) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= c.maxKeys {
+		delete(c.entries, oldest)
+	}
+}
+
+// expired tells whether the window of the entry ended
+func (c *MemoryFrequencyCounter) expired(entry frequencyEntry) bool {
+	return !c.now().Before(entry.start.Add(c.window))
+}
@@ -0,0 +1,46 @@
+package infrastructure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryFrequencyCounter(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	counter := NewMemoryFrequencyCounter(time.Hour, 2)
+	counter.now = func() time.Time { return now }
+
+	assert.NoError(t, counter.Add("a", []int64{1, 2}))
+	assert.NoError(t, counter.Add("a", []int64{1}))
+	counts, err := counter.Counts("a", []int64{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 2, 2: 1}, counts)
+	counts, _ = counter.Counts("b", []int64{1})
+	assert.Empty(t, counts)
+
+	// counts are reset once the window ends
+	now = now.Add(time.Hour)
+	counts, _ = counter.Counts("a", []int64{1})
+	assert.Empty(t, counts)
+	assert.NoError(t, counter.Add("a", []int64{1}))
+	counts, _ = counter.Counts("a", []int64{1})
+	assert.Equal(t, map[int64]int{1: 1}, counts)
+}
+
+func TestMemoryFrequencyCounterEviction(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	counter := NewMemoryFrequencyCounter(time.Hour, 2)
+	counter.now = func() time.Time { return now }
+	assert.NoError(t, counter.Add("a", []int64{1}))
+	now = now.Add(time.Minute)
+	assert.NoError(t, counter.Add("b", []int64{1}))
+
+	// the key whose window started first is evicted when the counter is full
+	assert.NoError(t, counter.Add("c", []int64{1}))
+	counts, _ := counter.Counts("a", []int64{1})
+	assert.Empty(t, counts)
+	counts, _ = counter.Counts("b", []int64{1})
+	assert.Equal(t, map[int64]int{1: 1}, counts)
+}
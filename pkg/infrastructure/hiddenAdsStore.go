@@ -0,0 +1,205 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// hiddenAdsEntry is the exclusions of a key and when it was last set
+type hiddenAdsEntry struct {
+	hidden domain.Exclusions
+	seq    uint64
+}
+
+// MemoryHiddenAdsStore keeps the hidden ads and sellers of each key in
+// memory, so they are lost on restart and not shared between replicas.
+// Hidden ads do not expire, the least recently set keys are evicted once
+// there are maxKeys of them
+type MemoryHiddenAdsStore struct {
+	maxKeys int
+	entries map[string]hiddenAdsEntry
+	seq     uint64
+	mutex   sync.Mutex
+}
+
+// NewMemoryHiddenAdsStore returns an empty store, zero maxKeys disables eviction
+func NewMemoryHiddenAdsStore(maxKeys int) *MemoryHiddenAdsStore {
+	return &MemoryHiddenAdsStore{
+		maxKeys: maxKeys,
+		entries: make(map[string]hiddenAdsEntry),
+	}
+}
+
+// Get returns a copy of the exclusions of the key, empty when it is unknown
+func (s *MemoryHiddenAdsStore) Get(key string) (domain.Exclusions, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyExclusions(s.entries[key].hidden), nil
+}
+
+// Set replaces the exclusions of the key, evicting the least recently set
+// key when the store is full
+func (s *MemoryHiddenAdsStore) Set(key string, hidden domain.Exclusions) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.entries[key]; !ok && s.maxKeys > 0 && len(s.entries) >= s.maxKeys {
+		var oldest string
+		for k, entry := range s.entries {
+			if oldest == "" || entry.seq < s.entries[oldest].seq {
+				oldest = k
+			}
+		}
+		delete(s.entries, oldest)
+	}
+	s.seq++
+	s.entries[key] = hiddenAdsEntry{hidden: copyExclusions(hidden), seq: s.seq}
+	return nil
+}
+
+// records returns the exclusions of every key, least recently set first
+func (s *MemoryHiddenAdsStore) records() []hiddenAdsRecord {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.entries[keys[i]].seq < s.entries[keys[j]].seq })
+	records := make([]hiddenAdsRecord, 0, len(keys))
+	for _, key := range keys {
+		hidden := s.entries[key].hidden
+		records = append(records, hiddenAdsRecord{Key: key, ListIDs: hidden.ListIDs, UserIDs: hidden.UserIDs})
+	}
+	return records
+}
+
+// copyExclusions returns exclusions not sharing memory with the given ones
+func copyExclusions(hidden domain.Exclusions) domain.Exclusions {
+	var out domain.Exclusions
+	if len(hidden.ListIDs) > 0 {
+		out.ListIDs = append([]int64{}, hidden.ListIDs...)
+	}
+	if len(hidden.UserIDs) > 0 {
+		out.UserIDs = append([]int64{}, hidden.UserIDs...)
+	}
+	return out
+}
+
+// hiddenAdsRecord is a line of the hidden ads file, the last line of a key
+// holds its exclusions
+type hiddenAdsRecord struct {
+	Key     string  `json:"key"`
+	ListIDs []int64 `json:"listIds,omitempty"`
+	UserIDs []int64 `json:"userIds,omitempty"`
+}
+
+// FileHiddenAdsStore keeps the hidden ads in memory and appends every
+// change to a ndjson file, so they survive restarts. The file is replayed
+// and compacted when the store is opened
+type FileHiddenAdsStore struct {
+	memory  *MemoryHiddenAdsStore
+	file    *os.File
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewFileHiddenAdsStore loads the hidden ads on path, creating it when it
+// does not exist. Lines that cannot be decoded, as a line partially
+// written on a crash, are skipped
+func NewFileHiddenAdsStore(path string, maxKeys int) (*FileHiddenAdsStore, error) {
+	path = filepath.Clean(path)
+	memory := NewMemoryHiddenAdsStore(maxKeys)
+	if err := replayHiddenAds(path, memory); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := writeHiddenAds(path, memory.records()); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileHiddenAdsStore{memory: memory, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Get returns a copy of the exclusions of the key, empty when it is unknown
+func (s *FileHiddenAdsStore) Get(key string) (domain.Exclusions, error) {
+	return s.memory.Get(key)
+}
+
+// Set replaces the exclusions of the key once they are appended to the file
+func (s *FileHiddenAdsStore) Set(key string, hidden domain.Exclusions) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record := hiddenAdsRecord{Key: key, ListIDs: hidden.ListIDs, UserIDs: hidden.UserIDs}
+	if err := s.encoder.Encode(record); err != nil {
+		return err
+	}
+	return s.memory.Set(key, hidden)
+}
+
+// Close closes the file, the store cannot be set afterwards
+func (s *FileHiddenAdsStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// replayHiddenAds sets on the store every record of the file on path
+func replayHiddenAds(path string, store *MemoryHiddenAdsStore) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // nolint: errcheck
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		var record hiddenAdsRecord
+		if len(line) > 0 && json.Unmarshal(line, &record) == nil && record.Key != "" {
+			store.Set(record.Key, domain.Exclusions{ListIDs: record.ListIDs, UserIDs: record.UserIDs}) // nolint: errcheck, gosec
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeHiddenAds replaces the file on path with the records atomically
+func writeHiddenAds(path string, records []hiddenAdsRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // nolint: errcheck
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close() // nolint: errcheck, gosec
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close() // nolint: errcheck, gosec
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,69 @@
+package infrastructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+func TestMemoryHiddenAdsStore(t *testing.T) {
+	store := NewMemoryHiddenAdsStore(2)
+	hidden := domain.Exclusions{ListIDs: []int64{2, 1}}
+	assert.NoError(t, store.Set("a", hidden))
+	hidden.ListIDs[0] = 3
+	assert.NoError(t, store.Set("b", domain.Exclusions{UserIDs: []int64{7}}))
+	assert.NoError(t, store.Set("a", domain.Exclusions{ListIDs: []int64{2, 1}}))
+
+	got, err := store.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{2, 1}}, got)
+
+	// the least recently set key is evicted when the store is full
+	assert.NoError(t, store.Set("c", domain.Exclusions{ListIDs: []int64{5}}))
+	got, _ = store.Get("b")
+	assert.Equal(t, domain.Exclusions{}, got)
+	got, _ = store.Get("a")
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{2, 1}}, got)
+}
+
+func TestFileHiddenAdsStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hidden")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store", "hidden.ndjson")
+
+	store, err := NewFileHiddenAdsStore(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("a", domain.Exclusions{ListIDs: []int64{1}}))
+	assert.NoError(t, store.Set("b", domain.Exclusions{UserIDs: []int64{7}}))
+	assert.NoError(t, store.Set("a", domain.Exclusions{ListIDs: []int64{2, 1}}))
+	assert.NoError(t, store.Close())
+
+	// a line partially written on a crash is skipped
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"key": "c", "listIds": [`) // nolint: errcheck
+	file.Close()                                  // nolint: errcheck
+
+	store, err = NewFileHiddenAdsStore(path, 0)
+	assert.NoError(t, err)
+	defer store.Close()
+	got, _ := store.Get("a")
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{2, 1}}, got)
+	got, _ = store.Get("b")
+	assert.Equal(t, domain.Exclusions{UserIDs: []int64{7}}, got)
+
+	// the file is compacted to the last exclusions of each key
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, `{"key":"b","userIds":[7]}`+"\n"+`{"key":"a","listIds":[2,1]}`+"\n", string(content))
+}
+
+func TestFileHiddenAdsStoreInvalidPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hidden")
+	defer os.RemoveAll(dir)
+
+	_, err := NewFileHiddenAdsStore(dir, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,304 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/loggers"
+)
+
+// IndexAdmin creates, loads and aliases elasticsearch indices
+type IndexAdmin interface {
+	CreateIndex(index string, body []byte) error
+	PutMapping(mapping []byte, index string) error
+	Bulk(collection []ElasticItem, index, action string) error
+	Reindex(source, dest string) error
+	Count(index string) (int, error)
+	ShardSettings(index string) (ShardSettings, error)
+	ListIndices(pattern string) ([]string, error)
+	AliasIndices(alias string) ([]string, error)
+	SetAlias(alias, index string) error
+	DeleteIndex(index string) error
+}
+
+// IndexBootstrap sets up new versions of the ads index from checked in
+// settings and mapping, loading an ads file or copying the current version
+type IndexBootstrap struct {
+	admin  IndexAdmin
+	logger loggers.Logger
+	// events is optional, it counts reindex results
+	events MetricsEvents
+}
+
+// ReindexRequest describes a new version of the alias index
+type ReindexRequest struct {
+	Alias        string
+	SettingsPath string
+	MappingPath  string
+	// AdsPath is the file the ads are loaded from, when empty they are
+	// copied from the index the alias points to
+	AdsPath string
+	// Keep is how many previous versions are kept once the alias is moved,
+	// older ones are deleted. Negative values keep every version
+	Keep int
+}
+
+// ShardSettings are the primary shards and replicas of an index
+type ShardSettings struct {
+	Shards   int
+	Replicas int
+}
+
+// countMismatchError is returned when the new index does not have the
+// expected documents
+type countMismatchError struct {
+	index           string
+	count, expected int
+}
+
+func (e *countMismatchError) Error() string {
+	return fmt.Sprintf("index %s has %d documents, expected %d", e.index, e.count, e.expected)
+}
+
+// NewIndexBootstrap returns an index bootstrap using admin
+func NewIndexBootstrap(admin IndexAdmin, logger loggers.Logger) *IndexBootstrap {
+	return &IndexBootstrap{admin: admin, logger: logger}
+}
+
+// SetMetrics enables counting reindex results by type: success,
+// count_mismatch and error
+func (b *IndexBootstrap) SetMetrics(events MetricsEvents) {
+	b.events = events
+}
+
+// Run creates the next version of the alias index with the settings and
+// mapping files, loads the ads file on it and points the alias to it.
+// Every previous version is kept. It returns the new index
+func (b *IndexBootstrap) Run(alias, settingsPath, mappingPath, adsPath string) (string, error) {
+	return b.Reindex(ReindexRequest{
+		Alias:        alias,
+		SettingsPath: settingsPath,
+		MappingPath:  mappingPath,
+		AdsPath:      adsPath,
+		Keep:         -1,
+	})
+}
+
+// Reindex creates the next version of the alias index, alias_v1, alias_v2
+// and so on, with the settings and mapping files and loads the ads file on
+// it, or copies the index the alias points to. Once the new index has the
+// expected documents the alias is atomically moved to it and the previous
+// versions are pruned. On failure the alias is not moved and the new index
+// is kept to be inspected. Copies keep the shards and replicas of the
+// copied index. Writes on the copied index during the copy make
+// the counts differ, so they should be paused. It returns the new index
+func (b *IndexBootstrap) Reindex(request ReindexRequest) (index string, err error) {
+	defer func() { b.collectEvent(err) }()
+	settings, err := ioutil.ReadFile(filepath.Clean(request.SettingsPath))
+	if err != nil {
+		return "", err
+	}
+	mapping, err := ioutil.ReadFile(filepath.Clean(request.MappingPath))
+	if err != nil {
+		return "", err
+	}
+	var ads []ElasticItem
+	var source string
+	if request.AdsPath != "" {
+		if ads, err = ReadAdsFile(request.AdsPath); err != nil {
+			return "", err
+		}
+	} else if source, err = b.currentIndex(request.Alias); err != nil {
+		return "", err
+	} else if settings, err = b.copyShardSettings(source, settings); err != nil {
+		return "", err
+	}
+	versions, err := b.versions(request.Alias)
+	if err != nil {
+		return "", err
+	}
+	last := 0
+	if len(versions) > 0 {
+		last = versions[len(versions)-1].number
+	}
+	index = fmt.Sprintf("%s_v%d", request.Alias, last+1)
+	b.logger.Info("Creating index %s", index)
+	if err = b.admin.CreateIndex(index, settings); err != nil {
+		return index, err
+	}
+	if err = b.admin.PutMapping(mapping, index); err != nil {
+		return index, err
+	}
+	expected, err := b.load(index, source, request.AdsPath, ads)
+	if err != nil {
+		return index, err
+	}
+	count, err := b.admin.Count(index)
+	if err != nil {
+		return index, err
+	}
+	if count != expected {
+		return index, &countMismatchError{index: index, count: count, expected: expected}
+	}
+	if err = b.admin.SetAlias(request.Alias, index); err != nil {
+		return index, err
+	}
+	b.logger.Info("Alias %s points to %s with %d documents", request.Alias, index, count)
+	b.prune(versions, request.Keep)
+	return index, nil
+}
+
+// load loads the ads on index, or copies the source index, returning how
+// many documents index should have. The source is counted before the copy,
+// which is what gets copied
+func (b *IndexBootstrap) load(index, source, adsPath string, ads []ElasticItem) (int, error) {
+	if source == "" {
+		b.logger.Info("Loading %d ads from %s on %s", len(ads), adsPath, index)
+		return len(ads), b.admin.Bulk(ads, index, "index")
+	}
+	expected, err := b.admin.Count(source)
+	if err != nil {
+		return 0, err
+	}
+	b.logger.Info("Copying %d documents of %s to %s", expected, source, index)
+	return expected, b.admin.Reindex(source, index)
+}
+
+// copyShardSettings overrides the shards and replicas of settings with the
+// ones of the source index, so a copy keeps the shape of the live index
+// instead of the one the checked in settings have for development
+func (b *IndexBootstrap) copyShardSettings(source string, settings []byte) ([]byte, error) {
+	shards, err := b.admin.ShardSettings(source)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(settings, &body); err != nil {
+		return nil, fmt.Errorf("invalid index settings: %w", err)
+	}
+	indexSettings := childObject(childObject(body, "settings"), "index")
+	indexSettings["number_of_shards"] = shards.Shards
+	indexSettings["number_of_replicas"] = shards.Replicas
+	b.logger.Info("Using %d shards and %d replicas of %s", shards.Shards, shards.Replicas, source)
+	return json.Marshal(body)
+}
+
+// childObject returns the object at key of parent, adding it when missing
+func childObject(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return child
+}
+
+// currentIndex returns the only index alias points to
+func (b *IndexBootstrap) currentIndex(alias string) (string, error) {
+	indices, err := b.admin.AliasIndices(alias)
+	if err != nil {
+		return "", err
+	}
+	if len(indices) != 1 {
+		return "", fmt.Errorf("alias %s points to %d indices, expected one to copy from", alias, len(indices))
+	}
+	return indices[0], nil
+}
+
+// indexVersion is a version of the alias index
+type indexVersion struct {
+	name   string
+	number int
+}
+
+// versions returns the versions of the alias index sorted by number
+func (b *IndexBootstrap) versions(alias string) ([]indexVersion, error) {
+	indices, err := b.admin.ListIndices(alias + "_v*")
+	if err != nil {
+		return nil, err
+	}
+	var versions []indexVersion
+	for _, index := range indices {
+		if number, err := strconv.Atoi(strings.TrimPrefix(index, alias+"_v")); err == nil {
+			versions = append(versions, indexVersion{name: index, number: number})
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].number < versions[j].number })
+	return versions, nil
+}
+
+// prune deletes the previous versions but the last keep ones. Failures
+// are logged since the alias was already moved
+func (b *IndexBootstrap) prune(previous []indexVersion, keep int) {
+	if keep < 0 || len(previous) <= keep {
+		return
+	}
+	for _, version := range previous[:len(previous)-keep] {
+		if err := b.admin.DeleteIndex(version.name); err != nil {
+			b.logger.Error("error deleting index %s: %+v", version.name, err)
+			continue
+		}
+		b.logger.Info("Deleted index %s", version.name)
+	}
+}
+
+// collectEvent counts the reindex result
+func (b *IndexBootstrap) collectEvent(err error) {
+	if b.events == nil {
+		return
+	}
+	var mismatch *countMismatchError
+	switch {
+	case err == nil:
+		b.events.CollectEvent("elasticsearch", "reindex", "success")
+	case errors.As(err, &mismatch):
+		b.events.CollectEvent("elasticsearch", "reindex", "count_mismatch")
+	default:
+		b.events.CollectEvent("elasticsearch", "reindex", "error")
+	}
+}
+
+// ReadAdsFile reads the ads of a ndjson file, one ad per line, or of a
+// json array as the one used by the memory elastic handler.
+// Ads are identified by their adId
+func ReadAdsFile(path string) ([]ElasticItem, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	var ads []ElasticItem
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return ads, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid ads file %s: %w", path, err)
+		}
+		docs := []json.RawMessage{raw}
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(raw, &docs); err != nil {
+				return nil, fmt.Errorf("invalid ads file %s: %w", path, err)
+			}
+		}
+		for _, doc := range docs {
+			var ad struct {
+				AdID json.Number `json:"adId"`
+			}
+			if err := json.Unmarshal(doc, &ad); err != nil || ad.AdID == "" {
+				return nil, fmt.Errorf("invalid ads file %s: ad %d has no adId", path, len(ads)+1)
+			}
+			ads = append(ads, ElasticItem{ID: ad.AdID.String(), Data: doc})
+		}
+	}
+}
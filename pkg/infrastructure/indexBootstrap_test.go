@@ -0,0 +1,265 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockIndexAdmin struct {
+	mock.Mock
+}
+
+func (m *mockIndexAdmin) CreateIndex(index string, body []byte) error {
+	return m.Called(index, string(body)).Error(0)
+}
+
+func (m *mockIndexAdmin) PutMapping(mapping []byte, index string) error {
+	return m.Called(string(mapping), index).Error(0)
+}
+
+func (m *mockIndexAdmin) Bulk(collection []ElasticItem, index, action string) error {
+	return m.Called(collection, index, action).Error(0)
+}
+
+func (m *mockIndexAdmin) Reindex(source, dest string) error {
+	return m.Called(source, dest).Error(0)
+}
+
+func (m *mockIndexAdmin) Count(index string) (int, error) {
+	args := m.Called(index)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockIndexAdmin) ShardSettings(index string) (ShardSettings, error) {
+	args := m.Called(index)
+	return args.Get(0).(ShardSettings), args.Error(1)
+}
+
+func (m *mockIndexAdmin) ListIndices(pattern string) ([]string, error) {
+	args := m.Called(pattern)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockIndexAdmin) AliasIndices(alias string) ([]string, error) {
+	args := m.Called(alias)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockIndexAdmin) SetAlias(alias, index string) error {
+	return m.Called(alias, index).Error(0)
+}
+
+func (m *mockIndexAdmin) DeleteIndex(index string) error {
+	return m.Called(index).Error(0)
+}
+
+// writeBootstrapFiles writes the settings, mapping and ads files used by the tests
+func writeBootstrapFiles(t *testing.T, ads string) (settings, mapping, adsPath string) {
+	dir := t.TempDir()
+	settings = filepath.Join(dir, "settings.json")
+	mapping = filepath.Join(dir, "mapping.json")
+	adsPath = filepath.Join(dir, "ads.ndjson")
+	assert.NoError(t, ioutil.WriteFile(settings, []byte(`{"settings": {}}`), 0600))
+	assert.NoError(t, ioutil.WriteFile(mapping, []byte(`{"properties": {}}`), 0600))
+	assert.NoError(t, ioutil.WriteFile(adsPath, []byte(ads), 0600))
+	return
+}
+
+func newTestIndexBootstrap(admin IndexAdmin) *IndexBootstrap {
+	logger := &MockLoggerInfrastructure{}
+	logger.On("Info").Maybe()
+	logger.On("Error").Maybe()
+	return NewIndexBootstrap(admin, logger)
+}
+
+func TestIndexBootstrapRun(t *testing.T) {
+	settings, mapping, adsPath := writeBootstrapFiles(t, "{\"adId\": 1}\n{\"adId\": 2}\n")
+	admin := &mockIndexAdmin{}
+	admin.On("ListIndices", "ads_v*").Return([]string{"ads_v1", "ads_v3", "ads_vtmp"}, nil)
+	admin.On("CreateIndex", "ads_v4", `{"settings": {}}`).Return(nil)
+	admin.On("PutMapping", `{"properties": {}}`, "ads_v4").Return(nil)
+	admin.On("Bulk", []ElasticItem{
+		{ID: "1", Data: json.RawMessage(`{"adId": 1}`)},
+		{ID: "2", Data: json.RawMessage(`{"adId": 2}`)},
+	}, "ads_v4", "index").Return(nil)
+	admin.On("Count", "ads_v4").Return(2, nil)
+	admin.On("SetAlias", "ads", "ads_v4").Return(nil)
+
+	index, err := newTestIndexBootstrap(admin).Run("ads", settings, mapping, adsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "ads_v4", index)
+	admin.AssertExpectations(t)
+}
+
+func TestIndexBootstrapRunBulkError(t *testing.T) {
+	settings, mapping, adsPath := writeBootstrapFiles(t, `{"adId": 1}`)
+	bulkErr := &BulkError{Total: 1, Failed: []BulkItemError{{ID: "1", Status: 400}}}
+	admin := &mockIndexAdmin{}
+	admin.On("ListIndices", "ads_v*").Return([]string{}, nil)
+	admin.On("CreateIndex", "ads_v1", mock.Anything).Return(nil)
+	admin.On("PutMapping", mock.Anything, "ads_v1").Return(nil)
+	admin.On("Bulk", mock.Anything, "ads_v1", "index").Return(bulkErr)
+
+	index, err := newTestIndexBootstrap(admin).Run("ads", settings, mapping, adsPath)
+	assert.Equal(t, bulkErr, err)
+	assert.Equal(t, "ads_v1", index)
+	admin.AssertNotCalled(t, "SetAlias", mock.Anything, mock.Anything)
+}
+
+func TestIndexBootstrapRunCreateError(t *testing.T) {
+	settings, mapping, adsPath := writeBootstrapFiles(t, `{"adId": 1}`)
+	admin := &mockIndexAdmin{}
+	admin.On("ListIndices", "ads_v*").Return([]string{}, nil)
+	admin.On("CreateIndex", "ads_v1", mock.Anything).Return(errors.New("cannot create index"))
+
+	_, err := newTestIndexBootstrap(admin).Run("ads", settings, mapping, adsPath)
+	assert.EqualError(t, err, "cannot create index")
+	admin.AssertNotCalled(t, "Bulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIndexBootstrapRunInvalidAds(t *testing.T) {
+	settings, mapping, adsPath := writeBootstrapFiles(t, `{"listId": 1}`)
+	admin := &mockIndexAdmin{}
+
+	_, err := newTestIndexBootstrap(admin).Run("ads", settings, mapping, adsPath)
+	assert.Error(t, err)
+	admin.AssertNotCalled(t, "CreateIndex", mock.Anything, mock.Anything)
+}
+
+func TestIndexBootstrapReindexCopy(t *testing.T) {
+	settings, mapping, _ := writeBootstrapFiles(t, "")
+	admin := &mockIndexAdmin{}
+	admin.On("AliasIndices", "ads").Return([]string{"ads_v3"}, nil)
+	admin.On("ShardSettings", "ads_v3").Return(ShardSettings{Shards: 3, Replicas: 2}, nil)
+	admin.On("ListIndices", "ads_v*").Return([]string{"ads_v3", "ads_v1", "ads_v2"}, nil)
+	admin.On("CreateIndex", "ads_v4", `{"settings":{"index":{"number_of_replicas":2,"number_of_shards":3}}}`).Return(nil)
+	admin.On("PutMapping", `{"properties": {}}`, "ads_v4").Return(nil)
+	admin.On("Reindex", "ads_v3", "ads_v4").Return(nil)
+	admin.On("Count", "ads_v3").Return(120, nil)
+	admin.On("Count", "ads_v4").Return(120, nil)
+	admin.On("SetAlias", "ads", "ads_v4").Return(nil)
+	admin.On("DeleteIndex", "ads_v1").Return(nil)
+	admin.On("DeleteIndex", "ads_v2").Return(errors.New("cannot delete index"))
+	events := &mockMetricsEvents{}
+	events.On("CollectEvent", "elasticsearch", "reindex", "success")
+
+	bootstrap := newTestIndexBootstrap(admin)
+	bootstrap.SetMetrics(events)
+	index, err := bootstrap.Reindex(ReindexRequest{
+		Alias: "ads", SettingsPath: settings, MappingPath: mapping, Keep: 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ads_v4", index)
+	admin.AssertExpectations(t)
+	admin.AssertNotCalled(t, "DeleteIndex", "ads_v3")
+	events.AssertExpectations(t)
+}
+
+func TestIndexBootstrapReindexCountMismatch(t *testing.T) {
+	settings, mapping, _ := writeBootstrapFiles(t, "")
+	admin := &mockIndexAdmin{}
+	admin.On("AliasIndices", "ads").Return([]string{"ads_v1"}, nil)
+	admin.On("ShardSettings", "ads_v1").Return(ShardSettings{Shards: 1, Replicas: 1}, nil)
+	admin.On("ListIndices", "ads_v*").Return([]string{"ads_v1"}, nil)
+	admin.On("CreateIndex", "ads_v2", mock.Anything).Return(nil)
+	admin.On("PutMapping", mock.Anything, "ads_v2").Return(nil)
+	admin.On("Reindex", "ads_v1", "ads_v2").Return(nil)
+	admin.On("Count", "ads_v1").Return(120, nil)
+	admin.On("Count", "ads_v2").Return(118, nil)
+	events := &mockMetricsEvents{}
+	events.On("CollectEvent", "elasticsearch", "reindex", "count_mismatch")
+
+	bootstrap := newTestIndexBootstrap(admin)
+	bootstrap.SetMetrics(events)
+	index, err := bootstrap.Reindex(ReindexRequest{
+		Alias: "ads", SettingsPath: settings, MappingPath: mapping, Keep: 0,
+	})
+	assert.EqualError(t, err, "index ads_v2 has 118 documents, expected 120")
+	assert.Equal(t, "ads_v2", index)
+	admin.AssertNotCalled(t, "SetAlias", mock.Anything, mock.Anything)
+	admin.AssertNotCalled(t, "DeleteIndex", mock.Anything)
+	events.AssertExpectations(t)
+}
+
+func TestIndexBootstrapReindexCountsSourceFirst(t *testing.T) {
+	settings, mapping, _ := writeBootstrapFiles(t, "")
+	admin := &mockIndexAdmin{}
+	admin.On("AliasIndices", "ads").Return([]string{"ads_v1"}, nil)
+	admin.On("ShardSettings", "ads_v1").Return(ShardSettings{Shards: 1, Replicas: 1}, nil)
+	admin.On("ListIndices", "ads_v*").Return([]string{"ads_v1"}, nil)
+	admin.On("CreateIndex", "ads_v2", mock.Anything).Return(nil)
+	admin.On("PutMapping", mock.Anything, "ads_v2").Return(nil)
+	admin.On("Count", "ads_v1").Return(120, nil).Once()
+	// the source is counted before the copy starts
+	admin.On("Reindex", "ads_v1", "ads_v2").Return(nil).Run(func(mock.Arguments) {
+		admin.AssertCalled(t, "Count", "ads_v1")
+	})
+	admin.On("Count", "ads_v2").Return(120, nil)
+	admin.On("SetAlias", "ads", "ads_v2").Return(nil)
+
+	index, err := newTestIndexBootstrap(admin).Reindex(ReindexRequest{
+		Alias: "ads", SettingsPath: settings, MappingPath: mapping, Keep: -1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ads_v2", index)
+	admin.AssertExpectations(t)
+}
+
+func TestIndexBootstrapReindexWithoutAlias(t *testing.T) {
+	settings, mapping, _ := writeBootstrapFiles(t, "")
+	admin := &mockIndexAdmin{}
+	admin.On("AliasIndices", "ads").Return([]string{}, nil)
+	events := &mockMetricsEvents{}
+	events.On("CollectEvent", "elasticsearch", "reindex", "error")
+
+	bootstrap := newTestIndexBootstrap(admin)
+	bootstrap.SetMetrics(events)
+	_, err := bootstrap.Reindex(ReindexRequest{Alias: "ads", SettingsPath: settings, MappingPath: mapping})
+	assert.EqualError(t, err, "alias ads points to 0 indices, expected one to copy from")
+	admin.AssertNotCalled(t, "CreateIndex", mock.Anything, mock.Anything)
+	events.AssertExpectations(t)
+}
+
+func TestIndexBootstrapReindexShardSettingsError(t *testing.T) {
+	settings, mapping, _ := writeBootstrapFiles(t, "")
+	admin := &mockIndexAdmin{}
+	admin.On("AliasIndices", "ads").Return([]string{"ads_v1"}, nil)
+	admin.On("ShardSettings", "ads_v1").Return(ShardSettings{}, errors.New("cannot get settings"))
+
+	_, err := newTestIndexBootstrap(admin).Reindex(ReindexRequest{Alias: "ads", SettingsPath: settings, MappingPath: mapping})
+	assert.EqualError(t, err, "cannot get settings")
+	admin.AssertNotCalled(t, "CreateIndex", mock.Anything, mock.Anything)
+}
+
+func TestReadAdsFile(t *testing.T) {
+	ads, err := ReadAdsFile("testdata/memory_ads.json")
+	assert.NoError(t, err)
+	assert.Len(t, ads, 5)
+	assert.Equal(t, "1", ads[0].ID)
+
+	path := filepath.Join(t.TempDir(), "ads.ndjson")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{\"adId\": 7}\n\n{\"adId\": \"8\"}\n"), 0600))
+	ads, err = ReadAdsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []ElasticItem{
+		{ID: "7", Data: json.RawMessage(`{"adId": 7}`)},
+		{ID: "8", Data: json.RawMessage(`{"adId": "8"}`)},
+	}, ads)
+}
+
+func TestReadAdsFileErrors(t *testing.T) {
+	_, err := ReadAdsFile("testdata/missing.ndjson")
+	assert.True(t, os.IsNotExist(err))
+
+	path := filepath.Join(t.TempDir(), "ads.ndjson")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{\"adId\": 7}\n{\"adId\": "), 0600))
+	_, err = ReadAdsFile(path)
+	assert.Error(t, err)
+}
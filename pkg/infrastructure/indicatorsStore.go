@@ -0,0 +1,189 @@
+package infrastructure
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indicatorDateLayout is the layout used to store indicator dates
+const indicatorDateLayout = "2006-01-02"
+
+// IndicatorValue represents the value of an indicator on a given date
+type IndicatorValue struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+}
+
+// IndicatorsFileStore keeps indicator values in memory sorted by date and
+// persists them as json in the given path, so the last known values survive
+// service restarts. When path is empty values are only kept in memory
+type IndicatorsFileStore struct {
+	path   string
+	mutex  sync.RWMutex
+	values map[string][]IndicatorValue
+}
+
+// NewIndicatorsFileStore creates a new IndicatorsFileStore loading the values
+// previously persisted in path, if any
+func NewIndicatorsFileStore(path string) (*IndicatorsFileStore, error) {
+	store := &IndicatorsFileStore{
+		path:   path,
+		values: make(map[string][]IndicatorValue),
+	}
+	if path == "" {
+		return store, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return store, nil
+	}
+	return store, store.LoadTable(path)
+}
+
+// LoadTable loads a historical indicators table from a json or csv file.
+// Json files must use the same format the store persists, a map of indicator
+// codes to a list of date and value objects. Csv files must contain code, date
+// and value columns, ex: uf,2021-01-21,29095.61. The csv header is optional.
+// The table is merged on a copy of the stored values, which replaces them
+// only once every row is valid
+func (s *IndicatorsFileStore) LoadTable(path string) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close() // nolint: errcheck
+	var table map[string][]IndicatorValue
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		table, err = readIndicatorsCSV(file)
+	} else {
+		err = json.NewDecoder(file).Decode(&table)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot load indicators table %s: %+v", path, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	merged := make(map[string][]IndicatorValue, len(s.values))
+	for code, values := range s.values {
+		merged[code] = append([]IndicatorValue(nil), values...)
+	}
+	for code, values := range table {
+		for _, value := range values {
+			date, err := time.Parse(indicatorDateLayout, value.Date)
+			if err != nil {
+				return fmt.Errorf("invalid date %s for indicator %s", value.Date, code)
+			}
+			setIndicatorValue(merged, strings.ToLower(code), date, value.Value)
+		}
+	}
+	s.values = merged
+	return nil
+}
+
+// Save stores the value of an indicator for the given date and persists the
+// store content. Saving a value that is already stored does nothing
+func (s *IndicatorsFileStore) Save(code string, date time.Time, value float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.set(code, date, value) || s.path == "" {
+		return nil
+	}
+	return s.persist()
+}
+
+// Get returns the value of an indicator for the given date. If there is no
+// value for that exact date, the closest previous value is returned along
+// with the date it belongs to
+func (s *IndicatorsFileStore) Get(code string, date time.Time) (float64, time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	values := s.values[code]
+	key := date.Format(indicatorDateLayout)
+	// values are sorted, look for the first value after the requested date
+	i := sort.Search(len(values), func(i int) bool {
+		return values[i].Date > key
+	})
+	if i == 0 {
+		return 0, time.Time{}, fmt.Errorf("no stored value for indicator %s on %s", code, key)
+	}
+	found, _ := time.Parse(indicatorDateLayout, values[i-1].Date)
+	return values[i-1].Value, found, nil
+}
+
+// set inserts or updates a value keeping the dates sorted. It returns true
+// when the store content changed. Must be called holding the lock
+func (s *IndicatorsFileStore) set(code string, date time.Time, value float64) bool {
+	return setIndicatorValue(s.values, code, date, value)
+}
+
+// setIndicatorValue inserts or updates a value of table keeping the dates
+// sorted. It returns true when the table changed
+func setIndicatorValue(table map[string][]IndicatorValue, code string, date time.Time, value float64) bool {
+	values := table[code]
+	key := date.Format(indicatorDateLayout)
+	i := sort.Search(len(values), func(i int) bool {
+		return values[i].Date >= key
+	})
+	if i < len(values) && values[i].Date == key {
+		if values[i].Value == value {
+			return false
+		}
+		values[i].Value = value
+		return true
+	}
+	values = append(values, IndicatorValue{})
+	copy(values[i+1:], values[i:])
+	values[i] = IndicatorValue{Date: key, Value: value}
+	table[code] = values
+	return true
+}
+
+// persist writes the store content in a temporary file and then moves it to
+// the store path, so a failure never leaves a corrupted file behind.
+// Must be called holding the lock
+func (s *IndicatorsFileStore) persist() error {
+	content, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil { // nolint: gomnd
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// readIndicatorsCSV parses csv rows with code, date and value columns
+func readIndicatorsCSV(reader io.Reader) (map[string][]IndicatorValue, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = 3
+	csvReader.TrimLeadingSpace = true
+	table := make(map[string][]IndicatorValue)
+	for line := 1; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			// the first line may be a header
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("invalid value on line %d: %s", line, record[2])
+		}
+		table[record[0]] = append(table[record[0]], IndicatorValue{Date: record[1], Value: value})
+	}
+}
@@ -0,0 +1,105 @@
+package infrastructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndicatorsFileStoreSaveAndReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "indicators")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "indicators.json")
+	date, _ := time.Parse(indicatorDateLayout, "2021-01-21")
+
+	store, err := NewIndicatorsFileStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save("uf", date, 29095.61))
+
+	reloaded, err := NewIndicatorsFileStore(path)
+	assert.NoError(t, err)
+	value, found, err := reloaded.Get("uf", date.Add(48*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 29095.61, value)
+	assert.Equal(t, date, found)
+}
+
+func TestIndicatorsFileStoreGetClosestPrevious(t *testing.T) {
+	store, _ := NewIndicatorsFileStore("")
+	first, _ := time.Parse(indicatorDateLayout, "2021-01-20")
+	second, _ := time.Parse(indicatorDateLayout, "2021-01-22")
+	assert.NoError(t, store.Save("uf", second, 2))
+	assert.NoError(t, store.Save("uf", first, 1))
+
+	value, found, err := store.Get("uf", second.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value)
+	assert.Equal(t, first, found)
+
+	_, _, err = store.Get("uf", first.Add(-24*time.Hour))
+	assert.Error(t, err)
+	_, _, err = store.Get("utm", second)
+	assert.Error(t, err)
+}
+
+func TestIndicatorsFileStoreLoadCSV(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "indicators")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uf.csv")
+	content := "code,date,value\nuf,2021-01-21,29095.61\nUF,2021-01-22,29100\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	store, _ := NewIndicatorsFileStore("")
+	assert.NoError(t, store.LoadTable(path))
+	date, _ := time.Parse(indicatorDateLayout, "2021-01-22")
+	value, _, err := store.Get("uf", date)
+	assert.NoError(t, err)
+	assert.Equal(t, 29100.0, value)
+}
+
+func TestIndicatorsFileStoreLoadInvalidCSV(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "indicators")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uf.csv")
+	content := "uf,2021-01-21,29095.61\nuf,2021-01-22,none\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	store, _ := NewIndicatorsFileStore("")
+	assert.Error(t, store.LoadTable(path))
+}
+
+func TestIndicatorsFileStoreLoadJSON(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "indicators")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uf.json")
+	content := `{"uf": [{"date": "2021-01-21", "value": 29095.61}]}`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	store, _ := NewIndicatorsFileStore("")
+	assert.NoError(t, store.LoadTable(path))
+	date, _ := time.Parse(indicatorDateLayout, "2021-01-21")
+	value, _, err := store.Get("uf", date)
+	assert.NoError(t, err)
+	assert.Equal(t, 29095.61, value)
+}
+
+func TestIndicatorsFileStoreLoadInvalidDateKeepsValues(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "indicators")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uf.csv")
+	content := "uf,2021-01-21,30000\nuf,21-01-2021,31000\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	store, _ := NewIndicatorsFileStore("")
+	date, _ := time.Parse(indicatorDateLayout, "2021-01-21")
+	assert.NoError(t, store.Save("uf", date, 29095.61))
+	assert.Error(t, store.LoadTable(path))
+	// the stored values are not replaced by a partially loaded table
+	value, _, err := store.Get("uf", date)
+	assert.NoError(t, err)
+	assert.Equal(t, 29095.61, value)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/Yapo/goutils"
 	"gopkg.in/gorilla/mux.v1"
 
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
 )
 
@@ -111,6 +112,15 @@ type inputHandler struct {
 	output       handlers.HandlerInput
 }
 
+// fieldErrors are the invalid fields found on a request. They are kept per
+// Input call since the input handler is shared by the requests of a route
+type fieldErrors []handlers.FieldError
+
+// add reports an invalid input field
+func (errs *fieldErrors) add(field, message string) {
+	*errs = append(*errs, handlers.FieldError{Field: field, Message: message})
+}
+
 // NewInputHandler returns a new InputHandler
 func NewInputHandler() handlers.InputHandler {
 	return &inputHandler{}
@@ -139,16 +149,15 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 	}
 
 	hasError := false
+	var invalid fieldErrors
 	for _, output := range ih.inputRequest.outputs {
 		reflectedOutput := reflect.ValueOf(output.out)
 		for _, source := range output.sources {
 			switch source {
 			case BODY:
-				hasError = hasError ||
-					goutils.ParseJSONBody(
-						ih.inputRequest.httpRequest,
-						output.out,
-					) != nil
+				if goutils.ParseJSONBody(ih.inputRequest.httpRequest, output.out) != nil {
+					invalid.add(string(BODY), "must be a valid json")
+				}
 			case RAWBODY:
 				rawBody, err := ioutil.ReadAll(ih.inputRequest.httpRequest.Body)
 				ih.inputRequest.httpRequest.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
@@ -157,6 +166,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						map[string]string{"body": string(rawBody)},
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			case QUERY:
 				hasError = hasError ||
@@ -164,6 +174,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						ih.httpValuesToMap(ih.inputRequest.httpRequest.URL.Query()),
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			case PATH:
 				hasError = hasError ||
@@ -171,6 +182,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						mux.Vars(ih.inputRequest.httpRequest),
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			case HEADERS:
 				hasError = hasError ||
@@ -178,6 +190,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						ih.httpValuesToMap(ih.inputRequest.httpRequest.Header),
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			case COOKIES:
 				hasError = hasError ||
@@ -185,6 +198,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						ih.httpCookiesToMap(ih.inputRequest.httpRequest.Cookies()),
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			case FORM:
 				hasError = hasError ||
@@ -192,6 +206,7 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 						ih.formToMap(ih.inputRequest.httpRequest.Body),
 						source,
 						reflectedOutput,
+						&invalid,
 					) != nil
 			}
 		}
@@ -205,6 +220,19 @@ func (ih *inputHandler) Input() (handlers.HandlerInput, *goutils.Response) { //n
 			},
 		}
 	}
+	for _, output := range ih.inputRequest.outputs {
+		invalid = append(invalid, validateInput(output.out)...)
+	}
+	if len(invalid) > 0 {
+		return ih.output, &goutils.Response{
+			Code: http.StatusBadRequest,
+			Body: &handlers.ErrorOutput{
+				ErrorMessage: "invalid input",
+				ErrorCode:    domain.ErrCodeInvalidInput,
+				Fields:       invalid,
+			},
+		}
+	}
 	return ih.output, nil
 }
 
@@ -234,7 +262,12 @@ func (ih *inputHandler) formToMap(values io.Reader) map[string]string {
 	return mapBody
 }
 
-func (ih *inputHandler) parseInput(vars map[string]string, inputTag InputSource, input reflect.Value) error {
+func (ih *inputHandler) parseInput(
+	vars map[string]string,
+	inputTag InputSource,
+	input reflect.Value,
+	invalid *fieldErrors,
+) error {
 	if input.Kind() != reflect.Ptr {
 		return ErrNotPointer
 	}
@@ -252,7 +285,7 @@ func (ih *inputHandler) parseInput(vars map[string]string, inputTag InputSource,
 		if tag, ok := reflectedInput.Type().Field(i).Tag.Lookup(string(inputTag)); ok {
 			switch reflectedInput.Field(i).Kind() {
 			case reflect.Struct:
-				if ih.parseInput(vars, inputTag, reflectedInput.Field(i).Addr()) != nil {
+				if ih.parseInput(vars, inputTag, reflectedInput.Field(i).Addr(), invalid) != nil {
 					continue
 				}
 			case reflect.String:
@@ -260,6 +293,8 @@ func (ih *inputHandler) parseInput(vars map[string]string, inputTag InputSource,
 			case reflect.Int:
 				if value, err := strconv.Atoi(vars[tag]); err == nil {
 					reflectedInput.Field(i).Set(reflect.ValueOf(value))
+				} else if vars[tag] != "" {
+					invalid.add(tag, "must be an integer")
 				}
 			case reflect.Slice:
 				values := []string{}
@@ -278,6 +313,8 @@ func (ih *inputHandler) parseInput(vars map[string]string, inputTag InputSource,
 					for _, value := range values {
 						if val, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
 							intValues = append(intValues, val)
+						} else {
+							invalid.add(tag, "must be a list of integers")
 						}
 					}
 					reflectedInput.Field(i).Set(reflect.ValueOf(intValues))
@@ -1,12 +1,16 @@
 package infrastructure
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/Yapo/goutils"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/gorilla/mux.v1"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
 )
 
 func TestQueryParamsOK(t *testing.T) {
@@ -176,3 +180,53 @@ func TestEmptySourceOK(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, &expected, result2)
 }
+
+func TestQueryParamsValidationErr(t *testing.T) {
+	type input struct {
+		From  int `query:"from" validate:"min=0"`
+		Limit int `query:"limit"`
+	}
+
+	result := input{}
+	r := httptest.NewRequest("GET", "/api/v1?from=-1&limit=ten", nil)
+
+	inputHandler := NewInputHandler()
+	ri := inputHandler.NewInputRequest(r)
+	ri.Set(&result).FromQuery()
+
+	inputHandler.SetInputRequest(ri, &result)
+	_, response := inputHandler.Input()
+	expected := &goutils.Response{
+		Code: http.StatusBadRequest,
+		Body: &handlers.ErrorOutput{
+			ErrorMessage: "invalid input",
+			ErrorCode:    "INVALID_INPUT",
+			Fields: []handlers.FieldError{
+				{Field: "limit", Message: "must be an integer"},
+				{Field: "from", Message: "must be greater than or equal to 0"},
+			},
+		},
+	}
+	assert.Equal(t, expected, response)
+}
+
+func TestJsonBodyInvalidErr(t *testing.T) {
+	type input struct {
+		ID string `json:"id"`
+	}
+
+	result := input{}
+	r := httptest.NewRequest("POST", "/api/v1/", strings.NewReader(`{"id": `))
+
+	inputHandler := NewInputHandler()
+	ri := inputHandler.NewInputRequest(r)
+	ri.Set(&result).FromJSONBody()
+
+	inputHandler.SetInputRequest(ri, &result)
+	_, response := inputHandler.Input()
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t,
+		[]handlers.FieldError{{Field: "body", Message: "must be a valid json"}},
+		response.Body.(*handlers.ErrorOutput).Fields,
+	)
+}
@@ -0,0 +1,1173 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
+)
+
+// defaultDecay is the decay used by decay functions when it is not set
+const defaultDecay = 0.5
+
+// MemoryElasticHandler is an in memory stand-in of the elastic search
+// handler for local development and tests. It serves the ads of a json
+// fixture file, evaluating the subset of the query DSL used by the query
+// templates: bool, match, term, terms, range, exists, query_string,
+// geo_distance, the price script, more_like_this and function_score with
+// decay, field_value_factor and price script_score functions.
+// Scores are approximations: match and query_string count the matched
+// terms and more_like_this the terms shared with the liked ads
+type MemoryElasticHandler struct {
+	docs []map[string]interface{}
+	// ids maps the document ids, the ad id, to their position on docs
+	ids map[string]int
+	now func() time.Time
+}
+
+// memorySearch is the search request body
+type memorySearch struct {
+	Source      interface{}            `json:"_source"`
+	Query       map[string]interface{} `json:"query"`
+	Sort        []interface{}          `json:"sort"`
+	SearchAfter []interface{}          `json:"search_after"`
+}
+
+// memoryHit is a document matched by a search
+type memoryHit struct {
+	doc   map[string]interface{}
+	score float64
+	sort  []interface{}
+}
+
+// memorySort is a search sort field and its order
+type memorySort struct {
+	field string
+	desc  bool
+}
+
+// NewMemoryElasticHandler loads the fixture file, a json array with the ads
+// as they are stored on the index. Ads are identified by their adId
+func NewMemoryElasticHandler(fixture string) (*MemoryElasticHandler, error) {
+	content, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		return nil, err
+	}
+	var docs []map[string]interface{}
+	if err := json.Unmarshal(content, &docs); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", fixture, err)
+	}
+	handler := &MemoryElasticHandler{docs: docs, ids: make(map[string]int, len(docs)), now: time.Now}
+	for i, doc := range docs {
+		handler.ids[formatValue(doc["adId"])] = i
+	}
+	return handler, nil
+}
+
+// Info returns the name of the in memory handler
+func (m *MemoryElasticHandler) Info() (interface{}, error) {
+	return map[string]interface{}{
+		"name":    "memory",
+		"version": map[string]interface{}{"number": "memory"},
+		"count":   len(m.docs),
+	}, nil
+}
+
+// Create does nothing, the fixture is the only index
+func (m *MemoryElasticHandler) Create(index string) error {
+	return nil
+}
+
+// PutMapping does nothing, fields are typed by their fixture values
+func (m *MemoryElasticHandler) PutMapping(mapping []byte, index string) error {
+	return nil
+}
+
+// Search evaluates query on the fixture ads, decoding the response hits object in hits
+func (m *MemoryElasticHandler) Search(index, query string, size, from int, hits interface{}) error {
+	var request memorySearch
+	if err := json.Unmarshal([]byte(query), &request); err != nil {
+		return memoryQueryError("failed to parse search source: %s", err)
+	}
+	if size <= 0 {
+		size = 10
+	}
+	response, err := m.search(request, size, from)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(map[string]interface{}{"hits": response})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, hits)
+}
+
+// MultiSearch evaluates every search, returning the error of each one
+func (m *MemoryElasticHandler) MultiSearch(index string, searches []repository.SearchRequest) ([]error, error) {
+	errs := make([]error, len(searches))
+	for i, search := range searches {
+		errs[i] = m.Search(index, search.Query, search.Size, search.From, search.Hits)
+	}
+	return errs, nil
+}
+
+// search returns the page of hits matching the request, with their
+// filtered source and sort values
+func (m *MemoryElasticHandler) search(request memorySearch, size, from int) ([]map[string]interface{}, error) {
+	var hits []memoryHit
+	for _, doc := range m.docs {
+		matches, score, err := m.evaluate(request.Query, doc)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			hits = append(hits, memoryHit{doc: doc, score: score})
+		}
+	}
+	sorts, err := parseSorts(request.Sort)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		for _, s := range sorts {
+			hits[i].sort = append(hits[i].sort, sortValue(hits[i], s.field))
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSortValues(hits[i].sort, hits[j].sort, sorts) < 0
+	})
+	if len(request.SearchAfter) > 0 {
+		if len(request.SearchAfter) != len(sorts) {
+			return nil, memoryQueryError("search_after has %d values but sort has %d", len(request.SearchAfter), len(sorts))
+		}
+		from = sort.Search(len(hits), func(i int) bool {
+			return compareSortValues(hits[i].sort, request.SearchAfter, sorts) > 0
+		})
+	}
+	includes := sourceIncludes(request.Source)
+	out := make([]map[string]interface{}, 0, size)
+	for i := from; i < len(hits) && len(out) < size; i++ {
+		out = append(out, map[string]interface{}{
+			"_source": filterSource(hits[i].doc, includes),
+			"sort":    hits[i].sort,
+		})
+	}
+	return out, nil
+}
+
+// evaluate returns if the document matches the query and its score
+func (m *MemoryElasticHandler) evaluate(query map[string]interface{}, doc map[string]interface{}) (bool, float64, error) {
+	if len(query) == 0 {
+		return true, 1, nil
+	}
+	if len(query) > 1 {
+		return false, 0, memoryQueryError("query has more than one type: %v", sortedQueryTypes(query))
+	}
+	for kind, value := range query {
+		body, ok := value.(map[string]interface{})
+		if !ok {
+			return false, 0, memoryQueryError("[%s] query malformed", kind)
+		}
+		switch kind {
+		case "match_all":
+			return true, 1, nil
+		case "match":
+			return evaluateMatch(body, doc)
+		case "term", "terms":
+			return evaluateTerm(body, doc)
+		case "range":
+			return m.evaluateRange(body, doc)
+		case "exists":
+			return len(lookupField(doc, formatValue(body["field"]))) > 0, 1, nil
+		case "bool":
+			return m.evaluateBool(body, doc)
+		case "query_string":
+			return evaluateQueryString(body, doc)
+		case "script":
+			return evaluatePriceScript(body, doc)
+		case "geo_distance":
+			return evaluateGeoDistance(body, doc)
+		case "more_like_this":
+			return m.evaluateMoreLikeThis(body, doc)
+		case "function_score":
+			return m.evaluateFunctionScore(body, doc)
+		default:
+			return false, 0, memoryQueryError("unknown query [%s]", kind)
+		}
+	}
+	return false, 0, nil
+}
+
+// evaluateBool requires every must and filter clause and none of the
+// must_not ones. When there are no must or filter clauses at least one
+// should clause is required. Must and should clauses add their scores
+func (m *MemoryElasticHandler) evaluateBool(body, doc map[string]interface{}) (bool, float64, error) {
+	musts, filters := queryClauses(body["must"]), queryClauses(body["filter"])
+	shoulds, mustsNot := queryClauses(body["should"]), queryClauses(body["must_not"])
+	var score float64
+	for _, clause := range append(musts, filters...) {
+		matches, clauseScore, err := m.evaluate(clause, doc)
+		if err != nil || !matches {
+			return false, 0, err
+		}
+		score += clauseScore
+	}
+	// filter clauses do not score
+	for _, clause := range filters {
+		_, clauseScore, _ := m.evaluate(clause, doc)
+		score -= clauseScore
+	}
+	for _, clause := range mustsNot {
+		matches, _, err := m.evaluate(clause, doc)
+		if err != nil || matches {
+			return false, 0, err
+		}
+	}
+	matchedShoulds := 0
+	for _, clause := range shoulds {
+		matches, clauseScore, err := m.evaluate(clause, doc)
+		if err != nil {
+			return false, 0, err
+		}
+		if matches {
+			matchedShoulds++
+			score += clauseScore
+		}
+	}
+	minimumShould := 0
+	if len(shoulds) > 0 && len(musts) == 0 && len(filters) == 0 {
+		minimumShould = 1
+	}
+	if value, ok := toNumber(body["minimum_should_match"]); ok {
+		minimumShould = int(value)
+	}
+	if matchedShoulds < minimumShould {
+		return false, 0, nil
+	}
+	// an empty bool, or with only must_not clauses, matches every document
+	if len(musts) == 0 && len(shoulds) == 0 && len(filters) == 0 {
+		score = 1
+	}
+	return true, score, nil
+}
+
+// evaluateMatch matches the documents sharing a term with the query,
+// scored by the number of shared terms. Keyword fields require the
+// whole value to be equal
+func evaluateMatch(body, doc map[string]interface{}) (bool, float64, error) {
+	for field, value := range body {
+		if conf, ok := value.(map[string]interface{}); ok {
+			value = conf["query"]
+		}
+		values := lookupField(doc, field)
+		if strings.HasSuffix(field, ".keyword") {
+			return containsValue(values, value, false), 1, nil
+		}
+		shared := sharedTerms(tokenize(formatValue(value)), values)
+		return shared > 0, float64(shared), nil
+	}
+	return false, 0, nil
+}
+
+// evaluateTerm matches the documents with a field equal to the value, or
+// to any of the values on terms queries
+func evaluateTerm(body, doc map[string]interface{}) (bool, float64, error) {
+	for field, value := range body {
+		if conf, ok := value.(map[string]interface{}); ok {
+			value = conf["value"]
+		}
+		candidates, ok := value.([]interface{})
+		if !ok {
+			candidates = []interface{}{value}
+		}
+		values := lookupField(doc, field)
+		for _, candidate := range candidates {
+			if containsValue(values, candidate, !strings.HasSuffix(field, ".keyword")) {
+				return true, 1, nil
+			}
+		}
+		return false, 0, nil
+	}
+	return false, 0, nil
+}
+
+// evaluateRange matches the documents with a value between the bounds.
+// Dates are compared in epoch milliseconds
+func (m *MemoryElasticHandler) evaluateRange(body, doc map[string]interface{}) (bool, float64, error) {
+	for field, value := range body {
+		bounds, ok := value.(map[string]interface{})
+		if !ok {
+			return false, 0, memoryQueryError("[range] query malformed on field [%s]", field)
+		}
+		limits := make(map[string]float64)
+		for _, op := range []string{"gt", "gte", "lt", "lte"} {
+			if bound, ok := bounds[op]; ok && bound != nil {
+				limit, ok := m.rangeValue(bound)
+				if !ok {
+					return false, 0, memoryQueryError("[range] invalid %s value [%v] on field [%s]", op, bound, field)
+				}
+				limits[op] = limit
+			}
+		}
+		for _, docValue := range lookupField(doc, field) {
+			number, ok := m.rangeValue(docValue)
+			if ok && inRange(number, limits) {
+				return true, 1, nil
+			}
+		}
+		return false, 0, nil
+	}
+	return false, 0, nil
+}
+
+// rangeValue returns a number, or a date in epoch milliseconds
+func (m *MemoryElasticHandler) rangeValue(value interface{}) (float64, bool) {
+	if number, ok := toNumber(value); ok {
+		return number, true
+	}
+	if date, ok := m.parseDate(formatValue(value)); ok {
+		return float64(date.UnixNano() / int64(time.Millisecond)), true
+	}
+	return 0, false
+}
+
+// inRange reports if number satisfies every limit
+func inRange(number float64, limits map[string]float64) bool {
+	if limit, ok := limits["gt"]; ok && number <= limit {
+		return false
+	}
+	if limit, ok := limits["gte"]; ok && number < limit {
+		return false
+	}
+	if limit, ok := limits["lt"]; ok && number >= limit {
+		return false
+	}
+	if limit, ok := limits["lte"]; ok && number > limit {
+		return false
+	}
+	return true
+}
+
+// evaluateQueryString matches the documents sharing a term with the query
+// on the default field, or on any field when it is not set. Operators are
+// ignored, so terms are always optional
+func evaluateQueryString(body, doc map[string]interface{}) (bool, float64, error) {
+	field := formatValue(body["default_field"])
+	shared := 0
+	for _, term := range strings.FieldsFunc(formatValue(body["query"]), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}) {
+		if term == "AND" || term == "OR" || term == "NOT" {
+			continue
+		}
+		termField := field
+		if idx := strings.Index(term, ":"); idx > 0 {
+			termField, term = term[:idx], term[idx+1:]
+		}
+		var values []interface{}
+		if termField == "" || termField == "*" {
+			values = allValues(doc)
+		} else {
+			values = lookupField(doc, termField)
+		}
+		shared += sharedTerms(tokenize(strings.Trim(term, "*?")), values)
+	}
+	return shared > 0, float64(shared), nil
+}
+
+// evaluatePriceScript evaluates the price range script, the only script
+// the query templates use as a filter
+func evaluatePriceScript(body, doc map[string]interface{}) (bool, float64, error) {
+	script, _ := body["script"].(map[string]interface{})
+	params, _ := script["params"].(map[string]interface{})
+	priceMin, okMin := toNumber(params["priceMin"])
+	priceMax, okMax := toNumber(params["priceMax"])
+	if !okMin || !okMax {
+		return false, 0, memoryQueryError("unsupported script, only the price range script is evaluated")
+	}
+	price, ok := convertedPrice(doc, params)
+	return ok && price >= priceMin && price <= priceMax, 1, nil
+}
+
+// convertedPrice returns the document price converted to the base currency
+// using the script rates
+func convertedPrice(doc, params map[string]interface{}) (float64, bool) {
+	prices := lookupField(doc, "price")
+	currencies := lookupField(doc, "params.currency.value")
+	if len(prices) == 0 || len(currencies) == 0 {
+		return 0, false
+	}
+	price, okPrice := toNumber(prices[0])
+	rates, _ := params["rates"].(map[string]interface{})
+	rate, okRate := toNumber(rates[strings.ToLower(formatValue(currencies[0]))])
+	base, okBase := toNumber(params["base"])
+	if !okPrice || !okRate || !okBase || base == 0 {
+		return 0, false
+	}
+	return price * rate / base, true
+}
+
+// evaluateGeoDistance matches the documents located within the distance
+func evaluateGeoDistance(body, doc map[string]interface{}) (bool, float64, error) {
+	distance, ok := parseDistance(formatValue(body["distance"]))
+	if !ok {
+		return false, 0, memoryQueryError("[geo_distance] invalid distance [%v]", body["distance"])
+	}
+	for field, value := range body {
+		if field == "distance" || field == "distance_type" || field == "validation_method" {
+			continue
+		}
+		origin, ok := parseGeoPoint(value)
+		if !ok {
+			return false, 0, memoryQueryError("[geo_distance] invalid origin [%v]", value)
+		}
+		for _, docValue := range lookupField(doc, field) {
+			if point, ok := parseGeoPoint(docValue); ok && origin.DistanceTo(point) <= distance {
+				return true, 1, nil
+			}
+		}
+		return false, 0, nil
+	}
+	return false, 0, memoryQueryError("[geo_distance] field is missing")
+}
+
+// evaluateMoreLikeThis matches the documents sharing terms with the liked
+// ads or texts on the given fields. Terms are selected by frequency up to
+// max_query_terms, min_doc_freq is ignored since fixtures are small.
+// At least 30% of the selected terms must be shared, like elasticsearch
+// does by default. Liked ads are never matched
+func (m *MemoryElasticHandler) evaluateMoreLikeThis(body, doc map[string]interface{}) (bool, float64, error) {
+	fields := getStringSlice(body["fields"])
+	frequencies := make(map[string]int)
+	likes, ok := body["like"].([]interface{})
+	if !ok {
+		likes = []interface{}{body["like"]}
+	}
+	for _, like := range likes {
+		item, ok := like.(map[string]interface{})
+		if !ok {
+			for _, term := range tokenize(formatValue(like)) {
+				frequencies[term]++
+			}
+			continue
+		}
+		position, found := m.ids[formatValue(item["_id"])]
+		if !found {
+			continue
+		}
+		liked := m.docs[position]
+		if formatValue(liked["adId"]) == formatValue(doc["adId"]) {
+			return false, 0, nil
+		}
+		for _, value := range fieldsValues(liked, fields) {
+			for _, term := range tokenize(formatValue(value)) {
+				frequencies[term]++
+			}
+		}
+	}
+	terms := selectTerms(frequencies, body)
+	if len(terms) == 0 {
+		return false, 0, nil
+	}
+	shared := sharedTerms(terms, fieldsValues(doc, fields))
+	minimum := int(math.Max(1, math.Floor(float64(len(terms))*0.3))) // nolint: gomnd
+	return shared >= minimum, float64(shared), nil
+}
+
+// selectTerms returns the most frequent terms, the ones below
+// min_term_freq are discarded
+func selectTerms(frequencies map[string]int, body map[string]interface{}) []string {
+	minTermFreq := 2
+	if value, ok := toNumber(body["min_term_freq"]); ok {
+		minTermFreq = int(value)
+	}
+	maxQueryTerms := 25
+	if value, ok := toNumber(body["max_query_terms"]); ok {
+		maxQueryTerms = int(value)
+	}
+	terms := make([]string, 0, len(frequencies))
+	for term, frequency := range frequencies {
+		if frequency >= minTermFreq {
+			terms = append(terms, term)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if frequencies[terms[i]] != frequencies[terms[j]] {
+			return frequencies[terms[i]] > frequencies[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > maxQueryTerms {
+		terms = terms[:maxQueryTerms]
+	}
+	return terms
+}
+
+// evaluateFunctionScore combines the query score with its functions score
+func (m *MemoryElasticHandler) evaluateFunctionScore(body, doc map[string]interface{}) (bool, float64, error) {
+	query, _ := body["query"].(map[string]interface{})
+	matches, score, err := m.evaluate(query, doc)
+	if err != nil || !matches {
+		return false, 0, err
+	}
+	functions := queryClauses(body["functions"])
+	var values []float64
+	for _, function := range functions {
+		if filter, ok := function["filter"].(map[string]interface{}); ok {
+			if filterMatches, _, err := m.evaluate(filter, doc); err != nil || !filterMatches {
+				if err != nil {
+					return false, 0, err
+				}
+				continue
+			}
+		}
+		value, err := m.functionValue(function, doc)
+		if err != nil {
+			return false, 0, err
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return true, score, nil
+	}
+	functionsScore := combineScores(formatValue(body["score_mode"]), values)
+	switch formatValue(body["boost_mode"]) {
+	case "replace":
+		score = functionsScore
+	case "sum":
+		score += functionsScore
+	case "avg":
+		score = (score + functionsScore) / 2
+	case "max":
+		score = math.Max(score, functionsScore)
+	case "min":
+		score = math.Min(score, functionsScore)
+	default:
+		score *= functionsScore
+	}
+	return true, score, nil
+}
+
+// functionValue returns the value of a score function multiplied by its weight
+func (m *MemoryElasticHandler) functionValue(function, doc map[string]interface{}) (float64, error) {
+	weight, hasWeight := toNumber(function["weight"])
+	if !hasWeight {
+		weight = 1
+	}
+	for kind, value := range function {
+		conf, _ := value.(map[string]interface{})
+		switch kind {
+		case "gauss", "linear", "exp":
+			decay, err := m.decayValue(kind, conf, doc)
+			return decay * weight, err
+		case "field_value_factor":
+			return fieldValueFactor(conf, doc) * weight, nil
+		case "script_score":
+			script, _ := conf["script"].(map[string]interface{})
+			params, _ := script["params"].(map[string]interface{})
+			decay, err := priceDecay(params, doc)
+			return decay * weight, err
+		case "weight", "filter":
+		default:
+			return 0, memoryQueryError("unknown function [%s]", kind)
+		}
+	}
+	return weight, nil
+}
+
+// decayValue evaluates a gauss, linear or exp decay function on a numeric,
+// date or geo_point field. Documents without the field score 1
+func (m *MemoryElasticHandler) decayValue(kind string, conf, doc map[string]interface{}) (float64, error) {
+	for field, value := range conf {
+		if field == "multi_value_mode" {
+			continue
+		}
+		params, _ := value.(map[string]interface{})
+		decay := defaultDecay
+		if number, ok := toNumber(params["decay"]); ok {
+			decay = number
+		}
+		docValues := lookupField(doc, field)
+		if len(docValues) == 0 {
+			return 1, nil
+		}
+		distance, scale, err := m.decayDistance(field, params, docValues)
+		if err != nil {
+			return 0, err
+		}
+		return decayFunction(kind, distance, scale, decay), nil
+	}
+	return 1, nil
+}
+
+// decayDistance returns the distance of the closest document value to the
+// origin, minus the offset, and the scale. Geo distances are in kilometers
+// and dates in milliseconds
+func (m *MemoryElasticHandler) decayDistance(
+	field string, params map[string]interface{}, docValues []interface{},
+) (distance, scale float64, err error) {
+	origin, offset, scaleValue := params["origin"], formatValue(params["offset"]), formatValue(params["scale"])
+	distance = math.Inf(1)
+	if point, ok := parseGeoPoint(origin); ok {
+		scale, okScale := parseDistance(scaleValue)
+		offsetValue, okOffset := parseDistance(offset)
+		if !okScale || (offset != "" && !okOffset) {
+			return 0, 0, memoryQueryError("[%s] invalid geo decay scale or offset", field)
+		}
+		for _, docValue := range docValues {
+			if docPoint, ok := parseGeoPoint(docValue); ok {
+				distance = math.Min(distance, point.DistanceTo(docPoint))
+			}
+		}
+		return math.Max(0, distance-offsetValue), scale, nil
+	}
+	if _, isDate := m.parseDate(formatValue(docValues[0])); isDate {
+		originDate := m.now()
+		if origin != nil {
+			var ok bool
+			if originDate, ok = m.parseDate(formatValue(origin)); !ok {
+				return 0, 0, memoryQueryError("[%s] invalid date origin [%v]", field, origin)
+			}
+		}
+		scaleDuration, okScale := parseDuration(scaleValue)
+		offsetDuration, okOffset := parseDuration(offset)
+		if !okScale || (offset != "" && !okOffset) {
+			return 0, 0, memoryQueryError("[%s] invalid date decay scale or offset", field)
+		}
+		for _, docValue := range docValues {
+			if date, ok := m.parseDate(formatValue(docValue)); ok {
+				distance = math.Min(distance, math.Abs(float64(date.Sub(originDate))))
+			}
+		}
+		return math.Max(0, distance-float64(offsetDuration)) / float64(time.Millisecond),
+			float64(scaleDuration) / float64(time.Millisecond), nil
+	}
+	originNumber, okOrigin := toNumber(origin)
+	scale, okScale := toNumber(scaleValue)
+	offsetNumber, _ := toNumber(offset)
+	if !okOrigin || !okScale {
+		return 0, 0, memoryQueryError("[%s] invalid numeric decay origin or scale", field)
+	}
+	for _, docValue := range docValues {
+		if number, ok := toNumber(docValue); ok {
+			distance = math.Min(distance, math.Abs(number-originNumber))
+		}
+	}
+	return math.Max(0, distance-offsetNumber), scale, nil
+}
+
+// decayFunction returns the score of a distance, which is decay when the
+// distance is equal to scale
+func decayFunction(kind string, distance, scale, decay float64) float64 {
+	if math.IsInf(distance, 1) || scale <= 0 {
+		return 1
+	}
+	switch kind {
+	case "linear":
+		s := scale / (1 - decay)
+		return math.Max(0, (s-distance)/s)
+	case "exp":
+		return math.Exp(math.Log(decay) * distance / scale)
+	default:
+		return math.Exp(math.Log(decay) * distance * distance / (scale * scale))
+	}
+}
+
+// priceDecay evaluates the price decay script: a gaussian decay over the
+// price range, prices that cannot be converted score the decay
+func priceDecay(params, doc map[string]interface{}) (float64, error) {
+	origin, okOrigin := toNumber(params["origin"])
+	priceMin, okMin := toNumber(params["priceMin"])
+	priceMax, okMax := toNumber(params["priceMax"])
+	decay, okDecay := toNumber(params["decay"])
+	if !okOrigin || !okMin || !okMax || !okDecay {
+		return 0, memoryQueryError("unsupported script_score, only the price decay script is evaluated")
+	}
+	price, ok := convertedPrice(doc, params)
+	if !ok {
+		return decay, nil
+	}
+	scale := priceMax - origin
+	if price < origin {
+		scale = origin - priceMin
+	}
+	if scale <= 0 {
+		if price == origin {
+			return 1, nil
+		}
+		return decay, nil
+	}
+	distance := price - origin
+	return math.Exp(math.Log(decay) * distance * distance / (scale * scale)), nil
+}
+
+// fieldValueFactor returns the field value multiplied by the factor and
+// modified, documents without the field use the missing value
+func fieldValueFactor(conf, doc map[string]interface{}) float64 {
+	value, ok := toNumber(conf["missing"])
+	if values := lookupField(doc, formatValue(conf["field"])); len(values) > 0 {
+		value, ok = toNumber(values[0])
+	}
+	if !ok {
+		return 1
+	}
+	if factor, ok := toNumber(conf["factor"]); ok {
+		value *= factor
+	}
+	switch formatValue(conf["modifier"]) {
+	case "log":
+		return math.Log10(value)
+	case "log1p":
+		return math.Log10(value + 1)
+	case "log2p":
+		return math.Log10(value + 2) // nolint: gomnd
+	case "ln":
+		return math.Log(value)
+	case "ln1p":
+		return math.Log1p(value)
+	case "ln2p":
+		return math.Log(value + 2) // nolint: gomnd
+	case "square":
+		return value * value
+	case "sqrt":
+		return math.Sqrt(value)
+	case "reciprocal":
+		return 1 / value
+	default:
+		return value
+	}
+}
+
+// combineScores combines the functions values using score_mode
+func combineScores(mode string, values []float64) float64 {
+	result := values[0]
+	for _, value := range values[1:] {
+		switch mode {
+		case "sum", "avg":
+			result += value
+		case "max":
+			result = math.Max(result, value)
+		case "min":
+			result = math.Min(result, value)
+		case "first":
+		default:
+			result *= value
+		}
+	}
+	if mode == "avg" {
+		result /= float64(len(values))
+	}
+	return result
+}
+
+// parseSorts returns the sort fields, _score descending by default
+func parseSorts(specs []interface{}) ([]memorySort, error) {
+	if len(specs) == 0 {
+		return []memorySort{{field: "_score", desc: true}}, nil
+	}
+	sorts := make([]memorySort, 0, len(specs))
+	for _, spec := range specs {
+		switch value := spec.(type) {
+		case string:
+			sorts = append(sorts, memorySort{field: value, desc: value == "_score"})
+		case map[string]interface{}:
+			for field, order := range value {
+				if conf, ok := order.(map[string]interface{}); ok {
+					order = conf["order"]
+				}
+				sorts = append(sorts, memorySort{field: field, desc: formatValue(order) == "desc"})
+			}
+		default:
+			return nil, memoryQueryError("invalid sort [%v]", spec)
+		}
+	}
+	return sorts, nil
+}
+
+// sortValue returns the hit value of a sort field, nil when it is missing
+func sortValue(hit memoryHit, field string) interface{} {
+	if field == "_score" {
+		return hit.score
+	}
+	if values := lookupField(hit.doc, field); len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// compareSortValues compares two hits by their sort values, missing values go last
+func compareSortValues(a, b []interface{}, sorts []memorySort) int {
+	for i, s := range sorts {
+		if i >= len(a) || i >= len(b) {
+			return 0
+		}
+		if a[i] == nil || b[i] == nil {
+			if a[i] == nil && b[i] != nil {
+				return 1
+			} else if a[i] != nil && b[i] == nil {
+				return -1
+			}
+			continue
+		}
+		result := compareValues(a[i], b[i])
+		if s.desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// compareValues compares numbers numerically and anything else as text
+func compareValues(a, b interface{}) int {
+	numberA, okA := toNumber(a)
+	numberB, okB := toNumber(b)
+	if okA && okB {
+		switch {
+		case numberA < numberB:
+			return -1
+		case numberA > numberB:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+// sourceIncludes returns the _source fields requested, nil for every field
+func sourceIncludes(source interface{}) []string {
+	switch value := source.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		return getStringSlice(value)
+	case map[string]interface{}:
+		return getStringSlice(value["includes"])
+	default:
+		return nil
+	}
+}
+
+// filterSource returns a copy of doc with only the included fields
+func filterSource(doc map[string]interface{}, includes []string) map[string]interface{} {
+	if len(includes) == 0 {
+		return doc
+	}
+	out := make(map[string]interface{})
+	for _, include := range includes {
+		copyPath(doc, out, strings.Split(include, "."))
+	}
+	return out
+}
+
+// copyPath copies the value on path from source to target
+func copyPath(source, target map[string]interface{}, path []string) {
+	value, ok := source[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		target[path[0]] = value
+		return
+	}
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	targetNested, ok := target[path[0]].(map[string]interface{})
+	if !ok {
+		targetNested = make(map[string]interface{})
+		target[path[0]] = targetNested
+	}
+	copyPath(nested, targetNested, path[1:])
+}
+
+// lookupField returns the values of a dotted field path, values inside
+// arrays are flattened. The keyword sub field is the field itself
+func lookupField(doc map[string]interface{}, field string) []interface{} {
+	values := []interface{}{doc}
+	for _, key := range strings.Split(strings.TrimSuffix(field, ".keyword"), ".") {
+		var next []interface{}
+		for _, value := range values {
+			if object, ok := value.(map[string]interface{}); ok {
+				next = appendFlattened(next, object[key])
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// appendFlattened appends value, or its elements when it is an array
+func appendFlattened(values []interface{}, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return values
+	case []interface{}:
+		for _, item := range v {
+			values = appendFlattened(values, item)
+		}
+		return values
+	default:
+		return append(values, v)
+	}
+}
+
+// allValues returns every scalar value of the document
+func allValues(value interface{}) (values []interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, nested := range v {
+			values = append(values, allValues(nested)...)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			values = append(values, allValues(nested)...)
+		}
+	case nil:
+	default:
+		values = append(values, v)
+	}
+	return
+}
+
+// fieldsValues returns the values of every field
+func fieldsValues(doc map[string]interface{}, fields []string) (values []interface{}) {
+	for _, field := range fields {
+		values = append(values, lookupField(doc, field)...)
+	}
+	return
+}
+
+// queryClauses returns the clauses of a bool occurrence or function list,
+// which may be a single object or an array of them
+func queryClauses(value interface{}) (clauses []map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		for _, item := range v {
+			if clause, ok := item.(map[string]interface{}); ok {
+				clauses = append(clauses, clause)
+			}
+		}
+	}
+	return
+}
+
+// containsValue reports if any of the values is equal to value, ignoring
+// case when foldCase is set
+func containsValue(values []interface{}, value interface{}, foldCase bool) bool {
+	expected := formatValue(value)
+	for _, candidate := range values {
+		actual := formatValue(candidate)
+		if actual == expected || foldCase && strings.EqualFold(actual, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedTerms counts the terms found on the values
+func sharedTerms(terms []string, values []interface{}) (shared int) {
+	found := make(map[string]bool)
+	for _, value := range values {
+		for _, term := range tokenize(formatValue(value)) {
+			found[term] = true
+		}
+	}
+	for _, term := range terms {
+		if found[term] {
+			shared++
+		}
+	}
+	return
+}
+
+// tokenize splits text in lowercase terms without accents, similar to
+// the standard analyzer with an ascii folding filter
+func tokenize(text string) []string {
+	return strings.FieldsFunc(specialChars.Replace(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// specialChars folds the accented characters to ascii
+var specialChars = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n") // nolint: gochecknoglobals
+
+// formatValue formats a json value as text, numbers without exponent
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toNumber converts a json number, or a string holding one, to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// getStringSlice returns the strings of a json array
+func getStringSlice(value interface{}) (out []string) {
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return
+}
+
+// parseDate parses a date, or date math relative to now such as now-1d/d.
+// Absolute dates may be RFC3339 or yyyy-MM-dd
+func (m *MemoryElasticHandler) parseDate(value string) (time.Time, bool) {
+	if !strings.HasPrefix(value, "now") {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, true
+			}
+		}
+		return time.Time{}, false
+	}
+	date := m.now().UTC()
+	expression := value[len("now"):]
+	for expression != "" {
+		op := expression[0]
+		end := strings.IndexAny(expression[1:], "+-/")
+		if end < 0 {
+			end = len(expression) - 1
+		}
+		operand := expression[1 : end+1]
+		expression = expression[end+1:]
+		switch op {
+		case '+', '-':
+			duration, ok := parseDuration(operand)
+			if !ok {
+				return time.Time{}, false
+			}
+			if op == '-' {
+				duration = -duration
+			}
+			date = date.Add(duration)
+		case '/':
+			// rounding units may have a leading number, as in now/1d
+			unit, ok := parseDuration("1" + strings.TrimLeft(operand, "0123456789"))
+			if !ok {
+				return time.Time{}, false
+			}
+			date = date.Truncate(unit)
+		default:
+			return time.Time{}, false
+		}
+	}
+	return date, true
+}
+
+// parseDuration parses an elasticsearch time value, ex: 30d, 12h, 500ms
+func parseDuration(value string) (time.Duration, bool) {
+	units := []struct {
+		suffix   string
+		duration time.Duration
+	}{
+		{"ms", time.Millisecond}, {"s", time.Second}, {"m", time.Minute},
+		{"h", time.Hour}, {"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil {
+				continue
+			}
+			return time.Duration(number * float64(unit.duration)), true
+		}
+	}
+	return 0, false
+}
+
+// parseDistance parses an elasticsearch distance in kilometers, ex: 10km, 500m
+func parseDistance(value string) (float64, bool) {
+	units := []struct {
+		suffix string
+		km     float64
+	}{
+		{"km", 1}, {"mi", 1.609344}, {"m", 0.001},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			return number * unit.km, err == nil
+		}
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return number / 1000, err == nil // nolint: gomnd
+}
+
+// parseGeoPoint parses a geo point given as "lat,lon" or as a lat lon object
+func parseGeoPoint(value interface{}) (domain.GeoPoint, bool) {
+	switch v := value.(type) {
+	case string:
+		parts := strings.Split(v, ",")
+		if len(parts) != 2 { // nolint: gomnd
+			return domain.GeoPoint{}, false
+		}
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lon, errLon := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		return domain.GeoPoint{Lat: lat, Lon: lon}, errLat == nil && errLon == nil
+	case map[string]interface{}:
+		lat, okLat := toNumber(v["lat"])
+		lon, okLon := toNumber(v["lon"])
+		return domain.GeoPoint{Lat: lat, Lon: lon}, okLat && okLon
+	default:
+		return domain.GeoPoint{}, false
+	}
+}
+
+// sortedQueryTypes returns the query types sorted, for error messages
+func sortedQueryTypes(query map[string]interface{}) []string {
+	types := make([]string, 0, len(query))
+	for kind := range query {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// memoryQueryError returns the error elasticsearch would return for an
+// invalid or unsupported query
+func memoryQueryError(format string, params ...interface{}) error {
+	return newSearchError(&ElasticError{
+		Status: http.StatusBadRequest,
+		Type:   "parsing_exception",
+		Reason: fmt.Sprintf(format, params...),
+	})
+}
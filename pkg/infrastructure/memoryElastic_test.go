@@ -0,0 +1,224 @@
+package infrastructure
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
+)
+
+type memoryHits struct {
+	Hits []struct {
+		Source map[string]interface{} `json:"_source"`
+		Sort   []interface{}          `json:"sort"`
+	} `json:"hits"`
+}
+
+func newTestMemoryHandler(t *testing.T) *MemoryElasticHandler {
+	handler, err := NewMemoryElasticHandler("testdata/memory_ads.json")
+	assert.NoError(t, err)
+	handler.now = func() time.Time {
+		return time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	}
+	return handler
+}
+
+// searchListIDs returns the list ids of the ads matching query, in order
+func searchListIDs(t *testing.T, handler *MemoryElasticHandler, query string) []float64 {
+	var hits memoryHits
+	assert.NoError(t, handler.Search("ads", query, 10, 0, &hits))
+	listIDs := []float64{}
+	for _, hit := range hits.Hits {
+		listIDs = append(listIDs, hit.Source["listId"].(float64))
+	}
+	return listIDs
+}
+
+func TestNewMemoryElasticHandlerDevFixture(t *testing.T) {
+	handler, err := NewMemoryElasticHandler("../../resources/fixtures/ads.json")
+	assert.NoError(t, err)
+	info, err := handler.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, info.(map[string]interface{})["count"])
+}
+
+func TestNewMemoryElasticHandlerErrors(t *testing.T) {
+	_, err := NewMemoryElasticHandler("testdata/missing.json")
+	assert.Error(t, err)
+	_, err = NewMemoryElasticHandler("testdata/from.data")
+	assert.Error(t, err)
+}
+
+func TestMemorySearchMatch(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	assert.Equal(t, []float64{102}, searchListIDs(t, handler, `{"query": {"match": {"listId": 102}}}`))
+	assert.Equal(t, []float64{103, 102, 101},
+		searchListIDs(t, handler, `{"query": {"match": {"subject": "casa 3 dormitorios"}}, "sort": ["_score", {"listId": "desc"}]}`))
+	assert.Equal(t, []float64{104},
+		searchListIDs(t, handler, `{"query": {"match": {"params.brand.value.keyword": "Toyota"}}}`))
+	assert.Equal(t, []float64{},
+		searchListIDs(t, handler, `{"query": {"match": {"params.brand.value.keyword": "toyota"}}}`))
+}
+
+func TestMemorySearchBool(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{
+		"query": {"bool": {
+			"must": [{"term": {"category.id": 1220}}],
+			"must_not": [{"term": {"listId": 101}}],
+			"should": [{"term": {"params.rooms.value": "3"}}],
+			"filter": [{"term": {"location.regionId": 13}}]
+		}},
+		"sort": [{"_score": "desc"}, {"listId": "desc"}]
+	}`
+	assert.Equal(t, []float64{102, 105}, searchListIDs(t, handler, query))
+
+	shouldOnly := `{"query": {"bool": {"should": [{"term": {"userId": 10}}]}}, "sort": [{"listId": "asc"}]}`
+	assert.Equal(t, []float64{101, 104}, searchListIDs(t, handler, shouldOnly))
+
+	empty := `{"query": {"bool": {"must": [], "must_not": [], "should": [], "filter": []}}}`
+	assert.Len(t, searchListIDs(t, handler, empty), 5)
+}
+
+func TestMemorySearchTerms(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"terms": {"location.communeId": [295, 55]}}, "sort": [{"listId": "asc"}]}`
+	assert.Equal(t, []float64{101, 103}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchRange(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	numeric := `{"query": {"range": {"price": {"gte": 5000, "lt": 7000}}}}`
+	assert.Equal(t, []float64{101}, searchListIDs(t, handler, numeric))
+
+	dates := `{"query": {"range": {"listTime": {"gte": "now-3d/d"}}}, "sort": [{"listId": "asc"}]}`
+	assert.Equal(t, []float64{101, 104, 105}, searchListIDs(t, handler, dates))
+
+	absolute := `{"query": {"range": {"listTime": {"lt": "2021-05-01"}}}}`
+	assert.Equal(t, []float64{103}, searchListIDs(t, handler, absolute))
+}
+
+func TestMemorySearchQueryString(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{
+		"query": {"query_string": {"query": "(private OR professional)", "default_field": "publisherType"}},
+		"sort": [{"listId": "asc"}]
+	}`
+	assert.Equal(t, []float64{102, 103}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchPriceScript(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"script": {"script": {"params": {
+		"priceMin": 4000, "priceMax": 6000, "rates": {"uf": 30000, "peso": 1}, "base": 30000
+	}}}}, "sort": [{"listId": "asc"}]}`
+	// 150.000.000 pesos are 5000 uf, ads without price or currency never match
+	assert.Equal(t, []float64{101, 103}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchGeoDistance(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"geo_distance": {"distance": "6.2km", "location.geo": "-33.4489,-70.6693"}}, "sort": [{"listId": "asc"}]}`
+	assert.Equal(t, []float64{101, 102}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchMoreLikeThis(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"more_like_this": {
+		"fields": ["subject", "body"],
+		"like": [{"_index": "ads", "_id": 1}],
+		"min_term_freq": 1, "min_doc_freq": 5, "max_query_terms": 20
+	}}, "sort": [{"_score": "desc"}, {"listId": "desc"}]}`
+	// ad 105 only shares departamento, below the 30% of the liked ad terms
+	assert.Equal(t, []float64{102, 103}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchFunctionScore(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"function_score": {
+		"query": {"term": {"category.id": 1220}},
+		"functions": [{"gauss": {"listTime": {"origin": "now/1d", "offset": "1d", "scale": "10d"}}}],
+		"score_mode": "multiply",
+		"boost_mode": "replace"
+	}}, "sort": [{"_score": "desc"}]}`
+	assert.Equal(t, []float64{105, 101, 102, 103}, searchListIDs(t, handler, query))
+
+	geo := `{"query": {"function_score": {
+		"functions": [{"exp": {"location.geo": {"origin": "-33.0245,-71.5518", "scale": "10km"}}, "weight": 2}],
+		"boost_mode": "replace"
+	}}, "_source": ["listId"]}`
+	var hits memoryHits
+	assert.NoError(t, handler.Search("ads", geo, 1, 0, &hits))
+	assert.Len(t, hits.Hits, 1)
+	assert.Equal(t, map[string]interface{}{"listId": float64(103)}, hits.Hits[0].Source)
+	assert.Equal(t, []interface{}{float64(2)}, hits.Hits[0].Sort)
+}
+
+func TestMemorySearchPriceDecay(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{"query": {"function_score": {
+		"query": {"term": {"category.id": 1220}},
+		"functions": [{"script_score": {"script": {"params": {
+			"origin": 7000, "priceMin": 5000, "priceMax": 9000, "decay": 0.5,
+			"rates": {"uf": 1, "peso": 0.0000333}, "base": 1
+		}}}}],
+		"boost_mode": "replace"
+	}}, "sort": [{"_score": "desc"}, {"listId": "asc"}]}`
+	// ad 102 is on the origin, 101 is on the scale and 105 without price scores the decay
+	assert.Equal(t, []float64{102, 101, 105, 103}, searchListIDs(t, handler, query))
+}
+
+func TestMemorySearchSourceAndSearchAfter(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	query := `{
+		"_source": {"includes": ["listId", "location.regionId"]},
+		"query": {"match_all": {}},
+		"sort": [{"_score": "desc"}, {"listId": "desc"}],
+		"search_after": [1, 104]
+	}`
+	var hits memoryHits
+	assert.NoError(t, handler.Search("ads", query, 2, 0, &hits))
+	assert.Len(t, hits.Hits, 2)
+	assert.Equal(t, map[string]interface{}{
+		"listId":   float64(103),
+		"location": map[string]interface{}{"regionId": float64(5)},
+	}, hits.Hits[0].Source)
+	assert.Equal(t, []interface{}{float64(1), float64(103)}, hits.Hits[0].Sort)
+	assert.Equal(t, float64(102), hits.Hits[1].Source["listId"])
+}
+
+func TestMemorySearchErrors(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	queries := []string{
+		`{"query": `,
+		`{"query": {"wildcard": {"subject": "dep*"}}}`,
+		`{"query": {"match_all": {}, "term": {"listId": 1}}}`,
+		`{"query": {"match_all": {}}, "sort": ["_score"], "search_after": [1, 2]}`,
+		`{"query": {"script": {"script": {"source": "doc['price'].value > 0"}}}}`,
+	}
+	for _, query := range queries {
+		var hits memoryHits
+		err := handler.Search("ads", query, 10, 0, &hits)
+		var elasticErr *ElasticError
+		if assert.True(t, errors.As(err, &elasticErr), query) {
+			assert.Equal(t, http.StatusBadRequest, elasticErr.Status)
+		}
+	}
+}
+
+func TestMemoryMultiSearch(t *testing.T) {
+	handler := newTestMemoryHandler(t)
+	var first, second memoryHits
+	errs, err := handler.MultiSearch("ads", []repository.SearchRequest{
+		{Query: `{"query": {"match": {"listId": 101}}}`, Size: 1, Hits: &first},
+		{Query: `{"query": {"unknown": {}}}`, Size: 1, Hits: &second},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.Equal(t, float64(101), first.Hits[0].Source["listId"])
+}
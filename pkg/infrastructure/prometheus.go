@@ -151,6 +151,83 @@ func (v *EventCollector) CollectEvent(entityName, eventName, eventType string) {
 	v.CounterVec.WithLabelValues(entityName, eventName, eventType).Inc()
 }
 
+// NewGaugeCollector creates a new instance of GaugeCollector using the given labels
+func (*Prometheus) NewGaugeCollector(name, help string, labels ...string) GaugeCollector {
+	gaugeVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: sanitizeMetricName(name),
+			Help: help,
+		},
+		labels,
+	)
+	prometheus.MustRegister(gaugeVec)
+	return GaugeCollector{gaugeVec}
+}
+
+// GaugeCollector is a Collector that bundles a set of Gauges that all share the
+// same descriptor, but have different values for their variable labels.
+type GaugeCollector struct {
+	*prometheus.GaugeVec
+}
+
+// Set sets the gauge identified by the given label values to value.
+// Ex: Set(3600, "uf")
+func (v GaugeCollector) Set(value float64, labels ...string) {
+	v.GaugeVec.WithLabelValues(labels...).Set(value)
+}
+
+// NewCounterCollector creates a new instance of CounterCollector using the given labels
+func (*Prometheus) NewCounterCollector(name, help string, labels ...string) CounterCollector {
+	counterVec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: sanitizeMetricName(name),
+			Help: help,
+		},
+		labels,
+	)
+	prometheus.MustRegister(counterVec)
+	return CounterCollector{counterVec}
+}
+
+// CounterCollector is a Collector that bundles a set of Counters that all share the
+// same descriptor, but have different values for their variable labels.
+type CounterCollector struct {
+	*prometheus.CounterVec
+}
+
+// Inc increments the counter identified by the given label values.
+// Ex: Inc("default", "click")
+func (v CounterCollector) Inc(labels ...string) {
+	v.CounterVec.WithLabelValues(labels...).Inc()
+}
+
+// NewHistogramCollector creates a new instance of HistogramCollector using the given
+// buckets and labels
+func (*Prometheus) NewHistogramCollector(name, help string, buckets []float64, labels ...string) HistogramCollector {
+	histogramVec := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    sanitizeMetricName(name),
+			Help:    help,
+			Buckets: buckets,
+		},
+		labels,
+	)
+	prometheus.MustRegister(histogramVec)
+	return HistogramCollector{histogramVec}
+}
+
+// HistogramCollector is a Collector that bundles a set of Histograms that all share the
+// same descriptor, but have different values for their variable labels.
+type HistogramCollector struct {
+	*prometheus.HistogramVec
+}
+
+// Observe adds an observation to the histogram identified by the given label values.
+// Ex: Observe(0.25, "ads")
+func (v HistogramCollector) Observe(value float64, labels ...string) {
+	v.HistogramVec.WithLabelValues(labels...).Observe(value)
+}
+
 // expose starts prometheus exporter metrics server exposing metrics in "/metrics" path
 func (p *Prometheus) expose(port string) {
 	if !p.enabled {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Yapo/goutils"
 	"github.com/anevsky/cachego/memory"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
 )
 
 // RequestCache holds the cache itself and the variables that control
@@ -19,8 +20,12 @@ type RequestCache struct {
 
 // getHash will print the data interface as string with all its fields
 // and then will md5 it to generate a hash usable as a unique key for
-// that data interface
+// that data interface. Inputs implementing handlers.RequestCacheKey are
+// hashed by their cache key
 func (rc *RequestCache) getHash(data interface{}) string {
+	if keyer, ok := data.(handlers.RequestCacheKey); ok {
+		data = keyer.CacheKey()
+	}
 	sum := md5.Sum([]byte(fmt.Sprintf("%v", data))) //nolint: gosec
 	return fmt.Sprintf("%x", sum)
 }
@@ -0,0 +1,31 @@
+package infrastructure
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Yapo/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// keyedInput is cached by its key, ignoring its unit
+type keyedInput struct {
+	Key  string
+	Unit string
+}
+
+func (i keyedInput) CacheKey() interface{} {
+	return i.Key
+}
+
+func TestRequestCacheKey(t *testing.T) {
+	cache := NewRequestCacheHandler(60000)
+	response := &goutils.Response{Code: http.StatusOK, Body: "ok"}
+	assert.NoError(t, cache.SetCache(keyedInput{Key: "a", Unit: "1"}, response))
+
+	cached, err := cache.GetCache(keyedInput{Key: "a", Unit: "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, response, cached)
+	_, err = cache.GetCache(keyedInput{Key: "b", Unit: "1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package infrastructure
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
+)
+
+// validateTag is the struct tag holding the validation rules of a field.
+// Rules are separated by commas, ex: `validate:"required,min=0,max=10"`.
+// Supported rules are required, min, max, enum (values separated by |)
+// and pattern. Since regular expressions may contain commas, pattern must
+// be the last rule of the tag
+const validateTag = "validate"
+
+// inputSources are the tags checked to name a field on validation errors
+var inputSources = []InputSource{PATH, QUERY, HEADERS, COOKIES, FORM} // nolint: gochecknoglobals
+
+// validationPatterns caches the compiled pattern rules
+var validationPatterns sync.Map // nolint: gochecknoglobals
+
+// validateInput checks the validate tags of every field in input, a pointer
+// to a struct, and returns the errors found
+func validateInput(input interface{}) (errs []handlers.FieldError) {
+	value := reflect.Indirect(reflect.ValueOf(input))
+	if value.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		// unexported fields are not read from the request
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && value.Field(i).CanAddr() {
+			errs = append(errs, validateInput(value.Field(i).Addr().Interface())...)
+			continue
+		}
+		rules, ok := field.Tag.Lookup(validateTag)
+		if !ok {
+			continue
+		}
+		for _, message := range validateField(value.Field(i), rules) {
+			errs = append(errs, handlers.FieldError{Field: fieldName(field), Message: message})
+		}
+	}
+	if validator, ok := input.(handlers.InputValidator); ok {
+		errs = append(errs, validator.Validate()...)
+	}
+	return
+}
+
+// validateField returns a message for every rule the value does not satisfy
+func validateField(value reflect.Value, rules string) (messages []string) {
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "pattern=") {
+			rule, rules = rules, ""
+		} else if idx := strings.Index(rules, ","); idx >= 0 {
+			rule, rules = rules[:idx], rules[idx+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+		name, arg := rule, ""
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			name, arg = rule[:idx], rule[idx+1:]
+		}
+		if message := checkRule(value, strings.TrimSpace(name), arg); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return
+}
+
+// checkRule returns a message when value does not satisfy the rule.
+// Strings and slices are measured by length on min and max rules, enum and
+// pattern rules are checked on every slice element
+func checkRule(value reflect.Value, name, arg string) string {
+	switch name {
+	case "required":
+		if value.IsZero() || value.Kind() == reflect.Slice && value.Len() == 0 {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("has an invalid %s rule", name)
+		}
+		size, ok := measure(value)
+		if ok && name == "min" && size < limit {
+			return "must be greater than or equal to " + arg
+		}
+		if ok && name == "max" && size > limit {
+			return "must be less than or equal to " + arg
+		}
+	case "enum":
+		allowed := strings.Split(arg, "|")
+		for _, item := range stringValues(value) {
+			if !containsFold(allowed, item) {
+				return "must be one of " + strings.Join(allowed, ", ")
+			}
+		}
+	case "pattern":
+		pattern, err := compilePattern(arg)
+		if err != nil {
+			return "has an invalid pattern rule"
+		}
+		for _, item := range stringValues(value) {
+			if !pattern.MatchString(item) {
+				return "has an invalid format"
+			}
+		}
+	}
+	return ""
+}
+
+// measure returns the number compared on min and max rules
+func measure(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String, reflect.Slice:
+		return float64(value.Len()), true
+	default:
+		return 0, false
+	}
+}
+
+// stringValues returns the non empty values checked on enum and pattern rules
+func stringValues(value reflect.Value) (out []string) {
+	switch value.Kind() {
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			out = append(out, stringValues(value.Index(i))...)
+		}
+	case reflect.String:
+		if value.String() != "" {
+			out = append(out, value.String())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		out = append(out, strconv.FormatInt(value.Int(), 10))
+	}
+	return
+}
+
+// compilePattern returns the compiled pattern, compiling it only once
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := validationPatterns.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	validationPatterns.Store(expr, pattern)
+	return pattern, nil
+}
+
+// fieldName returns the name the field has on the request, the go field
+// name when it is not read from any named source
+func fieldName(field reflect.StructField) string {
+	for _, source := range inputSources {
+		if tag, ok := field.Tag.Lookup(string(source)); ok && tag != "" {
+			return tag
+		}
+	}
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return field.Name
+}
+
+// containsFold reports whether values contains value ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package infrastructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/handlers"
+)
+
+type validatedInput struct {
+	ID     string   `path:"id" validate:"required,pattern=^[0-9]{1,3}$"`
+	From   int      `query:"from" validate:"min=0,max=10"`
+	Sort   string   `query:"sort" validate:"enum=asc|desc"`
+	Fields []string `query:"fields" validate:"max=2,enum=title|price"`
+	Name   string   `json:"name" validate:"max=5"`
+	Free   string
+}
+
+type customValidatedInput struct {
+	ID string `query:"id"`
+	// state is not read from the request, so it is not validated
+	state struct{ loaded bool }
+}
+
+func (input *customValidatedInput) Validate() []handlers.FieldError {
+	if input.ID == "bad" {
+		return []handlers.FieldError{{Field: "id", Message: "is bad"}}
+	}
+	return nil
+}
+
+func TestValidateInputOK(t *testing.T) {
+	input := validatedInput{ID: "123", From: 10, Sort: "DESC", Fields: []string{"title"}, Name: "edgar"}
+	assert.Empty(t, validateInput(&input))
+}
+
+func TestValidateInputErrors(t *testing.T) {
+	input := validatedInput{ID: "1234", From: -1, Sort: "random", Fields: []string{"title", "price", "body"}, Name: "edgardo"}
+	expected := []handlers.FieldError{
+		{Field: "id", Message: "has an invalid format"},
+		{Field: "from", Message: "must be greater than or equal to 0"},
+		{Field: "sort", Message: "must be one of asc, desc"},
+		{Field: "fields", Message: "must be less than or equal to 2"},
+		{Field: "fields", Message: "must be one of title, price"},
+		{Field: "name", Message: "must be less than or equal to 5"},
+	}
+	assert.Equal(t, expected, validateInput(&input))
+}
+
+func TestValidateInputRequired(t *testing.T) {
+	input := validatedInput{}
+	expected := []handlers.FieldError{{Field: "id", Message: "is required"}}
+	assert.Equal(t, expected, validateInput(&input))
+}
+
+func TestValidateInputCustomValidator(t *testing.T) {
+	input := customValidatedInput{ID: "bad"}
+	expected := []handlers.FieldError{{Field: "id", Message: "is bad"}}
+	assert.Equal(t, expected, validateInput(&input))
+}
+
+func TestValidateInputInvalidRules(t *testing.T) {
+	type input struct {
+		Size    int    `query:"size" validate:"min=a"`
+		Pattern string `query:"pattern" validate:"pattern=[a-"`
+	}
+	expected := []handlers.FieldError{
+		{Field: "size", Message: "has an invalid min rule"},
+		{Field: "pattern", Message: "has an invalid pattern rule"},
+	}
+	assert.Equal(t, expected, validateInput(&input{Pattern: "a"}))
+}
@@ -0,0 +1,104 @@
+package infrastructure
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// viewedAdsEntry is the list of ads of a key and when it expires
+type viewedAdsEntry struct {
+	key     string
+	listIDs []int64
+	expires time.Time
+}
+
+// MemoryViewedAdsStore keeps the viewed ads of each key in memory, so they
+// are lost on restart and not shared between replicas. Keys expire after
+// ttl without being set and the least recently set ones are evicted once
+// there are maxKeys of them
+type MemoryViewedAdsStore struct {
+	ttl     time.Duration
+	maxKeys int
+	entries map[string]*list.Element
+	// order holds the entries from the most to the least recently set,
+	// which is also their expiration order
+	order *list.List
+	now   func() time.Time
+	mutex sync.Mutex
+}
+
+// NewMemoryViewedAdsStore returns an empty store, zero ttl or maxKeys
+// disable expiration and eviction
+func NewMemoryViewedAdsStore(ttl time.Duration, maxKeys int) *MemoryViewedAdsStore {
+	return &MemoryViewedAdsStore{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns a copy of the ads of the key, empty when it is unknown or expired
+func (s *MemoryViewedAdsStore) Get(key string) ([]int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return []int64{}, nil
+	}
+	entry := element.Value.(*viewedAdsEntry)
+	if s.expired(entry) {
+		s.remove(element)
+		return []int64{}, nil
+	}
+	listIDs := make([]int64, len(entry.listIDs))
+	copy(listIDs, entry.listIDs)
+	return listIDs, nil
+}
+
+// Set replaces the ads of the key, evicting keys when the store is full
+func (s *MemoryViewedAdsStore) Set(key string, listIDs []int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry := &viewedAdsEntry{key: key, listIDs: make([]int64, len(listIDs))}
+	copy(entry.listIDs, listIDs)
+	if s.ttl > 0 {
+		entry.expires = s.now().Add(s.ttl)
+	}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+	if s.maxKeys > 0 && len(s.entries) >= s.maxKeys {
+		s.evict()
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	return nil
+}
+
+// evict removes the expired keys, or the least recently set one when none
+// is. Expired keys are the last ones of order, so only those are visited
+func (s *MemoryViewedAdsStore) evict() {
+	for element := s.order.Back(); element != nil && s.expired(element.Value.(*viewedAdsEntry)); {
+		previous := element.Prev()
+		s.remove(element)
+		element = previous
+	}
+	if len(s.entries) >= s.maxKeys {
+		s.remove(s.order.Back())
+	}
+}
+
+// remove deletes the entry of element
+func (s *MemoryViewedAdsStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*viewedAdsEntry).key)
+}
+
+// expired tells whether the entry is past its expiration
+func (s *MemoryViewedAdsStore) expired(entry *viewedAdsEntry) bool {
+	return !entry.expires.IsZero() && s.now().After(entry.expires)
+}
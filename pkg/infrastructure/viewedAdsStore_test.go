@@ -0,0 +1,77 @@
+package infrastructure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryViewedAdsStore(t *testing.T) {
+	store := NewMemoryViewedAdsStore(0, 0)
+	listIDs := []int64{2, 1}
+	assert.NoError(t, store.Set("device", listIDs))
+	listIDs[0] = 3
+
+	viewed, err := store.Get("device")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, viewed)
+
+	viewed, err = store.Get("unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, viewed)
+}
+
+func TestMemoryViewedAdsStoreExpiration(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	store := NewMemoryViewedAdsStore(time.Hour, 2)
+	store.now = func() time.Time { return now }
+	assert.NoError(t, store.Set("a", []int64{1}))
+	now = now.Add(time.Minute)
+	assert.NoError(t, store.Set("b", []int64{2}))
+
+	// the oldest key is evicted when the store is full
+	assert.NoError(t, store.Set("c", []int64{3}))
+	viewed, _ := store.Get("a")
+	assert.Empty(t, viewed)
+	viewed, _ = store.Get("b")
+	assert.Equal(t, []int64{2}, viewed)
+
+	now = now.Add(2 * time.Hour)
+	viewed, _ = store.Get("c")
+	assert.Empty(t, viewed)
+}
+
+func TestMemoryViewedAdsStoreEviction(t *testing.T) {
+	store := NewMemoryViewedAdsStore(0, 2)
+	assert.NoError(t, store.Set("a", []int64{1}))
+	assert.NoError(t, store.Set("b", []int64{2}))
+	// setting a key again makes it the most recent one
+	assert.NoError(t, store.Set("a", []int64{1, 3}))
+
+	assert.NoError(t, store.Set("c", []int64{4}))
+	viewed, _ := store.Get("b")
+	assert.Empty(t, viewed)
+	viewed, _ = store.Get("a")
+	assert.Equal(t, []int64{1, 3}, viewed)
+	viewed, _ = store.Get("c")
+	assert.Equal(t, []int64{4}, viewed)
+	assert.Equal(t, 2, store.order.Len())
+}
+
+func TestMemoryViewedAdsStoreEvictsExpired(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	store := NewMemoryViewedAdsStore(time.Hour, 3)
+	store.now = func() time.Time { return now }
+	assert.NoError(t, store.Set("a", []int64{1}))
+	assert.NoError(t, store.Set("b", []int64{2}))
+	now = now.Add(30 * time.Minute)
+	assert.NoError(t, store.Set("c", []int64{3}))
+
+	// every expired key is removed, so the store is no longer full
+	now = now.Add(45 * time.Minute)
+	assert.NoError(t, store.Set("d", []int64{4}))
+	assert.Len(t, store.entries, 2)
+	viewed, _ := store.Get("c")
+	assert.Equal(t, []int64{3}, viewed)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// AttributionSigner signs the attribution of a recommended ad as an opaque token
+type AttributionSigner interface {
+	Sign(attribution domain.Attribution) string
+}
+
+// ConfigVersions returns the version of a carousel configuration
+type ConfigVersions interface {
+	ConfigVersion(carousel string) string
+}
+
+// Attribution tags every recommended ad with a signed token, so the
+// events of the ad can be joined back to the recommendation
+type Attribution struct {
+	Signer AttributionSigner
+	// Versions is optional, tokens have no configuration version without it
+	Versions ConfigVersions
+	// Now returns the time ads are recommended at, time.Now when nil
+	Now func() time.Time
+}
+
+// sign sets the token of the carousel ads recommended for the source ad,
+// positions start at from. The configuration version is the one of the
+// variant when the carousel is on experiment. Interleaved ads are
+// attributed to the configuration that picked them, as their variant.
+// Nothing is done when attribution is disabled
+func (a *Attribution) sign(ads []AdsOutput, carousel, variant, sourceListID string, from int) {
+	if a == nil || a.Signer == nil {
+		return
+	}
+	attribution := domain.Attribution{Carousel: carousel, Time: time.Now()}
+	if a.Now != nil {
+		attribution.Time = a.Now()
+	}
+	attribution.SourceListID, _ = strconv.ParseInt(sourceListID, 10, 64)
+	for i := range ads {
+		attribution.Variant = variant
+		if ads[i].Source != "" {
+			attribution.Variant = ads[i].Source
+		}
+		attribution.ConfigVersion = a.configVersion(carousel, attribution.Variant)
+		attribution.ListID, _ = strconv.ParseInt(ads[i].ListID, 10, 64)
+		attribution.Position = from + i
+		ads[i].Token = a.Signer.Sign(attribution)
+	}
+}
+
+// configVersion returns the version of the configuration serving the
+// carousel, the variant one when it is set
+func (a *Attribution) configVersion(carousel, variant string) string {
+	if a.Versions == nil {
+		return ""
+	}
+	if variant != "" {
+		return a.Versions.ConfigVersion(variant)
+	}
+	return a.Versions.ConfigVersion(carousel)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+type mockAttributionSigner struct {
+	mock.Mock
+}
+
+func (m *mockAttributionSigner) Sign(attribution domain.Attribution) string {
+	return m.Called(attribution).String(0)
+}
+
+type mockConfigVersions struct {
+	mock.Mock
+}
+
+func (m *mockConfigVersions) ConfigVersion(carousel string) string {
+	return m.Called(carousel).String(0)
+}
+
+func TestAttributionSign(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	signer := &mockAttributionSigner{}
+	for i, listID := range []int64{7, 8} {
+		signer.On("Sign", domain.Attribution{
+			Carousel: "default", ConfigVersion: "0a1b2c3d", SourceListID: 1, ListID: listID, Position: 10 + i, Time: now,
+		}).Return(fmt.Sprintf("token-%d", listID))
+	}
+	versions := &mockConfigVersions{}
+	versions.On("ConfigVersion", "default").Return("0a1b2c3d")
+	attribution := &Attribution{Signer: signer, Versions: versions, Now: func() time.Time { return now }}
+
+	ads := []AdsOutput{{ListID: "7"}, {ListID: "8"}}
+	attribution.sign(ads, "default", "", "1", 10)
+	assert.Equal(t, []AdsOutput{{ListID: "7", Token: "token-7"}, {ListID: "8", Token: "token-8"}}, ads)
+	signer.AssertExpectations(t)
+}
+
+func TestAttributionSignInterleaved(t *testing.T) {
+	signer := &mockAttributionSigner{}
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.Variant == "pro" && attribution.ConfigVersion == "version-pro"
+	})).Return("token-pro")
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.Variant == "similar" && attribution.ConfigVersion == "version-similar"
+	})).Return("token-similar")
+	versions := &mockConfigVersions{}
+	versions.On("ConfigVersion", "pro").Return("version-pro")
+	versions.On("ConfigVersion", "similar").Return("version-similar")
+	attribution := &Attribution{Signer: signer, Versions: versions}
+
+	ads := []AdsOutput{{ListID: "7", Source: "pro"}, {ListID: "8", Source: "similar"}}
+	attribution.sign(ads, "default", "", "1", 0)
+	assert.Equal(t, "token-pro", ads[0].Token)
+	assert.Equal(t, "token-similar", ads[1].Token)
+	versions.AssertNotCalled(t, "ConfigVersion", "default")
+}
+
+func TestAttributionSignDisabled(t *testing.T) {
+	var attribution *Attribution
+	ads := []AdsOutput{{ListID: "7"}}
+	attribution.sign(ads, "default", "", "1", 0)
+	assert.Equal(t, []AdsOutput{{ListID: "7"}}, ads)
+}
+
+func TestGetSuggestionsHandlerAttribution(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", mock.Anything).
+		Return(usecases.SuggestionsResult{Ads: []domain.Ad{{ListID: 7}}, Offset: 2}, nil)
+	signer := &mockAttributionSigner{}
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.ListID == 7 && attribution.Position == 2 && attribution.Carousel == "default"
+	})).Return("token")
+	h := GetSuggestionsHandler{
+		Interactor:  mInteractor,
+		Attribution: &Attribution{Signer: signer},
+	}
+	input := &getSuggestionsHandlerInput{ListID: "1", CarouselType: "default", From: 2}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "token", r.Body.(getSuggestionsHandlerOutput).Ads[0].Token)
+	signer.AssertExpectations(t)
+}
+
+func TestGetSuggestionsHandlerAttributionCursorPage(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", mock.Anything).
+		Return(usecases.SuggestionsResult{Ads: []domain.Ad{{ListID: 7}, {ListID: 8}}, Offset: 10}, nil)
+	signer := &mockAttributionSigner{}
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.ListID == 7 && attribution.Position == 10
+	})).Return("token7").Once()
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.ListID == 8 && attribution.Position == 11
+	})).Return("token8").Once()
+	h := GetSuggestionsHandler{
+		Interactor:  mInteractor,
+		Attribution: &Attribution{Signer: signer},
+	}
+	// second pages requested with a cursor follow the first page positions
+	input := &getSuggestionsHandlerInput{ListID: "1", CarouselType: "default", Cursor: "next"}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	signer.AssertExpectations(t)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+// ExperimentAssigner assigns the variants of the carousels on experiment
+type ExperimentAssigner interface {
+	Assign(carousel, unitID string) (variant string, ok bool)
+}
+
+// experimentUnit returns who experiment variants are assigned to, the user
+// when it is known or else the device
+func experimentUnit(userID, deviceID string) string {
+	if userID != "" {
+		return userID
+	}
+	return deviceID
+}
+
+// assignVariant returns the variant of the carousel for the unit, empty
+// when the carousel is not on experiment or there are no experiments
+func assignVariant(experiments ExperimentAssigner, carousel, unitID string) string {
+	if experiments == nil {
+		return ""
+	}
+	variant, _ := experiments.Assign(carousel, unitID)
+	return variant
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// testExperiments assigns devices starting with b to the default_v2 variant
+type testExperiments struct{}
+
+func (testExperiments) Assign(carousel, unitID string) (string, bool) {
+	if carousel != "default" {
+		return "", false
+	}
+	if unitID != "" && unitID[0] == 'b' {
+		return "default_v2", true
+	}
+	return "default", true
+}
+
+// testFrequencyCaps caps the default_v2 and pro carousels
+type testFrequencyCaps struct{}
+
+func (testFrequencyCaps) FrequencyCapped(carousel string) bool {
+	return carousel == "default_v2" || carousel == "pro"
+}
+
+func TestExperimentUnit(t *testing.T) {
+	assert.Equal(t, "user", experimentUnit("user", "device"))
+	assert.Equal(t, "device", experimentUnit("", "device"))
+}
+
+func TestGetSuggestionsHandlerInputCacheKey(t *testing.T) {
+	input := func(carousel, userID, deviceID string) *getSuggestionsHandlerInput {
+		return &getSuggestionsHandlerInput{
+			ListID: "1", CarouselType: carousel, UserID: userID, DeviceID: deviceID, experiments: testExperiments{},
+		}
+	}
+	// units on the same variant share the cache key
+	assert.Equal(t, input("default", "", "a1").CacheKey(), input("default", "a2", "b2").CacheKey())
+	assert.NotEqual(t, input("default", "", "a1").CacheKey(), input("default", "", "b1").CacheKey())
+	assert.Equal(t, input("pro", "", "a1").CacheKey(), input("pro", "", "b1").CacheKey())
+	assert.Equal(t, getSuggestionsCacheKey{
+		Input:   getSuggestionsHandlerInput{ListID: "1", CarouselType: "default"},
+		Variant: "default_v2",
+	}, input("default", "", "b1").CacheKey())
+}
+
+func TestGetSuggestionsHandlerInputSkipCache(t *testing.T) {
+	input := func(carousel, deviceID string, from int) *getSuggestionsHandlerInput {
+		return &getSuggestionsHandlerInput{
+			ListID: "1", CarouselType: carousel, DeviceID: deviceID, From: from,
+			experiments: testExperiments{}, sponsored: testFrequencyCaps{},
+		}
+	}
+	// first pages of capped carousels, or variants, are not cached
+	assert.True(t, input("pro", "a1", 0).SkipCache())
+	assert.True(t, input("default", "b1", 0).SkipCache())
+	assert.False(t, input("default", "a1", 0).SkipCache())
+	assert.False(t, input("pro", "a1", 10).SkipCache())
+	assert.False(t, (&getSuggestionsHandlerInput{CarouselType: "pro"}).SkipCache())
+}
+
+func TestGetMultiSuggestionsHandlerInputCacheKey(t *testing.T) {
+	input := func(deviceID string) *getMultiSuggestionsHandlerInput {
+		return &getMultiSuggestionsHandlerInput{
+			ListID: "1", CarouselTypes: []string{"default", "pro"}, DeviceID: deviceID, experiments: testExperiments{},
+		}
+	}
+	assert.Equal(t, input("a1").CacheKey(), input("a2").CacheKey())
+	assert.Equal(t, getMultiSuggestionsCacheKey{
+		Input:    getMultiSuggestionsHandlerInput{ListID: "1", CarouselTypes: []string{"default", "pro"}},
+		Variants: []string{"default_v2", ""},
+	}, input("b1").CacheKey())
+}
+
+func TestGetSuggestionsHandlerVariant(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", usecases.SuggestionsRequest{
+		ListID: "1", CarouselType: "default", UnitID: "user",
+	}).Return(usecases.SuggestionsResult{Ads: []domain.Ad{{ListID: 7}}, Variant: "default_v2"}, nil)
+	signer := &mockAttributionSigner{}
+	signer.On("Sign", mock.MatchedBy(func(attribution domain.Attribution) bool {
+		return attribution.Carousel == "default" && attribution.Variant == "default_v2"
+	})).Return("token")
+	h := GetSuggestionsHandler{Interactor: mInteractor, Attribution: &Attribution{Signer: signer}}
+	input := &getSuggestionsHandlerInput{ListID: "1", CarouselType: "default", UserID: "user", DeviceID: "device"}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "default_v2", r.Body.(getSuggestionsHandlerOutput).Variant)
+	mInteractor.AssertExpectations(t)
+	signer.AssertExpectations(t)
+}
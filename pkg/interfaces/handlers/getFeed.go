@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// GetFeedHandler implements the handler interface and responds with the
+// feed sections for an ad
+type GetFeedHandler struct {
+	Interactor          usecases.GetFeedInteractor
+	CurrencySymbol      string
+	UnitOfAccountSymbol string
+	Regions             DataMapping
+	Categories          DataMapping
+	// Attribution is optional, it tags every ad with a signed token
+	Attribution *Attribution
+	// RecentlyViewed is optional, it adds the ads stored as viewed on the
+	// device to the viewed ones
+	RecentlyViewed ViewedAdsMerger
+	// HiddenAds is optional, it adds the ads and sellers hidden on the
+	// device to the excluded ones
+	HiddenAds ExclusionsGetter
+}
+
+// getFeedHandlerInput viewed ads and exclusions work as on the single
+// carousel endpoint, the device header adds the ads stored as viewed and
+// the ads and sellers hidden on the device
+type getFeedHandlerInput struct {
+	ListID         string   `path:"listID" validate:"required,pattern=^[0-9]+$"`
+	OptionalParams []string `query:"params"`
+	DeviceID       string   `headers:"X-Device-Id"`
+	Viewed         []string `query:"viewed" validate:"pattern=^[0-9]+$"`
+	ViewedHeader   []string `headers:"X-Viewed-Ads" validate:"pattern=^[0-9]+$"`
+	Exclude        []string `query:"exclude" validate:"max=100,pattern=^[0-9]+$"`
+	recentlyViewed ViewedAdsMerger
+	hiddenAds      ExclusionsGetter
+	// viewedAds are the merged viewed ads and exclusions the excluded and
+	// hidden ones, retrieved once per request
+	viewedAds        []int64
+	viewedLoaded     bool
+	exclusions       domain.Exclusions
+	exclusionsLoaded bool
+}
+
+// getFeedCacheKey is the input responses are cached by
+type getFeedCacheKey struct {
+	Input      getFeedHandlerInput
+	Viewed     []int64
+	Exclusions domain.Exclusions
+}
+
+// CacheKey keys responses by the ads viewed and the exclusions instead of
+// by device, so devices with the same ones share them
+func (input *getFeedHandlerInput) CacheKey() interface{} {
+	key := getFeedCacheKey{Input: *input, Viewed: input.viewed(), Exclusions: input.excluded()}
+	key.Input.DeviceID = ""
+	key.Input.Viewed, key.Input.ViewedHeader, key.Input.recentlyViewed = nil, nil, nil
+	key.Input.viewedAds, key.Input.viewedLoaded = nil, false
+	key.Input.Exclude, key.Input.hiddenAds = nil, nil
+	key.Input.exclusions, key.Input.exclusionsLoaded = domain.Exclusions{}, false
+	return key
+}
+
+// viewed returns the ads viewed on the request and stored for the device
+func (input *getFeedHandlerInput) viewed() []int64 {
+	if !input.viewedLoaded {
+		input.viewedAds = viewedAds(input.recentlyViewed, input.DeviceID, input.Viewed, input.ViewedHeader)
+		input.viewedLoaded = true
+	}
+	return input.viewedAds
+}
+
+// excluded returns the ads excluded on the request and the ads and sellers
+// hidden on the device
+func (input *getFeedHandlerInput) excluded() domain.Exclusions {
+	if !input.exclusionsLoaded {
+		input.exclusions = exclusions(input.hiddenAds, input.DeviceID, input.Exclude)
+		input.exclusionsLoaded = true
+	}
+	return input.exclusions
+}
+
+// Validate checks every requested optional param is available on the output
+func (input *getFeedHandlerInput) Validate() []FieldError {
+	return validateOptionalParams(input.OptionalParams)
+}
+
+// getFeedHandlerOutput is the schema of the endpoint response, sections
+// follow the layout order
+type getFeedHandlerOutput struct {
+	Sections []feedSectionOutput `json:"sections"`
+}
+
+// feedSectionOutput holds the ads of a feed section
+type feedSectionOutput struct {
+	Carousel string      `json:"carousel"`
+	Ads      []AdsOutput `json:"ads"`
+}
+
+// Input returns a fresh, empty instance of getFeedHandlerInput
+func (h *GetFeedHandler) Input(ir InputRequest) HandlerInput {
+	input := getFeedHandlerInput{recentlyViewed: h.RecentlyViewed, hiddenAds: h.HiddenAds}
+	ir.Set(&input).FromPath().FromQuery().FromHeaders()
+	return &input
+}
+
+// Execute is the main function of the GetFeed handler
+func (h *GetFeedHandler) Execute(ig InputGetter) *goutils.Response {
+	input, response := ig()
+	// cached and invalid input responses are returned as they are, cached
+	// errors are computed again
+	if response != nil && servable(response) {
+		return response
+	}
+	in := input.(*getFeedHandlerInput)
+	result, err := h.Interactor.GetFeed(
+		usecases.FeedRequest{
+			ListID:         in.ListID,
+			OptionalParams: in.OptionalParams,
+			Viewed:         in.viewed(),
+			Exclusions:     in.excluded(),
+		},
+	)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if len(result.Sections) == 0 {
+		return &goutils.Response{
+			Code: http.StatusNoContent,
+		}
+	}
+	presenter := GetSuggestionsHandler{
+		CurrencySymbol:      h.CurrencySymbol,
+		UnitOfAccountSymbol: h.UnitOfAccountSymbol,
+		Regions:             h.Regions,
+		Categories:          h.Categories,
+	}
+	output := getFeedHandlerOutput{Sections: make([]feedSectionOutput, 0, len(result.Sections))}
+	for _, section := range result.Sections {
+		ads := presenter.setOutput(section.Ads, in.OptionalParams).Ads
+		h.Attribution.sign(ads, section.Carousel, "", in.ListID, 0)
+		output.Sections = append(output.Sections, feedSectionOutput{
+			Carousel: section.Carousel,
+			Ads:      ads,
+		})
+	}
+	return &goutils.Response{
+		Code: http.StatusOK,
+		Body: output,
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Yapo/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+type mockGetFeed struct {
+	mock.Mock
+}
+
+func (m *mockGetFeed) GetFeed(request usecases.FeedRequest) (usecases.FeedResult, error) {
+	args := m.Called(request)
+	return args.Get(0).(usecases.FeedResult), args.Error(1)
+}
+
+func TestGetFeedHandlerInput(t *testing.T) {
+	mMockInputRequest := MockInputRequest{}
+	mMockTargetRequest := MockTargetRequest{}
+	mMockInputRequest.On(
+		"Set", mock.AnythingOfType("*handlers.getFeedHandlerInput"),
+	).Return(&mMockTargetRequest)
+	mMockTargetRequest.On("FromPath").Return()
+	mMockTargetRequest.On("FromQuery").Return()
+	mMockTargetRequest.On("FromHeaders").Return()
+
+	h := GetFeedHandler{}
+	input := h.Input(&mMockInputRequest)
+
+	var expected *getFeedHandlerInput
+	assert.IsType(t, expected, input)
+	mMockTargetRequest.AssertExpectations(t)
+	mMockInputRequest.AssertExpectations(t)
+}
+
+func TestGetFeedHandlerOK(t *testing.T) {
+	mInteractor := &mockGetFeed{}
+	mInteractor.On("GetFeed", usecases.FeedRequest{ListID: "1", OptionalParams: []string{"publisherType"}}).Return(
+		usecases.FeedResult{Sections: []usecases.FeedSectionResult{
+			{Carousel: "default", Ads: []domain.Ad{{ListID: 2, PublisherType: "pro"}}},
+			{Carousel: "pro", Ads: []domain.Ad{{ListID: 3}}},
+		}}, nil)
+	h := GetFeedHandler{Interactor: mInteractor, CurrencySymbol: "$"}
+	input := &getFeedHandlerInput{ListID: "1", OptionalParams: []string{"publisherType"}}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+
+	date := "0001-01-01 00:00:00"
+	expected := &goutils.Response{
+		Code: http.StatusOK,
+		Body: getFeedHandlerOutput{Sections: []feedSectionOutput{
+			{Carousel: "default", Ads: []AdsOutput{{ListID: "2", Currency: "$", Date: date, PublisherType: "pro"}}},
+			{Carousel: "pro", Ads: []AdsOutput{{ListID: "3", Currency: "$", Date: date}}},
+		}},
+	}
+	assert.Equal(t, expected, r)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestGetFeedHandlerNoContent(t *testing.T) {
+	mInteractor := &mockGetFeed{}
+	mInteractor.On("GetFeed", mock.Anything).Return(usecases.FeedResult{Sections: []usecases.FeedSectionResult{}}, nil)
+	h := GetFeedHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getFeedHandlerInput{ListID: "1"}, nil))
+	assert.Equal(t, &goutils.Response{Code: http.StatusNoContent}, r)
+}
+
+func TestGetFeedHandlerError(t *testing.T) {
+	mInteractor := &mockGetFeed{}
+	err := fmt.Errorf("err")
+	mInteractor.On("GetFeed", mock.Anything).Return(usecases.FeedResult{}, err)
+	h := GetFeedHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getFeedHandlerInput{ListID: "1"}, nil))
+
+	expected := &goutils.Response{
+		Code: http.StatusInternalServerError,
+		Body: &ErrorOutput{
+			ErrorMessage: "internal error",
+			ErrorCode:    domain.ErrCodeInternal,
+			cause:        err,
+		},
+	}
+	assert.Equal(t, expected, r)
+}
+
+func TestGetFeedHandlerCachedError(t *testing.T) {
+	mInteractor := &mockGetFeed{}
+	mInteractor.On("GetFeed", mock.Anything).Return(usecases.FeedResult{Sections: []usecases.FeedSectionResult{}}, nil).Once()
+	h := GetFeedHandler{Interactor: mInteractor}
+	cached := &goutils.Response{Code: http.StatusInternalServerError}
+	r := h.Execute(MakeMockInputGetter(&getFeedHandlerInput{ListID: "1"}, cached))
+	assert.Equal(t, &goutils.Response{Code: http.StatusNoContent}, r)
+	mInteractor.AssertExpectations(t)
+}
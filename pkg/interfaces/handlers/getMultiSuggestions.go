@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// GetMultiSuggestionsHandler implements the handler interface and responds
+// with the suggestions of several carousels for the same ad
+type GetMultiSuggestionsHandler struct {
+	Interactor          usecases.GetMultiSuggestionsInteractor
+	CurrencySymbol      string
+	UnitOfAccountSymbol string
+	Regions             DataMapping
+	Categories          DataMapping
+	// Attribution is optional, it tags every ad with a signed token
+	Attribution *Attribution
+	// Experiments is optional, it keys cached responses by variant
+	Experiments ExperimentAssigner
+	// HiddenAds is optional, it adds the ads and sellers hidden on the
+	// device to the excluded ones
+	HiddenAds ExclusionsGetter
+}
+
+// getMultiSuggestionsHandlerInput carousels are separated by commas. The
+// user or device headers assign the variant of carousels on experiment.
+// The exclude query param lists ads never suggested
+type getMultiSuggestionsHandlerInput struct {
+	ListID         string   `path:"listID" validate:"required,pattern=^[0-9]+$"`
+	Limit          int      `query:"limit" validate:"min=0"`
+	OptionalParams []string `query:"params"`
+	CarouselTypes  []string `query:"carousels" validate:"required,max=10,pattern=^[a-z_-]+$"`
+	UserID         string   `headers:"X-User-Id"`
+	DeviceID       string   `headers:"X-Device-Id"`
+	Exclude        []string `query:"exclude" validate:"max=100,pattern=^[0-9]+$"`
+	experiments    ExperimentAssigner
+	hiddenAds      ExclusionsGetter
+	// exclusions are the excluded and hidden ads, retrieved once per request
+	exclusions       domain.Exclusions
+	exclusionsLoaded bool
+}
+
+// getMultiSuggestionsCacheKey is the input responses are cached by
+type getMultiSuggestionsCacheKey struct {
+	Input      getMultiSuggestionsHandlerInput
+	Variants   []string
+	Exclusions domain.Exclusions
+}
+
+// CacheKey keys responses by the variants serving the carousels and the
+// exclusions instead of by user or device, so every unit on the same
+// variants shares them
+func (input *getMultiSuggestionsHandlerInput) CacheKey() interface{} {
+	key := getMultiSuggestionsCacheKey{Input: *input, Exclusions: input.excluded()}
+	unitID := experimentUnit(input.UserID, input.DeviceID)
+	for _, carousel := range input.CarouselTypes {
+		key.Variants = append(key.Variants, assignVariant(input.experiments, carousel, unitID))
+	}
+	key.Input.UserID, key.Input.DeviceID, key.Input.experiments = "", "", nil
+	key.Input.Exclude, key.Input.hiddenAds = nil, nil
+	key.Input.exclusions, key.Input.exclusionsLoaded = domain.Exclusions{}, false
+	return key
+}
+
+// excluded returns the ads excluded on the request and the ads and sellers
+// hidden on the device
+func (input *getMultiSuggestionsHandlerInput) excluded() domain.Exclusions {
+	if !input.exclusionsLoaded {
+		input.exclusions = exclusions(input.hiddenAds, input.DeviceID, input.Exclude)
+		input.exclusionsLoaded = true
+	}
+	return input.exclusions
+}
+
+// Validate checks every requested optional param is available on the output
+func (input *getMultiSuggestionsHandlerInput) Validate() []FieldError {
+	return validateOptionalParams(input.OptionalParams)
+}
+
+// getMultiSuggestionsHandlerOutput is the schema of the endpoint response,
+// carousels without suggestions are not included
+type getMultiSuggestionsHandlerOutput struct {
+	Carousels map[string]getSuggestionsHandlerOutput `json:"carousels"`
+}
+
+// Input returns a fresh, empty instance of getMultiSuggestionsHandlerInput
+func (h *GetMultiSuggestionsHandler) Input(ir InputRequest) HandlerInput {
+	input := getMultiSuggestionsHandlerInput{experiments: h.Experiments, hiddenAds: h.HiddenAds}
+	ir.Set(&input).FromPath().FromQuery().FromHeaders()
+	return &input
+}
+
+// Execute is the main function of the GetMultiSuggestions handler
+func (h *GetMultiSuggestionsHandler) Execute(ig InputGetter) *goutils.Response {
+	input, response := ig()
+	// cached and invalid input responses are returned as they are, cached
+	// errors are computed again
+	if response != nil && servable(response) {
+		return response
+	}
+	in := input.(*getMultiSuggestionsHandlerInput)
+	results, err := h.Interactor.GetMultiSuggestions(
+		usecases.MultiSuggestionsRequest{
+			ListID:         in.ListID,
+			OptionalParams: in.OptionalParams,
+			Size:           in.Limit,
+			CarouselTypes:  in.CarouselTypes,
+			UnitID:         experimentUnit(in.UserID, in.DeviceID),
+			Exclusions:     in.excluded(),
+		},
+	)
+	if err != nil {
+		return errorResponse(err)
+	}
+	presenter := GetSuggestionsHandler{
+		CurrencySymbol:      h.CurrencySymbol,
+		UnitOfAccountSymbol: h.UnitOfAccountSymbol,
+		Regions:             h.Regions,
+		Categories:          h.Categories,
+	}
+	output := getMultiSuggestionsHandlerOutput{Carousels: make(map[string]getSuggestionsHandlerOutput)}
+	for carousel, result := range results {
+		if len(result.Ads) == 0 {
+			continue
+		}
+		carouselOutput := presenter.setOutput(result.Ads, in.OptionalParams)
+		carouselOutput.Cursor = result.Cursor
+		carouselOutput.Variant = result.Variant
+		h.Attribution.sign(carouselOutput.Ads, carousel, result.Variant, in.ListID, 0)
+		output.Carousels[carousel] = carouselOutput
+	}
+	if len(output.Carousels) == 0 {
+		return &goutils.Response{
+			Code: http.StatusNoContent,
+		}
+	}
+	return &goutils.Response{
+		Code: http.StatusOK,
+		Body: output,
+	}
+}
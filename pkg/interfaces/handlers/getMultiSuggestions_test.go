@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Yapo/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+type mockGetMultiSuggestions struct {
+	mock.Mock
+}
+
+func (m *mockGetMultiSuggestions) GetMultiSuggestions(
+	request usecases.MultiSuggestionsRequest,
+) (map[string]usecases.SuggestionsResult, error) {
+	args := m.Called(request)
+	results, _ := args.Get(0).(map[string]usecases.SuggestionsResult)
+	return results, args.Error(1)
+}
+
+func TestGetMultiSuggestionsHandlerInput(t *testing.T) {
+	mMockInputRequest := MockInputRequest{}
+	mMockTargetRequest := MockTargetRequest{}
+	mMockInputRequest.On(
+		"Set", mock.AnythingOfType("*handlers.getMultiSuggestionsHandlerInput"),
+	).Return(&mMockTargetRequest)
+	mMockTargetRequest.On("FromPath").Return()
+	mMockTargetRequest.On("FromQuery").Return()
+	mMockTargetRequest.On("FromHeaders").Return()
+
+	h := GetMultiSuggestionsHandler{}
+	input := h.Input(&mMockInputRequest)
+
+	var expected *getMultiSuggestionsHandlerInput
+	assert.IsType(t, expected, input)
+	mMockTargetRequest.AssertExpectations(t)
+	mMockInputRequest.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsHandlerOK(t *testing.T) {
+	mInteractor := &mockGetMultiSuggestions{}
+	mInteractor.On("GetMultiSuggestions", usecases.MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          1,
+		CarouselTypes: []string{"default", "pro"},
+	}).Return(map[string]usecases.SuggestionsResult{
+		"default": {Ads: []domain.Ad{{ListID: 2, Currency: "uf"}}, Cursor: "next"},
+		"pro":     {Ads: []domain.Ad{}},
+	}, nil)
+	h := GetMultiSuggestionsHandler{
+		Interactor:          mInteractor,
+		UnitOfAccountSymbol: "UF",
+	}
+	input := &getMultiSuggestionsHandlerInput{
+		ListID:        "1",
+		Limit:         1,
+		CarouselTypes: []string{"default", "pro"},
+	}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+
+	expected := &goutils.Response{
+		Code: http.StatusOK,
+		Body: getMultiSuggestionsHandlerOutput{
+			Carousels: map[string]getSuggestionsHandlerOutput{
+				"default": {
+					Ads:    []AdsOutput{{ListID: "2", Currency: "UF", Date: "0001-01-01 00:00:00"}},
+					Cursor: "next",
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, r)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsHandlerNoContent(t *testing.T) {
+	mInteractor := &mockGetMultiSuggestions{}
+	mInteractor.On("GetMultiSuggestions", mock.Anything).Return(map[string]usecases.SuggestionsResult{
+		"default": {Ads: []domain.Ad{}},
+	}, nil)
+	h := GetMultiSuggestionsHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getMultiSuggestionsHandlerInput{}, nil))
+	assert.Equal(t, &goutils.Response{Code: http.StatusNoContent}, r)
+}
+
+func TestGetMultiSuggestionsHandlerError(t *testing.T) {
+	mInteractor := &mockGetMultiSuggestions{}
+	err := domain.NewError(domain.InvalidInputError, domain.ErrCodeInvalidCarousel, "invalid carousel: 'x'", nil)
+	mInteractor.On("GetMultiSuggestions", mock.Anything).Return(nil, err)
+	h := GetMultiSuggestionsHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getMultiSuggestionsHandlerInput{}, nil))
+
+	expected := &goutils.Response{
+		Code: http.StatusBadRequest,
+		Body: &ErrorOutput{
+			ErrorMessage: "invalid carousel: 'x'",
+			ErrorCode:    domain.ErrCodeInvalidCarousel,
+		},
+	}
+	assert.Equal(t, expected, r)
+}
+
+func TestGetMultiSuggestionsHandlerValidate(t *testing.T) {
+	input := getMultiSuggestionsHandlerInput{OptionalParams: []string{"price", "unknown"}}
+	assert.Equal(t, []FieldError{{Field: "params", Message: "unknown param 'unknown'"}}, input.Validate())
+}
+
+func TestGetMultiSuggestionsHandlerCachedError(t *testing.T) {
+	mInteractor := &mockGetMultiSuggestions{}
+	mInteractor.On("GetMultiSuggestions", mock.Anything).Return(map[string]usecases.SuggestionsResult{
+		"default": {Ads: []domain.Ad{}},
+	}, nil).Once()
+	h := GetMultiSuggestionsHandler{Interactor: mInteractor}
+	cached := &goutils.Response{Code: http.StatusGatewayTimeout}
+	r := h.Execute(MakeMockInputGetter(&getMultiSuggestionsHandlerInput{}, cached))
+	assert.Equal(t, &goutils.Response{Code: http.StatusNoContent}, r)
+	mInteractor.AssertExpectations(t)
+}
@@ -24,20 +24,137 @@ type GetSuggestionsHandler struct {
 	UnitOfAccountSymbol string
 	Regions             DataMapping
 	Categories          DataMapping
+	// Attribution is optional, it tags every ad with a signed token
+	Attribution *Attribution
+	// Experiments is optional, it keys cached responses by variant
+	Experiments ExperimentAssigner
+	// RecentlyViewed is optional, it adds the ads stored as viewed on the
+	// device to the viewed ones
+	RecentlyViewed ViewedAdsMerger
+	// HiddenAds is optional, it adds the ads and sellers hidden on the
+	// device to the excluded ones
+	HiddenAds ExclusionsGetter
+	// Sponsored is optional, it skips caching the first pages of frequency
+	// capped carousels
+	Sponsored FrequencyCapChecker
 }
 
+// FrequencyCapChecker tells whether the responses of a carousel depend on
+// the sponsored ads already served to each user or device
+type FrequencyCapChecker interface {
+	FrequencyCapped(carousel string) bool
+}
+
+// getSuggestionsHandlerInput from is limited by the elasticsearch
+// max_result_window and cursors are url safe base64 strings. The user or
+// device headers assign the variant of carousels on experiment. The ads
+// viewed on the session are sent on the viewed query param or the
+// X-Viewed-Ads header, most recent first. The exclude query param lists
+// ads never suggested
 type getSuggestionsHandlerInput struct {
-	ListID         string   `path:"listID"`
-	From           int      `query:"from"`
-	Limit          int      `query:"limit"`
+	ListID         string   `path:"listID" validate:"required,pattern=^[0-9]+$"`
+	From           int      `query:"from" validate:"min=0,max=10000"`
+	Limit          int      `query:"limit" validate:"min=0"`
 	OptionalParams []string `query:"params"`
-	CarouselType   string   `path:"carousel"`
+	CarouselType   string   `path:"carousel" validate:"required"`
+	Cursor         string   `query:"cursor" validate:"pattern=^[A-Za-z0-9_-]+$"`
+	UserID         string   `headers:"X-User-Id"`
+	DeviceID       string   `headers:"X-Device-Id"`
+	Viewed         []string `query:"viewed" validate:"pattern=^[0-9]+$"`
+	ViewedHeader   []string `headers:"X-Viewed-Ads" validate:"pattern=^[0-9]+$"`
+	Exclude        []string `query:"exclude" validate:"max=100,pattern=^[0-9]+$"`
+	experiments    ExperimentAssigner
+	recentlyViewed ViewedAdsMerger
+	hiddenAds      ExclusionsGetter
+	sponsored      FrequencyCapChecker
+	// viewedAds are the merged viewed ads and exclusions the excluded and
+	// hidden ones, retrieved once per request
+	viewedAds        []int64
+	viewedLoaded     bool
+	exclusions       domain.Exclusions
+	exclusionsLoaded bool
+}
+
+// getSuggestionsCacheKey is the input responses are cached by
+type getSuggestionsCacheKey struct {
+	Input      getSuggestionsHandlerInput
+	Variant    string
+	Viewed     []int64
+	Exclusions domain.Exclusions
+}
+
+// CacheKey keys responses by the variant serving the carousel, the ads
+// viewed and the exclusions instead of by user or device, so every unit on
+// a variant shares its responses
+func (input *getSuggestionsHandlerInput) CacheKey() interface{} {
+	key := getSuggestionsCacheKey{Input: *input, Viewed: input.viewed(), Exclusions: input.excluded()}
+	key.Variant = assignVariant(input.experiments, input.CarouselType, experimentUnit(input.UserID, input.DeviceID))
+	key.Input.UserID, key.Input.DeviceID, key.Input.experiments = "", "", nil
+	key.Input.sponsored = nil
+	key.Input.Viewed, key.Input.ViewedHeader, key.Input.recentlyViewed = nil, nil, nil
+	key.Input.viewedAds, key.Input.viewedLoaded = nil, false
+	key.Input.Exclude, key.Input.hiddenAds = nil, nil
+	key.Input.exclusions, key.Input.exclusionsLoaded = domain.Exclusions{}, false
+	return key
+}
+
+// SkipCache tells the first pages of frequency capped carousels are not
+// cached, so every request counts the sponsored ads served to its unit
+func (input *getSuggestionsHandlerInput) SkipCache() bool {
+	if input.sponsored == nil || input.From != 0 || input.Cursor != "" {
+		return false
+	}
+	carousel := input.CarouselType
+	if variant := assignVariant(input.experiments, carousel, experimentUnit(input.UserID, input.DeviceID)); variant != "" {
+		carousel = variant
+	}
+	return input.sponsored.FrequencyCapped(carousel)
+}
+
+// viewed returns the ads viewed on the request and stored for the device
+func (input *getSuggestionsHandlerInput) viewed() []int64 {
+	if !input.viewedLoaded {
+		input.viewedAds = viewedAds(input.recentlyViewed, input.DeviceID, input.Viewed, input.ViewedHeader)
+		input.viewedLoaded = true
+	}
+	return input.viewedAds
+}
+
+// excluded returns the ads excluded on the request and the ads and sellers
+// hidden on the device
+func (input *getSuggestionsHandlerInput) excluded() domain.Exclusions {
+	if !input.exclusionsLoaded {
+		input.exclusions = exclusions(input.hiddenAds, input.DeviceID, input.Exclude)
+		input.exclusionsLoaded = true
+	}
+	return input.exclusions
+}
+
+// Validate checks every requested optional param is available on the output
+func (input *getSuggestionsHandlerInput) Validate() []FieldError {
+	return validateOptionalParams(input.OptionalParams)
+}
+
+// validateOptionalParams checks every param is available on the output
+func validateOptionalParams(optionalParams []string) (errs []FieldError) {
+	output := AdsOutput{}
+	for _, param := range optionalParams {
+		if !output.hasField(param) {
+			errs = append(errs, FieldError{Field: "params", Message: fmt.Sprintf("unknown param '%s'", param)})
+		}
+	}
+	return
 }
 
 // getProSuggestionsHandlerOutput struct that represents presenter output.
 // This is the schema of endpoint response
 type getSuggestionsHandlerOutput struct {
 	Ads []AdsOutput `json:"ads"`
+	// Cursor allows to request the next page, it is empty on the last page
+	Cursor string `json:"cursor,omitempty"`
+	// Variant is the carousel that served the ads when the requested one
+	// is on experiment
+	Variant string `json:"variant,omitempty"`
 }
 
 // AdsOutput struct that represents Ads schema output
@@ -75,6 +192,15 @@ type AdsOutput struct {
 	PublisherType       string      `json:"publisherType,omitempty"`
 	BrandID             string      `json:"brandid,omitempty"`
 	ModelID             string      `json:"modelid,omitempty"`
+	Distance            string      `json:"distance,omitempty"`
+	// Token is the signed attribution of the recommendation, sent back on
+	// the events of the ad
+	Token string `json:"token,omitempty"`
+	// Source is the carousel configuration that picked the ad on
+	// interleaved carousels
+	Source string `json:"source,omitempty"`
+	// Sponsored tells the ad is served on a paid slot
+	Sponsored bool `json:"sponsored,omitempty"`
 }
 
 // Image struct that defines the internal structure of the images
@@ -85,6 +211,18 @@ type imageOutput struct {
 	Small  string `json:"small,omitempty"`
 }
 
+// hasField reports whether name is a json tag of AdsOutput, ignoring case
+func (output *AdsOutput) hasField(name string) bool {
+	val := reflect.TypeOf(output).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		fieldtag := strings.Split(val.Field(i).Tag.Get("json"), ",")[0]
+		if fieldtag != "" && fieldtag != "-" && strings.EqualFold(fieldtag, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // addOptionalParam sets a value on AdsOutput if name is a tag on struct
 // returns true when all is done successfully, otherwise false
 func (output *AdsOutput) addOptionalParam(name, value string) bool {
@@ -150,44 +288,54 @@ func (output *AdsOutput) SetCategory(categories DataMapping) {
 }
 
 // Input returns a fresh, empty instance of getProSuggestionsHandlerInput
-func (*GetSuggestionsHandler) Input(ir InputRequest) HandlerInput {
-	input := getSuggestionsHandlerInput{}
-	ir.Set(&input).FromPath().FromQuery()
+func (h *GetSuggestionsHandler) Input(ir InputRequest) HandlerInput {
+	input := getSuggestionsHandlerInput{
+		experiments:    h.Experiments,
+		recentlyViewed: h.RecentlyViewed,
+		hiddenAds:      h.HiddenAds,
+		sponsored:      h.Sponsored,
+	}
+	ir.Set(&input).FromPath().FromQuery().FromHeaders()
 	return &input
 }
 
 // Execute is the main function of the GetProSuggestions handler
 func (h *GetSuggestionsHandler) Execute(ig InputGetter) *goutils.Response {
 	input, response := ig()
-	if response != nil {
-		if response.Code == http.StatusOK {
-			return response
-		}
+	// cached and invalid input responses are returned as they are, cached
+	// errors are computed again
+	if response != nil && servable(response) {
+		return response
 	}
 	in := input.(*getSuggestionsHandlerInput)
 	results, errSuggestions := h.Interactor.GetSuggestions(
-		in.ListID,
-		in.OptionalParams,
-		in.Limit,
-		in.From,
-		in.CarouselType,
+		usecases.SuggestionsRequest{
+			ListID:         in.ListID,
+			OptionalParams: in.OptionalParams,
+			Size:           in.Limit,
+			From:           in.From,
+			CarouselType:   in.CarouselType,
+			Cursor:         in.Cursor,
+			UnitID:         experimentUnit(in.UserID, in.DeviceID),
+			Viewed:         in.viewed(),
+			Exclusions:     in.excluded(),
+		},
 	)
 	if errSuggestions != nil {
-		return &goutils.Response{
-			Code: http.StatusInternalServerError,
-			Body: &goutils.GenericError{
-				ErrorMessage: errSuggestions.Error(),
-			},
-		}
+		return errorResponse(errSuggestions)
 	}
-	if len(results) == 0 {
+	if len(results.Ads) == 0 {
 		return &goutils.Response{
 			Code: http.StatusNoContent,
 		}
 	}
+	output := h.setOutput(results.Ads, in.OptionalParams)
+	output.Cursor = results.Cursor
+	output.Variant = results.Variant
+	h.Attribution.sign(output.Ads, in.CarouselType, results.Variant, in.ListID, results.Offset)
 	return &goutils.Response{
 		Code: http.StatusOK,
-		Body: h.setOutput(results, in.OptionalParams),
+		Body: output,
 	}
 }
 
@@ -208,7 +356,9 @@ func (h *GetSuggestionsHandler) setOutput(
 				Medium: ad.Image.Medium,
 				Small:  ad.Image.Small,
 			},
-			URL: fixedURL(params["url"]),
+			URL:       fixedURL(params["url"]),
+			Source:    ad.Source,
+			Sponsored: ad.Sponsored,
 		}
 		if ad.Currency == "uf" {
 			adOutTemp.Currency = h.UnitOfAccountSymbol
@@ -220,6 +370,10 @@ func (h *GetSuggestionsHandler) setOutput(
 		for _, optionalParam := range optionalParams {
 			optionalParam = strings.ToLower(optionalParam)
 			if val, ok := params[optionalParam]; ok {
+				// params with a translated label are shown with the label
+				if param, found := ad.GetParam(optionalParam); found && param.String() == val {
+					val = param.Display()
+				}
 				if val != "" {
 					adOutTemp.addOptionalParam(optionalParam, val)
 				}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
 )
 
 type mockGetSuggestions struct {
@@ -17,13 +19,10 @@ type mockGetSuggestions struct {
 }
 
 func (m *mockGetSuggestions) GetSuggestions(
-	listID string,
-	optionalParams []string,
-	size, from int,
-	carouselType string,
-) (ads []domain.Ad, err error) {
-	args := m.Called(listID, size, from)
-	return args.Get(0).([]domain.Ad), args.Error(1)
+	request usecases.SuggestionsRequest,
+) (usecases.SuggestionsResult, error) {
+	args := m.Called(request)
+	return args.Get(0).(usecases.SuggestionsResult), args.Error(1)
 }
 
 type mockDataMapping struct {
@@ -44,6 +43,7 @@ func TestGetSuggestionsHandlerInput(t *testing.T) {
 	).Return(&mMockTargetRequest)
 	mMockTargetRequest.On("FromPath").Return()
 	mMockTargetRequest.On("FromQuery").Return()
+	mMockTargetRequest.On("FromHeaders").Return()
 
 	h := GetSuggestionsHandler{
 		Interactor: &m,
@@ -74,8 +74,8 @@ func TestGetSuggestionsHandlerOK(t *testing.T) {
 		ListTime: timeT,
 	}
 	mInteractor.On(
-		"GetSuggestions", mock.Anything, mock.Anything, mock.Anything,
-	).Return([]domain.Ad{ad}, nil)
+		"GetSuggestions", mock.Anything,
+	).Return(usecases.SuggestionsResult{Ads: []domain.Ad{ad}}, nil)
 	h := GetSuggestionsHandler{
 		Interactor: mInteractor,
 	}
@@ -100,12 +100,42 @@ func TestGetSuggestionsHandlerOK(t *testing.T) {
 	mInteractor.AssertExpectations(t)
 }
 
+func TestGetSuggestionsHandlerCursorOK(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	ad := domain.Ad{ListID: 1}
+	mInteractor.On("GetSuggestions", usecases.SuggestionsRequest{
+		ListID: "1",
+		Size:   1,
+		Cursor: "current",
+	}).Return(usecases.SuggestionsResult{Ads: []domain.Ad{ad}, Cursor: "next"}, nil)
+	h := GetSuggestionsHandler{
+		Interactor: mInteractor,
+	}
+	input := &getSuggestionsHandlerInput{
+		ListID: "1",
+		Limit:  1,
+		Cursor: "current",
+	}
+	getter := MakeMockInputGetter(input, nil)
+	r := h.Execute(getter)
+
+	expected := &goutils.Response{
+		Code: http.StatusOK,
+		Body: getSuggestionsHandlerOutput{
+			Ads:    []AdsOutput{{ListID: "1", Date: "0001-01-01 00:00:00"}},
+			Cursor: "next",
+		},
+	}
+	assert.Equal(t, expected, r)
+	mInteractor.AssertExpectations(t)
+}
+
 func TestGetProSuggestionsHandlerError(t *testing.T) {
 	mInteractor := &mockGetSuggestions{}
 	err := fmt.Errorf("err")
 	mInteractor.On(
-		"GetSuggestions", mock.Anything, mock.Anything, mock.Anything,
-	).Return([]domain.Ad{}, err)
+		"GetSuggestions", mock.Anything,
+	).Return(usecases.SuggestionsResult{Ads: []domain.Ad{}}, err)
 
 	h := GetSuggestionsHandler{
 		Interactor: mInteractor,
@@ -118,19 +148,55 @@ func TestGetProSuggestionsHandlerError(t *testing.T) {
 
 	expected := &goutils.Response{
 		Code: http.StatusInternalServerError,
-		Body: &goutils.GenericError{
-			ErrorMessage: err.Error(),
+		Body: &ErrorOutput{
+			ErrorMessage: "internal error",
+			ErrorCode:    domain.ErrCodeInternal,
+			cause:        err,
 		},
 	}
 	assert.Equal(t, expected, r)
 	mInteractor.AssertExpectations(t)
 }
 
+func TestGetSuggestionsHandlerTypedErrors(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+		message  string
+		cause    bool
+	}{
+		{domain.NewError(domain.NotFoundError, domain.ErrCodeAdNotFound, "ad 1 not found", nil), http.StatusNotFound, "ad 1 not found", false},
+		{domain.NewError(domain.InvalidInputError, domain.ErrCodeInvalidCarousel, "invalid", nil), http.StatusBadRequest, "invalid", false},
+		{domain.NewError(domain.UnavailableError, domain.ErrCodeSearchUnavailable, "down", fmt.Errorf("refused")), http.StatusServiceUnavailable, "down", true},
+		{fmt.Errorf("getting ads: %w", domain.NewError(domain.TimeoutError, domain.ErrCodeSearchTimeout, "slow", nil)), http.StatusGatewayTimeout, "slow", true},
+	}
+	for _, c := range cases {
+		mInteractor := &mockGetSuggestions{}
+		mInteractor.On("GetSuggestions", mock.Anything).Return(usecases.SuggestionsResult{}, c.err)
+		h := GetSuggestionsHandler{Interactor: mInteractor}
+		getter := MakeMockInputGetter(&getSuggestionsHandlerInput{ListID: "1"}, nil)
+		r := h.Execute(getter)
+
+		expected := &goutils.Response{
+			Code: c.expected,
+			Body: &ErrorOutput{
+				ErrorMessage: c.message,
+				ErrorCode:    domain.ErrorCodeOf(c.err),
+			},
+		}
+		if c.cause {
+			expected.Body.(*ErrorOutput).cause = c.err
+		}
+		assert.Equal(t, expected, r)
+		mInteractor.AssertExpectations(t)
+	}
+}
+
 func TestGetProSuggestionsHandlerEmptyResult(t *testing.T) {
 	mInteractor := &mockGetSuggestions{}
 	mInteractor.On(
-		"GetSuggestions", mock.Anything, mock.Anything, mock.Anything,
-	).Return([]domain.Ad{}, nil)
+		"GetSuggestions", mock.Anything,
+	).Return(usecases.SuggestionsResult{Ads: []domain.Ad{}}, nil)
 	h := GetSuggestionsHandler{
 		Interactor: mInteractor,
 	}
@@ -218,9 +284,9 @@ func TestGetProSuggestionsHandlerOptionalParams(t *testing.T) {
 			ListTime:      timeT,
 			CommuneID:     250,
 			Type:          "sell",
-			AdParams: map[string]string{
-				"brand":   "TOYOTA",
-				"Mileage": "1234"},
+			AdParams: map[string]domain.AdParam{
+				"brand":   domain.NewLabelParam("12", "TOYOTA"),
+				"Mileage": domain.NewIntParam(1234)},
 		},
 	}
 	mRegions.On("Get", mock.AnythingOfType("string")).Return("Metropolitana").Once()
@@ -322,3 +388,137 @@ func TestSetFixedURL(t *testing.T) {
 	result := fixedURL("example")
 	assert.Equal(t, expected, result)
 }
+
+func TestGetSuggestionsHandlerInputValidate(t *testing.T) {
+	input := getSuggestionsHandlerInput{OptionalParams: []string{"PhoneLink", "mileage", "rooms"}}
+	expected := []FieldError{{Field: "params", Message: "unknown param 'rooms'"}}
+	assert.Equal(t, expected, input.Validate())
+}
+
+func TestGetSuggestionsHandlerInvalidInput(t *testing.T) {
+	response := &goutils.Response{Code: http.StatusBadRequest}
+	getter := MakeMockInputGetter(&getSuggestionsHandlerInput{}, response)
+	h := GetSuggestionsHandler{}
+	assert.Equal(t, response, h.Execute(getter))
+}
+
+func TestGetSuggestionsHandlerInterleaved(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", mock.Anything).Return(usecases.SuggestionsResult{
+		Ads: []domain.Ad{{ListID: 1, Source: "pro"}, {ListID: 2, Source: "similar"}},
+	}, nil)
+	h := GetSuggestionsHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getSuggestionsHandlerInput{ListID: "1", CarouselType: "default"}, nil))
+	ads := r.Body.(getSuggestionsHandlerOutput).Ads
+	assert.Equal(t, "pro", ads[0].Source)
+	assert.Equal(t, "similar", ads[1].Source)
+}
+
+func TestGetSuggestionsHandlerSponsored(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", mock.Anything).Return(usecases.SuggestionsResult{
+		Ads: []domain.Ad{{ListID: 1}, {ListID: 2, Sponsored: true}},
+	}, nil)
+	h := GetSuggestionsHandler{Interactor: mInteractor}
+	r := h.Execute(MakeMockInputGetter(&getSuggestionsHandlerInput{ListID: "1", CarouselType: "default"}, nil))
+	ads := r.Body.(getSuggestionsHandlerOutput).Ads
+	assert.False(t, ads[0].Sponsored)
+	assert.True(t, ads[1].Sponsored)
+}
+
+func TestGetSuggestionsHandlerCachedError(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", mock.Anything).Return(usecases.SuggestionsResult{
+		Ads: []domain.Ad{{ListID: 1}},
+	}, nil).Once()
+	h := GetSuggestionsHandler{Interactor: mInteractor}
+	cached := &goutils.Response{Code: http.StatusServiceUnavailable}
+	input := &getSuggestionsHandlerInput{ListID: "1", CarouselType: "default"}
+
+	// cached errors are not replayed
+	r := h.Execute(MakeMockInputGetter(input, cached))
+	assert.Equal(t, http.StatusOK, r.Code)
+	cached = &goutils.Response{Code: http.StatusOK}
+	assert.Equal(t, cached, h.Execute(MakeMockInputGetter(input, cached)))
+	mInteractor.AssertExpectations(t)
+}
+
+// cappedSuggestions serves a sponsored ad capped to once per unit
+type cappedSuggestions struct {
+	served map[string]int
+}
+
+func (s *cappedSuggestions) GetSuggestions(request usecases.SuggestionsRequest) (usecases.SuggestionsResult, error) {
+	ads := []domain.Ad{{ListID: 2}}
+	if s.served[request.UnitID] < 1 {
+		s.served[request.UnitID]++
+		ads = append(ads, domain.Ad{ListID: 9, Sponsored: true})
+	}
+	return usecases.SuggestionsResult{Ads: ads}, nil
+}
+
+func (*cappedSuggestions) FrequencyCapped(string) bool {
+	return true
+}
+
+// testRequestCache caches responses in memory by the input cache key
+type testRequestCache map[string]*goutils.Response
+
+func (c testRequestCache) GetCache(input interface{}) (*goutils.Response, error) {
+	if response, ok := c[fmt.Sprintf("%v", input.(RequestCacheKey).CacheKey())]; ok {
+		return response, nil
+	}
+	return nil, fmt.Errorf("not cached")
+}
+
+func (c testRequestCache) SetCache(input interface{}, response *goutils.Response) error {
+	c[fmt.Sprintf("%v", input.(RequestCacheKey).CacheKey())] = response
+	return nil
+}
+
+// testInputHandler fills the handler input as the request does
+type testInputHandler struct {
+	input *getSuggestionsHandlerInput
+}
+
+func (ih *testInputHandler) NewInputRequest(*http.Request) InputRequest {
+	target := &MockTargetRequest{}
+	target.On("FromPath").On("FromQuery").On("FromHeaders")
+	request := &MockInputRequest{}
+	request.On("Set", mock.Anything).Return(target)
+	return request
+}
+
+func (ih *testInputHandler) SetInputRequest(_ InputRequest, input HandlerInput) {
+	ih.input = input.(*getSuggestionsHandlerInput)
+	ih.input.ListID, ih.input.CarouselType, ih.input.DeviceID = "1", "default", "a1"
+}
+
+func (ih *testInputHandler) Input() (HandlerInput, *goutils.Response) {
+	return ih.input, nil
+}
+
+func TestGetSuggestionsHandlerFrequencyCapNotCached(t *testing.T) {
+	interactor := &cappedSuggestions{served: map[string]int{}}
+	h := &GetSuggestionsHandler{Interactor: interactor, Sponsored: interactor}
+	l := &MockLogger{}
+	l.On("LogRequestStart", mock.Anything)
+	l.On("LogRequestEnd", mock.Anything, mock.Anything, "")
+	cors := &MockCors{}
+	cors.On("GetHeaders").Return(map[string]string{})
+	browserCache := &MockCache{}
+	browserCache.On("Validate").Return(false)
+	fn := MakeJSONHandlerFunc(h, l, &testInputHandler{}, cors, browserCache, testRequestCache{})
+
+	// the sponsored ad capped to once is not replayed from the cache
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		fn(w, httptest.NewRequest("GET", "/recommendations/default/1", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		bodies = append(bodies, w.Body.String())
+	}
+	assert.Contains(t, bodies[0], `"sponsored":true`)
+	assert.NotContains(t, bodies[1], `"sponsored":true`)
+	assert.Equal(t, 1, interactor.served["a1"])
+}
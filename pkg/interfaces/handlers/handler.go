@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 )
 
 // HandlerInput is a placeholder for whatever input a handler may need.
@@ -65,6 +66,85 @@ type RequestCacheHandler interface {
 	SetCache(input interface{}, response *goutils.Response) error
 }
 
+// RequestCacheKey can be implemented by handler inputs whose responses do
+// not depend on every field, the cache is keyed by CacheKey instead
+type RequestCacheKey interface {
+	CacheKey() interface{}
+}
+
+// RequestCacheSkipper can be implemented by handler inputs whose responses
+// must not be cached, as the ones that change on every request
+type RequestCacheSkipper interface {
+	SkipCache() bool
+}
+
+// skipCache tells whether the input responses must not be cached
+func skipCache(input HandlerInput) bool {
+	skipper, ok := input.(RequestCacheSkipper)
+	return ok && skipper.SkipCache()
+}
+
+// ErrorOutput is the body of error responses. ErrorCode is a stable
+// value clients can branch on, ErrorMessage is meant for humans.
+// Fields lists the invalid input fields, if any. The cause is only logged
+type ErrorOutput struct {
+	ErrorMessage string
+	ErrorCode    string
+	Fields       []FieldError `json:"Fields,omitempty"`
+	cause        error
+}
+
+// FieldError describes why an input field is not valid
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// InputValidator can be implemented by handler inputs that need checks
+// not covered by validate tags. It is called once the input is filled
+type InputValidator interface {
+	Validate() []FieldError
+}
+
+// errorStatus maps domain error kinds to http status codes
+var errorStatus = map[domain.ErrorKind]int{ // nolint: gochecknoglobals
+	domain.NotFoundError:     http.StatusNotFound,
+	domain.InvalidInputError: http.StatusBadRequest,
+	domain.UnavailableError:  http.StatusServiceUnavailable,
+	domain.TimeoutError:      http.StatusGatewayTimeout,
+}
+
+// errorResponse returns the response for err, untyped errors are
+// reported as internal errors. Clients only get the public message,
+// err is kept as the cause to be logged when it tells more
+func errorResponse(err error) *goutils.Response {
+	code, ok := errorStatus[domain.ErrorKindOf(err)]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	output := &ErrorOutput{
+		ErrorMessage: domain.ErrorMessageOf(err),
+		ErrorCode:    domain.ErrorCodeOf(err),
+	}
+	if err.Error() != output.ErrorMessage {
+		output.cause = err
+	}
+	return &goutils.Response{Code: code, Body: output}
+}
+
+// servable tells whether a response returned by the input getter, cached
+// or from input validation, can be served as it is. Other cached responses
+// are computed again
+func servable(response *goutils.Response) bool {
+	return response.Code == http.StatusOK || response.Code == http.StatusBadRequest
+}
+
+// cacheable tells whether a response can be cached. Server errors may be
+// transient and empty responses may be filled soon, so they are not
+func cacheable(response *goutils.Response) bool {
+	return response.Code < http.StatusInternalServerError && response.Code != http.StatusNoContent
+}
+
 const CACHESET string = " (cache set)"
 const FROMCACHE string = " (from cache)"
 
@@ -87,6 +167,7 @@ type JSONHandlerLogger interface {
 	LogRequestStart(r *http.Request)
 	LogRequestEnd(*http.Request, *goutils.Response, string)
 	LogRequestPanic(*http.Request, *goutils.Response, interface{})
+	LogRequestError(*http.Request, *goutils.Response, error)
 }
 
 // jsonHandler provides an http.HandlerFunc that reads its input and formats
@@ -107,11 +188,14 @@ func (jh *jsonHandler) setupCors(w *http.ResponseWriter) {
 }
 
 // inputGetterCacheDecorator will decorate the input getter and will validate if a cache is
-// already set then returning it
+// already set then returning it, unless it is not servable
 func (jh *jsonHandler) inputGetterCacheDecorator(input InputGetter, status *string) InputGetter {
 	decorator := func() (HandlerInput, *goutils.Response) {
 		requestInput, requestResponse := input()
-		if cachedResponse, err := jh.requestCache.GetCache(requestInput); err == nil {
+		if skipCache(requestInput) {
+			return requestInput, requestResponse
+		}
+		if cachedResponse, err := jh.requestCache.GetCache(requestInput); err == nil && servable(cachedResponse) {
 			*status = FROMCACHE
 			return requestInput, cachedResponse
 		}
@@ -160,9 +244,14 @@ func (jh *jsonHandler) run(w http.ResponseWriter, r *http.Request) {
 		response = jh.handler.Execute(
 			jh.inputGetterCacheDecorator(jh.inputHandler.Input, &requestCacheStatus),
 		)
-		if err := jh.requestCache.SetCache(input, response); err == nil {
-			requestCacheStatus = CACHESET
+		if cacheable(response) && !skipCache(input) {
+			if err := jh.requestCache.SetCache(input, response); err == nil {
+				requestCacheStatus = CACHESET
+			}
 		}
 	}
+	if output, ok := response.Body.(*ErrorOutput); ok && output.cause != nil {
+		jh.logger.LogRequestError(r, response, output.cause)
+	}
 	jh.logger.LogRequestEnd(r, response, requestCacheStatus)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,7 @@ import (
 	mux "gopkg.in/gorilla/mux.v1"
 
 	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 )
 
 func MakeMockInputGetter(input HandlerInput, response *goutils.Response) InputGetter {
@@ -82,6 +84,9 @@ func (m *MockLogger) LogRequestEnd(r *http.Request, response *goutils.Response,
 func (m *MockLogger) LogRequestPanic(r *http.Request, response *goutils.Response, err interface{}) {
 	m.Called(r, response, err)
 }
+func (m *MockLogger) LogRequestError(r *http.Request, response *goutils.Response, err error) {
+	m.Called(r, response, err)
+}
 
 type DummyInput struct {
 	X int
@@ -442,3 +447,79 @@ func TestJsonHandlerFuncCache(t *testing.T) {
 	mCache.AssertExpectations(t)
 	mRequestCache.AssertExpectations(t)
 }
+
+func TestCacheableResponses(t *testing.T) {
+	assert.True(t, cacheable(&goutils.Response{Code: http.StatusOK}))
+	assert.True(t, cacheable(&goutils.Response{Code: http.StatusBadRequest}))
+	assert.False(t, cacheable(&goutils.Response{Code: http.StatusNoContent}))
+	assert.False(t, cacheable(&goutils.Response{Code: http.StatusServiceUnavailable}))
+	assert.False(t, cacheable(&goutils.Response{Code: http.StatusGatewayTimeout}))
+	assert.True(t, servable(&goutils.Response{Code: http.StatusOK}))
+	assert.True(t, servable(&goutils.Response{Code: http.StatusBadRequest}))
+	assert.False(t, servable(&goutils.Response{Code: http.StatusNotFound}))
+}
+
+func TestJSONHandlerSkipsCachingErrors(t *testing.T) {
+	h := MockHandler{}
+	ih := MockInputHandler{}
+	l := MockLogger{}
+	input := &DummyInput{}
+	response := &goutils.Response{Code: http.StatusServiceUnavailable}
+	h.On("Execute", mock.AnythingOfType("handlers.InputGetter")).Return(response).Once()
+	h.On("Input", mock.AnythingOfType("*handlers.MockInputRequest")).Return(input).Once()
+	ih.On("NewInputRequest", mock.AnythingOfType("*http.Request")).Return(&MockInputRequest{})
+	ih.On("SetInputRequest", mock.AnythingOfType("*handlers.MockInputRequest"), input)
+	ih.On("Input").Return(input, (*goutils.Response)(nil))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/someurl", strings.NewReader("{}"))
+	l.On("LogRequestStart", r)
+	l.On("LogRequestEnd", r, response, "")
+	mC := MockCors{}
+	mC.On("GetHeaders").Return(map[string]string{})
+	mCache := MockCache{}
+	mCache.On("Validate").Return(false)
+	mRequestCache := MockRequestCache{}
+	mRequestCache.On("GetCache", input).Return(&goutils.Response{Code: http.StatusServiceUnavailable}, nil)
+	fn := MakeJSONHandlerFunc(&h, &l, &ih, &mC, &mCache, &mRequestCache)
+	fn(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	h.AssertExpectations(t)
+	l.AssertExpectations(t)
+	mRequestCache.AssertNotCalled(t, "SetCache", mock.Anything, mock.Anything)
+}
+
+func TestJSONHandlerLogsErrorCause(t *testing.T) {
+	h := MockHandler{}
+	ih := MockInputHandler{}
+	l := MockLogger{}
+	input := &DummyInput{}
+	err := domain.NewError(domain.UnavailableError, domain.ErrCodeSearchUnavailable, "search unavailable", fmt.Errorf("connection refused"))
+	response := errorResponse(err)
+	h.On("Execute", mock.AnythingOfType("handlers.InputGetter")).Return(response).Once()
+	h.On("Input", mock.AnythingOfType("*handlers.MockInputRequest")).Return(input).Once()
+	ih.On("NewInputRequest", mock.AnythingOfType("*http.Request")).Return(&MockInputRequest{})
+	ih.On("SetInputRequest", mock.AnythingOfType("*handlers.MockInputRequest"), input)
+	ih.On("Input").Return(input, (*goutils.Response)(nil))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/someurl", strings.NewReader("{}"))
+	l.On("LogRequestStart", r)
+	l.On("LogRequestError", r, response, err).Once()
+	l.On("LogRequestEnd", r, response, "")
+	mC := MockCors{}
+	mC.On("GetHeaders").Return(map[string]string{})
+	mCache := MockCache{}
+	mCache.On("Validate").Return(false)
+	mRequestCache := MockRequestCache{}
+	mRequestCache.On("GetCache", input).Return((*goutils.Response)(nil), fmt.Errorf("miss"))
+	fn := MakeJSONHandlerFunc(&h, &l, &ih, &mC, &mCache, &mRequestCache)
+	fn(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	body, _ := json.Marshal(errorResponse(err).Body)
+	assert.Equal(t, `{"ErrorMessage":"search unavailable","ErrorCode":"`+domain.ErrCodeSearchUnavailable+`"}`, string(body))
+	h.AssertExpectations(t)
+	l.AssertExpectations(t)
+}
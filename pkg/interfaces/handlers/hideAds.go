@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// ExclusionsGetter returns the excluded ads followed by the ads and sellers
+// hidden on the device
+type ExclusionsGetter interface {
+	Exclusions(deviceID string, excluded []int64) domain.Exclusions
+}
+
+// exclusions returns the excluded list ids, invalid values are ignored,
+// along with the ones hidden on the device when there is a getter
+func exclusions(getter ExclusionsGetter, deviceID string, values []string) domain.Exclusions {
+	var excluded []int64
+	for _, value := range values {
+		if listID, err := strconv.ParseInt(value, 10, 64); err == nil && listID > 0 {
+			excluded = append(excluded, listID)
+		}
+	}
+	if getter == nil || deviceID == "" && len(excluded) == 0 {
+		return domain.Exclusions{ListIDs: excluded}
+	}
+	return getter.Exclusions(deviceID, excluded)
+}
+
+// HideAdsHandler implements the handler interface and hides an ad, or
+// every ad of its seller, from the suggestions of a device
+type HideAdsHandler struct {
+	Interactor usecases.HideAdsInteractor
+}
+
+// hideAdsHandlerInput is the request body, the device header identifies
+// the device the ad is hidden on. List ids may be sent as numbers or as
+// the strings of the recommendations response
+type hideAdsHandlerInput struct {
+	ListID   json.Number `json:"listId"`
+	Seller   bool        `json:"seller"`
+	DeviceID string      `json:"-" headers:"X-Device-Id" validate:"required"`
+}
+
+// Validate checks the hidden ad is a list id
+func (input *hideAdsHandlerInput) Validate() []FieldError {
+	if _, err := parseListID(input.ListID); err != nil {
+		return []FieldError{{Field: "listId", Message: "must be a list id"}}
+	}
+	return nil
+}
+
+// Input returns a fresh, empty instance of hideAdsHandlerInput
+func (*HideAdsHandler) Input(ir InputRequest) HandlerInput {
+	input := hideAdsHandlerInput{}
+	ir.Set(&input).FromJSONBody().FromHeaders()
+	return &input
+}
+
+// Execute is the main function of the HideAds handler
+func (h *HideAdsHandler) Execute(ig InputGetter) *goutils.Response {
+	input, response := ig()
+	if response != nil {
+		return response
+	}
+	in := input.(*hideAdsHandlerInput)
+	listID, _ := parseListID(in.ListID)
+	err := h.Interactor.HideAds(usecases.HideAdsRequest{
+		DeviceID: in.DeviceID,
+		ListID:   listID,
+		Seller:   in.Seller,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+	return &goutils.Response{
+		Code: http.StatusNoContent,
+	}
+}
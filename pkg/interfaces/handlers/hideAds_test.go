@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Yapo/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+type mockHideAds struct {
+	mock.Mock
+}
+
+func (m *mockHideAds) HideAds(request usecases.HideAdsRequest) error {
+	return m.Called(request).Error(0)
+}
+
+type mockExclusionsGetter struct {
+	mock.Mock
+}
+
+func (m *mockExclusionsGetter) Exclusions(deviceID string, excluded []int64) domain.Exclusions {
+	return m.Called(deviceID, excluded).Get(0).(domain.Exclusions)
+}
+
+func TestExclusions(t *testing.T) {
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{3, 2}}, exclusions(nil, "device", []string{"3", "x", "0", "2"}))
+	assert.Equal(t, domain.Exclusions{}, exclusions(nil, "", nil))
+
+	getter := &mockExclusionsGetter{}
+	getter.On("Exclusions", "device", []int64{3}).Return(domain.Exclusions{ListIDs: []int64{3, 5}, UserIDs: []int64{7}})
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{3, 5}, UserIDs: []int64{7}},
+		exclusions(getter, "device", []string{"3"}))
+	assert.Equal(t, domain.Exclusions{}, exclusions(getter, "", nil))
+	getter.AssertNumberOfCalls(t, "Exclusions", 1)
+}
+
+func TestHideAdsHandlerInput(t *testing.T) {
+	mMockInputRequest := MockInputRequest{}
+	mMockTargetRequest := MockTargetRequest{}
+	mMockInputRequest.On(
+		"Set", mock.AnythingOfType("*handlers.hideAdsHandlerInput"),
+	).Return(&mMockTargetRequest)
+	mMockTargetRequest.On("FromJSONBody").Return()
+	mMockTargetRequest.On("FromHeaders").Return()
+
+	h := HideAdsHandler{}
+	input := h.Input(&mMockInputRequest)
+
+	var expected *hideAdsHandlerInput
+	assert.IsType(t, expected, input)
+	mMockTargetRequest.AssertExpectations(t)
+	mMockInputRequest.AssertExpectations(t)
+}
+
+func TestHideAdsHandlerInputValidate(t *testing.T) {
+	assert.Empty(t, (&hideAdsHandlerInput{ListID: "5"}).Validate())
+	assert.Equal(t, []FieldError{{Field: "listId", Message: "must be a list id"}},
+		(&hideAdsHandlerInput{ListID: "-5"}).Validate())
+}
+
+func TestHideAdsHandlerOK(t *testing.T) {
+	mInteractor := &mockHideAds{}
+	mInteractor.On("HideAds", usecases.HideAdsRequest{DeviceID: "device", ListID: 5, Seller: true}).Return(nil)
+	h := HideAdsHandler{Interactor: mInteractor}
+	input := &hideAdsHandlerInput{ListID: "5", Seller: true, DeviceID: "device"}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, &goutils.Response{Code: http.StatusNoContent}, r)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestHideAdsHandlerError(t *testing.T) {
+	mInteractor := &mockHideAds{}
+	mInteractor.On("HideAds", mock.Anything).Return(
+		domain.NewError(domain.UnavailableError, domain.ErrCodeHiddenUnavailable, "ad not hidden", errors.New("disk full")))
+	h := HideAdsHandler{Interactor: mInteractor}
+	input := &hideAdsHandlerInput{ListID: "5", DeviceID: "device"}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+	assert.Equal(t, domain.ErrCodeHiddenUnavailable, r.Body.(*ErrorOutput).ErrorCode)
+}
+
+func TestGetSuggestionsHandlerInputCacheKeyExclusions(t *testing.T) {
+	getter := &mockExclusionsGetter{}
+	getter.On("Exclusions", "a", []int64(nil)).Return(domain.Exclusions{UserIDs: []int64{7}}).Once()
+	hidden := &getSuggestionsHandlerInput{ListID: "1", DeviceID: "a", hiddenAds: getter}
+
+	assert.Equal(t, getSuggestionsCacheKey{
+		Input:      getSuggestionsHandlerInput{ListID: "1"},
+		Exclusions: domain.Exclusions{UserIDs: []int64{7}},
+	}, hidden.CacheKey())
+	assert.NotEqual(t, hidden.CacheKey(), (&getSuggestionsHandlerInput{ListID: "1"}).CacheKey())
+	getter.AssertExpectations(t)
+}
+
+func TestGetSuggestionsHandlerExclusions(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", usecases.SuggestionsRequest{
+		ListID: "1", CarouselType: "default", Exclusions: domain.Exclusions{ListIDs: []int64{3, 2}},
+	}).Return(usecases.SuggestionsResult{Ads: []domain.Ad{{ListID: 7}}}, nil)
+	h := GetSuggestionsHandler{Interactor: mInteractor}
+	input := &getSuggestionsHandlerInput{ListID: "1", CarouselType: "default", Exclude: []string{"3", "2"}}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsHandlerExclusions(t *testing.T) {
+	getter := &mockExclusionsGetter{}
+	getter.On("Exclusions", "device", []int64{3}).Return(domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}})
+	mInteractor := &mockGetMultiSuggestions{}
+	mInteractor.On("GetMultiSuggestions", usecases.MultiSuggestionsRequest{
+		ListID: "1", CarouselTypes: []string{"default"}, UnitID: "device",
+		Exclusions: domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}},
+	}).Return(map[string]usecases.SuggestionsResult{"default": {Ads: []domain.Ad{}}}, nil)
+	h := GetMultiSuggestionsHandler{Interactor: mInteractor}
+	input := &getMultiSuggestionsHandlerInput{
+		ListID: "1", CarouselTypes: []string{"default"}, DeviceID: "device", Exclude: []string{"3"}, hiddenAds: getter,
+	}
+	key := input.CacheKey().(getMultiSuggestionsCacheKey)
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}}, key.Exclusions)
+	h.Execute(MakeMockInputGetter(input, nil))
+	mInteractor.AssertExpectations(t)
+	getter.AssertNumberOfCalls(t, "Exclusions", 1)
+}
+
+func TestGetFeedHandlerExclusions(t *testing.T) {
+	getter := &mockExclusionsGetter{}
+	getter.On("Exclusions", "device", []int64{3}).Return(domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}})
+	mInteractor := &mockGetFeed{}
+	mInteractor.On("GetFeed", usecases.FeedRequest{
+		ListID: "1", Exclusions: domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}},
+	}).Return(usecases.FeedResult{Sections: []usecases.FeedSectionResult{}}, nil)
+	h := GetFeedHandler{Interactor: mInteractor}
+	input := &getFeedHandlerInput{ListID: "1", DeviceID: "device", Exclude: []string{"3"}, hiddenAds: getter}
+
+	// devices with the same exclusions share the cache key
+	other := &getFeedHandlerInput{ListID: "1", DeviceID: "other", Exclude: []string{"3"}, hiddenAds: getter}
+	getter.On("Exclusions", "other", []int64{3}).Return(domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}})
+	assert.Equal(t, input.CacheKey(), other.CacheKey())
+	assert.Equal(t, getFeedCacheKey{
+		Input:      getFeedHandlerInput{ListID: "1"},
+		Exclusions: domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}},
+	}, input.CacheKey())
+	assert.NotEqual(t, input.CacheKey(), (&getFeedHandlerInput{ListID: "1"}).CacheKey())
+	h.Execute(MakeMockInputGetter(input, nil))
+	mInteractor.AssertExpectations(t)
+	getter.AssertNumberOfCalls(t, "Exclusions", 2)
+}
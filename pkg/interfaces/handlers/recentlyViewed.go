@@ -0,0 +1,34 @@
+package handlers
+
+import "strconv"
+
+// maxViewedAds is how many of the most recently viewed ads personalize
+// the suggestions
+const maxViewedAds = 20
+
+// ViewedAdsMerger returns the ads viewed on the request followed by the
+// ones stored for the device
+type ViewedAdsMerger interface {
+	Merge(deviceID string, viewed []int64) []int64
+}
+
+// viewedAds returns the list ids of the viewed values, most recent first,
+// merged with the ones stored for the device when there is a merger. It
+// returns up to maxViewedAds ads, invalid values are ignored
+func viewedAds(merger ViewedAdsMerger, deviceID string, values ...[]string) []int64 {
+	var viewed []int64
+	for _, listIDs := range values {
+		for _, value := range listIDs {
+			if listID, err := strconv.ParseInt(value, 10, 64); err == nil && listID > 0 {
+				viewed = append(viewed, listID)
+			}
+		}
+	}
+	if merger != nil && (deviceID != "" || len(viewed) > 0) {
+		viewed = merger.Merge(deviceID, viewed)
+	}
+	if len(viewed) > maxViewedAds {
+		viewed = viewed[:maxViewedAds]
+	}
+	return viewed
+}
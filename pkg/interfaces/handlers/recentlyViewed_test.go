@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+type mockViewedAdsMerger struct {
+	mock.Mock
+}
+
+func (m *mockViewedAdsMerger) Merge(deviceID string, viewed []int64) []int64 {
+	merged, _ := m.Called(deviceID, viewed).Get(0).([]int64)
+	return merged
+}
+
+func TestViewedAds(t *testing.T) {
+	assert.Equal(t, []int64{3, 2, 1}, viewedAds(nil, "", []string{"3", "x", "0"}, []string{"2", "1"}))
+	assert.Nil(t, viewedAds(nil, "device"))
+
+	merger := &mockViewedAdsMerger{}
+	merger.On("Merge", "device", []int64{3}).Return([]int64{3, 5})
+	assert.Equal(t, []int64{3, 5}, viewedAds(merger, "device", []string{"3"}))
+	assert.Nil(t, viewedAds(merger, ""))
+	merger.AssertNumberOfCalls(t, "Merge", 1)
+
+	many := make([]string, maxViewedAds+5)
+	for i := range many {
+		many[i] = "1"
+	}
+	assert.Len(t, viewedAds(nil, "", many), maxViewedAds)
+}
+
+func TestGetSuggestionsHandlerInputCacheKeyViewed(t *testing.T) {
+	merger := &mockViewedAdsMerger{}
+	merger.On("Merge", "a", []int64(nil)).Return([]int64{7}).Once()
+	merger.On("Merge", "b", []int64{7}).Return([]int64{7}).Once()
+	stored := &getSuggestionsHandlerInput{ListID: "1", DeviceID: "a", recentlyViewed: merger}
+	sent := &getSuggestionsHandlerInput{ListID: "1", DeviceID: "b", Viewed: []string{"7"}, recentlyViewed: merger}
+
+	// the ads viewed key the cache, wherever they come from
+	assert.Equal(t, stored.CacheKey(), sent.CacheKey())
+	assert.Equal(t, getSuggestionsCacheKey{
+		Input:  getSuggestionsHandlerInput{ListID: "1"},
+		Viewed: []int64{7},
+	}, stored.CacheKey())
+	assert.NotEqual(t, stored.CacheKey(), (&getSuggestionsHandlerInput{ListID: "1"}).CacheKey())
+	merger.AssertExpectations(t)
+}
+
+func TestGetSuggestionsHandlerViewed(t *testing.T) {
+	mInteractor := &mockGetSuggestions{}
+	mInteractor.On("GetSuggestions", usecases.SuggestionsRequest{
+		ListID: "1", CarouselType: "suggested-ads", Viewed: []int64{3, 2},
+	}).Return(usecases.SuggestionsResult{Ads: []domain.Ad{{ListID: 7}}}, nil)
+	h := GetSuggestionsHandler{Interactor: mInteractor}
+	input := &getSuggestionsHandlerInput{
+		ListID: "1", CarouselType: "suggested-ads", Viewed: []string{"3"}, ViewedHeader: []string{"2"},
+	}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestGetFeedHandlerViewed(t *testing.T) {
+	merger := &mockViewedAdsMerger{}
+	merger.On("Merge", "device", []int64{3}).Return([]int64{3, 2})
+	mInteractor := &mockGetFeed{}
+	mInteractor.On("GetFeed", usecases.FeedRequest{ListID: "1", Viewed: []int64{3, 2}}).
+		Return(usecases.FeedResult{Sections: []usecases.FeedSectionResult{}}, nil)
+	h := GetFeedHandler{Interactor: mInteractor}
+	input := &getFeedHandlerInput{ListID: "1", DeviceID: "device", Viewed: []string{"3"}, recentlyViewed: merger}
+
+	// the ads viewed key the cache instead of the device
+	assert.Equal(t, getFeedCacheKey{Input: getFeedHandlerInput{ListID: "1"}, Viewed: []int64{3, 2}}, input.CacheKey())
+	h.Execute(MakeMockInputGetter(input, nil))
+	mInteractor.AssertExpectations(t)
+	merger.AssertNumberOfCalls(t, "Merge", 1)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Yapo/goutils"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// maxTrackedEvents is the maximum number of events of a request
+const maxTrackedEvents = 100
+
+// TrackEventsHandler implements the handler interface and stores the
+// impressions, clicks and replies of recommended ads
+type TrackEventsHandler struct {
+	Interactor usecases.TrackEventsInteractor
+}
+
+// trackEventsHandlerInput is the request body, events are batched by
+// clients. The device header identifies the device the events happened on
+type trackEventsHandlerInput struct {
+	Events   []trackEventInput `json:"events"`
+	DeviceID string            `json:"-" headers:"X-Device-Id"`
+}
+
+// trackEventInput is an interaction with a recommended ad. List ids may
+// be sent as numbers or as the strings of the recommendations response.
+// Events with the token of the recommended ad may omit its carousel and ads
+type trackEventInput struct {
+	Type         string      `json:"type"`
+	Carousel     string      `json:"carousel"`
+	SourceListID json.Number `json:"sourceListId"`
+	ListID       json.Number `json:"listId"`
+	Position     int         `json:"position"`
+	RequestID    string      `json:"requestId"`
+	Token        string      `json:"token"`
+}
+
+// Validate checks every event has a known type, the ads, carousel and
+// request it belongs to
+func (input *trackEventsHandlerInput) Validate() (errs []FieldError) {
+	if len(input.Events) == 0 || len(input.Events) > maxTrackedEvents {
+		return []FieldError{{Field: "events", Message: fmt.Sprintf("must have between 1 and %d events", maxTrackedEvents)}}
+	}
+	for i, event := range input.Events {
+		field := fmt.Sprintf("events[%d].", i)
+		switch domain.TrackingEventType(event.Type) {
+		case domain.ImpressionEvent, domain.ClickEvent, domain.ReplyEvent:
+		default:
+			errs = append(errs, FieldError{Field: field + "type", Message: "must be one of impression|click|reply"})
+		}
+		attributed := event.Token != ""
+		if event.Carousel == "" && !attributed {
+			errs = append(errs, FieldError{Field: field + "carousel", Message: "is required"})
+		}
+		if _, err := parseListID(event.SourceListID); err != nil && (!attributed || event.SourceListID != "") {
+			errs = append(errs, FieldError{Field: field + "sourceListId", Message: "must be a list id"})
+		}
+		if _, err := parseListID(event.ListID); err != nil && (!attributed || event.ListID != "") {
+			errs = append(errs, FieldError{Field: field + "listId", Message: "must be a list id"})
+		}
+		if event.Position < 0 {
+			errs = append(errs, FieldError{Field: field + "position", Message: "must be greater than or equal to 0"})
+		}
+		if event.RequestID == "" {
+			errs = append(errs, FieldError{Field: field + "requestId", Message: "is required"})
+		}
+	}
+	return
+}
+
+// parseListID parses a positive list id
+func parseListID(listID json.Number) (int64, error) {
+	id, err := strconv.ParseInt(listID.String(), 10, 64)
+	if err == nil && id <= 0 {
+		err = fmt.Errorf("invalid list id %d", id)
+	}
+	return id, err
+}
+
+// Input returns a fresh, empty instance of trackEventsHandlerInput
+func (*TrackEventsHandler) Input(ir InputRequest) HandlerInput {
+	input := trackEventsHandlerInput{}
+	ir.Set(&input).FromJSONBody().FromHeaders()
+	return &input
+}
+
+// Execute is the main function of the TrackEvents handler, events are
+// accepted once buffered, before they are persisted
+func (h *TrackEventsHandler) Execute(ig InputGetter) *goutils.Response {
+	input, response := ig()
+	if response != nil {
+		return response
+	}
+	in := input.(*trackEventsHandlerInput)
+	events := make([]domain.TrackingEvent, 0, len(in.Events))
+	for _, event := range in.Events {
+		sourceListID, _ := parseListID(event.SourceListID)
+		listID, _ := parseListID(event.ListID)
+		events = append(events, domain.TrackingEvent{
+			Type:         domain.TrackingEventType(event.Type),
+			Carousel:     event.Carousel,
+			SourceListID: sourceListID,
+			ListID:       listID,
+			Position:     event.Position,
+			RequestID:    event.RequestID,
+			Token:        event.Token,
+			DeviceID:     in.DeviceID,
+		})
+	}
+	if err := h.Interactor.TrackEvents(events); err != nil {
+		return errorResponse(err)
+	}
+	return &goutils.Response{
+		Code: http.StatusAccepted,
+	}
+}
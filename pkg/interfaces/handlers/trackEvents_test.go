@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Yapo/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockTrackEvents struct {
+	mock.Mock
+}
+
+func (m *mockTrackEvents) TrackEvents(events []domain.TrackingEvent) error {
+	return m.Called(events).Error(0)
+}
+
+func TestTrackEventsHandlerInput(t *testing.T) {
+	mMockInputRequest := MockInputRequest{}
+	mMockTargetRequest := MockTargetRequest{}
+	mMockInputRequest.On(
+		"Set", mock.AnythingOfType("*handlers.trackEventsHandlerInput"),
+	).Return(&mMockTargetRequest)
+	mMockTargetRequest.On("FromJSONBody").Return()
+	mMockTargetRequest.On("FromHeaders").Return()
+
+	h := TrackEventsHandler{}
+	input := h.Input(&mMockInputRequest)
+
+	var expected *trackEventsHandlerInput
+	assert.IsType(t, expected, input)
+	mMockTargetRequest.AssertExpectations(t)
+	mMockInputRequest.AssertExpectations(t)
+}
+
+func TestTrackEventsHandlerInputValidate(t *testing.T) {
+	input := trackEventsHandlerInput{}
+	assert.Equal(t, []FieldError{{Field: "events", Message: "must have between 1 and 100 events"}}, input.Validate())
+
+	input.Events = []trackEventInput{
+		{Type: "click", Carousel: "default", SourceListID: "1", ListID: "2", Position: 0, RequestID: "r"},
+		{Type: "view", SourceListID: "a", ListID: "0", Position: -1},
+		{Type: "click", RequestID: "r", Token: "token"},
+		{Type: "click", ListID: "a", RequestID: "r", Token: "token"},
+	}
+	assert.Equal(t, []FieldError{
+		{Field: "events[1].type", Message: "must be one of impression|click|reply"},
+		{Field: "events[1].carousel", Message: "is required"},
+		{Field: "events[1].sourceListId", Message: "must be a list id"},
+		{Field: "events[1].listId", Message: "must be a list id"},
+		{Field: "events[1].position", Message: "must be greater than or equal to 0"},
+		{Field: "events[1].requestId", Message: "is required"},
+		{Field: "events[3].listId", Message: "must be a list id"},
+	}, input.Validate())
+}
+
+func TestTrackEventsHandlerOK(t *testing.T) {
+	mInteractor := &mockTrackEvents{}
+	mInteractor.On("TrackEvents", []domain.TrackingEvent{
+		{Type: domain.ReplyEvent, Carousel: "default", SourceListID: 1, ListID: 2, Position: 3, RequestID: "r"},
+		{Type: domain.ClickEvent, RequestID: "r", Token: "token"},
+	}).Return(nil)
+	h := TrackEventsHandler{Interactor: mInteractor}
+	input := &trackEventsHandlerInput{Events: []trackEventInput{
+		{Type: "reply", Carousel: "default", SourceListID: "1", ListID: "2", Position: 3, RequestID: "r"},
+		{Type: "click", RequestID: "r", Token: "token"},
+	}}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, &goutils.Response{Code: http.StatusAccepted}, r)
+	mInteractor.AssertExpectations(t)
+}
+
+func TestTrackEventsHandlerError(t *testing.T) {
+	mInteractor := &mockTrackEvents{}
+	mInteractor.On("TrackEvents", mock.Anything).Return(
+		domain.NewError(domain.UnavailableError, domain.ErrCodeEventsUnavailable, "events not saved", errors.New("full")))
+	h := TrackEventsHandler{Interactor: mInteractor}
+	input := &trackEventsHandlerInput{Events: []trackEventInput{
+		{Type: "click", Carousel: "default", SourceListID: "1", ListID: "2", RequestID: "r"},
+	}}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+	assert.Equal(t, domain.ErrCodeEventsUnavailable, r.Body.(*ErrorOutput).ErrorCode)
+}
+
+func TestTrackEventsHandlerDeviceID(t *testing.T) {
+	mInteractor := &mockTrackEvents{}
+	mInteractor.On("TrackEvents", []domain.TrackingEvent{
+		{Type: domain.ClickEvent, Carousel: "default", SourceListID: 1, ListID: 2, RequestID: "r", DeviceID: "device"},
+	}).Return(nil)
+	h := TrackEventsHandler{Interactor: mInteractor}
+	input := &trackEventsHandlerInput{DeviceID: "device", Events: []trackEventInput{
+		{Type: "click", Carousel: "default", SourceListID: "1", ListID: "2", RequestID: "r"},
+	}}
+	r := h.Execute(MakeMockInputGetter(input, nil))
+	assert.Equal(t, http.StatusAccepted, r.Code)
+	mInteractor.AssertExpectations(t)
+}
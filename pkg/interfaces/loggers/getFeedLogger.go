@@ -0,0 +1,25 @@
+package loggers
+
+import "gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+
+type getFeedLogger struct {
+	logger Logger
+}
+
+// ErrorGettingSection logs when cannot get the ads of a feed section
+func (l *getFeedLogger) ErrorGettingSection(carousel string, err error) {
+	l.logger.Error("cannot get ads of feed section %s with error: %+v", carousel, err)
+}
+
+// DuplicatedAds logs the ads removed from a feed section since they are shown on a previous one
+func (l *getFeedLogger) DuplicatedAds(carousel string, duplicated int) {
+	l.logger.Debug("%d ads of feed section %s are shown on previous sections", duplicated, carousel)
+}
+
+// MakeGetFeedLogger sets up a GetFeedLogger instrumented
+// via the provided logger
+func MakeGetFeedLogger(logger Logger) usecases.GetFeedLogger {
+	return &getFeedLogger{
+		logger: logger,
+	}
+}
@@ -0,0 +1,14 @@
+package loggers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetFeedLogger(t *testing.T) {
+	m := &loggerMock{t: t}
+	l := MakeGetFeedLogger(m)
+	l.ErrorGettingSection("", fmt.Errorf(""))
+	l.DuplicatedAds("", 0)
+	m.AssertExpectations(t)
+}
@@ -32,9 +32,14 @@ func (l *getSuggestionsLogger) ErrorGettingAds(musts, shoulds, mustsNot map[stri
 	l.logger.Error("cannot get ads using params %v - %v - %v with err %+v", musts, shoulds, mustsNot, err)
 }
 
-// ErrorGettingUF logs when cannot get uf value
-func (l *getSuggestionsLogger) ErrorGettingUF(err error) {
-	l.logger.Error("cannot get uf value: %+v", err)
+// ErrorGettingIndicator logs when cannot get an indicator value
+func (l *getSuggestionsLogger) ErrorGettingIndicator(code string, err error) {
+	l.logger.Error("cannot get %s value: %+v", code, err)
+}
+
+// UnsupportedCurrency logs when a price cannot be converted to the carousel currency
+func (l *getSuggestionsLogger) UnsupportedCurrency(listID string, currency string) {
+	l.logger.Warn("unsupported currency %s on price range for listID %s", currency, listID)
 }
 
 // NotEnoughAds logs when ads returned are not enough
@@ -52,6 +57,28 @@ func (l *getSuggestionsLogger) InvalidCarousel(carousel string) {
 	l.logger.Warn("carousel '%s' not found", carousel)
 }
 
+// ErrorGettingCoordinates logs when cannot get the coordinates of a commune
+func (l *getSuggestionsLogger) ErrorGettingCoordinates(communeID int64, err error) {
+	l.logger.Warn("cannot get coordinates of commune %d: %+v", communeID, err)
+}
+
+// ExperimentVariant logs the variant serving a carousel on experiment
+func (l *getSuggestionsLogger) ExperimentVariant(carousel, variant, unitID string) {
+	l.logger.Info("carousel '%s' served with variant '%s' to unit '%s'", carousel, variant, unitID)
+}
+
+// ErrorGettingSponsoredAds logs when the sponsored ads of a carousel cannot
+// be retrieved, it is served without them
+func (l *getSuggestionsLogger) ErrorGettingSponsoredAds(listID string, err error) {
+	l.logger.Error("cannot get sponsored ads for listID %s with error: %+v", listID, err)
+}
+
+// ErrorCappingSponsoredAds logs when the sponsored ads served to a unit
+// cannot be counted or retrieved
+func (l *getSuggestionsLogger) ErrorCappingSponsoredAds(unitID string, err error) {
+	l.logger.Error("cannot cap sponsored ads of unit '%s' with error: %+v", unitID, err)
+}
+
 // MakeGetSuggestionsLogger sets up a GetSuggestionsLogger instrumented
 // via the provided logger
 func MakeGetSuggestionsLogger(logger Logger) usecases.GetSuggestionsLogger {
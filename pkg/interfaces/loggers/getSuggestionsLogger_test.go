@@ -15,7 +15,12 @@ func TestGetSuggestionsLogger(t *testing.T) {
 	l.ErrorGettingAds(mMap, mMap, mMap, fmt.Errorf(""))
 	l.NotEnoughAds("", 0)
 	l.ErrorGettingAdsContact("", fmt.Errorf(""))
-	l.ErrorGettingUF(fmt.Errorf(""))
+	l.ErrorGettingIndicator("", fmt.Errorf(""))
+	l.UnsupportedCurrency("", "")
 	l.InvalidCarousel("")
+	l.ErrorGettingCoordinates(0, fmt.Errorf(""))
+	l.ExperimentVariant("", "", "")
+	l.ErrorGettingSponsoredAds("", fmt.Errorf(""))
+	l.ErrorCappingSponsoredAds("", fmt.Errorf(""))
 	m.AssertExpectations(t)
 }
@@ -0,0 +1,25 @@
+package loggers
+
+import "gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+
+type hideAdsLogger struct {
+	logger Logger
+}
+
+// ErrorGettingHiddenAds logs when the ads hidden on a device cannot be
+// retrieved, suggestions exclude only the ones on the request
+func (l *hideAdsLogger) ErrorGettingHiddenAds(deviceID string, err error) {
+	l.logger.Error("cannot get hidden ads of device %s with error: %+v", deviceID, err)
+}
+
+// ErrorAddingHiddenAds logs when the ads hidden on a device cannot be stored
+func (l *hideAdsLogger) ErrorAddingHiddenAds(deviceID string, err error) {
+	l.logger.Error("cannot add hidden ads of device %s with error: %+v", deviceID, err)
+}
+
+// MakeHideAdsLogger sets up a HideAdsLogger instrumented via the provided logger
+func MakeHideAdsLogger(logger Logger) usecases.HideAdsLogger {
+	return &hideAdsLogger{
+		logger: logger,
+	}
+}
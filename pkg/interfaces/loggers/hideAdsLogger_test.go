@@ -0,0 +1,14 @@
+package loggers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHideAdsLogger(t *testing.T) {
+	m := &loggerMock{t: t}
+	l := MakeHideAdsLogger(m)
+	l.ErrorGettingHiddenAds("", fmt.Errorf(""))
+	l.ErrorAddingHiddenAds("", fmt.Errorf(""))
+	m.AssertExpectations(t)
+}
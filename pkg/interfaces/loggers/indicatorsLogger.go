@@ -0,0 +1,42 @@
+package loggers
+
+import (
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/interfaces/repository"
+)
+
+type indicatorsLogger struct {
+	logger Logger
+}
+
+// ErrorSavingIndicator logs when an indicator value cannot be stored
+func (l *indicatorsLogger) ErrorSavingIndicator(code string, err error) {
+	l.logger.Error("cannot store value for indicator %s: %+v", code, err)
+}
+
+// UsingStoredIndicator logs when a stored indicator value is served
+// because the indicators api is not available
+func (l *indicatorsLogger) UsingStoredIndicator(code string, date time.Time, err error) {
+	l.logger.Warn("using stored value of indicator %s from %s, api error: %+v",
+		code, date.Format("2006-01-02"), err)
+}
+
+// StaleIndicator logs when the served indicator value is older than allowed
+func (l *indicatorsLogger) StaleIndicator(code string, date time.Time, age time.Duration) {
+	l.logger.Warn("stored value of indicator %s from %s is stale, age: %s",
+		code, date.Format("2006-01-02"), age)
+}
+
+// OfflineIndicators logs when the indicators api is disabled
+func (l *indicatorsLogger) OfflineIndicators() {
+	l.logger.Warn("indicators api disabled, only stored and default values are served")
+}
+
+// MakeIndicatorsLogger sets up a IndicatorsLogger instrumented
+// via the provided logger
+func MakeIndicatorsLogger(logger Logger) repository.IndicatorsLogger {
+	return &indicatorsLogger{
+		logger: logger,
+	}
+}
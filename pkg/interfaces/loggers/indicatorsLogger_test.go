@@ -0,0 +1,17 @@
+package loggers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIndicatorsLogger(t *testing.T) {
+	m := &loggerMock{t: t}
+	l := MakeIndicatorsLogger(m)
+	l.ErrorSavingIndicator("", fmt.Errorf(""))
+	l.UsingStoredIndicator("", time.Time{}, fmt.Errorf(""))
+	l.StaleIndicator("", time.Time{}, 0)
+	l.OfflineIndicators()
+	m.AssertExpectations(t)
+}
@@ -24,6 +24,10 @@ func (l *jsonHandlerDefaultLogger) LogRequestPanic(r *http.Request, response *go
 	l.logger.Error("> %s %s %s (%d): %s", r.RemoteAddr, r.Method, r.URL, response.Code, err)
 }
 
+func (l *jsonHandlerDefaultLogger) LogRequestError(r *http.Request, response *goutils.Response, err error) {
+	l.logger.Error("> %s %s %s (%d): %s", r.RemoteAddr, r.Method, r.URL, response.Code, err)
+}
+
 // MakeJSONHandlerLogger sets up a JsonHandlerLogger instrumented
 // via the provided logger
 func MakeJSONHandlerLogger(logger Logger) handlers.JSONHandlerLogger {
@@ -1,6 +1,7 @@
 package loggers
 
 import (
+	"fmt"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -19,4 +20,5 @@ func TestJSONHandlerLogger(t *testing.T) {
 	l.LogRequestStart(r)
 	l.LogRequestEnd(r, &goutils.Response{}, "")
 	l.LogRequestPanic(r, &goutils.Response{}, nil)
+	l.LogRequestError(r, &goutils.Response{}, fmt.Errorf("e"))
 }
@@ -0,0 +1,26 @@
+package loggers
+
+import "gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+
+type recentlyViewedLogger struct {
+	logger Logger
+}
+
+// ErrorGettingViewedAds logs when the ads viewed on a device cannot be
+// retrieved, suggestions use only the ones on the request
+func (l *recentlyViewedLogger) ErrorGettingViewedAds(deviceID string, err error) {
+	l.logger.Error("cannot get viewed ads of device %s with error: %+v", deviceID, err)
+}
+
+// ErrorAddingViewedAds logs when the ads viewed on a device cannot be stored
+func (l *recentlyViewedLogger) ErrorAddingViewedAds(deviceID string, err error) {
+	l.logger.Error("cannot add viewed ads of device %s with error: %+v", deviceID, err)
+}
+
+// MakeRecentlyViewedLogger sets up a RecentlyViewedLogger instrumented
+// via the provided logger
+func MakeRecentlyViewedLogger(logger Logger) usecases.RecentlyViewedLogger {
+	return &recentlyViewedLogger{
+		logger: logger,
+	}
+}
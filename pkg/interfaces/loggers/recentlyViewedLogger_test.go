@@ -0,0 +1,14 @@
+package loggers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRecentlyViewedLogger(t *testing.T) {
+	m := &loggerMock{t: t}
+	l := MakeRecentlyViewedLogger(m)
+	l.ErrorGettingViewedAds("", fmt.Errorf(""))
+	l.ErrorAddingViewedAds("", fmt.Errorf(""))
+	m.AssertExpectations(t)
+}
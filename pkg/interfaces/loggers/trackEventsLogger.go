@@ -0,0 +1,26 @@
+package loggers
+
+import "gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+
+type trackEventsLogger struct {
+	logger Logger
+}
+
+// ErrorSavingEvents logs when the events of a request cannot be saved
+func (l *trackEventsLogger) ErrorSavingEvents(count int, err error) {
+	l.logger.Error("cannot save %d tracking events with error: %+v", count, err)
+}
+
+// InvalidAttributionToken logs when an event token cannot be verified, the
+// event is saved unattributed
+func (l *trackEventsLogger) InvalidAttributionToken(listID int64, err error) {
+	l.logger.Info("unattributed tracking event of list id %d: %+v", listID, err)
+}
+
+// MakeTrackEventsLogger sets up a TrackEventsLogger instrumented
+// via the provided logger
+func MakeTrackEventsLogger(logger Logger) usecases.TrackEventsLogger {
+	return &trackEventsLogger{
+		logger: logger,
+	}
+}
@@ -0,0 +1,14 @@
+package loggers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTrackEventsLogger(t *testing.T) {
+	m := &loggerMock{t: t}
+	l := MakeTrackEventsLogger(m)
+	l.ErrorSavingEvents(0, fmt.Errorf(""))
+	l.InvalidAttributionToken(0, fmt.Errorf(""))
+	m.AssertExpectations(t)
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 )
 
 // HTTPRequest interface represents the request that is going to be sent via HTTP
@@ -37,10 +39,79 @@ type ElasticSearchHandler interface {
 	Info() (interface{}, error)
 	Create(index string) error
 	PutMapping(mapping []byte, index string) error
-	Search(index, query string, size, from int) (string, error)
+	// Search decodes the response hits object in hits
+	Search(index, query string, size, from int, hits interface{}) error
+	// MultiSearch sends every search on a single request, decoding each
+	// response hits object in the search Hits. It returns the error of each
+	// search in the same order, or an error when the whole request fails
+	MultiSearch(index string, searches []SearchRequest) ([]error, error)
+}
+
+// SearchRequest is one of the searches sent on a multi search
+type SearchRequest struct {
+	Query string
+	Size  int
+	From  int
+	// Hits is the pointer where the response hits object is decoded
+	Hits interface{}
 }
 
 // DataMapping allows get specific configuration params from etcd
 type DataMapping interface {
 	Get(string) string
 }
+
+// IndicatorsStore persists indicator values by date, so they can be served
+// when the indicators api is not available
+type IndicatorsStore interface {
+	Save(code string, date time.Time, value float64) error
+	// Get returns the value for the given date or the closest previous one,
+	// along with the date the value belongs to
+	Get(code string, date time.Time) (float64, time.Time, error)
+}
+
+// MetricsGauge allows to report point-in-time values to a metrics backend
+type MetricsGauge interface {
+	Set(value float64, labels ...string)
+}
+
+// EventsSink receives records to be persisted, as json values
+type EventsSink interface {
+	Write(records []interface{}) error
+}
+
+// MetricsCounter allows to count events on a metrics backend
+type MetricsCounter interface {
+	Inc(labels ...string)
+}
+
+// CoviewStore holds the co-view neighbours of every ad
+type CoviewStore interface {
+	// Neighbours returns the neighbours of the ad by descending score
+	Neighbours(listID int64) []domain.Neighbour
+}
+
+// ViewedAdsStore keeps a list of ads by key, it is the pluggable backend
+// of the viewed ads repository
+type ViewedAdsStore interface {
+	// Get returns the ads of the key, empty when it is unknown
+	Get(key string) ([]int64, error)
+	Set(key string, listIDs []int64) error
+}
+
+// HiddenAdsStore keeps the ads and sellers hidden by key, it is the
+// pluggable backend of the hidden ads repository
+type HiddenAdsStore interface {
+	// Get returns the exclusions of the key, empty when it is unknown
+	Get(key string) (domain.Exclusions, error)
+	Set(key string, hidden domain.Exclusions) error
+}
+
+// FrequencyCounter counts how many times ids are seen by key on a time
+// window, it is the pluggable backend of the frequency cap repository
+type FrequencyCounter interface {
+	// Counts returns the count of each id of the key on the current window
+	Counts(key string, ids []int64) (map[int64]int, error)
+	// Add counts the ids once more for the key
+	Add(key string, ids []int64) error
+}
@@ -2,19 +2,43 @@ package repository
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"net"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
 )
 
+const (
+	// priceFunction is the scoring function type that scores ads using
+	// a gaussian decay over the carousel price range
+	priceFunction = "price"
+	// defaultScoreMode is the function_score score_mode used when not configured
+	defaultScoreMode = "multiply"
+	// defaultBoostMode is the function_score boost_mode used when not configured
+	defaultBoostMode = "multiply"
+	// geoFunction is the scoring function type that scores ads using a decay
+	// over the distance to the source ad commune
+	geoFunction = "geo"
+	// defaultGeoField is the geo_point field used when the carousel does not configure one
+	defaultGeoField = "location.geo"
+	// seedFilter keeps the ads listed before the cursor seed, so new ads do
+	// not shift the following pages
+	seedFilter = `{"range": {"listTime": {"lte": %d, "format": "epoch_millis"}}}`
+	// errInvalidCursor error text when the cursor cannot be decoded
+	errInvalidCursor = "invalid cursor: '%s'"
+)
+
 var notAlphaNumbericRegex = regexp.MustCompile("[^a-zA-Z0-9]+")
 var specialCases = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o",
 	"ú", "u", "'", "", "ñ", "n")
@@ -34,6 +58,8 @@ type adsRepository struct {
 // Hit represent a query match on elasticsearch
 type Hit struct {
 	Source usecases.Ad `json:"_source"`
+	// Sort holds the hit sort values, used to build the next page cursor
+	Sort []json.RawMessage `json:"sort"`
 }
 
 // Hits is a slice of Hits on elasticsearch
@@ -44,9 +70,21 @@ type HitsParent struct {
 	Hits Hits `json:"hits"`
 }
 
-// elasticResponse is the response that elastic search gives to a query
-type elasticResponse struct {
-	HitsParent HitsParent `json:"hits"`
+// adsSearch is a suggestions query ready to be sent, along with the
+// cursor used to build the next page one
+type adsSearch struct {
+	query  string
+	size   int
+	from   int
+	cursor adsCursor
+}
+
+// adsCursor is the content of the opaque cursor used to paginate suggestions.
+// It holds the sort values of the last hit retrieved and the seed of the first
+// page, in unix milliseconds
+type adsCursor struct {
+	SortValues []json.RawMessage `json:"s"`
+	Seed       int64             `json:"t"`
 }
 
 // NewAdsRepository return a new ads repositoryinstance
@@ -71,12 +109,17 @@ func (repo *adsRepository) GetAd(listID string) (ad domain.Ad, err error) {
 	params := map[string]string{
 		"ListID": listID,
 	}
-	ads, err := repo.getAdsProcess("getAd", params, 0, 0)
+	ads, _, err := repo.getAdsProcess("getAd", params, 0, 0)
 	if err != nil {
 		return
 	}
 	if len(ads) < 1 {
-		err = fmt.Errorf("get ad fails to get it, len: %d", len(ads))
+		err = domain.NewError(
+			domain.NotFoundError,
+			domain.ErrCodeAdNotFound,
+			fmt.Sprintf("ad %s not found", listID),
+			nil,
+		)
 		return
 	}
 	return ads[0], nil
@@ -85,80 +128,284 @@ func (repo *adsRepository) GetAd(listID string) (ad domain.Ad, err error) {
 // GetAds returns a slice of Ad object using mandatory parameters (musts),
 // optional parameters(shoulds), exclude results if param is on ad(mustsNot)
 // and aditional keyword filters (filters and fields) to get ads related to this terms.
+// Ads are sorted by score and listId, when the page is full a cursor is returned
+// to get the next page using search_after
 func (repo *adsRepository) GetAds(
 	adID string,
 	parameters usecases.SuggestionParameters,
 	size, from int,
-) (ads []domain.Ad, err error) {
+) (ads []domain.Ad, nextCursor string, err error) {
+	search, err := repo.newAdsSearch(adID, parameters, size, from)
+	if err != nil {
+		return
+	}
+	var parsed HitsParent
+	if err = repo.elasticHandler.Search(repo.index, search.query, search.size, search.from, &parsed); err != nil {
+		err = searchError(err)
+		return
+	}
+	ads, nextCursor = repo.searchResult(search, parsed.Hits)
+	return ads, nextCursor, nil
+}
+
+// MultiGetAds returns the suggested ads of every query sending all of them
+// on a single multi search. Queries that cannot be built or whose search
+// fails have their error set on their result
+func (repo *adsRepository) MultiGetAds(
+	adID string,
+	queries []usecases.AdsQuery,
+) ([]usecases.AdsQueryResult, error) {
+	results := make([]usecases.AdsQueryResult, len(queries))
+	searches := make([]adsSearch, len(queries))
+	parsed := make([]HitsParent, len(queries))
+	requests := make([]SearchRequest, 0, len(queries))
+	positions := make([]int, 0, len(queries))
+	for i, query := range queries {
+		search, err := repo.newAdsSearch(adID, query.Params, query.Size, query.From)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		searches[i] = search
+		requests = append(requests, SearchRequest{
+			Query: search.query,
+			Size:  search.size,
+			From:  search.from,
+			Hits:  &parsed[i],
+		})
+		positions = append(positions, i)
+	}
+	if len(requests) == 0 {
+		return results, nil
+	}
+	errs, err := repo.elasticHandler.MultiSearch(repo.index, requests)
+	if err != nil {
+		return nil, searchError(err)
+	}
+	for j, i := range positions {
+		if errs[j] != nil {
+			results[i].Err = searchError(errs[j])
+			continue
+		}
+		results[i].Ads, results[i].Cursor = repo.searchResult(searches[i], parsed[i].Hits)
+	}
+	return results, nil
+}
+
+// GetAdsByListIDs returns the ads of listIDs that match the carousel musts,
+// mustsNot, filters and ranges, in the same order as listIDs. Ads not
+// found, or not matching, are skipped
+func (repo *adsRepository) GetAdsByListIDs(
+	listIDs []int64,
+	parameters usecases.SuggestionParameters,
+) ([]domain.Ad, error) {
+	if len(listIDs) == 0 {
+		return []domain.Ad{}, nil
+	}
+	encodedIDs, _ := json.Marshal(listIDs)
+	params := map[string]string{
+		"ListIDs": string(encodedIDs),
+		"Musts":   repo.getBoolParameters(parameters.Musts),
+		"MustsNot": joinParams(
+			repo.getBoolParameters(parameters.MustsNot),
+			getExcludedTerms("listId", parameters.ExcludedListIDs),
+			getExcludedTerms("userId", parameters.ExcludedUserIDs),
+		),
+		"Filters": joinParams(
+			repo.getFilters(parameters.Filters),
+			getRangeFilters(parameters.Ranges),
+		),
+	}
+	if len(parameters.SourceIncludes) > 0 {
+		source, _ := json.Marshal(parameters.SourceIncludes)
+		params["Source"] = string(source)
+	}
+	query, err := repo.ProcessTemplate("getAdsByListIDs", params)
+	if err != nil {
+		return nil, err
+	}
+	var parsed HitsParent
+	if err = repo.elasticHandler.Search(repo.index, query, len(listIDs), 0, &parsed); err != nil {
+		return nil, searchError(err)
+	}
+	found, _ := repo.fillHits(parsed.Hits)
+	byListID := make(map[int64]domain.Ad, len(found))
+	for _, ad := range found {
+		byListID[ad.ListID] = ad
+	}
+	ads := make([]domain.Ad, 0, len(found))
+	for _, listID := range listIDs {
+		if ad, ok := byListID[listID]; ok {
+			ads = append(ads, ad)
+		}
+	}
+	return ads, nil
+}
+
+// newAdsSearch builds the suggestions query for the given parameters
+func (repo *adsRepository) newAdsSearch(
+	adID string,
+	parameters usecases.SuggestionParameters,
+	size, from int,
+) (search adsSearch, err error) {
+	cursor, err := decodeCursor(parameters.Cursor, time.Now())
+	if err != nil {
+		return
+	}
 	mustsParams := repo.getBoolParameters(parameters.Musts)
-	mustsNotParams := repo.getBoolParameters(parameters.MustsNot)
+	mustsNotParams := joinParams(
+		repo.getBoolParameters(parameters.MustsNot),
+		getExcludedTerms("listId", parameters.ExcludedListIDs),
+		getExcludedTerms("userId", parameters.ExcludedUserIDs),
+	)
 	shouldsParams := repo.getBoolParameters(parameters.Shoulds)
 	filtersParams := repo.getFilters(parameters.Filters)
 	queryStringParams := repo.getQueryString(parameters.QueryString)
+	functions := repo.getScoreFunctions(parameters)
+	filtersParams = joinParams(
+		filtersParams,
+		getGeoDistanceFilter(parameters.GeoConf),
+		getRangeFilters(parameters.Ranges),
+		fmt.Sprintf(seedFilter, cursor.Seed),
+	)
 
 	if len(parameters.PriceConf) > 0 {
-		priceParams := repo.processPriceTemplate(parameters.PriceConf)
 		switch parameters.PriceConf["type"] {
 		case "must":
-			mustsParams = joinParams(mustsParams, priceParams)
+			mustsParams = joinParams(mustsParams, repo.processPriceTemplate(parameters.PriceConf))
 		case "mustNot":
-			mustsNotParams = joinParams(mustsNotParams, priceParams)
+			mustsNotParams = joinParams(mustsNotParams, repo.processPriceTemplate(parameters.PriceConf))
 		case "should":
-			shouldsParams = joinParams(shouldsParams, priceParams)
+			shouldsParams = joinParams(shouldsParams, repo.processPriceTemplate(parameters.PriceConf))
 		case "filter":
-			filtersParams = joinParams(filtersParams, priceParams)
+			filtersParams = joinParams(filtersParams, repo.processPriceTemplate(parameters.PriceConf))
+		case "decay":
+			if !hasScoreFunction(parameters.ScoreFunctions, priceFunction) {
+				functions = joinParams(functions, repo.processPriceDecayTemplate(parameters.PriceConf))
+			}
 		}
 	}
 	if len(queryStringParams) > 0 {
 		mustsParams = joinParams(mustsParams, queryStringParams)
 	}
 	if len(parameters.Fields) > 0 {
-		likeParams := repo.processLikeTemplate(adID, parameters.Fields, parameters.QueryConf)
+		likeParams := repo.processLikeTemplate(adID, parameters.Fields, parameters.QueryConf, parameters.Likes...)
 		mustsParams = joinParams(likeParams, mustsParams)
 	}
 	params := map[string]string{
-		"Musts":    mustsParams,
-		"MustsNot": mustsNotParams,
-		"Shoulds":  shouldsParams,
-		"Filters":  filtersParams,
-		"Name":     parameters.DecayConf["name"],
-		"Field":    parameters.DecayConf["field"],
-		"Origin":   parameters.DecayConf["origin"],
-		"Offset":   parameters.DecayConf["offset"],
-		"Scale":    parameters.DecayConf["scale"],
+		"Musts":     mustsParams,
+		"MustsNot":  mustsNotParams,
+		"Shoulds":   shouldsParams,
+		"Filters":   filtersParams,
+		"Functions": functions,
+		"ScoreMode": getStringOrDefault(parameters.ScoreConf["scoreMode"], defaultScoreMode),
+		"BoostMode": getStringOrDefault(parameters.ScoreConf["boostMode"], defaultBoostMode),
+	}
+	if len(parameters.SourceIncludes) > 0 {
+		source, _ := json.Marshal(parameters.SourceIncludes)
+		params["Source"] = string(source)
+	}
+	if len(cursor.SortValues) > 0 {
+		searchAfter, _ := json.Marshal(cursor.SortValues)
+		params["SearchAfter"] = string(searchAfter)
+		// elasticsearch requires from to be 0 when search_after is used
+		from = 0
+	}
+	query, err := repo.ProcessTemplate("getAds", params)
+	if err != nil {
+		return
+	}
+	size, from = repo.searchWindow(params, size, from)
+	return adsSearch{query: query, size: size, from: from, cursor: cursor}, nil
+}
+
+// searchResult returns the ads found and the cursor to get the next page,
+// which is empty when the page is not full
+func (repo *adsRepository) searchResult(search adsSearch, hits Hits) ([]domain.Ad, string) {
+	ads, sortValues := repo.fillHits(hits)
+	if len(ads) < search.size || len(sortValues) == 0 {
+		return ads, ""
+	}
+	return ads, encodeCursor(adsCursor{SortValues: sortValues, Seed: search.cursor.Seed})
+}
+
+// decodeCursor decodes an opaque cursor. An empty cursor returns a new one
+// without sort values, seeded with the given time
+func decodeCursor(cursor string, now time.Time) (decoded adsCursor, err error) {
+	if cursor == "" {
+		return adsCursor{Seed: now.UnixNano() / int64(time.Millisecond)}, nil
+	}
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(content, &decoded) != nil || decoded.Seed <= 0 {
+		return adsCursor{}, domain.NewError(
+			domain.InvalidInputError,
+			domain.ErrCodeInvalidCursor,
+			fmt.Sprintf(errInvalidCursor, cursor),
+			nil,
+		)
 	}
-	return repo.getAdsProcess("getAds", params, size, from)
+	return decoded, nil
+}
+
+// encodeCursor encodes a cursor as an url safe opaque string
+func encodeCursor(cursor adsCursor) string {
+	content, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(content)
 }
 
 // getAdsProcess executes a query to elastic search through the elastic handler
-// and process the response. It returns an ads slice
+// and process the response. It returns an ads slice and the sort values of the last hit
 func (repo *adsRepository) getAdsProcess(
 	templateName string,
 	params map[string]string,
 	size, from int,
-) (ads []domain.Ad, err error) {
+) (ads []domain.Ad, sortValues []json.RawMessage, err error) {
 	query, err := repo.ProcessTemplate(templateName, params)
 	if err != nil {
 		return
 	}
+	size, from = repo.searchWindow(params, size, from)
+	var parsed HitsParent
+	if err = repo.elasticHandler.Search(repo.index, query, size, from, &parsed); err != nil {
+		err = searchError(err)
+		return
+	}
+	ads, sortValues = repo.fillHits(parsed.Hits)
+	return ads, sortValues, nil
+}
+
+// searchWindow returns the size and from used on a search, the repository
+// defaults are used when they are not set. From is not used with search_after
+func (repo *adsRepository) searchWindow(params map[string]string, size, from int) (int, int) {
 	if size == 0 {
 		size = repo.resultSize
 	}
-	if from == 0 {
+	if from == 0 && params["SearchAfter"] == "" {
 		from = repo.from
 	}
-	response, err := repo.elasticHandler.Search(repo.index, query, size, from)
-	if err != nil {
-		return
+	return size, from
+}
+
+// fillHits returns the ads of the search hits and the sort values of the last one
+func (repo *adsRepository) fillHits(hits Hits) (ads []domain.Ad, sortValues []json.RawMessage) {
+	for _, hit := range hits {
+		ads = append(ads, repo.fillAd(hit.Source))
+		sortValues = hit.Sort
 	}
-	var parsed elasticResponse
-	if err = json.Unmarshal([]byte(response), &parsed); err != nil {
-		return
+	return
+}
+
+// searchError wraps an elasticsearch request error as a timeout or
+// unavailable typed error. Errors already typed are returned as they are
+func searchError(err error) error {
+	if domain.ErrorKindOf(err) != domain.UnknownError || domain.ErrorCodeOf(err) != domain.ErrCodeInternal {
+		return err
 	}
-	for _, hit := range parsed.HitsParent.Hits {
-		ads = append(ads, repo.fillAd(hit.Source))
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return domain.NewError(domain.TimeoutError, domain.ErrCodeSearchTimeout, "search timed out", err)
 	}
-	return ads, nil
+	return domain.NewError(domain.UnavailableError, domain.ErrCodeSearchUnavailable, "search unavailable", err)
 }
 
 // getBoolParameters returns a string with bool parameters
@@ -184,7 +431,8 @@ func (repo *adsRepository) processPriceTemplate(priceRange map[string]string) st
 	params := map[string]string{
 		"PriceMin": priceRange["gte"],
 		"PriceMax": priceRange["lte"],
-		"UF":       priceRange["uf"],
+		"Rates":    priceRange["rates"],
+		"Base":     priceRange["base"],
 	}
 	query, err := repo.ProcessTemplate("priceScript", params)
 	if err != nil {
@@ -193,14 +441,196 @@ func (repo *adsRepository) processPriceTemplate(priceRange map[string]string) st
 	return query
 }
 
+// processPriceDecayTemplate returns the price decay score function template
+// as string to be used in the final query
+func (repo *adsRepository) processPriceDecayTemplate(priceRange map[string]string) string {
+	params := map[string]string{
+		"Origin":   priceRange["origin"],
+		"PriceMin": priceRange["gte"],
+		"PriceMax": priceRange["lte"],
+		"Decay":    priceRange["decay"],
+		"Rates":    priceRange["rates"],
+		"Base":     priceRange["base"],
+	}
+	query, err := repo.ProcessTemplate("priceDecay", params)
+	if err != nil {
+		return ""
+	}
+	return query
+}
+
+// getScoreFunctions returns the function_score functions to be used in the
+// final query. When the carousel does not define scoring functions the decay
+// configuration is used as the only function
+func (repo *adsRepository) getScoreFunctions(parameters usecases.SuggestionParameters) string {
+	if len(parameters.ScoreFunctions) == 0 {
+		return repo.getDecayFunction(parameters.DecayConf)
+	}
+	var functions string
+	for _, conf := range parameters.ScoreFunctions {
+		var function map[string]interface{}
+		switch conf["type"] {
+		case "gauss", "linear", "exp":
+			function = getDecayScoreFunction(conf)
+		case "field_value_factor":
+			function = getFieldValueFactorFunction(conf)
+		case geoFunction:
+			if parameters.GeoConf["origin"] == "" {
+				continue
+			}
+			function = getDecayScoreFunction(map[string]string{
+				"type":   getStringOrDefault(conf["decayType"], "gauss"),
+				"field":  getStringOrDefault(parameters.GeoConf["field"], defaultGeoField),
+				"origin": parameters.GeoConf["origin"],
+				"offset": conf["offset"],
+				"scale":  conf["scale"],
+				"decay":  conf["decay"],
+			})
+		case priceFunction:
+			if len(parameters.PriceConf) == 0 {
+				continue
+			}
+			if err := json.Unmarshal(
+				[]byte(repo.processPriceDecayTemplate(parameters.PriceConf)), &function,
+			); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		if weight, err := strconv.ParseFloat(conf["weight"], 64); err == nil {
+			function["weight"] = weight
+		}
+		functionJSON, err := json.Marshal(function)
+		if err != nil {
+			continue
+		}
+		functions = joinParams(functions, string(functionJSON))
+	}
+	return functions
+}
+
+// getGeoDistanceFilter returns a geo_distance filter that keeps the ads
+// located within the configured distance from the source ad commune
+func getGeoDistanceFilter(geoConf map[string]string) string {
+	if geoConf["origin"] == "" || geoConf["distance"] == "" {
+		return ""
+	}
+	return fmt.Sprintf(
+		`{"geo_distance": {"distance": "%s", "%s": "%s"}}`,
+		geoConf["distance"],
+		getStringOrDefault(geoConf["field"], defaultGeoField),
+		geoConf["origin"],
+	)
+}
+
+// getExcludedTerms returns a terms query on the excluded ids of the field,
+// as the ads or sellers never suggested, to be used on must_not
+func getExcludedTerms(field string, ids []int64) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(ids)
+	return fmt.Sprintf(`{"terms": {"%s": %s}}`, field, encoded)
+}
+
+// getRangeFilters returns numeric range filters, values are not quoted so
+// elasticsearch compares them as numbers
+func getRangeFilters(ranges []map[string]string) string {
+	var out string
+	for _, r := range ranges {
+		gte, errGte := strconv.ParseFloat(r["gte"], 64)
+		lte, errLte := strconv.ParseFloat(r["lte"], 64)
+		if r["field"] == "" || errGte != nil || errLte != nil {
+			continue
+		}
+		out = joinParams(out, fmt.Sprintf(
+			`{"range": {"%s": {"gte": %s, "lte": %s}}}`,
+			r["field"],
+			strconv.FormatFloat(gte, 'f', -1, 64),
+			strconv.FormatFloat(lte, 'f', -1, 64),
+		))
+	}
+	return out
+}
+
+// getDecayScoreFunction returns a gauss, linear or exp decay function on the configured field
+func getDecayScoreFunction(conf map[string]string) map[string]interface{} {
+	decay := make(map[string]interface{})
+	for _, key := range []string{"origin", "offset", "scale"} {
+		if conf[key] != "" {
+			decay[key] = conf[key]
+		}
+	}
+	if value, err := strconv.ParseFloat(conf["decay"], 64); err == nil {
+		decay["decay"] = value
+	}
+	return map[string]interface{}{
+		conf["type"]: map[string]interface{}{conf["field"]: decay},
+	}
+}
+
+// getFieldValueFactorFunction returns a field_value_factor function on the configured field
+func getFieldValueFactorFunction(conf map[string]string) map[string]interface{} {
+	factor := map[string]interface{}{"field": conf["field"]}
+	if conf["modifier"] != "" {
+		factor["modifier"] = conf["modifier"]
+	}
+	for _, key := range []string{"factor", "missing"} {
+		if value, err := strconv.ParseFloat(conf[key], 64); err == nil {
+			factor[key] = value
+		}
+	}
+	return map[string]interface{}{"field_value_factor": factor}
+}
+
+// hasScoreFunction returns true when a function of the given type is configured
+func hasScoreFunction(functions []map[string]string, functionType string) bool {
+	for _, conf := range functions {
+		if conf["type"] == functionType {
+			return true
+		}
+	}
+	return false
+}
+
+// getStringOrDefault returns value or defaultValue when value is empty
+func getStringOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getDecayFunction returns the decay score function to be used in the final query
+func (repo *adsRepository) getDecayFunction(decayConf map[string]string) string {
+	if decayConf["name"] == "" {
+		return ""
+	}
+	return fmt.Sprintf(
+		`{"%s": {"%s": {"origin": "%s", "offset": "%s", "scale": "%s"}}}`,
+		decayConf["name"],
+		decayConf["field"],
+		decayConf["origin"],
+		decayConf["offset"],
+		decayConf["scale"],
+	)
+}
+
 // processLikeTemplate returns the more like this query template as string
-// to be used in the final query
+// to be used in the final query. The likes documents are liked along adID
 func (repo *adsRepository) processLikeTemplate(
 	adID string,
 	fields []string,
-	config map[string]string) string {
+	config map[string]string,
+	likes ...string) string {
+	likeDocs := make([]string, len(likes))
+	for i, like := range likes {
+		likeDocs[i] = fmt.Sprintf(`{"_index": "%s","_id": %s}`, repo.index, like)
+	}
 	params := map[string]string{
 		"AdID":          adID,
+		"Likes":         strings.Join(likeDocs, ", "),
 		"index":         repo.index,
 		"Fields":        fmt.Sprintf("\"%s\"", strings.Join(fields, "\",\"")),
 		"MinTermFreq":   config["minTermFreq"],
@@ -316,28 +746,69 @@ func (repo *adsRepository) fillURL(subject string, listID, regionID int64) strin
 	)
 }
 
-// fillAdParams returns all the ad params as a map[string]string
-func (repo *adsRepository) fillAdParams(adParams map[string]usecases.Param) (output map[string]string) {
-	output = map[string]string{}
+// fillAdParams returns all the ad params as typed domain params.
+// Params with an unknown type are kept as their json representation
+func (repo *adsRepository) fillAdParams(adParams map[string]usecases.Param) (output map[string]domain.AdParam) {
+	output = map[string]domain.AdParam{}
 	for key, val := range adParams {
-		if output[key] == "" {
-			switch val.Type {
-			case "array":
-				{
-					translates := reflect.ValueOf(val.Translate)
-					for i := 0; i < translates.Len(); i++ {
-						output[key] += translates.Index(i).Interface().(string)
-						if i+1 != translates.Len() {
-							output[key] += ","
-						}
-					}
-				}
-			case "int":
-			case "string":
-				output[key] = fmt.Sprintf("%v", val.Value)
-			default:
-				continue // TODO: implement json conversion if you need it
+		if _, ok := output[key]; ok || (val.Value == nil && val.Translate == nil) {
+			continue
+		}
+		switch val.Type {
+		case "array":
+			output[key] = domain.NewArrayParam(toStringSlice(val.Translate, val.Value))
+		case "int":
+			if number, ok := toFloat(val.Value); ok {
+				output[key] = withLabel(domain.NewIntParam(int64(number)), val.Translate)
+			}
+		case "float", "double":
+			if number, ok := toFloat(val.Value); ok {
+				output[key] = withLabel(domain.NewFloatParam(number), val.Translate)
+			}
+		case "string":
+			output[key] = withLabel(domain.NewStringParam(fmt.Sprintf("%v", val.Value)), val.Translate)
+		default:
+			if content, err := json.Marshal(val.Value); err == nil {
+				output[key] = domain.NewStringParam(string(content))
+			}
+		}
+	}
+	return
+}
+
+// withLabel turns param into a label param when translate holds a label
+func withLabel(param domain.AdParam, translate interface{}) domain.AdParam {
+	label, ok := translate.(string)
+	if !ok || label == "" {
+		return param
+	}
+	return domain.NewLabelParam(param.String(), label)
+}
+
+// toFloat converts a json number, or a string holding one, to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// toStringSlice returns the elements of the first json array found on values
+func toStringSlice(values ...interface{}) (out []string) {
+	for _, value := range values {
+		if items, ok := value.([]interface{}); ok {
+			for _, item := range items {
+				out = append(out, fmt.Sprintf("%v", item))
 			}
+			return
 		}
 	}
 	return
@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,6 +19,7 @@ const getAdTemplateName = "getAd"
 const getAdsTemplateName = "getAds"
 const getPriceRangeTemplateName = "priceScript"
 const getLikeTemplateName = "like"
+const getPriceDecayTemplateName = "priceDecay"
 
 func TestNewAdsRepository(t *testing.T) {
 	mHandler := MockElasticSearchHandler{}
@@ -74,6 +79,7 @@ func TestGetAdErr(t *testing.T) {
 	expected := domain.Ad{}
 	assert.Equal(t, expected, resp)
 	assert.Error(t, err)
+	assert.Equal(t, domain.UnavailableError, domain.ErrorKindOf(err))
 	mHandler.AssertExpectations(t)
 }
 
@@ -95,7 +101,8 @@ func TestGetAdNotEnough(t *testing.T) {
 	resp, err := repo.GetAd("1")
 	expected := domain.Ad{}
 	assert.Equal(t, expected, resp)
-	assert.Error(t, err)
+	assert.EqualError(t, err, "ad 1 not found")
+	assert.Equal(t, domain.NotFoundError, domain.ErrorKindOf(err))
 	mHandler.AssertExpectations(t)
 }
 
@@ -121,7 +128,7 @@ func TestGetAdsOK(t *testing.T) {
 		queryTemplates: templates,
 		regionsConf:    &mDataMapping,
 	}
-	resp, err := repo.GetAds(
+	resp, _, err := repo.GetAds(
 		"1", usecases.SuggestionParameters{}, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
@@ -138,7 +145,7 @@ func TestGetAdsProcessNoTemplate(t *testing.T) {
 	repo := adsRepository{
 		queryTemplates: templates,
 	}
-	resp, err := repo.getAdsProcess("test2", nil, 0, 0)
+	resp, _, err := repo.getAdsProcess("test2", nil, 0, 0)
 	var expected []domain.Ad
 	assert.Equal(t, expected, resp)
 	assert.Error(t, err)
@@ -156,7 +163,7 @@ func TestGetAdsProcessUnmarshalErr(t *testing.T) {
 		elasticHandler: &mHandler,
 		queryTemplates: templates,
 	}
-	resp, err := repo.getAdsProcess(getAdsTemplateName, nil, 0, 0)
+	resp, _, err := repo.getAdsProcess(getAdsTemplateName, nil, 0, 0)
 	var expected []domain.Ad
 	assert.Equal(t, expected, resp)
 	assert.Error(t, err)
@@ -248,9 +255,9 @@ func TestGetAdsPriceRangeMust(t *testing.T) {
 		regionsConf:    &mDataMapping,
 	}
 	parameters := usecases.SuggestionParameters{
-		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "uf": "29.000", "type": "must"},
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "must"},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -281,9 +288,9 @@ func TestGetAdsPriceRangeShould(t *testing.T) {
 		regionsConf:    &mDataMapping,
 	}
 	parameters := usecases.SuggestionParameters{
-		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "uf": "29.000", "type": "should"},
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "should"},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -315,9 +322,9 @@ func TestGetAdsPriceRangeFilter(t *testing.T) {
 	}
 
 	parameters := usecases.SuggestionParameters{
-		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "uf": "29.000", "type": "filter"},
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "filter"},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -353,7 +360,7 @@ func TestGetAdsFieldsOK(t *testing.T) {
 	parameters := usecases.SuggestionParameters{
 		Fields: []string{"test"},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -384,9 +391,9 @@ func TestGetAdsPriceRangeMustNot(t *testing.T) {
 		regionsConf:    &mDataMapping,
 	}
 	parameters := usecases.SuggestionParameters{
-		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "uf": "29.000", "type": "mustNot"},
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "mustNot"},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -424,7 +431,7 @@ func TestGetAdsQueryString(t *testing.T) {
 			},
 		},
 	}
-	resp, err := repo.GetAds("1", parameters, 1, 0)
+	resp, _, err := repo.GetAds("1", parameters, 1, 0)
 	expected := []domain.Ad{{ListID: 1, Subject: "ad testing", URL: "/test/ad_testing_1"}}
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
@@ -433,20 +440,152 @@ func TestGetAdsQueryString(t *testing.T) {
 }
 
 func TestProcessPriceTemplateOK(t *testing.T) {
-	templateValue, err := template.New(getPriceRangeTemplateName).Parse("{{.PriceMin}}{{.PriceMax}}")
+	templateValue, err := template.New(getPriceRangeTemplateName).Parse("{{.PriceMin}}{{.PriceMax}}{{.Base}}")
 	templates := map[string]*template.Template{
 		getPriceRangeTemplateName: templateValue,
 	}
 	repo := adsRepository{
 		queryTemplates: templates,
 	}
-	priceRange := map[string]string{"gte": "5000", "lte": "7000", "uf": "29.000", "type": "filter"}
+	priceRange := map[string]string{"gte": "5000", "lte": "7000", "rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "filter"}
 	resp := repo.processPriceTemplate(priceRange)
-	expected := "50007000"
+	expected := "5000700029000"
 	assert.Equal(t, expected, resp)
 	assert.NoError(t, err)
 }
 
+func TestProcessPriceDecayTemplateOK(t *testing.T) {
+	templateValue, err := template.New(getPriceDecayTemplateName).Parse("{{.Origin}}-{{.PriceMin}}-{{.PriceMax}}-{{.Decay}}")
+	templates := map[string]*template.Template{
+		getPriceDecayTemplateName: templateValue,
+	}
+	repo := adsRepository{
+		queryTemplates: templates,
+	}
+	priceRange := map[string]string{
+		"gte": "5000", "lte": "7000", "origin": "6000", "decay": "0.5",
+		"rates": `{"peso":1,"uf":29000}`, "base": "29000", "type": "decay",
+	}
+	resp := repo.processPriceDecayTemplate(priceRange)
+	expected := "6000-5000-7000-0.5"
+	assert.Equal(t, expected, resp)
+	assert.NoError(t, err)
+}
+
+func TestGetAdsPriceRangeDecay(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	mDataMapping := MockDataMapping{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse("{{.Musts}}|{{.Functions}}")
+	priceDecayValue, _ := template.New(getPriceDecayTemplateName).Parse("{{.Origin}}")
+	templates := map[string]*template.Template{
+		getAdsTemplateName:        templateValue,
+		getPriceDecayTemplateName: priceDecayValue,
+	}
+	mDataMapping.On("Get", mock.Anything).Return("test")
+	mHandler.On("Search", mock.Anything,
+		`|{"gauss": {"listTime": {"origin": "now/1d", "offset": "1d", "scale": "7d"}}},6000`,
+		mock.Anything, mock.Anything,
+	).Return(`{"hits" : {"hits" : []}}`, nil)
+
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+		regionsConf:    &mDataMapping,
+	}
+	parameters := usecases.SuggestionParameters{
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "origin": "6000", "decay": "0.5", "type": "decay"},
+		DecayConf: map[string]string{
+			"name": "gauss", "field": "listTime", "origin": "now/1d", "offset": "1d", "scale": "7d",
+		},
+	}
+	_, _, err := repo.GetAds("1", parameters, 1, 0)
+	assert.NoError(t, err)
+	mHandler.AssertExpectations(t)
+}
+
+func TestGetScoreFunctionsOK(t *testing.T) {
+	priceDecayValue, _ := template.New(getPriceDecayTemplateName).Parse(`{"script_score": {"origin": {{.Origin}}}}`)
+	repo := adsRepository{
+		queryTemplates: map[string]*template.Template{getPriceDecayTemplateName: priceDecayValue},
+	}
+	parameters := usecases.SuggestionParameters{
+		PriceConf: map[string]string{"gte": "5000", "lte": "7000", "origin": "6000", "type": "must"},
+		DecayConf: map[string]string{"name": "gauss", "field": "listTime", "scale": "7d"},
+		ScoreFunctions: []map[string]string{
+			{"type": "gauss", "field": "listTime", "origin": "now/1d", "scale": "30d", "decay": "0.3", "weight": "1"},
+			{"type": "price", "weight": "2"},
+			{"type": "field_value_factor", "field": "imageCount", "modifier": "log1p", "factor": "1.2", "missing": "1"},
+			{"type": "unknown"},
+		},
+	}
+	resp := repo.getScoreFunctions(parameters)
+	expected := `{"gauss":{"listTime":{"decay":0.3,"origin":"now/1d","scale":"30d"}},"weight":1},` +
+		`{"script_score":{"origin":6000},"weight":2},` +
+		`{"field_value_factor":{"factor":1.2,"field":"imageCount","missing":1,"modifier":"log1p"}}`
+	assert.Equal(t, expected, resp)
+}
+
+func TestGetScoreFunctionsDecayConf(t *testing.T) {
+	repo := adsRepository{}
+	parameters := usecases.SuggestionParameters{
+		DecayConf: map[string]string{"name": "gauss", "field": "listTime", "origin": "now/1d", "offset": "1d", "scale": "7d"},
+	}
+	resp := repo.getScoreFunctions(parameters)
+	expected := `{"gauss": {"listTime": {"origin": "now/1d", "offset": "1d", "scale": "7d"}}}`
+	assert.Equal(t, expected, resp)
+}
+
+func TestGetAdsScoreConf(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse("{{.Functions}}|{{.ScoreMode}}|{{.BoostMode}}")
+	templates := map[string]*template.Template{
+		getAdsTemplateName: templateValue,
+	}
+	mHandler.On("Search", mock.Anything,
+		`{"linear":{"price":{"origin":"100","scale":"50"}}}|sum|multiply`,
+		mock.Anything, mock.Anything,
+	).Return(`{"hits" : {"hits" : []}}`, nil)
+
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+	}
+	parameters := usecases.SuggestionParameters{
+		ScoreFunctions: []map[string]string{{"type": "linear", "field": "price", "origin": "100", "scale": "50"}},
+		ScoreConf:      map[string]string{"scoreMode": "sum"},
+	}
+	_, _, err := repo.GetAds("1", parameters, 1, 0)
+	assert.NoError(t, err)
+	mHandler.AssertExpectations(t)
+}
+
+func TestGetGeoDistanceFilter(t *testing.T) {
+	geoConf := map[string]string{"distance": "25km", "origin": "-33.45,-70.66"}
+	expected := `{"geo_distance": {"distance": "25km", "location.geo": "-33.45,-70.66"}}`
+	assert.Equal(t, expected, getGeoDistanceFilter(geoConf))
+	assert.Equal(t, "", getGeoDistanceFilter(map[string]string{"distance": "25km"}))
+}
+
+func TestGetScoreFunctionsGeo(t *testing.T) {
+	repo := adsRepository{}
+	parameters := usecases.SuggestionParameters{
+		GeoConf: map[string]string{"field": "location.point", "origin": "-33.45,-70.66"},
+		ScoreFunctions: []map[string]string{
+			{"type": "geo", "offset": "2km", "scale": "20km", "weight": "3"},
+		},
+	}
+	resp := repo.getScoreFunctions(parameters)
+	expected := `{"gauss":{"location.point":{"offset":"2km","origin":"-33.45,-70.66","scale":"20km"}},"weight":3}`
+	assert.Equal(t, expected, resp)
+	parameters.GeoConf = map[string]string{}
+	assert.Equal(t, "", repo.getScoreFunctions(parameters))
+}
+
+func TestGetDecayFunctionEmpty(t *testing.T) {
+	repo := adsRepository{}
+	assert.Equal(t, "", repo.getDecayFunction(map[string]string{}))
+}
+
 func TestProcessLikeTemplateOK(t *testing.T) {
 	templateValue, err := template.New(getLikeTemplateName).Parse("{{.Fields}}")
 	templates := map[string]*template.Template{
@@ -463,6 +602,24 @@ func TestProcessLikeTemplateOK(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestProcessLikeTemplateLikes(t *testing.T) {
+	templateValue, _ := template.New(getLikeTemplateName).Parse(
+		`[{"_id": {{.AdID}}}{{if .Likes}}, {{.Likes}}{{end}}]`)
+	repo := adsRepository{
+		queryTemplates: map[string]*template.Template{getLikeTemplateName: templateValue},
+		index:          "ads",
+	}
+	resp := repo.processLikeTemplate("1", []string{"subject"}, map[string]string{}, "7", "8")
+	assert.Equal(t, `[{"_id": 1}, {"_index": "ads","_id": 7}, {"_index": "ads","_id": 8}]`, resp)
+	assert.Equal(t, `[{"_id": 1}]`, repo.processLikeTemplate("1", []string{"subject"}, map[string]string{}))
+}
+
+func TestGetExcludedTerms(t *testing.T) {
+	assert.Equal(t, `{"terms": {"listId": [3,4]}}`, getExcludedTerms("listId", []int64{3, 4}))
+	assert.Equal(t, `{"terms": {"userId": [5]}}`, getExcludedTerms("userId", []int64{5}))
+	assert.Empty(t, getExcludedTerms("listId", nil))
+}
+
 func TestProcessLikeTemplateEmpty(t *testing.T) {
 	repo := adsRepository{}
 	fields := []string{"Test"}
@@ -470,3 +627,257 @@ func TestProcessLikeTemplateEmpty(t *testing.T) {
 	resp := repo.processLikeTemplate("1", fields, config)
 	assert.Empty(t, resp)
 }
+
+func TestGetAdsNextCursor(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	mDataMapping := MockDataMapping{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse("{{.SearchAfter}}")
+	templates := map[string]*template.Template{
+		getAdsTemplateName: templateValue,
+	}
+	current := encodeCursor(adsCursor{SortValues: []json.RawMessage{[]byte("2.5"), []byte("10")}, Seed: 1000})
+	mDataMapping.On("Get", mock.Anything).Return("test")
+	mHandler.On("Search", mock.Anything, "[2.5,10]", 1, 0).Return(
+		`{
+			"hits" : {
+				"hits" : [{"_source" : {"AdID" : 1,"ListID" : 1, "Subject": "ad testing"}, "sort": [1.5, 1]}]
+			}
+		}`,
+		nil,
+	)
+
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+		regionsConf:    &mDataMapping,
+		from:           5,
+	}
+	parameters := usecases.SuggestionParameters{Cursor: current}
+	resp, next, err := repo.GetAds("1", parameters, 1, 3)
+	assert.NoError(t, err)
+	assert.Len(t, resp, 1)
+	decoded, err := decodeCursor(next, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, adsCursor{SortValues: []json.RawMessage{[]byte("1.5"), []byte("1")}, Seed: 1000}, decoded)
+	mHandler.AssertExpectations(t)
+	mDataMapping.AssertExpectations(t)
+}
+
+func TestGetAdsLastPageWithoutCursor(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	mDataMapping := MockDataMapping{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse("test")
+	templates := map[string]*template.Template{
+		getAdsTemplateName: templateValue,
+	}
+	mDataMapping.On("Get", mock.Anything).Return("test")
+	mHandler.On("Search", mock.Anything, mock.Anything, 2, 0).Return(
+		`{
+			"hits" : {
+				"hits" : [{"_source" : {"AdID" : 1,"ListID" : 1, "Subject": "ad testing"}, "sort": [1.5, 1]}]
+			}
+		}`,
+		nil,
+	)
+
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+		regionsConf:    &mDataMapping,
+	}
+	resp, next, err := repo.GetAds("1", usecases.SuggestionParameters{}, 2, 0)
+	assert.Len(t, resp, 1)
+	assert.Equal(t, "", next)
+	assert.NoError(t, err)
+	mHandler.AssertExpectations(t)
+}
+
+func TestGetAdsInvalidCursor(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	repo := adsRepository{elasticHandler: &mHandler}
+	parameters := usecases.SuggestionParameters{Cursor: "not a cursor"}
+	resp, next, err := repo.GetAds("1", parameters, 1, 0)
+	assert.Empty(t, resp)
+	assert.Equal(t, "", next)
+	assert.EqualError(t, err, "invalid cursor: 'not a cursor'")
+	assert.Equal(t, domain.InvalidInputError, domain.ErrorKindOf(err))
+	mHandler.AssertExpectations(t)
+}
+
+func TestDecodeCursorEmpty(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	cursor, err := decodeCursor("", now)
+	assert.NoError(t, err)
+	assert.Equal(t, adsCursor{Seed: 1600000000000}, cursor)
+}
+
+func TestFillAdParamsTyped(t *testing.T) {
+	repo := adsRepository{}
+	params := map[string]usecases.Param{
+		"rooms":      {Type: "int", Value: float64(3)},
+		"regdate":    {Type: "int", Value: "2015"},
+		"size":       {Type: "float", Value: 45.5},
+		"brand":      {Type: "string", Value: "TOYOTA"},
+		"estateType": {Type: "string", Value: "1", Translate: "Departamento"},
+		"equipment":  {Type: "array", Value: []interface{}{"1", "2"}, Translate: []interface{}{"pool", "gym"}},
+		"extra":      {Type: "object", Value: map[string]interface{}{"a": "b"}},
+		"empty":      {Type: "string"},
+		"invalid":    {Type: "int", Value: "many"},
+	}
+	expected := map[string]domain.AdParam{
+		"rooms":      domain.NewIntParam(3),
+		"regdate":    domain.NewIntParam(2015),
+		"size":       domain.NewFloatParam(45.5),
+		"brand":      domain.NewStringParam("TOYOTA"),
+		"estateType": domain.NewLabelParam("1", "Departamento"),
+		"equipment":  domain.NewArrayParam([]string{"pool", "gym"}),
+		"extra":      domain.NewStringParam(`{"a":"b"}`),
+	}
+	assert.Equal(t, expected, repo.fillAdParams(params))
+}
+
+func TestGetRangeFilters(t *testing.T) {
+	ranges := []map[string]string{
+		{"field": "params.rooms.value", "gte": "2", "lte": "4"},
+		{"field": "params.size.value", "gte": "40.5", "lte": "50"},
+		{"field": "params.bad.value", "gte": "a", "lte": "4"},
+		{"gte": "1", "lte": "4"},
+	}
+	expected := `{"range": {"params.rooms.value": {"gte": 2, "lte": 4}}},` +
+		`{"range": {"params.size.value": {"gte": 40.5, "lte": 50}}}`
+	assert.Equal(t, expected, getRangeFilters(ranges))
+}
+
+func TestSearchErrorTimeout(t *testing.T) {
+	err := searchError(fmt.Errorf("request failed: %w", context.DeadlineExceeded))
+	assert.Equal(t, domain.TimeoutError, domain.ErrorKindOf(err))
+	assert.Equal(t, domain.ErrCodeSearchTimeout, domain.ErrorCodeOf(err))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestSearchErrorTyped(t *testing.T) {
+	typed := domain.NewError(domain.UnknownError, domain.ErrCodeSearchQuery, "search failed", nil)
+	assert.Equal(t, typed, searchError(typed))
+}
+
+func TestMultiGetAdsOK(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	mDataMapping := MockDataMapping{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse(`{"source": {{.Source}}}`)
+	templates := map[string]*template.Template{
+		getAdsTemplateName: templateValue,
+	}
+	mDataMapping.On("Get", mock.Anything).Return("test")
+	mHandler.On("MultiSearch", "ads", mock.MatchedBy(func(searches []SearchRequest) bool {
+		return len(searches) == 2 &&
+			searches[0].Query == `{"source": ["listId"]}` && searches[0].Size == 1 && searches[0].From == 5 &&
+			searches[1].Query == `{"source": ["subject"]}` && searches[1].Size == 2
+	})).Return(
+		[]string{
+			`{"hits": {"hits": [{"_source": {"AdID": 1, "ListID": 1}, "sort": [1.5, 1]}]}}`,
+			`{"hits": {"hits": [{"_source": {"AdID": 2, "ListID": 2}, "sort": [1.2, 2]}]}}`,
+		},
+		nil,
+		nil,
+	)
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+		regionsConf:    &mDataMapping,
+		index:          "ads",
+		from:           5,
+	}
+	results, err := repo.MultiGetAds("1", []usecases.AdsQuery{
+		{Params: usecases.SuggestionParameters{SourceIncludes: []string{"listId"}}, Size: 1},
+		{Params: usecases.SuggestionParameters{SourceIncludes: []string{"subject"}}, Size: 2},
+		{Params: usecases.SuggestionParameters{Cursor: "invalid"}, Size: 2},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Len(t, results[0].Ads, 1)
+	assert.NotEmpty(t, results[0].Cursor)
+	assert.NoError(t, results[0].Err)
+	assert.Len(t, results[1].Ads, 1)
+	assert.Empty(t, results[1].Cursor)
+	assert.Equal(t, domain.ErrCodeInvalidCursor, domain.ErrorCodeOf(results[2].Err))
+	mHandler.AssertExpectations(t)
+}
+
+func TestMultiGetAdsSearchErrors(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	templateValue, _ := template.New(getAdsTemplateName).Parse("{}")
+	templates := map[string]*template.Template{
+		getAdsTemplateName: templateValue,
+	}
+	mHandler.On("MultiSearch", mock.Anything, mock.Anything).Return(
+		[]string{`{}`, `{}`}, []error{nil, fmt.Errorf("shard failure")}, nil,
+	).Once()
+	mHandler.On("MultiSearch", mock.Anything, mock.Anything).Return(nil, nil, fmt.Errorf("connection refused"))
+	repo := adsRepository{elasticHandler: &mHandler, queryTemplates: templates}
+	queries := []usecases.AdsQuery{{Size: 1}, {Size: 1}}
+
+	results, err := repo.MultiGetAds("1", queries)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.Empty(t, results[0].Ads)
+	assert.Equal(t, domain.UnavailableError, domain.ErrorKindOf(results[1].Err))
+
+	results, err = repo.MultiGetAds("1", queries)
+	assert.Nil(t, results)
+	assert.Equal(t, domain.ErrCodeSearchUnavailable, domain.ErrorCodeOf(err))
+}
+
+func TestGetAdsByListIDsOK(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	mDataMapping := MockDataMapping{}
+	templateValue, _ := template.New("getAdsByListIDs").Parse(
+		`{"ids": {{.ListIDs}}, "must_not": [{{.MustsNot}}], "filter": [{{.Filters}}]}`)
+	templates := map[string]*template.Template{
+		"getAdsByListIDs": templateValue,
+	}
+	mDataMapping.On("Get", mock.Anything).Return("test")
+	mHandler.On(
+		"Search", "ads",
+		`{"ids": [3,1,2], "must_not": [{"match": {"listId": "9"}}], "filter": [{"term": {"categoryId": "2020"}}]}`,
+		3, 0,
+	).Return(
+		`{"hits": {"hits": [{"_source": {"AdID": 1, "ListID": 1}}, {"_source": {"AdID": 3, "ListID": 3}}]}}`,
+		nil,
+	)
+	repo := adsRepository{
+		elasticHandler: &mHandler,
+		queryTemplates: templates,
+		regionsConf:    &mDataMapping,
+		index:          "ads",
+		from:           5,
+	}
+	ads, err := repo.GetAdsByListIDs([]int64{3, 1, 2}, usecases.SuggestionParameters{
+		MustsNot: map[string]string{"listId": "9"},
+		Filters:  map[string]string{"categoryId": "2020"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ads, 2)
+	assert.Equal(t, int64(3), ads[0].ListID)
+	assert.Equal(t, int64(1), ads[1].ListID)
+	mHandler.AssertExpectations(t)
+}
+
+func TestGetAdsByListIDsErr(t *testing.T) {
+	mHandler := MockElasticSearchHandler{}
+	templateValue, _ := template.New("getAdsByListIDs").Parse("{}")
+	templates := map[string]*template.Template{
+		"getAdsByListIDs": templateValue,
+	}
+	mHandler.On("Search", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(`{}`, fmt.Errorf("connection refused"))
+	repo := adsRepository{elasticHandler: &mHandler, queryTemplates: templates}
+
+	ads, err := repo.GetAdsByListIDs([]int64{1}, usecases.SuggestionParameters{})
+	assert.Nil(t, ads)
+	assert.Equal(t, domain.ErrCodeSearchUnavailable, domain.ErrorCodeOf(err))
+
+	ads, err = repo.GetAdsByListIDs(nil, usecases.SuggestionParameters{})
+	assert.NoError(t, err)
+	assert.Empty(t, ads)
+	mHandler.AssertNumberOfCalls(t, "Search", 1)
+}
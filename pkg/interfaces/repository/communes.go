@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+const errorCommuneCoordinates = "coordinates not found for commune %d"
+
+// communesRepository gets communes data from a DataMapping, etcd or a local file
+type communesRepository struct {
+	coordinates DataMapping
+}
+
+// NewCommunesRepository returns a fresh instance of communesRepository
+func NewCommunesRepository(coordinates DataMapping) usecases.CommunesRepository {
+	return &communesRepository{
+		coordinates: coordinates,
+	}
+}
+
+// GetCoordinates returns the coordinates of the commune center,
+// read from the commune.{id}.lat and commune.{id}.lon keys
+func (repo *communesRepository) GetCoordinates(communeID int64) (domain.GeoPoint, error) {
+	lat, errLat := strconv.ParseFloat(repo.coordinates.Get(fmt.Sprintf("commune.%d.lat", communeID)), 64)
+	lon, errLon := strconv.ParseFloat(repo.coordinates.Get(fmt.Sprintf("commune.%d.lon", communeID)), 64)
+	if errLat != nil || errLon != nil {
+		return domain.GeoPoint{}, fmt.Errorf(errorCommuneCoordinates, communeID)
+	}
+	return domain.GeoPoint{Lat: lat, Lon: lon}, nil
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+func TestNewCommunesRepository(t *testing.T) {
+	mDataMapping := MockDataMapping{}
+	expected := &communesRepository{coordinates: &mDataMapping}
+	assert.Equal(t, expected, NewCommunesRepository(&mDataMapping))
+}
+
+func TestGetCoordinatesOK(t *testing.T) {
+	mDataMapping := MockDataMapping{}
+	mDataMapping.On("Get", "commune.295.lat").Return("-33.4489")
+	mDataMapping.On("Get", "commune.295.lon").Return("-70.6693")
+	repo := communesRepository{coordinates: &mDataMapping}
+	point, err := repo.GetCoordinates(295)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.GeoPoint{Lat: -33.4489, Lon: -70.6693}, point)
+	mDataMapping.AssertExpectations(t)
+}
+
+func TestGetCoordinatesNotFound(t *testing.T) {
+	mDataMapping := MockDataMapping{}
+	mDataMapping.On("Get", "commune.1.lat").Return("")
+	mDataMapping.On("Get", "commune.1.lon").Return("")
+	repo := communesRepository{coordinates: &mDataMapping}
+	point, err := repo.GetCoordinates(1)
+	assert.Error(t, err)
+	assert.Equal(t, domain.GeoPoint{}, point)
+	mDataMapping.AssertExpectations(t)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// coviewRepository serves the co-view neighbours computed offline by the
+// coview command
+type coviewRepository struct {
+	store CoviewStore
+}
+
+// NewCoviewRepository returns a fresh instance of coviewRepository
+func NewCoviewRepository(store CoviewStore) usecases.CoviewRepository {
+	return &coviewRepository{
+		store: store,
+	}
+}
+
+// GetNeighbours returns up to size neighbours of the ad, ads without
+// neighbours, as new ones, have an empty slice
+func (repo *coviewRepository) GetNeighbours(listID int64, size int) ([]domain.Neighbour, error) {
+	neighbours := repo.store.Neighbours(listID)
+	if size > 0 && len(neighbours) > size {
+		neighbours = neighbours[:size]
+	}
+	out := make([]domain.Neighbour, len(neighbours))
+	copy(out, neighbours)
+	return out, nil
+}
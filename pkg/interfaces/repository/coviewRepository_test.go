@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockCoviewStore map[int64][]domain.Neighbour
+
+func (m mockCoviewStore) Neighbours(listID int64) []domain.Neighbour {
+	return m[listID]
+}
+
+func TestCoviewRepositoryGetNeighbours(t *testing.T) {
+	store := mockCoviewStore{1: {{ListID: 2, Score: 0.8}, {ListID: 3, Score: 0.5}}}
+	repo := NewCoviewRepository(store)
+
+	neighbours, err := repo.GetNeighbours(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Neighbour{{ListID: 2, Score: 0.8}}, neighbours)
+
+	neighbours, _ = repo.GetNeighbours(1, 10)
+	assert.Len(t, neighbours, 2)
+
+	neighbours, err = repo.GetNeighbours(4, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, neighbours)
+}
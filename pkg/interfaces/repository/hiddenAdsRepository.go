@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// hiddenAdsRepository keeps the ads and sellers hidden on each device on a store
+type hiddenAdsRepository struct {
+	store     HiddenAdsStore
+	maxHidden int
+}
+
+// NewHiddenAdsRepository returns a fresh instance of hiddenAdsRepository
+// keeping up to maxHidden ads and maxHidden sellers for each device
+func NewHiddenAdsRepository(store HiddenAdsStore, maxHidden int) usecases.HiddenAdsRepository {
+	return &hiddenAdsRepository{
+		store:     store,
+		maxHidden: maxHidden,
+	}
+}
+
+// GetHidden returns the ads and sellers hidden on the device, most recent first
+func (repo *hiddenAdsRepository) GetHidden(deviceID string) (domain.Exclusions, error) {
+	return repo.store.Get(deviceID)
+}
+
+// AddHidden puts the ads and sellers first on the ones hidden on the
+// device, the oldest ones are dropped past maxHidden
+func (repo *hiddenAdsRepository) AddHidden(deviceID string, hidden domain.Exclusions) error {
+	current, err := repo.store.Get(deviceID)
+	if err != nil {
+		return err
+	}
+	return repo.store.Set(deviceID, domain.Exclusions{
+		ListIDs: prependUnique(hidden.ListIDs, current.ListIDs, repo.maxHidden),
+		UserIDs: prependUnique(hidden.UserIDs, current.UserIDs, repo.maxHidden),
+	})
+}
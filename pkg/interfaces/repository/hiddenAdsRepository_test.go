@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockHiddenAdsStore struct {
+	mock.Mock
+}
+
+func (m *mockHiddenAdsStore) Get(key string) (domain.Exclusions, error) {
+	args := m.Called(key)
+	return args.Get(0).(domain.Exclusions), args.Error(1)
+}
+
+func (m *mockHiddenAdsStore) Set(key string, hidden domain.Exclusions) error {
+	return m.Called(key, hidden).Error(0)
+}
+
+func TestHiddenAdsRepositoryAddHidden(t *testing.T) {
+	store := &mockHiddenAdsStore{}
+	store.On("Get", "device").Return(domain.Exclusions{ListIDs: []int64{3, 2}, UserIDs: []int64{7}}, nil)
+	store.On("Set", "device", domain.Exclusions{ListIDs: []int64{2, 3}, UserIDs: []int64{7}}).Return(nil)
+	repo := NewHiddenAdsRepository(store, 2)
+
+	assert.NoError(t, repo.AddHidden("device", domain.Exclusions{ListIDs: []int64{2}}))
+	store.AssertExpectations(t)
+}
+
+func TestHiddenAdsRepositoryAddHiddenErr(t *testing.T) {
+	store := &mockHiddenAdsStore{}
+	store.On("Get", "device").Return(domain.Exclusions{}, fmt.Errorf("unavailable"))
+	repo := NewHiddenAdsRepository(store, 2)
+
+	assert.Error(t, repo.AddHidden("device", domain.Exclusions{UserIDs: []int64{7}}))
+	store.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+}
+
+func TestHiddenAdsRepositoryGetHidden(t *testing.T) {
+	store := &mockHiddenAdsStore{}
+	store.On("Get", "device").Return(domain.Exclusions{UserIDs: []int64{7}}, nil)
+	repo := NewHiddenAdsRepository(store, 2)
+
+	hidden, err := repo.GetHidden("device")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Exclusions{UserIDs: []int64{7}}, hidden)
+}
@@ -8,44 +8,141 @@ import (
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
 )
 
+const (
+	// errOfflineIndicator error text when an indicator is not stored and
+	// the repository is working offline
+	errOfflineIndicator = "indicators api disabled, no stored value for '%s'"
+)
+
+// IndicatorsLogger defines the logger methods that will be used for this repository
+type IndicatorsLogger interface {
+	ErrorSavingIndicator(code string, err error)
+	UsingStoredIndicator(code string, date time.Time, err error)
+	StaleIndicator(code string, date time.Time, age time.Duration)
+	OfflineIndicators()
+}
+
 // indicatorsRepository loan settings datasource
 type indicatorsRepository struct {
 	HTTPCachedHandler HTTPCachedHandler
-	UFPath            string
-	DefaultValue      float64
+	// APIPath is the indicators api base path, the indicator code and
+	// date are appended to it
+	APIPath string
+	// DefaultValues are returned when an indicator cannot be retrieved
+	DefaultValues map[string]float64
+	// Store keeps the last known values to be served when the api fails
+	Store IndicatorsStore
+	// AgeGauge reports the age in seconds of the served values
+	AgeGauge MetricsGauge
+	// StaleAfter is the age after which a stored value is reported as stale
+	StaleAfter time.Duration
+	// Offline disables the indicators api, only stored values are served
+	Offline bool
+	Logger  IndicatorsLogger
 }
 
-// NewIndicatorsRepository returns a indicatorsRepository instance
+// NewIndicatorsRepository returns a indicatorsRepository instance. Working
+// offline is logged once here instead of on every served value
 func NewIndicatorsRepository(
 	httpCachedHandler HTTPCachedHandler,
-	ufPath string,
-	defaultValue int,
+	apiPath string,
+	defaultValues map[string]float64,
+	store IndicatorsStore,
+	ageGauge MetricsGauge,
+	staleAfter time.Duration,
+	offline bool,
+	logger IndicatorsLogger,
 ) usecases.IndicatorsRepository {
+	if offline {
+		logger.OfflineIndicators()
+	}
 	return &indicatorsRepository{
 		HTTPCachedHandler: httpCachedHandler,
-		UFPath:            ufPath,
-		DefaultValue:      float64(defaultValue),
+		APIPath:           apiPath,
+		DefaultValues:     defaultValues,
+		Store:             store,
+		AgeGauge:          ageGauge,
+		StaleAfter:        staleAfter,
+		Offline:           offline,
+		Logger:            logger,
+	}
+}
+
+// GetIndicator gets the value of an indicator for the given date.
+// Successfully fetched values are saved on the store, when the api fails
+// the last stored value is returned instead
+func (repo *indicatorsRepository) GetIndicator(code string, date time.Time) (float64, error) {
+	if repo.Offline {
+		return repo.getStored(code, date, fmt.Errorf(errOfflineIndicator, code))
+	}
+	value, valueDate, err := repo.fetchIndicator(code, date)
+	if err != nil {
+		return repo.getStored(code, date, err)
+	}
+	repo.reportAge(code, date.Sub(valueDate))
+	if repo.Store != nil {
+		if errSave := repo.Store.Save(code, valueDate, value); errSave != nil {
+			repo.Logger.ErrorSavingIndicator(code, errSave)
+		}
 	}
+	return value, nil
 }
 
-// GetUF get UF value
-func (repo *indicatorsRepository) GetUF() (float64, error) {
-	t := time.Now()
+// fetchIndicator gets the indicator value of the given day from the indicators api
+func (repo *indicatorsRepository) fetchIndicator(code string, t time.Time) (float64, time.Time, error) {
 	dateStr := fmt.Sprintf("%02d-%02d-%d", t.Day(), t.Month(), t.Year())
 	request := repo.HTTPCachedHandler.NewRequest().
 		SetMethod("GET").
-		SetPath(repo.UFPath + dateStr)
+		SetPath(repo.APIPath + code + "/" + dateStr)
 	response, err := repo.HTTPCachedHandler.Send(request)
 	if err == nil && response != nil {
-		var ufAPIResponse usecases.UFApiResponse
+		var apiResponse usecases.IndicatorsAPIResponse
 		b := []byte(response.(string))
-		err = json.Unmarshal(b, &ufAPIResponse)
+		err = json.Unmarshal(b, &apiResponse)
 		if err == nil {
-			if len(ufAPIResponse.Sets) > 0 {
-				return ufAPIResponse.Sets[0].Value, nil
+			if len(apiResponse.Sets) > 0 {
+				date, errDate := time.Parse(time.RFC3339, apiResponse.Sets[0].Date)
+				if errDate != nil {
+					date = t
+				}
+				return apiResponse.Sets[0].Value, date, nil
 			}
-			return repo.DefaultValue, fmt.Errorf(usecases.ErrGetUF)
+			return repo.DefaultValues[code], t, fmt.Errorf(usecases.ErrGetIndicator)
 		}
 	}
-	return repo.DefaultValue, err
+	return repo.DefaultValues[code], t, err
+}
+
+// getStored returns the last stored value of the indicator. If there is no
+// stored value, the default value and the original error are returned.
+// Offline every value is stored, so they are not logged
+func (repo *indicatorsRepository) getStored(code string, t time.Time, err error) (float64, error) {
+	if repo.Store == nil {
+		return repo.DefaultValues[code], err
+	}
+	value, date, errStore := repo.Store.Get(code, t)
+	if errStore != nil {
+		return repo.DefaultValues[code], err
+	}
+	age := t.Sub(date)
+	repo.reportAge(code, age)
+	if repo.Offline {
+		return value, nil
+	}
+	repo.Logger.UsingStoredIndicator(code, date, err)
+	if repo.StaleAfter > 0 && age > repo.StaleAfter {
+		repo.Logger.StaleIndicator(code, date, age)
+	}
+	return value, nil
+}
+
+// reportAge exports the age of the served indicator value
+func (repo *indicatorsRepository) reportAge(code string, age time.Duration) {
+	if repo.AgeGauge == nil {
+		return
+	}
+	if age < 0 {
+		age = 0
+	}
+	repo.AgeGauge.Set(age.Seconds(), code)
 }
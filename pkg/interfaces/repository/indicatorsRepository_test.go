@@ -6,26 +6,36 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 var t = time.Now()
 var today = fmt.Sprintf("%02d-%02d-%d", t.Day(), t.Month(), t.Year())
-var ufPath = ""
-var defaultValue = 30000
+var apiPath = ""
+var defaultValues = map[string]float64{"uf": 30000, "dolar": 850}
 
 func TestNewIndicatorsRepository(t *testing.T) {
 	mHTTPCachedHandler := new(MockHTTPCachedHandler)
+	mStore := new(MockIndicatorsStore)
+	mGauge := new(MockMetricsGauge)
+	mLogger := new(MockIndicatorsLogger)
 	indicatorsRepository := &indicatorsRepository{
 		HTTPCachedHandler: mHTTPCachedHandler,
-		UFPath:            ufPath,
-		DefaultValue:      float64(defaultValue),
+		APIPath:           apiPath,
+		DefaultValues:     defaultValues,
+		Store:             mStore,
+		AgeGauge:          mGauge,
+		StaleAfter:        time.Hour,
+		Logger:            mLogger,
 	}
-	repository := NewIndicatorsRepository(mHTTPCachedHandler, ufPath, defaultValue)
+	repository := NewIndicatorsRepository(
+		mHTTPCachedHandler, apiPath, defaultValues, mStore, mGauge, time.Hour, false, mLogger,
+	)
 	assert.Equal(t, indicatorsRepository, repository)
 	mHTTPCachedHandler.AssertExpectations(t)
 }
 
-func TestGetUFOK(t *testing.T) {
+func TestGetIndicatorOK(t *testing.T) {
 	expectedResult := 29095.61
 	// nolint: misspell
 	response := `{
@@ -43,21 +53,21 @@ func TestGetUFOK(t *testing.T) {
 	mHTTPCachedHandler := new(MockHTTPCachedHandler)
 	mHTTPRequest := new(mockRequest)
 	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
-	mHTTPRequest.On("SetPath", ufPath+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetPath", apiPath+"uf/"+today).Return(mHTTPRequest)
 	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
 	mHTTPCachedHandler.On("Send", mHTTPRequest).Return(response, nil)
 	indicatorsRepository := &indicatorsRepository{
 		HTTPCachedHandler: mHTTPCachedHandler,
-		UFPath:            ufPath,
+		APIPath:           apiPath,
 	}
-	result, err := indicatorsRepository.GetUF()
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
 	assert.Equal(t, result, expectedResult)
 	assert.NoError(t, err)
 	mHTTPCachedHandler.AssertExpectations(t)
 	mHTTPRequest.AssertExpectations(t)
 }
 
-func TestGetUFError(t *testing.T) {
+func TestGetIndicatorError(t *testing.T) {
 	var expectedResult float64
 	// nolint: misspell
 	response := `{
@@ -75,21 +85,21 @@ func TestGetUFError(t *testing.T) {
 	mHTTPCachedHandler := new(MockHTTPCachedHandler)
 	mHTTPRequest := new(mockRequest)
 	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
-	mHTTPRequest.On("SetPath", ufPath+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetPath", apiPath+"uf/"+today).Return(mHTTPRequest)
 	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
 	mHTTPCachedHandler.On("Send", mHTTPRequest).Return(response, fmt.Errorf(""))
 	indicatorsRepository := &indicatorsRepository{
 		HTTPCachedHandler: mHTTPCachedHandler,
-		UFPath:            ufPath,
+		APIPath:           apiPath,
 	}
-	result, err := indicatorsRepository.GetUF()
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
 	assert.Equal(t, result, expectedResult)
 	assert.Error(t, err)
 	mHTTPCachedHandler.AssertExpectations(t)
 	mHTTPRequest.AssertExpectations(t)
 }
 
-func TestGetUFSetEmpty(t *testing.T) {
+func TestGetIndicatorSetEmpty(t *testing.T) {
 	expectedResult := 0.0
 	// nolint: misspell
 	response := `{
@@ -104,16 +114,162 @@ func TestGetUFSetEmpty(t *testing.T) {
 	mHTTPCachedHandler := new(MockHTTPCachedHandler)
 	mHTTPRequest := new(mockRequest)
 	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
-	mHTTPRequest.On("SetPath", ufPath+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetPath", apiPath+"uf/"+today).Return(mHTTPRequest)
 	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
 	mHTTPCachedHandler.On("Send", mHTTPRequest).Return(response, nil)
 	indicatorsRepository := &indicatorsRepository{
 		HTTPCachedHandler: mHTTPCachedHandler,
-		UFPath:            ufPath,
+		APIPath:           apiPath,
 	}
-	result, err := indicatorsRepository.GetUF()
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
 	assert.Equal(t, result, expectedResult)
 	assert.Error(t, err)
 	mHTTPCachedHandler.AssertExpectations(t)
 	mHTTPRequest.AssertExpectations(t)
 }
+
+func TestGetIndicatorSavesValue(t *testing.T) {
+	// nolint: misspell
+	response := `{
+			"codigo":"uf",
+			"serie":[{
+				"fecha":"2021-01-21T03:00:00.000Z",
+				"valor":29095.61
+			}]
+		}`
+	date, _ := time.Parse(time.RFC3339, "2021-01-21T03:00:00.000Z")
+	mHTTPCachedHandler := new(MockHTTPCachedHandler)
+	mHTTPRequest := new(mockRequest)
+	mStore := new(MockIndicatorsStore)
+	mGauge := new(MockMetricsGauge)
+	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
+	mHTTPRequest.On("SetPath", apiPath+"uf/"+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
+	mHTTPCachedHandler.On("Send", mHTTPRequest).Return(response, nil)
+	mStore.On("Save", "uf", date, 29095.61).Return(nil)
+	mGauge.On("Set", mock.AnythingOfType("float64"), []string{"uf"})
+	indicatorsRepository := &indicatorsRepository{
+		HTTPCachedHandler: mHTTPCachedHandler,
+		APIPath:           apiPath,
+		Store:             mStore,
+		AgeGauge:          mGauge,
+	}
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
+	assert.Equal(t, 29095.61, result)
+	assert.NoError(t, err)
+	mHTTPCachedHandler.AssertExpectations(t)
+	mStore.AssertExpectations(t)
+	mGauge.AssertExpectations(t)
+}
+
+func TestGetIndicatorErrorUsesStoredValue(t *testing.T) {
+	storedDate := time.Now().Add(-time.Hour)
+	apiErr := fmt.Errorf("api error")
+	mHTTPCachedHandler := new(MockHTTPCachedHandler)
+	mHTTPRequest := new(mockRequest)
+	mStore := new(MockIndicatorsStore)
+	mGauge := new(MockMetricsGauge)
+	mLogger := new(MockIndicatorsLogger)
+	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
+	mHTTPRequest.On("SetPath", apiPath+"uf/"+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
+	mHTTPCachedHandler.On("Send", mHTTPRequest).Return("", apiErr)
+	mStore.On("Get", "uf", mock.AnythingOfType("time.Time")).Return(29000.5, storedDate, nil)
+	mGauge.On("Set", mock.AnythingOfType("float64"), []string{"uf"})
+	mLogger.On("UsingStoredIndicator", "uf", storedDate, apiErr)
+	indicatorsRepository := &indicatorsRepository{
+		HTTPCachedHandler: mHTTPCachedHandler,
+		APIPath:           apiPath,
+		DefaultValues:     defaultValues,
+		Store:             mStore,
+		AgeGauge:          mGauge,
+		StaleAfter:        24 * time.Hour,
+		Logger:            mLogger,
+	}
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
+	assert.Equal(t, 29000.5, result)
+	assert.NoError(t, err)
+	mStore.AssertExpectations(t)
+	mGauge.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetIndicatorOfflineStaleValue(t *testing.T) {
+	storedDate := time.Now().Add(-72 * time.Hour)
+	mStore := new(MockIndicatorsStore)
+	mLogger := new(MockIndicatorsLogger)
+	mStore.On("Get", "uf", mock.AnythingOfType("time.Time")).Return(29000.5, storedDate, nil)
+	mLogger.On("OfflineIndicators").Once()
+	indicatorsRepository := NewIndicatorsRepository(nil, apiPath, defaultValues, mStore, nil, 24*time.Hour, true, mLogger)
+	for i := 0; i < 2; i++ {
+		result, err := indicatorsRepository.GetIndicator("uf", time.Now())
+		assert.Equal(t, 29000.5, result)
+		assert.NoError(t, err)
+	}
+	mStore.AssertExpectations(t)
+	// offline is logged once, not on every stored or stale value
+	mLogger.AssertExpectations(t)
+	mLogger.AssertNotCalled(t, "UsingStoredIndicator", mock.Anything, mock.Anything, mock.Anything)
+	mLogger.AssertNotCalled(t, "StaleIndicator", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetIndicatorOfflineNotStored(t *testing.T) {
+	mStore := new(MockIndicatorsStore)
+	mStore.On("Get", "uf", mock.AnythingOfType("time.Time")).Return(0.0, time.Time{}, fmt.Errorf("not found"))
+	indicatorsRepository := &indicatorsRepository{
+		DefaultValues: defaultValues,
+		Store:         mStore,
+		Offline:       true,
+	}
+	result, err := indicatorsRepository.GetIndicator("uf", time.Now())
+	assert.Equal(t, defaultValues["uf"], result)
+	assert.Error(t, err)
+	mStore.AssertExpectations(t)
+}
+
+func TestGetIndicatorDolar(t *testing.T) {
+	// nolint: misspell
+	response := `{
+			"codigo":"dolar",
+			"nombre":"Dólar observado",
+			"unidad_medida":"Pesos",
+			"serie":[{
+				"fecha":"2021-01-21T03:00:00.000Z",
+				"valor":734.52
+			}]
+		}`
+	mHTTPCachedHandler := new(MockHTTPCachedHandler)
+	mHTTPRequest := new(mockRequest)
+	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
+	mHTTPRequest.On("SetPath", apiPath+"dolar/"+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
+	mHTTPCachedHandler.On("Send", mHTTPRequest).Return(response, nil)
+	indicatorsRepository := &indicatorsRepository{
+		HTTPCachedHandler: mHTTPCachedHandler,
+		APIPath:           apiPath,
+		DefaultValues:     defaultValues,
+	}
+	result, err := indicatorsRepository.GetIndicator("dolar", time.Now())
+	assert.Equal(t, 734.52, result)
+	assert.NoError(t, err)
+	mHTTPCachedHandler.AssertExpectations(t)
+	mHTTPRequest.AssertExpectations(t)
+}
+
+func TestGetIndicatorErrorDefaultValue(t *testing.T) {
+	mHTTPCachedHandler := new(MockHTTPCachedHandler)
+	mHTTPRequest := new(mockRequest)
+	mHTTPCachedHandler.On("NewRequest").Return(mHTTPRequest, nil)
+	mHTTPRequest.On("SetPath", apiPath+"dolar/"+today).Return(mHTTPRequest)
+	mHTTPRequest.On("SetMethod", "GET").Return(mHTTPRequest)
+	mHTTPCachedHandler.On("Send", mHTTPRequest).Return("", fmt.Errorf("api error"))
+	indicatorsRepository := &indicatorsRepository{
+		HTTPCachedHandler: mHTTPCachedHandler,
+		APIPath:           apiPath,
+		DefaultValues:     defaultValues,
+	}
+	result, err := indicatorsRepository.GetIndicator("dolar", time.Now())
+	assert.Equal(t, defaultValues["dolar"], result)
+	assert.Error(t, err)
+	mHTTPCachedHandler.AssertExpectations(t)
+}
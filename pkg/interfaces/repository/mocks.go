@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -22,9 +23,49 @@ func (m *MockElasticSearchHandler) PutMapping(mapping []byte, index string) erro
 	args := m.Called(mapping, index)
 	return args.Error(0)
 }
-func (m *MockElasticSearchHandler) Search(index, query string, size, from int) (string, error) {
+
+// Search decodes the hits object of the response given as first return
+// argument, as the elastic handler does
+func (m *MockElasticSearchHandler) Search(index, query string, size, from int, hits interface{}) error {
 	args := m.Called(index, query, size, from)
-	return args.Get(0).(string), args.Error(1)
+	if args.Error(1) != nil {
+		return args.Error(1)
+	}
+	return decodeMockHits(args.String(0), hits)
+}
+
+// MultiSearch decodes the hits of each response given as first return
+// argument in the search with the same position
+func (m *MockElasticSearchHandler) MultiSearch(index string, searches []SearchRequest) ([]error, error) {
+	args := m.Called(index, searches)
+	if args.Error(2) != nil {
+		return nil, args.Error(2)
+	}
+	responses, _ := args.Get(0).([]string)
+	errs, _ := args.Get(1).([]error)
+	if errs == nil {
+		errs = make([]error, len(searches))
+	}
+	for i, search := range searches {
+		if i < len(responses) && errs[i] == nil {
+			errs[i] = decodeMockHits(responses[i], search.Hits)
+		}
+	}
+	return errs, nil
+}
+
+// decodeMockHits decodes the hits object of a search response in hits
+func decodeMockHits(response string, hits interface{}) error {
+	var envelope struct {
+		Hits json.RawMessage `json:"hits"`
+	}
+	if err := json.Unmarshal([]byte(response), &envelope); err != nil {
+		return err
+	}
+	if len(envelope.Hits) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Hits, hits)
 }
 
 type MockDataMapping struct {
@@ -130,3 +171,75 @@ func (m *MockHTTPCachedHandler) NewRequest() HTTPRequest {
 	args := m.Called()
 	return args.Get(0).(HTTPRequest)
 }
+
+// MockIndicatorsStore mocks IndicatorsStore
+type MockIndicatorsStore struct {
+	mock.Mock
+}
+
+// Save mocks IndicatorsStore's Save method
+func (m *MockIndicatorsStore) Save(code string, date time.Time, value float64) error {
+	args := m.Called(code, date, value)
+	return args.Error(0)
+}
+
+// Get mocks IndicatorsStore's Get method
+func (m *MockIndicatorsStore) Get(code string, date time.Time) (float64, time.Time, error) {
+	args := m.Called(code, date)
+	return args.Get(0).(float64), args.Get(1).(time.Time), args.Error(2)
+}
+
+// MockMetricsGauge mocks MetricsGauge
+type MockMetricsGauge struct {
+	mock.Mock
+}
+
+// Set mocks MetricsGauge's Set method
+func (m *MockMetricsGauge) Set(value float64, labels ...string) {
+	m.Called(value, labels)
+}
+
+// MockEventsSink mocks EventsSink
+type MockEventsSink struct {
+	mock.Mock
+}
+
+// Write mocks EventsSink's Write method
+func (m *MockEventsSink) Write(records []interface{}) error {
+	return m.Called(records).Error(0)
+}
+
+// MockMetricsCounter mocks MetricsCounter
+type MockMetricsCounter struct {
+	mock.Mock
+}
+
+// Inc mocks MetricsCounter's Inc method
+func (m *MockMetricsCounter) Inc(labels ...string) {
+	m.Called(labels)
+}
+
+// MockIndicatorsLogger mocks IndicatorsLogger
+type MockIndicatorsLogger struct {
+	mock.Mock
+}
+
+// ErrorSavingIndicator mocks IndicatorsLogger's ErrorSavingIndicator method
+func (m *MockIndicatorsLogger) ErrorSavingIndicator(code string, err error) {
+	m.Called(code, err)
+}
+
+// UsingStoredIndicator mocks IndicatorsLogger's UsingStoredIndicator method
+func (m *MockIndicatorsLogger) UsingStoredIndicator(code string, date time.Time, err error) {
+	m.Called(code, date, err)
+}
+
+// StaleIndicator mocks IndicatorsLogger's StaleIndicator method
+func (m *MockIndicatorsLogger) StaleIndicator(code string, date time.Time, age time.Duration) {
+	m.Called(code, date, age)
+}
+
+// OfflineIndicators mocks IndicatorsLogger's OfflineIndicators method
+func (m *MockIndicatorsLogger) OfflineIndicators() {
+	m.Called()
+}
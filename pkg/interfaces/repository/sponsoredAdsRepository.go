@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"sort"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// SponsoredCampaign is a paid placement of an ad on the suggestions for
+// the ads of its categories and regions, any of them when empty. Main
+// categories also match the ads of their subcategories
+type SponsoredCampaign struct {
+	ListID       int64   `json:"listId"`
+	Categories   []int64 `json:"categories"`
+	Regions      []int64 `json:"regions"`
+	Priority     int     `json:"priority"`
+	FrequencyCap int     `json:"frequencyCap"`
+}
+
+// sponsoredAdsRepository serves the sponsored ads of a list of campaigns,
+// as the ones loaded from the sponsored ads file
+type sponsoredAdsRepository struct {
+	campaigns []SponsoredCampaign
+}
+
+// NewSponsoredAdsRepository returns a fresh instance of sponsoredAdsRepository
+func NewSponsoredAdsRepository(campaigns []SponsoredCampaign) usecases.SponsoredAdsRepository {
+	sorted := make([]SponsoredCampaign, len(campaigns))
+	copy(sorted, campaigns)
+	// ties are sorted by descending listID so newer ads come first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ListID > sorted[j].ListID
+	})
+	return &sponsoredAdsRepository{campaigns: sorted}
+}
+
+// GetSponsoredAds returns the ads of the campaigns eligible on the
+// category and region, by descending priority
+func (repo *sponsoredAdsRepository) GetSponsoredAds(categoryID, regionID int64) ([]domain.SponsoredAd, error) {
+	parentID := (categoryID / 1000) * 1000
+	ads := make([]domain.SponsoredAd, 0)
+	for _, campaign := range repo.campaigns {
+		if !matchesAny(campaign.Categories, categoryID, parentID) || !matchesAny(campaign.Regions, regionID) {
+			continue
+		}
+		ads = append(ads, domain.SponsoredAd{
+			ListID:       campaign.ListID,
+			Priority:     campaign.Priority,
+			FrequencyCap: campaign.FrequencyCap,
+		})
+	}
+	return ads, nil
+}
+
+// matchesAny tells whether ids is empty or holds any of the values
+func matchesAny(ids []int64, values ...int64) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		for _, value := range values {
+			if id == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// frequencyCapRepository counts the sponsored ads served to each unit on
+// a frequency counter
+type frequencyCapRepository struct {
+	counter FrequencyCounter
+}
+
+// NewFrequencyCapRepository returns a fresh instance of frequencyCapRepository
+func NewFrequencyCapRepository(counter FrequencyCounter) usecases.FrequencyCapRepository {
+	return &frequencyCapRepository{
+		counter: counter,
+	}
+}
+
+// GetServed returns how many times each ad was served to the unit on the
+// counter window
+func (repo *frequencyCapRepository) GetServed(unitID string, listIDs []int64) (map[int64]int, error) {
+	return repo.counter.Counts(unitID, listIDs)
+}
+
+// AddServed counts the ads as served once more to the unit
+func (repo *frequencyCapRepository) AddServed(unitID string, listIDs []int64) error {
+	return repo.counter.Add(unitID, listIDs)
+}
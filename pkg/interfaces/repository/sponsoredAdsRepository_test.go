@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockFrequencyCounter struct {
+	mock.Mock
+}
+
+func (m *mockFrequencyCounter) Counts(key string, ids []int64) (map[int64]int, error) {
+	args := m.Called(key, ids)
+	counts, _ := args.Get(0).(map[int64]int)
+	return counts, args.Error(1)
+}
+
+func (m *mockFrequencyCounter) Add(key string, ids []int64) error {
+	return m.Called(key, ids).Error(0)
+}
+
+func TestSponsoredAdsRepositoryGetSponsoredAds(t *testing.T) {
+	repo := NewSponsoredAdsRepository([]SponsoredCampaign{
+		{ListID: 1, Priority: 1},
+		{ListID: 2, Priority: 5, Categories: []int64{2020}, FrequencyCap: 3},
+		{ListID: 3, Priority: 5, Categories: []int64{2000}, Regions: []int64{13}},
+		{ListID: 4, Priority: 9, Categories: []int64{5000}},
+		{ListID: 5, Priority: 9, Regions: []int64{5}},
+	})
+
+	ads, err := repo.GetSponsoredAds(2020, 13)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.SponsoredAd{
+		{ListID: 3, Priority: 5},
+		{ListID: 2, Priority: 5, FrequencyCap: 3},
+		{ListID: 1, Priority: 1},
+	}, ads)
+
+	ads, err = repo.GetSponsoredAds(2040, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.SponsoredAd{{ListID: 5, Priority: 9}, {ListID: 1, Priority: 1}}, ads)
+}
+
+func TestFrequencyCapRepository(t *testing.T) {
+	counter := &mockFrequencyCounter{}
+	counter.On("Counts", "device", []int64{1, 2}).Return(map[int64]int{1: 2}, nil)
+	counter.On("Add", "device", []int64{1}).Return(nil)
+	repo := NewFrequencyCapRepository(counter)
+
+	served, err := repo.GetServed("device", []int64{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 2}, served)
+	assert.NoError(t, repo.AddServed("device", []int64{1}))
+	counter.AssertExpectations(t)
+}
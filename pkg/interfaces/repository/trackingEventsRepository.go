@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// unknownCarousel labels the events of carousels not served by the service
+const unknownCarousel = "unknown"
+
+// trackingEventsRepository writes tracking events on a sink, counting them
+// by carousel and type so the carousels click through rate can be followed
+type trackingEventsRepository struct {
+	sink      EventsSink
+	counter   MetricsCounter
+	carousels map[string]bool
+}
+
+// trackingEventRecord is the stored representation of a tracking event
+type trackingEventRecord struct {
+	Type          string    `json:"type"`
+	Carousel      string    `json:"carousel"`
+	SourceListID  int64     `json:"sourceListId"`
+	ListID        int64     `json:"listId"`
+	Position      int       `json:"position"`
+	RequestID     string    `json:"requestId"`
+	Time          time.Time `json:"time"`
+	ConfigVersion string    `json:"configVersion,omitempty"`
+	Variant       string    `json:"variant,omitempty"`
+	// Attributed tells the carousel, ads and position come from a verified token
+	Attributed bool `json:"attributed"`
+}
+
+// NewTrackingEventsRepository returns a fresh instance of trackingEventsRepository,
+// counter is optional. Events are counted by the known carousels, the rest
+// are counted as unknown so clients cannot create unbounded metric series
+func NewTrackingEventsRepository(
+	sink EventsSink,
+	counter MetricsCounter,
+	carousels []string,
+) usecases.TrackingEventsRepository {
+	known := make(map[string]bool, len(carousels))
+	for _, carousel := range carousels {
+		known[carousel] = true
+	}
+	return &trackingEventsRepository{
+		sink:      sink,
+		counter:   counter,
+		carousels: known,
+	}
+}
+
+// Save writes the events on the sink, they are counted once the sink accepts them
+func (repo *trackingEventsRepository) Save(events []domain.TrackingEvent) error {
+	records := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		records = append(records, trackingEventRecord{
+			Type:          string(event.Type),
+			Carousel:      event.Carousel,
+			SourceListID:  event.SourceListID,
+			ListID:        event.ListID,
+			Position:      event.Position,
+			RequestID:     event.RequestID,
+			Time:          event.Time,
+			ConfigVersion: event.ConfigVersion,
+			Variant:       event.Variant,
+			Attributed:    event.Attributed,
+		})
+	}
+	if err := repo.sink.Write(records); err != nil {
+		return err
+	}
+	if repo.counter != nil {
+		for _, event := range events {
+			carousel := event.Carousel
+			if !repo.carousels[carousel] {
+				carousel = unknownCarousel
+			}
+			repo.counter.Inc(carousel, string(event.Type))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+func TestTrackingEventsRepositorySave(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	sink := &MockEventsSink{}
+	sink.On("Write", []interface{}{
+		trackingEventRecord{Type: "impression", Carousel: "default", SourceListID: 1, ListID: 2, RequestID: "r", Time: now},
+		trackingEventRecord{
+			Type: "click", Carousel: "default", SourceListID: 1, ListID: 2, RequestID: "r", Time: now,
+			ConfigVersion: "0a1b2c3d", Variant: "b", Attributed: true,
+		},
+	}).Return(nil)
+	counter := &MockMetricsCounter{}
+	counter.On("Inc", []string{"default", "impression"}).Once()
+	counter.On("Inc", []string{"default", "click"}).Once()
+
+	repo := NewTrackingEventsRepository(sink, counter, []string{"default"})
+	err := repo.Save([]domain.TrackingEvent{
+		{Type: domain.ImpressionEvent, Carousel: "default", SourceListID: 1, ListID: 2, RequestID: "r", Time: now},
+		{
+			Type: domain.ClickEvent, Carousel: "default", SourceListID: 1, ListID: 2, RequestID: "r", Time: now,
+			Token: "token", ConfigVersion: "0a1b2c3d", Variant: "b", Attributed: true,
+		},
+	})
+	assert.NoError(t, err)
+	sink.AssertExpectations(t)
+	counter.AssertExpectations(t)
+}
+
+func TestTrackingEventsRepositorySaveError(t *testing.T) {
+	sink := &MockEventsSink{}
+	sink.On("Write", mock.Anything).Return(errors.New("buffer full"))
+	counter := &MockMetricsCounter{}
+
+	repo := NewTrackingEventsRepository(sink, counter, nil)
+	err := repo.Save([]domain.TrackingEvent{{Type: domain.ClickEvent}})
+	assert.EqualError(t, err, "buffer full")
+	counter.AssertNotCalled(t, "Inc", mock.Anything)
+}
+
+func TestTrackingEventsRepositorySaveUnknownCarousel(t *testing.T) {
+	sink := &MockEventsSink{}
+	sink.On("Write", mock.Anything).Return(nil)
+	counter := &MockMetricsCounter{}
+	counter.On("Inc", []string{"unknown", "click"}).Twice()
+
+	repo := NewTrackingEventsRepository(sink, counter, []string{"default"})
+	err := repo.Save([]domain.TrackingEvent{
+		{Type: domain.ClickEvent, Carousel: "made-up"},
+		{Type: domain.ClickEvent},
+	})
+	assert.NoError(t, err)
+	counter.AssertExpectations(t)
+}
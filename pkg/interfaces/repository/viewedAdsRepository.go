@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/usecases"
+)
+
+// viewedAdsRepository keeps the last ads viewed on each device on a store
+type viewedAdsRepository struct {
+	store     ViewedAdsStore
+	maxViewed int
+}
+
+// NewViewedAdsRepository returns a fresh instance of viewedAdsRepository
+// keeping up to maxViewed ads for each device
+func NewViewedAdsRepository(store ViewedAdsStore, maxViewed int) usecases.ViewedAdsRepository {
+	return &viewedAdsRepository{
+		store:     store,
+		maxViewed: maxViewed,
+	}
+}
+
+// GetViewed returns the ads viewed on the device, most recent first
+func (repo *viewedAdsRepository) GetViewed(deviceID string) ([]int64, error) {
+	return repo.store.Get(deviceID)
+}
+
+// AddViewed puts the ads first on the ones viewed on the device, ads
+// viewed again are moved and the oldest ones are dropped past maxViewed
+func (repo *viewedAdsRepository) AddViewed(deviceID string, listIDs []int64) error {
+	current, err := repo.store.Get(deviceID)
+	if err != nil {
+		return err
+	}
+	return repo.store.Set(deviceID, prependUnique(listIDs, current, repo.maxViewed))
+}
+
+// prependUnique returns the ids followed by the current ones without
+// repetitions, keeping up to max of them when max is positive
+func prependUnique(ids, current []int64, max int) []int64 {
+	out := make([]int64, 0, len(ids)+len(current))
+	seen := make(map[int64]bool, len(ids)+len(current))
+	for _, values := range [][]int64{ids, current} {
+		for _, id := range values {
+			if !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+			}
+		}
+	}
+	if max > 0 && len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockViewedAdsStore struct {
+	mock.Mock
+}
+
+func (m *mockViewedAdsStore) Get(key string) ([]int64, error) {
+	args := m.Called(key)
+	listIDs, _ := args.Get(0).([]int64)
+	return listIDs, args.Error(1)
+}
+
+func (m *mockViewedAdsStore) Set(key string, listIDs []int64) error {
+	return m.Called(key, listIDs).Error(0)
+}
+
+func TestViewedAdsRepositoryAddViewed(t *testing.T) {
+	store := &mockViewedAdsStore{}
+	store.On("Get", "device").Return([]int64{3, 2, 1}, nil)
+	store.On("Set", "device", []int64{5, 2, 3, 1}).Return(nil)
+	repo := NewViewedAdsRepository(store, 4)
+
+	assert.NoError(t, repo.AddViewed("device", []int64{5, 2}))
+	store.AssertExpectations(t)
+}
+
+func TestViewedAdsRepositoryAddViewedErr(t *testing.T) {
+	store := &mockViewedAdsStore{}
+	store.On("Get", "device").Return(nil, fmt.Errorf("unavailable"))
+	repo := NewViewedAdsRepository(store, 4)
+
+	assert.Error(t, repo.AddViewed("device", []int64{5}))
+	store.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+}
+
+func TestViewedAdsRepositoryGetViewed(t *testing.T) {
+	store := &mockViewedAdsStore{}
+	store.On("Get", "device").Return([]int64{3, 2}, nil)
+	repo := NewViewedAdsRepository(store, 4)
+
+	viewed, err := repo.GetViewed("device")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, viewed)
+}
@@ -58,8 +58,9 @@ type Location struct {
 	CommuneName string `json:"communeName"`
 }
 
-// UFApiResponse represents the indicators api response
-type UFApiResponse struct {
+// IndicatorsAPIResponse represents the indicators api response, the same
+// format is used for every indicator code
+type IndicatorsAPIResponse struct {
 	Version     string `json:"version"`
 	Author      string `json:"autor"` // nolint: misspell
 	Code        string `json:"codigo"`
@@ -86,4 +87,27 @@ type SuggestionParameters struct {
 	PriceConf   map[string]string
 	QueryConf   map[string]string
 	QueryString []map[string]string
+	// ScoreFunctions are the function_score functions with their weights,
+	// when empty DecayConf is used as the only function
+	ScoreFunctions []map[string]string
+	// ScoreConf holds the function_score scoreMode and boostMode
+	ScoreConf map[string]string
+	// GeoConf holds the geo field, the origin coordinates of the source
+	// ad commune and the optional distance to filter ads
+	GeoConf map[string]string
+	// Cursor is the opaque position of the page to retrieve
+	Cursor string
+	// Ranges are range filters calculated from the source ad numeric
+	// params, each one holds the field and its gte and lte values
+	Ranges []map[string]string
+	// SourceIncludes are the document fields retrieved for each
+	// suggestion, when empty the whole document is retrieved
+	SourceIncludes []string
+	// Likes are the ids of the documents liked along the source ad on
+	// more_like_this queries
+	Likes []string
+	// ExcludedListIDs are ads never suggested
+	ExcludedListIDs []int64
+	// ExcludedUserIDs are sellers whose ads are never suggested
+	ExcludedUserIDs []int64
 }
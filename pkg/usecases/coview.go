@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"math"
+	"strconv"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// coviewCandidates is how many neighbours are requested for each co-view
+// slot, since some of them may not match the carousel constraints
+const coviewCandidates = 3
+
+// coviewShare returns the share of the carousel slots served with co-viewed
+// ads, set on the carousel as "coview": [{"share": "0.5"}]. Share 1 serves
+// only co-viewed ads, content ones filling the slots left
+func (interactor *GetSuggestions) coviewShare(carouselType string) float64 {
+	conf := getValues(interactor.SuggestionsParams, carouselType, "coview")
+	share, err := strconv.ParseFloat(conf["share"], 64)
+	if err != nil || share <= 0 {
+		return 0
+	}
+	return math.Min(share, 1)
+}
+
+// getCoviewAds returns the neighbours of the source ad matching the carousel
+// parameters, up to the carousel co-view slots. Ads without neighbours or
+// errors getting them return no ads, so content suggestions are served
+func (interactor *GetSuggestions) getCoviewAds(
+	sourceAd domain.Ad,
+	parameters SuggestionParameters,
+	size int,
+	share float64,
+) []domain.Ad {
+	slots := coviewSlots(size, share)
+	if slots == 0 || interactor.CoviewRepo == nil {
+		return nil
+	}
+	neighbours, err := interactor.CoviewRepo.GetNeighbours(sourceAd.ListID, slots*coviewCandidates)
+	if err != nil || len(neighbours) == 0 {
+		return nil
+	}
+	listIDs := make([]int64, len(neighbours))
+	for i, neighbour := range neighbours {
+		listIDs[i] = neighbour.ListID
+	}
+	ads, err := interactor.SuggestionsRepo.GetAdsByListIDs(listIDs, parameters)
+	if err != nil {
+		interactor.Logger.ErrorGettingAds(parameters.Musts, parameters.Shoulds, parameters.MustsNot, err)
+		return nil
+	}
+	if len(ads) > slots {
+		ads = ads[:slots]
+	}
+	return ads
+}
+
+// coviewSlots returns how many of the size slots are served with co-viewed ads
+func coviewSlots(size int, share float64) int {
+	return int(math.Floor(float64(size) * share))
+}
+
+// isCoviewSlot tells whether the slot at position is served with a
+// co-viewed ad, they are spread evenly on the page
+func isCoviewSlot(position int, share float64) bool {
+	return math.Floor(float64(position+1)*share) > math.Floor(float64(position)*share)
+}
+
+// blendAds places the co-viewed ads on their slots and the content ones on
+// the rest, each list filling the slots of the other once it runs out.
+// Ads on both lists are shown once
+func blendAds(content, coview []domain.Ad, size int, share float64) []domain.Ad {
+	ads := make([]domain.Ad, 0, size)
+	shown := make(map[int64]bool, size)
+	next := func(from []domain.Ad, position *int) bool {
+		for *position < len(from) {
+			ad := from[*position]
+			*position++
+			if !shown[ad.ListID] {
+				shown[ad.ListID] = true
+				ads = append(ads, ad)
+				return true
+			}
+		}
+		return false
+	}
+	var contentPosition, coviewPosition int
+	for len(ads) < size {
+		var ok bool
+		if isCoviewSlot(len(ads), share) {
+			ok = next(coview, &coviewPosition) || next(content, &contentPosition)
+		} else {
+			ok = next(content, &contentPosition) || next(coview, &coviewPosition)
+		}
+		if !ok {
+			break
+		}
+	}
+	return ads
+}
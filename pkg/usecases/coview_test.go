@@ -0,0 +1,173 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockCoviewRepository struct {
+	mock.Mock
+}
+
+func (m *mockCoviewRepository) GetNeighbours(listID int64, size int) ([]domain.Neighbour, error) {
+	args := m.Called(listID, size)
+	neighbours, _ := args.Get(0).([]domain.Neighbour)
+	return neighbours, args.Error(1)
+}
+
+// listIDsOf returns the list id of each ad
+func listIDsOf(ads []domain.Ad) []int64 {
+	out := make([]int64, len(ads))
+	for i, ad := range ads {
+		out[i] = ad.ListID
+	}
+	return out
+}
+
+func TestBlendAds(t *testing.T) {
+	ads := blendAds(adsOf(1, 2, 3, 4), adsOf(10, 11, 12), 4, 0.5)
+	assert.Equal(t, []int64{1, 10, 2, 11}, listIDsOf(ads))
+
+	// ads on both lists are shown once
+	ads = blendAds(adsOf(1, 2, 3), adsOf(2, 11), 4, 0.5)
+	assert.Equal(t, []int64{1, 2, 3, 11}, listIDsOf(ads))
+
+	ads = blendAds(adsOf(1, 2), adsOf(10), 3, 1)
+	assert.Equal(t, []int64{10, 1, 2}, listIDsOf(ads))
+
+	ads = blendAds(adsOf(1), nil, 3, 0.5)
+	assert.Equal(t, []int64{1}, listIDsOf(ads))
+}
+
+func TestCoviewShare(t *testing.T) {
+	interactor := GetSuggestions{SuggestionsParams: map[string]map[string][]interface{}{
+		"default": {},
+		"half":    {"coview": {map[string]interface{}{"share": "0.5"}}},
+		"more":    {"coview": {map[string]interface{}{"share": "2"}}},
+		"invalid": {"coview": {map[string]interface{}{"share": "half"}}},
+	}}
+	assert.Equal(t, 0.0, interactor.coviewShare("default"))
+	assert.Equal(t, 0.5, interactor.coviewShare("half"))
+	assert.Equal(t, 1.0, interactor.coviewShare("more"))
+	assert.Equal(t, 0.0, interactor.coviewShare("invalid"))
+}
+
+func coviewInteractor(
+	repo AdsRepository, coview CoviewRepository, logger GetSuggestionsLogger, share string,
+) GetSuggestions {
+	return GetSuggestions{
+		SuggestionsRepo: repo,
+		CoviewRepo:      coview,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default": {
+				"must":   {"categoryparent,categoryParent"},
+				"coview": {map[string]interface{}{"share": share}},
+			},
+		},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 4,
+		RequestedAdsQty: 4,
+		Logger:          logger,
+	}
+}
+
+func TestGetSuggestionsCoview(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mCoview := mockCoviewRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mCoview.On("GetNeighbours", int64(1), 6).Return([]domain.Neighbour{{ListID: 10}, {ListID: 11}, {ListID: 12}}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{10, 11, 12}, mock.MatchedBy(func(params SuggestionParameters) bool {
+		return params.Musts["categoryParent"] == "cars"
+	})).Return(adsOf(10, 12), nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 2, 0).Return(adsOf(2, 3), "cursor", nil)
+	interactor := coviewInteractor(&mAdsRepo, &mCoview, &mLogger, "0.5")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "default", Size: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 10, 3, 12}, listIDsOf(result.Ads))
+	assert.Equal(t, encodePageCursor("cursor", 4), result.Cursor)
+	mAdsRepo.AssertExpectations(t)
+	mCoview.AssertExpectations(t)
+}
+
+func TestGetSuggestionsCoviewOnly(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mCoview := mockCoviewRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mCoview.On("GetNeighbours", int64(1), 12).Return([]domain.Neighbour{{ListID: 10}, {ListID: 11}}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{10, 11}, mock.Anything).Return(adsOf(10, 11), nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 2, 0).Return(adsOf(2, 11), "", nil)
+	interactor := coviewInteractor(&mAdsRepo, &mCoview, &mLogger, "1")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "default", Size: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10, 11, 2}, listIDsOf(result.Ads))
+	assert.Empty(t, result.Cursor)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsCoviewNextPage(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mCoview := mockCoviewRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 4, 0).Return(adsOf(2, 3), "", nil)
+	interactor := coviewInteractor(&mAdsRepo, &mCoview, &mLogger, "0.5")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{
+		ListID: "1", CarouselType: "default", Size: 4, Cursor: "cursor"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, listIDsOf(result.Ads))
+	mCoview.AssertNotCalled(t, "GetNeighbours", mock.Anything, mock.Anything)
+}
+
+func TestGetSuggestionsCoviewFullPage(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mCoview := mockCoviewRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mCoview.On("GetNeighbours", int64(1), 12).Return(
+		[]domain.Neighbour{{ListID: 10}, {ListID: 11}, {ListID: 12}, {ListID: 13}}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{10, 11, 12, 13}, mock.Anything).Return(adsOf(10, 11, 12, 13), nil)
+	interactor := coviewInteractor(&mAdsRepo, &mCoview, &mLogger, "1")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "default", Size: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10, 11, 12, 13}, listIDsOf(result.Ads))
+	mAdsRepo.AssertNotCalled(t, "GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// no content ad was shown, the next page starts with the first one
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return params.Cursor == ""
+	}), 4, 0).Return(adsOf(2, 3, 4, 5), "next", nil)
+	result, err = interactor.GetSuggestions(SuggestionsRequest{
+		ListID: "1", CarouselType: "default", Size: 4, From: 4, Cursor: result.Cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 4, 5}, listIDsOf(result.Ads))
+	assert.Equal(t, 4, result.Offset)
+	assert.Equal(t, encodePageCursor("next", 8), result.Cursor)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsCoviewErr(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mCoview := mockCoviewRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mCoview.On("GetNeighbours", int64(1), 6).Return([]domain.Neighbour{{ListID: 10}}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{10}, mock.Anything).Return(nil, fmt.Errorf("timeout"))
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Once()
+	mAdsRepo.On("GetAds", "10", mock.Anything, 4, 0).Return(adsOf(2, 3), "", nil)
+	interactor := coviewInteractor(&mAdsRepo, &mCoview, &mLogger, "0.5")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "default", Size: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, listIDsOf(result.Ads))
+	mLogger.AssertExpectations(t)
+}
@@ -0,0 +1,70 @@
+package usecases
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// ExperimentVariant is a carousel configuration tested on an experiment,
+// its weight is relative to the other variants of the experiment
+type ExperimentVariant struct {
+	Carousel string `json:"carousel"`
+	Weight   int    `json:"weight"`
+}
+
+// Experiments maps the carousels on experiment to their variants, each
+// variant being a carousel of the suggestion params, ex:
+// {"post_adreply_inmo": [{"carousel": "post_adreply_inmo", "weight": 90},
+// {"carousel": "post_adreply_inmo_v2", "weight": 10}]}
+// The first variant is the control, served when there is no unit to assign
+type Experiments map[string][]ExperimentVariant
+
+// Assign returns the variant of the carousel for the user or device
+// unitID, ok is false when the carousel is not on experiment. The same unit
+// always gets the same variant while the experiment weights do not change
+func (e Experiments) Assign(carousel, unitID string) (variant string, ok bool) {
+	variants := e[carousel]
+	if len(variants) == 0 {
+		return "", false
+	}
+	if unitID == "" {
+		return variants[0].Carousel, true
+	}
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return variants[0].Carousel, true
+	}
+	// the carousel is part of the hash so units are not assigned to the
+	// same bucket on every experiment
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(carousel + "/" + unitID))
+	bucket := int(hash.Sum32() % uint32(total))
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v.Carousel, true
+		}
+		bucket -= v.Weight
+	}
+	return variants[len(variants)-1].Carousel, true
+}
+
+// Validate checks every variant is a configured carousel with a positive weight
+func (e Experiments) Validate(suggestionsParams map[string]map[string][]interface{}) error {
+	for carousel, variants := range e {
+		if len(variants) == 0 {
+			return fmt.Errorf("experiment %s has no variants", carousel)
+		}
+		for _, v := range variants {
+			if _, ok := suggestionsParams[v.Carousel]; !ok {
+				return fmt.Errorf("variant %s of experiment %s is not a carousel", v.Carousel, carousel)
+			}
+			if v.Weight <= 0 {
+				return fmt.Errorf("variant %s of experiment %s must have a positive weight", v.Carousel, carousel)
+			}
+		}
+	}
+	return nil
+}
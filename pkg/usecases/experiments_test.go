@@ -0,0 +1,43 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExperimentsAssign(t *testing.T) {
+	experiments := Experiments{"default": {
+		{Carousel: "default", Weight: 3},
+		{Carousel: "default_v2", Weight: 1},
+	}}
+	_, ok := experiments.Assign("pro", "device")
+	assert.False(t, ok)
+
+	variant, ok := experiments.Assign("default", "")
+	assert.True(t, ok)
+	assert.Equal(t, "default", variant)
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		unit := fmt.Sprintf("device-%d", i)
+		variant, _ := experiments.Assign("default", unit)
+		again, _ := experiments.Assign("default", unit)
+		assert.Equal(t, variant, again)
+		counts[variant]++
+	}
+	assert.InDelta(t, 3000, counts["default"], 200)
+	assert.InDelta(t, 1000, counts["default_v2"], 200)
+}
+
+func TestExperimentsValidate(t *testing.T) {
+	params := map[string]map[string][]interface{}{"default": {}, "default_v2": {}}
+	assert.NoError(t, Experiments{"default": {{Carousel: "default", Weight: 1}, {Carousel: "default_v2", Weight: 1}}}.
+		Validate(params))
+	assert.EqualError(t, Experiments{"default": {}}.Validate(params), "experiment default has no variants")
+	assert.EqualError(t, Experiments{"default": {{Carousel: "default_v3", Weight: 1}}}.Validate(params),
+		"variant default_v3 of experiment default is not a carousel")
+	assert.EqualError(t, Experiments{"default": {{Carousel: "default_v2"}}}.Validate(params),
+		"variant default_v2 of experiment default must have a positive weight")
+}
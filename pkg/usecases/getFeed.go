@@ -0,0 +1,162 @@
+package usecases
+
+import (
+	"strconv"
+	"sync"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// FeedLayout is the ordered list of sections shown on the feed
+type FeedLayout struct {
+	Sections []FeedSection `json:"sections"`
+}
+
+// FeedSection is a carousel of the feed and the number of ads it shows
+type FeedSection struct {
+	Carousel string `json:"carousel"`
+	Size     int    `json:"size"`
+}
+
+// GetFeed composes the carousels of the layout on a single feed, each ad is
+// shown only on the first section it appears
+type GetFeed struct {
+	Suggestions *GetSuggestions
+	Layout      FeedLayout
+	Logger      GetFeedLogger
+}
+
+// GetFeedLogger defines the logger methods that will be used for this usecase
+type GetFeedLogger interface {
+	ErrorGettingSection(carousel string, err error)
+	DuplicatedAds(carousel string, duplicated int)
+}
+
+// sectionCandidates are the ads retrieved for a section before removing
+// the ads shown on previous sections
+type sectionCandidates struct {
+	ads []domain.Ad
+	err error
+}
+
+// GetFeed gets the ads of every layout section for the given listID. The
+// source ad is retrieved once and the sections are searched concurrently,
+// then ads already shown on a previous section are removed and replaced
+// with deeper results. Sections that fail or without enough ads are not
+// included, an error is returned when every section fails. Sections with a
+// viewed conf use the viewed ads as the single carousel does, the excluded
+// ads and sellers are never suggested
+func (interactor *GetFeed) GetFeed(request FeedRequest) (result FeedResult, err error) {
+	result.Sections = []FeedSectionResult{}
+	suggestions := interactor.Suggestions
+	sourceAd, err := suggestions.SuggestionsRepo.GetAd(request.ListID)
+	if err != nil {
+		suggestions.Logger.ErrorGettingAd(request.ListID, err)
+		return
+	}
+	sections := interactor.Layout.Sections
+	candidates := interactor.getCandidates(sourceAd, request)
+
+	seen := map[int64]bool{sourceAd.ListID: true}
+	sizes := make([]int, len(sections))
+	var ads []domain.Ad
+	failed := 0
+	for i, section := range sections {
+		if candidates[i].err != nil {
+			err = candidates[i].err
+			failed++
+			continue
+		}
+		sectionAds, duplicated := dedupAds(candidates[i].ads, seen, section.Size)
+		if duplicated > 0 {
+			interactor.Logger.DuplicatedAds(section.Carousel, duplicated)
+		}
+		if len(sectionAds) < suggestions.MinDisplayedAds {
+			suggestions.Logger.NotEnoughAds(request.ListID, len(sectionAds))
+			continue
+		}
+		for _, ad := range sectionAds {
+			seen[ad.ListID] = true
+		}
+		ads = append(ads, sectionAds...)
+		sizes[i] = len(sectionAds)
+	}
+	if failed > 0 && failed == len(sections) {
+		return
+	}
+	err = nil
+	if len(ads) == 0 {
+		return
+	}
+	// contacts and distances of every section are retrieved together
+	ads, errContact := suggestions.getAdsContact(ads, request.OptionalParams)
+	if errContact != nil {
+		suggestions.Logger.ErrorGettingAdsContact(request.ListID, errContact)
+	}
+	ads = suggestions.getAdsDistance(sourceAd, ads, request.OptionalParams)
+	for i, section := range sections {
+		if sizes[i] == 0 {
+			continue
+		}
+		result.Sections = append(result.Sections, FeedSectionResult{
+			Carousel: section.Carousel,
+			Ads:      ads[:sizes[i]:sizes[i]],
+		})
+		ads = ads[sizes[i]:]
+	}
+	return
+}
+
+// getCandidates searches the ads of every section concurrently. Since ads
+// shown on previous sections are removed, each section requests as many
+// extra ads as the previous sections show, to be backfilled from them
+func (interactor *GetFeed) getCandidates(sourceAd domain.Ad, request FeedRequest) []sectionCandidates {
+	suggestions := interactor.Suggestions
+	sections := interactor.Layout.Sections
+	candidates := make([]sectionCandidates, len(sections))
+	adID := strconv.FormatInt(sourceAd.AdID, 10)
+	previous := 0
+	var wg sync.WaitGroup
+	for i, section := range sections {
+		if err := suggestions.checkCarousel(section.Carousel); err != nil {
+			candidates[i].err = err
+			continue
+		}
+		params := suggestions.getCarouselParameters(sourceAd, section.Carousel)
+		params.SourceIncludes = getSourceIncludes(suggestions.SuggestionsParams, section.Carousel, request.OptionalParams)
+		suggestions.setViewedParameters(&params, sourceAd, section.Carousel, request.Viewed)
+		params.exclude(request.Exclusions)
+		size := section.Size + previous
+		previous += section.Size
+		wg.Add(1)
+		go func(i int, params SuggestionParameters, size int) {
+			defer wg.Done()
+			ads, _, err := suggestions.SuggestionsRepo.GetAds(adID, params, size, 0)
+			if err != nil {
+				interactor.Logger.ErrorGettingSection(sections[i].Carousel, err)
+			}
+			candidates[i] = sectionCandidates{ads: ads, err: err}
+		}(i, params, size)
+	}
+	wg.Wait()
+	return candidates
+}
+
+// dedupAds returns up to size ads that are not seen, keeping their order,
+// along with the number of duplicated ads skipped
+func dedupAds(ads []domain.Ad, seen map[int64]bool, size int) (out []domain.Ad, duplicated int) {
+	out = make([]domain.Ad, 0, size)
+	added := make(map[int64]bool, size)
+	for _, ad := range ads {
+		if len(out) == size {
+			break
+		}
+		if seen[ad.ListID] || added[ad.ListID] {
+			duplicated++
+			continue
+		}
+		added[ad.ListID] = true
+		out = append(out, ad)
+	}
+	return
+}
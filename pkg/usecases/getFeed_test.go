@@ -0,0 +1,154 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockGetFeedLogger struct {
+	mock.Mock
+}
+
+func (m *mockGetFeedLogger) ErrorGettingSection(carousel string, err error) {
+	m.Called(carousel, err)
+}
+func (m *mockGetFeedLogger) DuplicatedAds(carousel string, duplicated int) {
+	m.Called(carousel, duplicated)
+}
+
+func feedInteractor(repo AdsRepository, logger GetSuggestionsLogger, feedLogger GetFeedLogger) GetFeed {
+	return GetFeed{
+		Suggestions: &GetSuggestions{
+			SuggestionsRepo: repo,
+			SuggestionsParams: map[string]map[string][]interface{}{
+				"default": {"must": {"categoryparent,categoryParent"}},
+				"pro":     {"filter": {"categoryparent,categoryParent"}},
+				"similar": {"should": {"categoryparent,categoryParent"}},
+			},
+			MinDisplayedAds: 2,
+			Logger:          logger,
+		},
+		Layout: FeedLayout{Sections: []FeedSection{
+			{Carousel: "default", Size: 2},
+			{Carousel: "pro", Size: 2},
+			{Carousel: "similar", Size: 3},
+		}},
+		Logger: feedLogger,
+	}
+}
+
+// carouselParams matches the parameters of the carousel using categoryParent on the given clause
+func carouselParams(clause string) interface{} {
+	return mock.MatchedBy(func(params SuggestionParameters) bool {
+		clauses := map[string]map[string]string{"must": params.Musts, "filter": params.Filters, "should": params.Shoulds}
+		return clauses[clause]["categoryParent"] != ""
+	})
+}
+
+func adsWithIDs(ids ...int64) (ads []domain.Ad) {
+	for _, id := range ids {
+		ads = append(ads, domain.Ad{ListID: id})
+	}
+	return
+}
+
+func TestGetFeedDedupAndBackfill(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mFeedLogger := mockGetFeedLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("GetAds", "10", carouselParams("must"), 2, 0).Return(adsWithIDs(2, 3), "", nil)
+	mAdsRepo.On("GetAds", "10", carouselParams("filter"), 4, 0).Return(adsWithIDs(3, 1, 4, 5), "", nil)
+	mAdsRepo.On("GetAds", "10", carouselParams("should"), 7, 0).Return(adsWithIDs(4, 6, 2, 7, 8, 9, 11), "", nil)
+	mFeedLogger.On("DuplicatedAds", "pro", 2)
+	mFeedLogger.On("DuplicatedAds", "similar", 2)
+	i := feedInteractor(&mAdsRepo, &mLogger, &mFeedLogger)
+
+	output, err := i.GetFeed(FeedRequest{ListID: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, FeedResult{Sections: []FeedSectionResult{
+		{Carousel: "default", Ads: adsWithIDs(2, 3)},
+		{Carousel: "pro", Ads: adsWithIDs(4, 5)},
+		{Carousel: "similar", Ads: adsWithIDs(6, 7, 8)},
+	}}, output)
+	mAdsRepo.AssertExpectations(t)
+	mFeedLogger.AssertExpectations(t)
+}
+
+func TestGetFeedSectionErrors(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mFeedLogger := mockGetFeedLogger{}
+	err := fmt.Errorf("err")
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("GetAds", "10", carouselParams("must"), 2, 0).Return([]domain.Ad(nil), "", err)
+	mAdsRepo.On("GetAds", "10", carouselParams("filter"), 4, 0).Return(adsWithIDs(2), "", nil)
+	mAdsRepo.On("GetAds", "10", carouselParams("should"), 7, 0).Return(adsWithIDs(2, 3), "", nil)
+	mFeedLogger.On("ErrorGettingSection", "default", err)
+	mLogger.On("NotEnoughAds", "1", 1)
+	i := feedInteractor(&mAdsRepo, &mLogger, &mFeedLogger)
+
+	output, errFeed := i.GetFeed(FeedRequest{ListID: "1"})
+	assert.NoError(t, errFeed)
+	assert.Equal(t, FeedResult{Sections: []FeedSectionResult{
+		{Carousel: "similar", Ads: adsWithIDs(2, 3)},
+	}}, output)
+	mFeedLogger.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetFeedAllSectionsFailed(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mFeedLogger := mockGetFeedLogger{}
+	err := fmt.Errorf("err")
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, mock.Anything, 0).Return([]domain.Ad(nil), "", err)
+	mFeedLogger.On("ErrorGettingSection", mock.Anything, err)
+	i := feedInteractor(&mAdsRepo, &mLogger, &mFeedLogger)
+
+	output, errFeed := i.GetFeed(FeedRequest{ListID: "1"})
+	assert.Equal(t, err, errFeed)
+	assert.Empty(t, output.Sections)
+}
+
+func TestGetFeedGetAdErr(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	err := fmt.Errorf("err")
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{}, err)
+	mLogger.On("ErrorGettingAd", "1", err)
+	i := feedInteractor(&mAdsRepo, &mLogger, &mockGetFeedLogger{})
+
+	_, errFeed := i.GetFeed(FeedRequest{ListID: "1"})
+	assert.Equal(t, err, errFeed)
+	mAdsRepo.AssertNotCalled(t, "GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetFeedExclusions(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mFeedLogger := mockGetFeedLogger{}
+	excluded := func(clause string) interface{} {
+		return mock.MatchedBy(func(params SuggestionParameters) bool {
+			clauses := map[string]map[string]string{"must": params.Musts, "filter": params.Filters, "should": params.Shoulds}
+			return clauses[clause]["categoryParent"] != "" &&
+				assert.ObjectsAreEqual([]int64{3}, params.ExcludedListIDs) &&
+				assert.ObjectsAreEqual([]int64{7}, params.ExcludedUserIDs)
+		})
+	}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("GetAds", "10", excluded("must"), 2, 0).Return(adsWithIDs(2, 4), "", nil)
+	mAdsRepo.On("GetAds", "10", excluded("filter"), 4, 0).Return(adsWithIDs(5, 6), "", nil)
+	mAdsRepo.On("GetAds", "10", excluded("should"), 7, 0).Return(adsWithIDs(8, 9), "", nil)
+	i := feedInteractor(&mAdsRepo, &mLogger, &mFeedLogger)
+
+	_, err := i.GetFeed(FeedRequest{ListID: "1", Exclusions: domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}}})
+	assert.NoError(t, err)
+	mAdsRepo.AssertExpectations(t)
+}
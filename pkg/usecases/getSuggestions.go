@@ -1,21 +1,59 @@
 package usecases
 
 import (
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
 )
 
 const (
 	contactField = "phonelink"
-	// ErrGetUF error code when get uf fails
-	ErrGetUF = "ERR_GET_UF_VALUE"
+	// distanceField is the optional param used to request the distance in
+	// kilometers between the source ad and each suggestion
+	distanceField = "distance"
+	// pesoCurrency is the currency every indicator value is expressed in
+	pesoCurrency = "peso"
+	// defaultBaseCurrency is the currency used on price ranges when the
+	// carousel does not configure one
+	defaultBaseCurrency = "uf"
+	// priceModeAbsolute adds and subtracts fixed values to the ad price
+	priceModeAbsolute = "absolute"
+	// priceModePercent adds and subtracts a percentage of the ad price
+	priceModePercent = "percent"
+	// priceModeTiered selects the range from tiers defined by price bucket
+	priceModeTiered = "tiered"
+	// defaultPriceDecay is the score given to ads priced on the range bounds
+	defaultPriceDecay = "0.5"
+	// ErrGetIndicator error code when get an indicator value fails
+	ErrGetIndicator = "ERR_GET_INDICATOR_VALUE"
 	// ErrInvalidCarousel error text when an invalid carousel is requested
 	ErrInvalidCarousel = "invalid carousel: '%s'"
 )
 
+// optionalSourceFields maps the optional params to the document fields
+// they are read from, when those fields are not always retrieved
+var optionalSourceFields = map[string]string{ // nolint: gochecknoglobals
+	"body": "body",
+}
+
+// currencyIndicators maps the supported ad currencies to the indicator
+// used to convert their prices to pesos
+var currencyIndicators = map[string]string{ // nolint: gochecknoglobals
+	"uf":    "uf",
+	"utm":   "utm",
+	"dolar": "dolar",
+	"usd":   "dolar",
+	"euro":  "euro",
+}
+
 // GetSuggestions contains the repositories needed to retrieve ads suggestions
 type GetSuggestions struct {
 	SuggestionsRepo      AdsRepository
@@ -26,6 +64,26 @@ type GetSuggestions struct {
 	SuggestionsParams    map[string]map[string][]interface{}
 	Logger               GetSuggestionsLogger
 	IndicatorsRepository IndicatorsRepository
+	// DefaultRates are the indicator values, by indicator code, used when
+	// the indicators repository cannot provide one, so price ranges are
+	// still converted instead of dropped
+	DefaultRates map[string]float64
+	// CommunesRepo is optional, it enables geo params and ads distance
+	CommunesRepo CommunesRepository
+	// Experiments is optional, it serves carousels on experiment with the
+	// variant assigned to each user or device
+	Experiments Experiments
+	// Interleavings is optional, it serves carousels with the results of two
+	// configurations interleaved. They take precedence over experiments
+	Interleavings Interleavings
+	// CoviewRepo is optional, it serves the ads viewed along the source ad
+	// on carousels with a coview share
+	CoviewRepo CoviewRepository
+	// SponsoredRepo is optional, it places paid ads on the carousels with
+	// sponsored slots
+	SponsoredRepo SponsoredAdsRepository
+	// FrequencyCaps is optional, without it sponsored ads are not capped
+	FrequencyCaps FrequencyCapRepository
 }
 
 // GetSuggestionsLogger defines the logger methods that will be used for this usecase
@@ -33,73 +91,286 @@ type GetSuggestionsLogger interface {
 	LimitExceeded(size, maxDisplayedAds, defaultAdsQty int)
 	MinimumQtyNotEnough(size, minDisplayedAds, defaultAdsQty int)
 	ErrorGettingAd(listID string, err error)
-	ErrorGettingUF(err error)
+	ErrorGettingIndicator(code string, err error)
+	UnsupportedCurrency(listID string, currency string)
 	ErrorGettingAds(musts, shoulds, mustsNot map[string]string, err error)
 	NotEnoughAds(listID string, lenAds int)
 	ErrorGettingAdsContact(listID string, err error)
 	InvalidCarousel(carousel string)
+	ErrorGettingCoordinates(communeID int64, err error)
+	ExperimentVariant(carousel, variant, unitID string)
+	ErrorGettingSponsoredAds(listID string, err error)
+	ErrorCappingSponsoredAds(unitID string, err error)
 }
 
 // GetSuggestions search ad details using listId and returns a slice with ad objects
 // When sourceAd parameter is true, it retrieves an ad using a listID.
 // It translates data from conf y/o ad fields as parameters to search a slice with ad suggestions.
-// When suggestions retrieved on repo are less than MinDisplayedAds value, it returns empty slice.
+// When suggestions retrieved on repo are less than MinDisplayedAds value, it returns empty slice,
+// next pages requested with a cursor are returned even if they are smaller.
+// Carousels on experiment are served with the variant assigned to the request unit,
+// interleaved carousels merge the results of both of their configurations.
+// Carousels with a coview share blend the ads viewed along the source ad on
+// the first page, the content ads filling the rest of it. Carousels with a
+// viewed conf exclude the ads viewed on the session and suggest ads like them.
+// The excluded ads and sellers are never suggested. Carousels with sponsored
+// slots place the paid ads eligible for the source ad on the first page.
 // If something goes wrong returns empty slice and error.
 func (interactor *GetSuggestions) GetSuggestions(
-	listID string, optionalParams []string, size, from int, carouselType string,
-) (ads []domain.Ad, err error) {
-	ads = []domain.Ad{}
-	size = interactor.getSize(size)
-	if _, ok := interactor.SuggestionsParams[carouselType]; !ok {
-		interactor.Logger.InvalidCarousel(carouselType)
-		err = fmt.Errorf(ErrInvalidCarousel, carouselType)
+	request SuggestionsRequest,
+) (result SuggestionsResult, err error) {
+	if configs, ok := interactor.Interleavings[request.CarouselType]; ok {
+		return interactor.getInterleavedSuggestions(request, configs)
+	}
+	result.Ads = []domain.Ad{}
+	size := interactor.getSize(request.Size)
+	carousel, variant := interactor.assignVariant(request.CarouselType, request.UnitID)
+	result.Variant = variant
+	if err = interactor.checkCarousel(carousel); err != nil {
 		return
 	}
-	parameters, adID, err := interactor.getSuggestionParameters(listID, carouselType)
+	parameters, sourceAd, err := interactor.getSuggestionParameters(request.ListID, carousel)
 	if err != nil {
 		return
 	}
+	offset, from := request.From, request.From
+	if request.Cursor != "" {
+		parameters.Cursor, offset = decodePageCursor(request.Cursor)
+		from = 0
+	}
+	parameters.SourceIncludes = getSourceIncludes(
+		interactor.SuggestionsParams, carousel, request.OptionalParams)
+	interactor.setViewedParameters(&parameters, sourceAd, carousel, request.Viewed)
+	parameters.exclude(request.Exclusions)
+
+	// co-viewed and sponsored ads are not paginated, next pages are
+	// content ads only
+	var coviewAds, sponsoredAds []domain.Ad
+	firstPage := request.Cursor == "" && request.From == 0
+	slots := interactor.sponsoredSlots(carousel)
+	if len(slots) > 0 && firstPage {
+		sponsoredAds = interactor.getSponsoredAds(sourceAd, parameters, slots, size, request.UnitID)
+	}
+	organicSize := size - len(sponsoredAds)
+	share := interactor.coviewShare(carousel)
+	if share > 0 && firstPage {
+		coviewAds = interactor.getCoviewAds(sourceAd, parameters, organicSize, share)
+	}
+	ads, cursor := coviewAds, ""
+	// content ads are requested only for their slots, so the cursor
+	// continues after the last one shown
+	contentSize := organicSize - len(coviewAds)
+	if contentSize > 0 {
+		ads, cursor, err = interactor.SuggestionsRepo.GetAds(
+			strconv.FormatInt(sourceAd.AdID, 10),
+			parameters,
+			contentSize,
+			from,
+		)
+		if err != nil {
+			interactor.Logger.ErrorGettingAds(
+				parameters.Musts, parameters.Shoulds, parameters.MustsNot, err)
+			return
+		}
+		if len(coviewAds) > 0 {
+			ads = blendAds(ads, coviewAds, organicSize, share)
+		}
+	}
+	if len(sponsoredAds) > 0 {
+		ads = placeSponsoredAds(ads, sponsoredAds, slots)
+	}
 
-	ads, err = interactor.SuggestionsRepo.GetAds(
-		adID,
-		parameters,
-		size,
-		from,
-	)
-	if err != nil {
-		interactor.Logger.ErrorGettingAds(
-			parameters.Musts, parameters.Shoulds, parameters.MustsNot, err)
+	if request.Cursor == "" && len(ads) < interactor.MinDisplayedAds {
+		interactor.Logger.NotEnoughAds(request.ListID, len(ads))
 		return
 	}
 
-	if len(ads) < interactor.MinDisplayedAds {
-		interactor.Logger.NotEnoughAds(listID, len(ads))
-		return []domain.Ad{}, nil
+	ads, err = interactor.getAdsContact(ads, request.OptionalParams)
+	if err != nil {
+		interactor.Logger.ErrorGettingAdsContact(request.ListID, err)
+	}
+	interactor.addServed(request.UnitID, ads)
+	result.Ads = interactor.getAdsDistance(sourceAd, ads, request.OptionalParams)
+	result.Cursor = encodePageCursor(cursor, offset+len(result.Ads))
+	if contentSize <= 0 && len(result.Ads) > 0 {
+		// the next page starts with the first content ad
+		result.Cursor = encodeFirstContentCursor(offset + len(result.Ads))
+	}
+	result.Offset = offset
+	return result, nil
+}
+
+// assignVariant returns the carousel serving the requested one for the unit
+// and, when it is on experiment, the assigned variant
+func (interactor *GetSuggestions) assignVariant(carouselType, unitID string) (carousel, variant string) {
+	variant, ok := interactor.Experiments.Assign(carouselType, unitID)
+	if !ok {
+		return carouselType, ""
+	}
+	interactor.Logger.ExperimentVariant(carouselType, variant, unitID)
+	return variant, variant
+}
+
+// GetMultiSuggestions gets the suggestions of several carousels for the
+// same ad. The source ad is retrieved once and the searches of every
+// carousel are sent together. Carousels whose search fails or without
+// enough ads are returned empty, an error is returned when all of them fail
+func (interactor *GetSuggestions) GetMultiSuggestions(
+	request MultiSuggestionsRequest,
+) (map[string]SuggestionsResult, error) {
+	size := interactor.getSize(request.Size)
+	carousels := make([]string, 0, len(request.CarouselTypes))
+	// served are the carousels serving each requested one, they differ
+	// from the requested ones on experiments
+	served := make([]string, 0, len(request.CarouselTypes))
+	variants := make([]string, 0, len(request.CarouselTypes))
+	for _, carousel := range request.CarouselTypes {
+		if containsParam(carousels, carousel) {
+			continue
+		}
+		servedCarousel, variant := interactor.assignVariant(carousel, request.UnitID)
+		if err := interactor.checkCarousel(servedCarousel); err != nil {
+			return nil, err
+		}
+		carousels = append(carousels, carousel)
+		served = append(served, servedCarousel)
+		variants = append(variants, variant)
+	}
+	sourceAd, err := interactor.SuggestionsRepo.GetAd(request.ListID)
+	if err != nil {
+		interactor.Logger.ErrorGettingAd(request.ListID, err)
+		return nil, err
+	}
+	queries := make([]AdsQuery, len(carousels))
+	for i, carousel := range served {
+		queries[i].Params = interactor.getCarouselParameters(sourceAd, carousel)
+		queries[i].Params.SourceIncludes = getSourceIncludes(
+			interactor.SuggestionsParams, carousel, request.OptionalParams)
+		queries[i].Params.exclude(request.Exclusions)
+		queries[i].Size = size
+	}
+	results, err := interactor.SuggestionsRepo.MultiGetAds(strconv.FormatInt(sourceAd.AdID, 10), queries)
+	if err != nil {
+		interactor.Logger.ErrorGettingAds(nil, nil, nil, err)
+		return nil, err
+	}
+
+	var suggestions []domain.Ad
+	failed := 0
+	for i := range results {
+		if results[i].Err != nil {
+			params := queries[i].Params
+			interactor.Logger.ErrorGettingAds(params.Musts, params.Shoulds, params.MustsNot, results[i].Err)
+			err = results[i].Err
+			failed++
+			results[i].Ads = nil
+		} else if len(results[i].Ads) < interactor.MinDisplayedAds {
+			interactor.Logger.NotEnoughAds(request.ListID, len(results[i].Ads))
+			results[i].Ads = nil
+		}
+		suggestions = append(suggestions, results[i].Ads...)
+	}
+	if failed > 0 && failed == len(carousels) {
+		return nil, err
+	}
+	// contacts and distances of every carousel are retrieved together
+	if len(suggestions) > 0 {
+		var errContact error
+		if suggestions, errContact = interactor.getAdsContact(suggestions, request.OptionalParams); errContact != nil {
+			interactor.Logger.ErrorGettingAdsContact(request.ListID, errContact)
+		}
+		suggestions = interactor.getAdsDistance(sourceAd, suggestions, request.OptionalParams)
+	}
+	out := make(map[string]SuggestionsResult, len(carousels))
+	for i, carousel := range carousels {
+		count := len(results[i].Ads)
+		result := SuggestionsResult{Ads: []domain.Ad{}}
+		if count > 0 {
+			result = SuggestionsResult{Ads: suggestions[:count:count], Cursor: encodePageCursor(results[i].Cursor, count)}
+			suggestions = suggestions[count:]
+		}
+		result.Variant = variants[i]
+		out[carousel] = result
+	}
+	return out, nil
+}
+
+// checkCarousel returns an invalid input error when the carousel is not configured
+func (interactor *GetSuggestions) checkCarousel(carouselType string) error {
+	if _, ok := interactor.SuggestionsParams[carouselType]; ok {
+		return nil
+	}
+	interactor.Logger.InvalidCarousel(carouselType)
+	return domain.NewError(
+		domain.InvalidInputError,
+		domain.ErrCodeInvalidCarousel,
+		fmt.Sprintf(ErrInvalidCarousel, carouselType),
+		nil,
+	)
+}
+
+// Carousels returns the sorted carousels that can be requested, the
+// configured ones and the ones on experiment or interleaved
+func (interactor *GetSuggestions) Carousels() []string {
+	known := make(map[string]bool)
+	for carousel := range interactor.SuggestionsParams {
+		known[carousel] = true
+	}
+	for carousel := range interactor.Experiments {
+		known[carousel] = true
 	}
+	for carousel := range interactor.Interleavings {
+		known[carousel] = true
+	}
+	carousels := make([]string, 0, len(known))
+	for carousel := range known {
+		carousels = append(carousels, carousel)
+	}
+	sort.Strings(carousels)
+	return carousels
+}
 
-	ads, err = interactor.getAdsContact(ads, optionalParams)
+// ConfigVersion returns a short hash of the carousel configuration, it
+// changes whenever the carousel parameters change. Unknown carousels have
+// an empty version
+func (interactor *GetSuggestions) ConfigVersion(carouselType string) string {
+	params, ok := interactor.SuggestionsParams[carouselType]
+	if !ok {
+		return ""
+	}
+	// maps are encoded with sorted keys, so the encoding is stable
+	encoded, err := json.Marshal(params)
 	if err != nil {
-		interactor.Logger.ErrorGettingAdsContact(listID, err)
+		return ""
 	}
-	return ads, nil
+	sum := sha1.Sum(encoded) // nolint: gosec
+	return hex.EncodeToString(sum[:4])
 }
 
 // getSuggestionParameters creates and retrieves a struct containing all parameters to get ad suggestions
 // if something goes wrong it retrieves and empty struct and error
 func (interactor *GetSuggestions) getSuggestionParameters(
-	listID, carouselType string) (params SuggestionParameters, adID string, err error) {
-	var ad domain.Ad
+	listID, carouselType string) (params SuggestionParameters, ad domain.Ad, err error) {
 	ad, err = interactor.SuggestionsRepo.GetAd(listID)
 	if err != nil {
 		interactor.Logger.ErrorGettingAd(listID, err)
 		return
 	}
-	adID = strconv.FormatInt(ad.AdID, 10)
+	return interactor.getCarouselParameters(ad, carouselType), ad, nil
+}
+
+// getCarouselParameters returns the parameters to get the carousel suggestions for the source ad
+func (interactor *GetSuggestions) getCarouselParameters(
+	ad domain.Ad, carouselType string) (params SuggestionParameters) {
 	adMap := ad.GetFieldsMapString()
 	params.PriceConf = interactor.getPriceRange(ad, interactor.SuggestionsParams[carouselType]["priceRange"])
 
 	params.QueryConf = getValues(interactor.SuggestionsParams, carouselType, "queryConf")
 	params.DecayConf = getValues(interactor.SuggestionsParams, carouselType, "decayFunc")
+	params.ScoreFunctions = getSliceMaps(interactor.SuggestionsParams[carouselType]["scoring"])
+	params.ScoreConf = getValues(interactor.SuggestionsParams, carouselType, "scoreConf")
+	params.GeoConf = interactor.getGeoConf(ad, carouselType)
+	params.Ranges = getParamRanges(ad, getSliceMaps(interactor.SuggestionsParams[carouselType]["range"]))
 	params.QueryString = getQueryStringParams(interactor.SuggestionsParams[carouselType]["queryString"])
 
 	params.Musts = getSliceParams(adMap, interactor.SuggestionsParams[carouselType]["must"])
@@ -125,19 +396,72 @@ func (interactor *GetSuggestions) getAdsContact(
 		}
 	}
 	if len(phones) > 0 {
-		for _, ad := range suggestions {
-			if val, ok := phones[strconv.FormatInt(ad.ListID, 10)]; ok {
-				if ad.AdParams == nil {
-					ad.AdParams = make(map[string]string)
-				}
-				ad.AdParams[contactField] = val
+		for i := range suggestions {
+			if val, ok := phones[strconv.FormatInt(suggestions[i].ListID, 10)]; ok {
+				suggestions[i].SetParam(contactField, domain.NewStringParam(val))
 			}
 		}
 	}
 	return suggestions, err
 }
 
-// getPriceRange returns a map with price range values
+// getGeoConf returns the carousel geo config with the source ad commune
+// coordinates as origin. It returns an empty map when the carousel does not
+// use geo params or the commune coordinates are unknown
+func (interactor *GetSuggestions) getGeoConf(ad domain.Ad, carouselType string) map[string]string {
+	conf := getValues(interactor.SuggestionsParams, carouselType, "geo")
+	if len(conf) == 0 || interactor.CommunesRepo == nil {
+		return make(map[string]string)
+	}
+	origin, err := interactor.CommunesRepo.GetCoordinates(ad.CommuneID)
+	if err != nil {
+		interactor.Logger.ErrorGettingCoordinates(ad.CommuneID, err)
+		return make(map[string]string)
+	}
+	conf["origin"] = origin.String()
+	return conf
+}
+
+// getAdsDistance sets the distance in kilometers between the source ad
+// commune and each suggestion commune when distance param is required
+func (interactor *GetSuggestions) getAdsDistance(
+	sourceAd domain.Ad,
+	suggestions []domain.Ad,
+	optionalParams []string,
+) []domain.Ad {
+	if interactor.CommunesRepo == nil || !containsParam(optionalParams, distanceField) {
+		return suggestions
+	}
+	origin, err := interactor.CommunesRepo.GetCoordinates(sourceAd.CommuneID)
+	if err != nil {
+		interactor.Logger.ErrorGettingCoordinates(sourceAd.CommuneID, err)
+		return suggestions
+	}
+	distances := make(map[int64]string)
+	for i := range suggestions {
+		communeID := suggestions[i].CommuneID
+		distance, ok := distances[communeID]
+		if !ok {
+			// unknown communes are cached as empty distances
+			point, err := interactor.CommunesRepo.GetCoordinates(communeID)
+			if err != nil {
+				interactor.Logger.ErrorGettingCoordinates(communeID, err)
+			} else {
+				distance = strconv.FormatFloat(origin.DistanceTo(point), 'f', 1, 64)
+			}
+			distances[communeID] = distance
+		}
+		if distance != "" {
+			suggestions[i].SetParam(distanceField, domain.NewStringParam(distance))
+		}
+	}
+	return suggestions
+}
+
+// getPriceRange returns a map with price range values. Ranges are expressed
+// in the carousel base currency, ads in any supported currency are converted
+// to it using the indicators repository. Ranges calculated from the ad price
+// may use absolute values, percentages or tiers by price bucket
 func (interactor *GetSuggestions) getPriceRange(
 	ad domain.Ad,
 	priceRangeSlice []interface{},
@@ -147,41 +471,76 @@ func (interactor *GetSuggestions) getPriceRange(
 		return out
 	}
 
-	uf, errUF := interactor.IndicatorsRepository.GetUF()
-	if errUF != nil {
-		interactor.Logger.ErrorGettingUF(errUF)
-	}
-
 	priceRange := priceRangeSlice[0].(map[string]interface{})
-
-	out["uf"] = fmt.Sprintf("%v", uf)
-	if _, ok := priceRange["type"]; !ok {
-		out["type"] = "must"
-	} else {
-		out["type"] = priceRange["type"].(string)
+	baseCurrency := strings.ToLower(getStringValue(priceRange, "currency", defaultBaseCurrency))
+	rates := interactor.getRates(time.Now())
+	if _, ok := rates[baseCurrency]; !ok {
+		interactor.Logger.UnsupportedCurrency(strconv.FormatInt(ad.ListID, 10), baseCurrency)
+		return make(map[string]string)
 	}
 
-	if _, ok := priceRange["calculate"]; ok {
-		adMap := ad.GetFieldsMapString()
-
-		adCurrency := adMap["currency"]
-		adPrice, _ := strconv.ParseFloat(adMap["price"], 64)
-		minusPrice, _ := strconv.Atoi(priceRange["gte"].(string))
-		plusPrice, _ := strconv.Atoi(priceRange["lte"].(string))
+	ratesJSON, _ := json.Marshal(rates)
+	out["rates"] = string(ratesJSON)
+	out["base"] = fmt.Sprintf("%v", rates[baseCurrency])
+	out["type"] = getStringValue(priceRange, "type", "must")
+	mode := getStringValue(priceRange, "mode", priceModeAbsolute)
+
+	var origin float64
+	if _, ok := priceRange["calculate"]; ok || mode != priceModeAbsolute {
+		adRate, ok := rates[strings.ToLower(ad.Currency)]
+		if !ok {
+			interactor.Logger.UnsupportedCurrency(strconv.FormatInt(ad.ListID, 10), ad.Currency)
+			return make(map[string]string)
+		}
+		origin = ad.Price * adRate / rates[baseCurrency]
+		bounds := priceRange
+		if mode == priceModeTiered {
+			if bounds = getPriceTier(origin, priceRange["tiers"]); bounds == nil {
+				return make(map[string]string)
+			}
+			mode = getStringValue(bounds, "mode", priceModeAbsolute)
+		}
+		minusPrice, _ := strconv.ParseFloat(getStringValue(bounds, "gte", "0"), 64)
+		plusPrice, _ := strconv.ParseFloat(getStringValue(bounds, "lte", "0"), 64)
 
-		out["gte"], out["lte"] = calculateMinMaxPriceRange(
-			adPrice,
-			uf,
-			adCurrency,
-			minusPrice,
-			plusPrice,
-		)
+		out["gte"], out["lte"] = calculateMinMaxPriceRange(origin, mode, minusPrice, plusPrice)
 	} else {
-		out["gte"], out["lte"] = priceRange["gte"].(string), priceRange["lte"].(string)
+		out["gte"], out["lte"] = getStringValue(priceRange, "gte", "0"), getStringValue(priceRange, "lte", "0")
+		minPrice, _ := strconv.ParseFloat(out["gte"], 64)
+		maxPrice, _ := strconv.ParseFloat(out["lte"], 64)
+		origin = (minPrice + maxPrice) / 2
 	}
+	out["origin"] = formatPrice(origin)
+	out["decay"] = getStringValue(priceRange, "decay", defaultPriceDecay)
 	return out
 }
 
+// getRates returns the value in pesos of every supported currency for the given date.
+// When an indicator cannot be retrieved the value returned by the repository is used,
+// or the default rate when the repository has none
+func (interactor *GetSuggestions) getRates(date time.Time) map[string]float64 {
+	rates := map[string]float64{pesoCurrency: 1}
+	values := make(map[string]float64)
+	for currency, code := range currencyIndicators {
+		value, ok := values[code]
+		if !ok {
+			var err error
+			value, err = interactor.IndicatorsRepository.GetIndicator(code, date)
+			if err != nil {
+				interactor.Logger.ErrorGettingIndicator(code, err)
+			}
+			if value <= 0 {
+				value = interactor.DefaultRates[code]
+			}
+			values[code] = value
+		}
+		if value > 0 {
+			rates[currency] = value
+		}
+	}
+	return rates
+}
+
 // getSize retrieves default size if input size equals zero, otherwise returns size
 func (interactor *GetSuggestions) getSize(size int) int {
 	if size > interactor.MaxDisplayedAds {
@@ -215,21 +574,85 @@ func getQueryStringParams(queryStringSlice []interface{}) (out []map[string]stri
 
 // calculateMinMaxPriceRange calculates the minimum and maximum
 // price for a range query, where a value is subtracted and added to the price
-// of the ad being requested
+// of the ad being requested. On percent mode the values are percentages of
+// the ad price, so asymmetric ranges can be defined
 func calculateMinMaxPriceRange(
-	adPrice, uf float64,
-	adCurrency string,
-	minusValue, plusValue int,
+	adPrice float64,
+	mode string,
+	minusValue, plusValue float64,
 ) (string, string) {
-	// if ad currency is 'peso', divide price by UF to convert to equivalent
-	// UF value
-	if adCurrency == "peso" {
-		adPrice /= uf
+	if mode == priceModePercent {
+		minusValue = adPrice * minusValue / 100
+		plusValue = adPrice * plusValue / 100
 	}
-	minPrice := adPrice - float64(minusValue)
-	maxPrice := adPrice + float64(plusValue)
+	minPrice := adPrice - minusValue
+	maxPrice := adPrice + plusValue
+
+	return formatPrice(minPrice), formatPrice(maxPrice)
+}
 
-	return fmt.Sprintf("%v", minPrice), fmt.Sprintf("%v", maxPrice)
+// getParamRanges returns range filters around the source ad numeric params.
+// Each range conf defines the param, the field to filter and the gte and lte
+// values to subtract and add, absolute or percentages on percent mode.
+// Params missing on the ad or without a numeric value are ignored
+func getParamRanges(ad domain.Ad, rangesConf []map[string]string) (out []map[string]string) {
+	out = make([]map[string]string, 0)
+	for _, conf := range rangesConf {
+		param, ok := ad.GetParam(conf["param"])
+		if !ok {
+			continue
+		}
+		value, ok := param.Number()
+		if !ok {
+			continue
+		}
+		field := conf["field"]
+		if field == "" {
+			field = "params." + conf["param"] + ".value"
+		}
+		minus, _ := strconv.ParseFloat(conf["gte"], 64)
+		plus, _ := strconv.ParseFloat(conf["lte"], 64)
+		gte, lte := calculateMinMaxPriceRange(value, conf["mode"], minus, plus)
+		out = append(out, map[string]string{"field": field, "gte": gte, "lte": lte})
+	}
+	return
+}
+
+// getPriceTier returns the first tier whose upTo value is greater than or
+// equal to the given price. A tier without upTo matches every price
+func getPriceTier(price float64, tiers interface{}) map[string]interface{} {
+	tiersSlice, _ := tiers.([]interface{})
+	for _, value := range tiersSlice {
+		tier, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		upTo, err := strconv.ParseFloat(getStringValue(tier, "upTo", ""), 64)
+		if err != nil || price <= upTo {
+			return tier
+		}
+	}
+	return nil
+}
+
+// formatPrice formats a price rounded to two decimals
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(math.Round(price*100)/100, 'f', -1, 64)
+}
+
+// getStringValue returns the string value of key in conf or defaultValue
+// when it is not set. Json numbers are formatted, so "gte": 20 and
+// "gte": "20" are the same
+func getStringValue(conf map[string]interface{}, key, defaultValue string) string {
+	switch value := conf[key].(type) {
+	case string:
+		if value != "" {
+			return value
+		}
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return defaultValue
 }
 
 // getSliceParams function that reads the parameters to be used in the queries
@@ -263,6 +686,31 @@ func getSliceParams(adMap map[string]string, suggestionsParams []interface{}) (o
 	return
 }
 
+// getSourceIncludes returns the document fields configured for the
+// carousel, or the default ones. Optional params stored out of the
+// configured fields, as the ad body, are added when requested
+func getSourceIncludes(
+	confValues map[string]map[string][]interface{},
+	carouselType string,
+	optionalParams []string,
+) []string {
+	conf := confValues[carouselType]["source"]
+	if len(conf) == 0 {
+		conf = confValues["default"]["source"]
+	}
+	includes := getSliceString(conf)
+	if len(includes) == 0 {
+		return includes
+	}
+	for _, param := range optionalParams {
+		field, ok := optionalSourceFields[strings.ToLower(param)]
+		if ok && !containsParam(includes, field) {
+			includes = append(includes, field)
+		}
+	}
+	return includes
+}
+
 // getSliceString transforms interface slice to string slice
 func getSliceString(input []interface{}) (output []string) {
 	for _, value := range input {
@@ -273,6 +721,34 @@ func getSliceString(input []interface{}) (output []string) {
 	return
 }
 
+// containsParam returns true when name is one of the optional params
+func containsParam(optionalParams []string, name string) bool {
+	for _, param := range optionalParams {
+		if strings.EqualFold(param, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSliceMaps transforms a slice of config objects to a slice of string maps
+func getSliceMaps(input []interface{}) (output []map[string]string) {
+	for _, value := range input {
+		conf, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		item := make(map[string]string)
+		for key, val := range conf {
+			if val != nil {
+				item[key] = fmt.Sprintf("%v", val)
+			}
+		}
+		output = append(output, item)
+	}
+	return
+}
+
 // getValues returns a map with a config used in a specific carousel
 func getValues(
 	confValues map[string]map[string][]interface{},
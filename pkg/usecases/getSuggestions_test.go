@@ -3,6 +3,7 @@ package usecases
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -31,12 +32,27 @@ func (m *mockGetSuggestionsLogger) NotEnoughAds(listID string, lenAds int) {
 func (m *mockGetSuggestionsLogger) ErrorGettingAdsContact(listID string, err error) {
 	m.Called(listID, err)
 }
-func (m *mockGetSuggestionsLogger) ErrorGettingUF(err error) {
-	m.Called(err)
+func (m *mockGetSuggestionsLogger) ErrorGettingIndicator(code string, err error) {
+	m.Called(code, err)
+}
+func (m *mockGetSuggestionsLogger) UnsupportedCurrency(listID string, currency string) {
+	m.Called(listID, currency)
 }
 func (m *mockGetSuggestionsLogger) InvalidCarousel(carousel string) {
 	m.Called(carousel)
 }
+func (m *mockGetSuggestionsLogger) ErrorGettingCoordinates(communeID int64, err error) {
+	m.Called(communeID, err)
+}
+func (m *mockGetSuggestionsLogger) ExperimentVariant(carousel, variant, unitID string) {
+	m.Called(carousel, variant, unitID)
+}
+func (m *mockGetSuggestionsLogger) ErrorGettingSponsoredAds(listID string, err error) {
+	m.Called(listID, err)
+}
+func (m *mockGetSuggestionsLogger) ErrorCappingSponsoredAds(unitID string, err error) {
+	m.Called(unitID, err)
+}
 
 type mockAdsRepository struct {
 	mock.Mock
@@ -50,9 +66,19 @@ func (m *mockAdsRepository) GetAds(
 	listID string,
 	parameters SuggestionParameters,
 	size, from int,
-) ([]domain.Ad, error) {
+) ([]domain.Ad, string, error) {
 	args := m.Called(listID, parameters, size, from)
-	return args.Get(0).([]domain.Ad), args.Error(1)
+	return args.Get(0).([]domain.Ad), args.String(1), args.Error(2)
+}
+func (m *mockAdsRepository) MultiGetAds(listID string, queries []AdsQuery) ([]AdsQueryResult, error) {
+	args := m.Called(listID, queries)
+	results, _ := args.Get(0).([]AdsQueryResult)
+	return results, args.Error(1)
+}
+func (m *mockAdsRepository) GetAdsByListIDs(listIDs []int64, parameters SuggestionParameters) ([]domain.Ad, error) {
+	args := m.Called(listIDs, parameters)
+	ads, _ := args.Get(0).([]domain.Ad)
+	return ads, args.Error(1)
 }
 
 type mockAdContactRepository struct {
@@ -70,11 +96,20 @@ type mockIndicatorsRepository struct {
 	mock.Mock
 }
 
-func (m *mockIndicatorsRepository) GetUF() (float64, error) {
-	args := m.Called()
+func (m *mockIndicatorsRepository) GetIndicator(code string, date time.Time) (float64, error) {
+	args := m.Called(code, date)
 	return args.Get(0).(float64), args.Error(1)
 }
 
+type mockCommunesRepository struct {
+	mock.Mock
+}
+
+func (m *mockCommunesRepository) GetCoordinates(communeID int64) (domain.GeoPoint, error) {
+	args := m.Called(communeID)
+	return args.Get(0).(domain.GeoPoint), args.Error(1)
+}
+
 func getDefaultSuggestionParams() (out map[string]map[string][]interface{}) {
 	out = make(map[string]map[string][]interface{})
 	out["default"] = make(map[string][]interface{})
@@ -142,8 +177,8 @@ func TestGetSuggestionsOK(t *testing.T) {
 		},
 	}
 	mAdsRepo.On("GetAd", mock.Anything).Return(ad, nil)
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
-	mIndicatorsRepo.On("GetUF").Return(float64(28000), nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
+	mIndicatorsRepo.On("GetIndicator", mock.Anything, mock.Anything).Return(float64(28000), nil)
 	i := GetSuggestions{
 		SuggestionsRepo:      &mAdsRepo,
 		IndicatorsRepository: &mIndicatorsRepo,
@@ -152,9 +187,9 @@ func TestGetSuggestionsOK(t *testing.T) {
 		SuggestionsParams:    getSuggestionParams("default", params),
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mIndicatorsRepo.AssertExpectations(t)
 }
@@ -199,8 +234,8 @@ func TestGetSuggestionsWithParametersOK(t *testing.T) {
 		},
 	}
 	mAdsRepo.On("GetAd", mock.Anything).Return(ad, nil)
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
-	mIndicatorsRepo.On("GetUF").Return(float64(28000), nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
+	mIndicatorsRepo.On("GetIndicator", mock.Anything, mock.Anything).Return(float64(28000), nil)
 	i := GetSuggestions{
 		SuggestionsRepo:      &mAdsRepo,
 		IndicatorsRepository: &mIndicatorsRepo,
@@ -209,9 +244,9 @@ func TestGetSuggestionsWithParametersOK(t *testing.T) {
 		SuggestionsParams:    getSuggestionParams("default", params),
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mIndicatorsRepo.AssertExpectations(t)
 }
@@ -219,7 +254,7 @@ func TestGetSuggestionsMaxDisplayedAds(t *testing.T) {
 	mAdsRepo := mockAdsRepository{}
 	mLogger := mockGetSuggestionsLogger{}
 	ads := []domain.Ad{{ListID: 2, Category: "test"}}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
 	mLogger.On("LimitExceeded", mock.Anything, mock.Anything, mock.Anything)
 	i := GetSuggestions{
 		SuggestionsRepo:   &mAdsRepo,
@@ -230,9 +265,9 @@ func TestGetSuggestionsMaxDisplayedAds(t *testing.T) {
 		SuggestionsParams: getSuggestionParams("default"),
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{}, 2, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default"})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
@@ -241,7 +276,7 @@ func TestGetSuggestionsMinDisplayedAds(t *testing.T) {
 	mAdsRepo := mockAdsRepository{}
 	mLogger := mockGetSuggestionsLogger{}
 	ads := []domain.Ad{{ListID: 2, Category: "test"}, {ListID: 3, Category: "test"}}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
 	mLogger.On("MinimumQtyNotEnough", mock.Anything, mock.Anything, mock.Anything)
 	i := GetSuggestions{
 		SuggestionsRepo:   &mAdsRepo,
@@ -252,9 +287,9 @@ func TestGetSuggestionsMinDisplayedAds(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
@@ -263,7 +298,7 @@ func TestGetSuggestionsNotEnoughAds(t *testing.T) {
 	mAdsRepo := mockAdsRepository{}
 	mLogger := mockGetSuggestionsLogger{}
 	ads := []domain.Ad{{ListID: 2, Category: "test"}}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
 	mLogger.On("NotEnoughAds", mock.Anything, mock.Anything)
 	i := GetSuggestions{
 		SuggestionsRepo:   &mAdsRepo,
@@ -274,10 +309,67 @@ func TestGetSuggestionsNotEnoughAds(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := []domain.Ad{}
-	output, err := i.GetSuggestions("1", []string{}, 2, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, output.Ads)
+	mAdsRepo.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetSuggestionsCursorOK(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	ads := []domain.Ad{{ListID: 2, Category: "test"}}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return params.Cursor == "current"
+	}), 2, 0).Return(ads, "next", nil)
+	i := GetSuggestions{
+		SuggestionsRepo: &mAdsRepo,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default": {"must": {"categoryparent,categoryParent"}},
+		},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 2,
+		RequestedAdsQty: 2,
+	}
+	// the second page follows the two ads of the first one
+	expected := SuggestionsResult{Ads: ads, Cursor: encodePageCursor("next", 3), Offset: 2}
+	output, err := i.GetSuggestions(SuggestionsRequest{
+		ListID:       "1",
+		Size:         2,
+		CarouselType: "default",
+		Cursor:       encodePageCursor("current", 2),
+	})
 	assert.NoError(t, err)
 	assert.Equal(t, expected, output)
 	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsExperiment(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	ads := []domain.Ad{{ListID: 2}, {ListID: 3}}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return params.Filters["categoryParent"] == "cars"
+	}), 2, 0).Return(ads, "", nil)
+	mLogger.On("ExperimentVariant", "default", "default_v2", "device")
+	i := GetSuggestions{
+		SuggestionsRepo: &mAdsRepo,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default":    {"must": {"categoryparent,categoryParent"}},
+			"default_v2": {"filter": {"categoryparent,categoryParent"}},
+		},
+		Experiments:     Experiments{"default": {{Carousel: "default_v2", Weight: 1}}},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 2,
+		RequestedAdsQty: 2,
+		Logger:          &mLogger,
+	}
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default", UnitID: "device"})
+	assert.NoError(t, err)
+	assert.Equal(t, SuggestionsResult{Ads: ads, Variant: "default_v2"}, output)
+	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
 
@@ -301,9 +393,9 @@ func TestGetSuggestionsGetAdErr(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := []domain.Ad{}
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.Error(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
@@ -311,7 +403,7 @@ func TestGetSuggestionsGetAdErr(t *testing.T) {
 func TestGetSuggestionsGetAdsErr(t *testing.T) {
 	mAdsRepo := mockAdsRepository{}
 	mLogger := mockGetSuggestionsLogger{}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]domain.Ad{}, fmt.Errorf(""))
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]domain.Ad{}, "", fmt.Errorf(""))
 	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	i := GetSuggestions{
 		SuggestionsRepo:   &mAdsRepo,
@@ -322,9 +414,9 @@ func TestGetSuggestionsGetAdsErr(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := []domain.Ad{}
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.Error(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
@@ -334,7 +426,7 @@ func TestGetSuggestionsOKWithPhoneLink(t *testing.T) {
 	mAdContactRepo := mockAdContactRepository{}
 	ads := []domain.Ad{{ListID: 2, Category: "test"}}
 	phones := map[string]string{"2": "998765432"}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
 	mAdContactRepo.On("GetAdsPhone", mock.Anything).Return(phones, nil)
 	i := GetSuggestions{
 		SuggestionsRepo:   &mAdsRepo,
@@ -344,9 +436,14 @@ func TestGetSuggestionsOKWithPhoneLink(t *testing.T) {
 		MaxDisplayedAds:   2,
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{"phonelink"}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{
+		ListID:         "1",
+		OptionalParams: []string{"phonelink"},
+		Size:           1,
+		CarouselType:   "default",
+	})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mAdContactRepo.AssertExpectations(t)
 }
@@ -357,7 +454,7 @@ func TestGetSuggestionsWithPhoneLinkErr(t *testing.T) {
 	mLogger := mockGetSuggestionsLogger{}
 	ads := []domain.Ad{{ListID: 2, Category: "test"}}
 	phones := map[string]string{"2": "998765432"}
-	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, nil)
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(ads, "", nil)
 	mAdContactRepo.On("GetAdsPhone", mock.Anything).Return(phones, fmt.Errorf("error"))
 	mLogger.On("ErrorGettingAdsContact", mock.Anything, mock.Anything)
 	i := GetSuggestions{
@@ -369,9 +466,14 @@ func TestGetSuggestionsWithPhoneLinkErr(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := ads
-	output, err := i.GetSuggestions("1", []string{"phonelink"}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{
+		ListID:         "1",
+		OptionalParams: []string{"phonelink"},
+		Size:           1,
+		CarouselType:   "default",
+	})
 	assert.NoError(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mAdContactRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
@@ -390,14 +492,16 @@ func TestGetSuggestionsGetAdsInvalidCarousel(t *testing.T) {
 		Logger:            &mLogger,
 	}
 	expected := []domain.Ad{}
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "not_a_carousel")
-	assert.Error(t, err)
-	assert.Equal(t, expected, output)
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "not_a_carousel"})
+	assert.EqualError(t, err, "invalid carousel: 'not_a_carousel'")
+	assert.Equal(t, domain.InvalidInputError, domain.ErrorKindOf(err))
+	assert.Equal(t, domain.ErrCodeInvalidCarousel, domain.ErrorCodeOf(err))
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
 }
 
-func TestGetSuggestionsGetAdsErrUF(t *testing.T) {
+func TestGetSuggestionsGetAdsErrIndicator(t *testing.T) {
 	mAdsRepo := mockAdsRepository{}
 	mIndicatorsRepo := mockIndicatorsRepository{}
 	mLogger := mockGetSuggestionsLogger{}
@@ -416,8 +520,12 @@ func TestGetSuggestionsGetAdsErrUF(t *testing.T) {
 		},
 	}
 	mAdsRepo.On("GetAd", mock.Anything).Return(ad, nil)
-	mIndicatorsRepo.On("GetUF").Return(float64(0), fmt.Errorf("error"))
-	mLogger.On("ErrorGettingUF", mock.Anything)
+	mIndicatorsRepo.On("GetIndicator", mock.Anything, mock.Anything).Return(float64(0), fmt.Errorf("error"))
+	mLogger.On("ErrorGettingIndicator", mock.Anything, mock.Anything)
+	mLogger.On("UnsupportedCurrency", "1", "uf")
+	mAdsRepo.On("GetAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]domain.Ad{}, "", fmt.Errorf("error"))
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	i := GetSuggestions{
 		SuggestionsRepo:      &mAdsRepo,
 		IndicatorsRepository: &mIndicatorsRepo,
@@ -428,9 +536,9 @@ func TestGetSuggestionsGetAdsErrUF(t *testing.T) {
 		Logger:               &mLogger,
 	}
 	expected := []domain.Ad{}
-	output, err := i.GetSuggestions("1", []string{}, 1, 0, "default")
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 1, CarouselType: "default"})
 	assert.Error(t, err)
-	assert.Equal(t, expected, output)
+	assert.Equal(t, expected, output.Ads)
 	mAdsRepo.AssertExpectations(t)
 	mIndicatorsRepo.AssertExpectations(t)
 	mLogger.AssertExpectations(t)
@@ -442,8 +550,12 @@ func TestGetPriceRangeOK(t *testing.T) {
 		Currency: "uf",
 	}
 	mIndicatorsRepo := mockIndicatorsRepository{}
-	mIndicatorsRepo.On("GetUF").Return(float64(10), nil)
+	mIndicatorsRepo.On("GetIndicator", "uf", mock.Anything).Return(float64(10), nil)
+	mIndicatorsRepo.On("GetIndicator", "dolar", mock.Anything).Return(float64(2), nil)
+	mIndicatorsRepo.On("GetIndicator", "utm", mock.Anything).Return(float64(50), nil)
+	mIndicatorsRepo.On("GetIndicator", "euro", mock.Anything).Return(float64(4), nil)
 	i := GetSuggestions{IndicatorsRepository: &mIndicatorsRepo}
+	rates := `{"dolar":2,"euro":4,"peso":1,"uf":10,"usd":2,"utm":50}`
 	testCases := []struct {
 		name       string
 		priceRange []interface{}
@@ -452,17 +564,88 @@ func TestGetPriceRangeOK(t *testing.T) {
 		{
 			"gte and lte only",
 			[]interface{}{map[string]interface{}{"gte": "1000", "lte": "2000"}},
-			map[string]string{"gte": "1000", "lte": "2000", "type": "must", "uf": "10"},
+			map[string]string{"gte": "1000", "lte": "2000", "type": "must", "rates": rates, "base": "10",
+				"origin": "1500", "decay": "0.5"},
 		},
 		{
 			"calculate price",
 			[]interface{}{map[string]interface{}{"gte": "10", "lte": "20", "calculate": "true"}},
-			map[string]string{"gte": "0", "lte": "30", "type": "must", "uf": "10"},
+			map[string]string{"gte": "990", "lte": "1020", "type": "must", "rates": rates, "base": "10",
+				"origin": "1000", "decay": "0.5"},
+		},
+		{
+			"calculate price in dolar",
+			[]interface{}{map[string]interface{}{"gte": "10", "lte": "20", "calculate": "true", "currency": "dolar"}},
+			map[string]string{"gte": "4990", "lte": "5020", "type": "must", "rates": rates, "base": "2",
+				"origin": "5000", "decay": "0.5"},
 		},
 		{
 			"should type",
 			[]interface{}{map[string]interface{}{"gte": "1000", "lte": "2000", "type": "should"}},
-			map[string]string{"gte": "1000", "lte": "2000", "type": "should", "uf": "10"},
+			map[string]string{"gte": "1000", "lte": "2000", "type": "should", "rates": rates, "base": "10",
+				"origin": "1500", "decay": "0.5"},
+		},
+		{
+			"asymmetric percent",
+			[]interface{}{map[string]interface{}{"gte": "10", "lte": "25", "mode": "percent"}},
+			map[string]string{"gte": "900", "lte": "1250", "type": "must", "rates": rates, "base": "10",
+				"origin": "1000", "decay": "0.5"},
+		},
+		{
+			"tiered",
+			[]interface{}{map[string]interface{}{
+				"mode": "tiered",
+				"tiers": []interface{}{
+					map[string]interface{}{"upTo": "500", "gte": "100", "lte": "100"},
+					map[string]interface{}{"upTo": "5000", "gte": "20", "lte": "20", "mode": "percent"},
+					map[string]interface{}{"gte": "10", "lte": "10", "mode": "percent"},
+				},
+			}},
+			map[string]string{"gte": "800", "lte": "1200", "type": "must", "rates": rates, "base": "10",
+				"origin": "1000", "decay": "0.5"},
+		},
+		{
+			"gte and lte numbers",
+			[]interface{}{map[string]interface{}{"gte": float64(1000), "lte": 2500.5}},
+			map[string]string{"gte": "1000", "lte": "2500.5", "type": "must", "rates": rates, "base": "10",
+				"origin": "1750.25", "decay": "0.5"},
+		},
+		{
+			"tiered with numbers",
+			[]interface{}{map[string]interface{}{
+				"mode": "tiered",
+				"tiers": []interface{}{
+					map[string]interface{}{"upTo": float64(500), "gte": float64(100), "lte": float64(100)},
+					map[string]interface{}{"gte": float64(20), "lte": 12.5, "mode": "percent"},
+				},
+				"decay": 0.3,
+			}},
+			map[string]string{"gte": "800", "lte": "1125", "type": "must", "rates": rates, "base": "10",
+				"origin": "1000", "decay": "0.3"},
+		},
+		{
+			"tiered without matching tier",
+			[]interface{}{map[string]interface{}{
+				"mode":  "tiered",
+				"tiers": []interface{}{map[string]interface{}{"upTo": "500", "gte": "100", "lte": "100"}},
+			}},
+			map[string]string{},
+		},
+		{
+			"percent decay",
+			[]interface{}{map[string]interface{}{"gte": "10", "lte": "20", "mode": "percent", "type": "decay"}},
+			map[string]string{
+				"gte": "900", "lte": "1200", "type": "decay", "rates": rates, "base": "10",
+				"origin": "1000", "decay": "0.5",
+			},
+		},
+		{
+			"fixed range decay",
+			[]interface{}{map[string]interface{}{"gte": "1000", "lte": "2000", "type": "decay", "decay": "0.3"}},
+			map[string]string{
+				"gte": "1000", "lte": "2000", "type": "decay", "rates": rates, "base": "10",
+				"origin": "1500", "decay": "0.3",
+			},
 		},
 	}
 
@@ -476,42 +659,83 @@ func TestGetPriceRangeOK(t *testing.T) {
 	}
 }
 
+func TestGetPriceRangeIndicatorError(t *testing.T) {
+	ad := domain.Ad{ListID: 1, Price: 1000, Currency: "uf"}
+	mIndicatorsRepo := mockIndicatorsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mIndicatorsRepo.On("GetIndicator", mock.Anything, mock.Anything).Return(float64(0), fmt.Errorf("error"))
+	mLogger.On("ErrorGettingIndicator", mock.Anything, mock.Anything)
+	i := GetSuggestions{
+		IndicatorsRepository: &mIndicatorsRepo,
+		Logger:               &mLogger,
+		DefaultRates:         map[string]float64{"uf": 30000},
+	}
+	priceRange := []interface{}{map[string]interface{}{"gte": "10", "lte": "20", "calculate": "true"}}
+	// the default uf rate keeps the price range instead of dropping it
+	output := i.getPriceRange(ad, priceRange)
+	assert.Equal(t, map[string]string{"gte": "990", "lte": "1020", "type": "must",
+		"rates": `{"peso":1,"uf":30000}`, "base": "30000", "origin": "1000", "decay": "0.5"}, output)
+	mLogger.AssertNotCalled(t, "UnsupportedCurrency", mock.Anything, mock.Anything)
+}
+
+func TestGetPriceRangeUnsupportedCurrency(t *testing.T) {
+	ad := domain.Ad{
+		ListID:   1,
+		Price:    1000,
+		Currency: "yen",
+	}
+	mIndicatorsRepo := mockIndicatorsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mIndicatorsRepo.On("GetIndicator", mock.Anything, mock.Anything).Return(float64(10), nil)
+	mLogger.On("UnsupportedCurrency", "1", "yen")
+	i := GetSuggestions{IndicatorsRepository: &mIndicatorsRepo, Logger: &mLogger}
+	priceRange := []interface{}{map[string]interface{}{"gte": "10", "lte": "20", "calculate": "true"}}
+	output := i.getPriceRange(ad, priceRange)
+	assert.Equal(t, map[string]string{}, output)
+	mIndicatorsRepo.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
 func TestCalculateMinMaxPriceRange(t *testing.T) {
 	testCases := []struct {
 		name                     string
-		adPrice, uf              float64
-		adCurrency               string
-		minusValue, plusValue    int
+		adPrice                  float64
+		mode                     string
+		minusValue, plusValue    float64
 		expectedMin, expectedMax string
 	}{
 		{
-			"integer peso currency",
-			1000, 10, "peso", 10, 10, "90", "110",
+			"integer absolute",
+			1000, "absolute", 10, 10, "990", "1010",
 		},
 		{
-			"float peso currency",
-			1055, 10.55, "peso", 10, 10, "90", "110",
+			"float absolute",
+			8000.5, "absolute", 1000, 1000, "7000.5", "9000.5",
 		},
 		{
-			"integer uf currency",
-			1000, 10, "uf", 10, 10, "0", "20",
+			"negative min value absolute",
+			800, "absolute", 1000, 1000, "-200", "1800",
 		},
 		{
-			"float uf currency",
-			800000, 10, "uf", 1000, 1000, "7000", "9000",
+			"symmetric percent",
+			2000, "percent", 20, 20, "1600", "2400",
 		},
 		{
-			"negative min value uf",
-			80000, 10, "uf", 1000, 1000, "-200", "1800",
+			"asymmetric percent",
+			40000, "percent", 10, 25, "36000", "50000",
+		},
+		{
+			"percent rounded to two decimals",
+			33.333, "percent", 10, 10, "30", "36.67",
 		},
 	}
 
 	for _, testCase := range testCases {
 		tc := testCase
 		t.Run(tc.name, func(t *testing.T) {
-			min, max := calculateMinMaxPriceRange(tc.adPrice, tc.uf, tc.adCurrency, tc.minusValue, tc.plusValue)
-			assert.Equal(t, min, tc.expectedMin)
-			assert.Equal(t, max, tc.expectedMax)
+			min, max := calculateMinMaxPriceRange(tc.adPrice, tc.mode, tc.minusValue, tc.plusValue)
+			assert.Equal(t, tc.expectedMin, min)
+			assert.Equal(t, tc.expectedMax, max)
 		})
 	}
 }
@@ -677,3 +901,274 @@ func TestGetQueryStringParams(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSliceMaps(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"type": "gauss", "field": "listTime", "weight": 2.5, "empty": nil},
+		"invalid",
+	}
+	expected := []map[string]string{{"type": "gauss", "field": "listTime", "weight": "2.5"}}
+	assert.Equal(t, expected, getSliceMaps(input))
+}
+
+func TestGetGeoConfOK(t *testing.T) {
+	mCommunesRepo := mockCommunesRepository{}
+	mCommunesRepo.On("GetCoordinates", int64(295)).Return(domain.GeoPoint{Lat: -33.45, Lon: -70.66}, nil)
+	params := map[string][]interface{}{
+		"geo": {map[string]interface{}{"field": "location.geo", "distance": "25km"}},
+	}
+	i := GetSuggestions{
+		SuggestionsParams: getSuggestionParams("geo", params),
+		CommunesRepo:      &mCommunesRepo,
+	}
+	output := i.getGeoConf(domain.Ad{CommuneID: 295}, "geo")
+	expected := map[string]string{"field": "location.geo", "distance": "25km", "origin": "-33.45,-70.66"}
+	assert.Equal(t, expected, output)
+	mCommunesRepo.AssertExpectations(t)
+}
+
+func TestGetGeoConfUnknownCommune(t *testing.T) {
+	mCommunesRepo := mockCommunesRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mCommunesRepo.On("GetCoordinates", int64(1)).Return(domain.GeoPoint{}, fmt.Errorf("not found"))
+	mLogger.On("ErrorGettingCoordinates", int64(1), mock.Anything)
+	params := map[string][]interface{}{
+		"geo": {map[string]interface{}{"distance": "25km"}},
+	}
+	i := GetSuggestions{
+		SuggestionsParams: getSuggestionParams("geo", params),
+		CommunesRepo:      &mCommunesRepo,
+		Logger:            &mLogger,
+	}
+	output := i.getGeoConf(domain.Ad{CommuneID: 1}, "geo")
+	assert.Equal(t, map[string]string{}, output)
+	mCommunesRepo.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetAdsDistance(t *testing.T) {
+	mCommunesRepo := mockCommunesRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mCommunesRepo.On("GetCoordinates", int64(1)).Return(domain.GeoPoint{Lat: -33.4489, Lon: -70.6693}, nil)
+	mCommunesRepo.On("GetCoordinates", int64(2)).Return(domain.GeoPoint{Lat: -33.0472, Lon: -71.6127}, nil).Once()
+	mCommunesRepo.On("GetCoordinates", int64(3)).Return(domain.GeoPoint{}, fmt.Errorf("not found")).Once()
+	mLogger.On("ErrorGettingCoordinates", int64(3), mock.Anything).Once()
+	i := GetSuggestions{CommunesRepo: &mCommunesRepo, Logger: &mLogger}
+	suggestions := []domain.Ad{
+		{ListID: 2, CommuneID: 2},
+		{ListID: 3, CommuneID: 2, AdParams: map[string]domain.AdParam{"rooms": domain.NewIntParam(2)}},
+		{ListID: 4, CommuneID: 3},
+		{ListID: 5, CommuneID: 3},
+	}
+	output := i.getAdsDistance(domain.Ad{CommuneID: 1}, suggestions, []string{"Distance"})
+	expected := []domain.Ad{
+		{ListID: 2, CommuneID: 2, AdParams: map[string]domain.AdParam{"distance": domain.NewStringParam("98.4")}},
+		{ListID: 3, CommuneID: 2, AdParams: map[string]domain.AdParam{
+			"rooms":    domain.NewIntParam(2),
+			"distance": domain.NewStringParam("98.4"),
+		}},
+		{ListID: 4, CommuneID: 3},
+		{ListID: 5, CommuneID: 3},
+	}
+	assert.Equal(t, expected, output)
+	mCommunesRepo.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetAdsDistanceNotRequired(t *testing.T) {
+	mCommunesRepo := mockCommunesRepository{}
+	i := GetSuggestions{CommunesRepo: &mCommunesRepo}
+	suggestions := []domain.Ad{{ListID: 2, CommuneID: 2}}
+	output := i.getAdsDistance(domain.Ad{CommuneID: 1}, suggestions, []string{"phonelink"})
+	assert.Equal(t, suggestions, output)
+	mCommunesRepo.AssertExpectations(t)
+}
+
+func TestGetParamRanges(t *testing.T) {
+	ad := domain.Ad{AdParams: map[string]domain.AdParam{
+		"rooms":   domain.NewIntParam(3),
+		"size":    domain.NewFloatParam(100),
+		"brand":   domain.NewStringParam("TOYOTA"),
+		"mileage": domain.NewLabelParam("1000", "1.000 km"),
+	}}
+	conf := []map[string]string{
+		{"param": "rooms", "gte": "1", "lte": "1"},
+		{"param": "size", "field": "params.size.number", "mode": "percent", "gte": "10", "lte": "20"},
+		{"param": "Mileage", "gte": "500", "lte": "0"},
+		{"param": "brand", "gte": "1", "lte": "1"},
+		{"param": "regdate", "gte": "1", "lte": "1"},
+	}
+	expected := []map[string]string{
+		{"field": "params.rooms.value", "gte": "2", "lte": "4"},
+		{"field": "params.size.number", "gte": "90", "lte": "120"},
+		{"field": "params.Mileage.value", "gte": "500", "lte": "1000"},
+	}
+	assert.Equal(t, expected, getParamRanges(ad, conf))
+}
+
+func TestGetSourceIncludes(t *testing.T) {
+	conf := map[string]map[string][]interface{}{
+		"default": {"source": {"listId", "subject"}},
+		"pro":     {"source": {"listId", "price"}},
+		"all":     {},
+	}
+	assert.Equal(t, []string{"listId", "subject", "body"},
+		getSourceIncludes(conf, "default", []string{"Body"}))
+	assert.Equal(t, []string{"listId", "price"}, getSourceIncludes(conf, "pro", []string{"phone"}))
+	assert.Equal(t, []string{"listId", "subject"}, getSourceIncludes(conf, "unknown", nil))
+	assert.Empty(t, getSourceIncludes(map[string]map[string][]interface{}{}, "default", []string{"body"}))
+}
+
+func multiSuggestionsInteractor(repo AdsRepository, logger GetSuggestionsLogger) GetSuggestions {
+	return GetSuggestions{
+		SuggestionsRepo: repo,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default": {"must": {"categoryparent,categoryParent"}},
+			"pro":     {"must": {"categoryparent,categoryParent"}, "source": {"listId"}},
+			"similar": {"filter": {"categoryparent,categoryParent"}},
+		},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 2,
+		RequestedAdsQty: 2,
+		Logger:          logger,
+	}
+}
+
+func TestGetMultiSuggestionsOK(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	defaultAds := []domain.Ad{{ListID: 2}, {ListID: 3}}
+	proAds := []domain.Ad{{ListID: 4}, {ListID: 5}}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil).Once()
+	mAdsRepo.On("MultiGetAds", "10", mock.MatchedBy(func(queries []AdsQuery) bool {
+		return len(queries) == 3 &&
+			queries[0].Params.Musts["categoryParent"] == "cars" && queries[0].Size == 2 &&
+			assert.ObjectsAreEqual([]string{"listId"}, queries[1].Params.SourceIncludes) &&
+			queries[2].Params.Filters["categoryParent"] == "cars"
+	})).Return([]AdsQueryResult{
+		{Ads: defaultAds, Cursor: "next"},
+		{Ads: proAds},
+		{Ads: []domain.Ad{{ListID: 6}}, Cursor: "ignored"},
+	}, nil)
+	mLogger.On("NotEnoughAds", "1", 1)
+	i := multiSuggestionsInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          2,
+		CarouselTypes: []string{"default", "pro", "similar", "default"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]SuggestionsResult{
+		"default": {Ads: defaultAds, Cursor: encodePageCursor("next", 2)},
+		"pro":     {Ads: proAds},
+		"similar": {Ads: []domain.Ad{}},
+	}, output)
+	mAdsRepo.AssertExpectations(t)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsExperiment(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	defaultAds := []domain.Ad{{ListID: 2}, {ListID: 3}}
+	proAds := []domain.Ad{{ListID: 4}, {ListID: 5}}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.MatchedBy(func(queries []AdsQuery) bool {
+		return len(queries) == 2 &&
+			queries[0].Params.Filters["categoryParent"] == "cars" &&
+			queries[1].Params.Musts["categoryParent"] == "cars"
+	})).Return([]AdsQueryResult{{Ads: defaultAds}, {Ads: proAds}}, nil)
+	mLogger.On("ExperimentVariant", "default", "similar", "device")
+	i := multiSuggestionsInteractor(&mAdsRepo, &mLogger)
+	i.Experiments = Experiments{"default": {{Carousel: "similar", Weight: 1}}}
+	output, err := i.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          2,
+		CarouselTypes: []string{"default", "pro"},
+		UnitID:        "device",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]SuggestionsResult{
+		"default": {Ads: defaultAds, Variant: "similar"},
+		"pro":     {Ads: proAds},
+	}, output)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsPartialError(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	ads := []domain.Ad{{ListID: 2}, {ListID: 3}}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.Anything).Return([]AdsQueryResult{
+		{Err: fmt.Errorf("err")},
+		{Ads: ads},
+	}, nil)
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, fmt.Errorf("err"))
+	i := multiSuggestionsInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          2,
+		CarouselTypes: []string{"default", "pro"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]SuggestionsResult{
+		"default": {Ads: []domain.Ad{}},
+		"pro":     {Ads: ads},
+	}, output)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsAllFailed(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.Anything).Return([]AdsQueryResult{
+		{Err: fmt.Errorf("err")},
+	}, nil)
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, fmt.Errorf("err"))
+	i := multiSuggestionsInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          2,
+		CarouselTypes: []string{"default"},
+	})
+	assert.EqualError(t, err, "err")
+	assert.Nil(t, output)
+}
+
+func TestGetMultiSuggestionsInvalidCarousel(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mLogger.On("InvalidCarousel", "unknown")
+	i := multiSuggestionsInteractor(&mAdsRepo, &mLogger)
+	_, err := i.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID:        "1",
+		Size:          2,
+		CarouselTypes: []string{"default", "unknown"},
+	})
+	assert.Equal(t, domain.ErrCodeInvalidCarousel, domain.ErrorCodeOf(err))
+	mAdsRepo.AssertNotCalled(t, "GetAd", mock.Anything)
+}
+
+func TestCarousels(t *testing.T) {
+	interactor := GetSuggestions{
+		SuggestionsParams: map[string]map[string][]interface{}{"default": {}, "pro": {}, "pro_v2": {}},
+		Experiments:       Experiments{"pro": {{Carousel: "pro", Weight: 1}}, "cars": {{Carousel: "pro_v2", Weight: 1}}},
+		Interleavings:     Interleavings{"mixed": {"default", "pro"}},
+	}
+	assert.Equal(t, []string{"cars", "default", "mixed", "pro", "pro_v2"}, interactor.Carousels())
+}
+
+func TestConfigVersion(t *testing.T) {
+	interactor := GetSuggestions{SuggestionsParams: map[string]map[string][]interface{}{
+		"default": {"must": {"category.id,category.id"}, "mustNot": {"listId,listId"}},
+		"similar": {"mustNot": {"listId,listId"}, "must": {"category.id,category.id"}},
+		"pro":     {"must": {"category.id,category.id"}},
+	}}
+	version := interactor.ConfigVersion("default")
+	assert.Len(t, version, 8)
+	assert.Equal(t, version, interactor.ConfigVersion("similar"))
+	assert.NotEqual(t, version, interactor.ConfigVersion("pro"))
+	assert.Equal(t, "", interactor.ConfigVersion("unknown"))
+}
@@ -0,0 +1,79 @@
+package usecases
+
+import (
+	"strconv"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// HideAds keeps the ads and sellers dismissed on each device, so they are
+// left out of its next suggestions
+type HideAds struct {
+	Repository HiddenAdsRepository
+	// AdsRepo retrieves the seller of the ads whose seller is hidden
+	AdsRepo AdsRepository
+	Logger  HideAdsLogger
+}
+
+// HideAdsLogger defines the logger methods that will be used for this usecase
+type HideAdsLogger interface {
+	ErrorGettingHiddenAds(deviceID string, err error)
+	ErrorAddingHiddenAds(deviceID string, err error)
+}
+
+// HideAds adds the ad, or its seller, to the ones hidden on the device. The
+// ad must exist to hide its seller
+func (interactor *HideAds) HideAds(request HideAdsRequest) error {
+	hidden := domain.Exclusions{ListIDs: []int64{request.ListID}}
+	if request.Seller {
+		listID := strconv.FormatInt(request.ListID, 10)
+		ad, err := interactor.AdsRepo.GetAd(listID)
+		if err != nil {
+			return err
+		}
+		hidden = domain.Exclusions{UserIDs: []int64{ad.UserID}}
+	}
+	if err := interactor.Repository.AddHidden(request.DeviceID, hidden); err != nil {
+		interactor.Logger.ErrorAddingHiddenAds(request.DeviceID, err)
+		return domain.NewError(domain.UnavailableError, domain.ErrCodeHiddenUnavailable, "ad not hidden", err)
+	}
+	return nil
+}
+
+// Exclusions returns the excluded ads followed by the ads and sellers
+// hidden on the device. Hidden ones are ignored when they cannot be retrieved
+func (interactor *HideAds) Exclusions(deviceID string, excluded []int64) domain.Exclusions {
+	exclusions := domain.Exclusions{ListIDs: appendUnique(nil, excluded)}
+	if deviceID == "" {
+		return exclusions
+	}
+	hidden, err := interactor.Repository.GetHidden(deviceID)
+	if err != nil {
+		interactor.Logger.ErrorGettingHiddenAds(deviceID, err)
+		return exclusions
+	}
+	exclusions.ListIDs = appendUnique(exclusions.ListIDs, hidden.ListIDs)
+	exclusions.UserIDs = hidden.UserIDs
+	return exclusions
+}
+
+// exclude leaves the ads and sellers of the exclusions out of the suggestions
+func (params *SuggestionParameters) exclude(exclusions domain.Exclusions) {
+	params.ExcludedListIDs = appendUnique(params.ExcludedListIDs, exclusions.ListIDs)
+	params.ExcludedUserIDs = appendUnique(params.ExcludedUserIDs, exclusions.UserIDs)
+}
+
+// appendUnique appends the ids not found on ids
+func appendUnique(ids []int64, values []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			ids = append(ids, value)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,138 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockHiddenAdsRepository struct {
+	mock.Mock
+}
+
+func (m *mockHiddenAdsRepository) GetHidden(deviceID string) (domain.Exclusions, error) {
+	args := m.Called(deviceID)
+	return args.Get(0).(domain.Exclusions), args.Error(1)
+}
+
+func (m *mockHiddenAdsRepository) AddHidden(deviceID string, hidden domain.Exclusions) error {
+	return m.Called(deviceID, hidden).Error(0)
+}
+
+type mockHideAdsLogger struct {
+	mock.Mock
+}
+
+func (m *mockHideAdsLogger) ErrorGettingHiddenAds(deviceID string, err error) {
+	m.Called(deviceID, err)
+}
+
+func (m *mockHideAdsLogger) ErrorAddingHiddenAds(deviceID string, err error) {
+	m.Called(deviceID, err)
+}
+
+func TestHideAdsAd(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	repo.On("AddHidden", "device", domain.Exclusions{ListIDs: []int64{5}}).Return(nil)
+	interactor := HideAds{Repository: repo}
+
+	assert.NoError(t, interactor.HideAds(HideAdsRequest{DeviceID: "device", ListID: 5}))
+	repo.AssertExpectations(t)
+}
+
+func TestHideAdsSeller(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	mAdsRepo := &mockAdsRepository{}
+	mAdsRepo.On("GetAd", "5").Return(domain.Ad{ListID: 5, UserID: 7}, nil)
+	repo.On("AddHidden", "device", domain.Exclusions{UserIDs: []int64{7}}).Return(nil)
+	interactor := HideAds{Repository: repo, AdsRepo: mAdsRepo}
+
+	assert.NoError(t, interactor.HideAds(HideAdsRequest{DeviceID: "device", ListID: 5, Seller: true}))
+	repo.AssertExpectations(t)
+}
+
+func TestHideAdsSellerNotFound(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	mAdsRepo := &mockAdsRepository{}
+	notFound := domain.NewError(domain.NotFoundError, domain.ErrCodeAdNotFound, "ad not found", nil)
+	mAdsRepo.On("GetAd", "5").Return(domain.Ad{}, notFound)
+	interactor := HideAds{Repository: repo, AdsRepo: mAdsRepo}
+
+	err := interactor.HideAds(HideAdsRequest{DeviceID: "device", ListID: 5, Seller: true})
+	assert.Equal(t, domain.NotFoundError, domain.ErrorKindOf(err))
+	repo.AssertNotCalled(t, "AddHidden", mock.Anything, mock.Anything)
+}
+
+func TestHideAdsErr(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	logger := &mockHideAdsLogger{}
+	repo.On("AddHidden", "device", mock.Anything).Return(fmt.Errorf("disk full"))
+	logger.On("ErrorAddingHiddenAds", "device", mock.Anything).Once()
+	interactor := HideAds{Repository: repo, Logger: logger}
+
+	err := interactor.HideAds(HideAdsRequest{DeviceID: "device", ListID: 5})
+	assert.Equal(t, domain.ErrCodeHiddenUnavailable, domain.ErrorCodeOf(err))
+	logger.AssertExpectations(t)
+}
+
+func TestHideAdsExclusions(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	repo.On("GetHidden", "device").Return(domain.Exclusions{ListIDs: []int64{3, 5}, UserIDs: []int64{7}}, nil)
+	interactor := HideAds{Repository: repo}
+
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{5, 2, 3}, UserIDs: []int64{7}},
+		interactor.Exclusions("device", []int64{5, 2, 5}))
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{2}}, interactor.Exclusions("", []int64{2}))
+	repo.AssertNumberOfCalls(t, "GetHidden", 1)
+}
+
+func TestHideAdsExclusionsErr(t *testing.T) {
+	repo := &mockHiddenAdsRepository{}
+	logger := &mockHideAdsLogger{}
+	repo.On("GetHidden", "device").Return(domain.Exclusions{}, fmt.Errorf("unavailable"))
+	logger.On("ErrorGettingHiddenAds", "device", mock.Anything).Once()
+	interactor := HideAds{Repository: repo, Logger: logger}
+
+	assert.Equal(t, domain.Exclusions{ListIDs: []int64{2}}, interactor.Exclusions("device", []int64{2}))
+	logger.AssertExpectations(t)
+}
+
+func TestGetSuggestionsExclusions(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{5, 3}, params.ExcludedListIDs) &&
+			assert.ObjectsAreEqual([]int64{7}, params.ExcludedUserIDs)
+	}), 2, 0).Return(adsOf(6, 8), "", nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "0")
+
+	_, err := interactor.GetSuggestions(SuggestionsRequest{
+		ListID: "1", CarouselType: "suggested-ads", Size: 2, Viewed: []int64{5},
+		Exclusions: domain.Exclusions{ListIDs: []int64{5, 3}, UserIDs: []int64{7}},
+	})
+	assert.NoError(t, err)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetMultiSuggestionsExclusions(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.MatchedBy(func(queries []AdsQuery) bool {
+		return len(queries) == 2 &&
+			assert.ObjectsAreEqual([]int64{3}, queries[0].Params.ExcludedListIDs) &&
+			assert.ObjectsAreEqual([]int64{7}, queries[1].Params.ExcludedUserIDs)
+	})).Return([]AdsQueryResult{{Ads: adsOf(6, 8)}, {Ads: adsOf(9, 11)}}, nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "0")
+
+	_, err := interactor.GetMultiSuggestions(MultiSuggestionsRequest{
+		ListID: "1", CarouselTypes: []string{"default", "suggested-ads"}, Size: 2,
+		Exclusions: domain.Exclusions{ListIDs: []int64{3}, UserIDs: []int64{7}},
+	})
+	assert.NoError(t, err)
+	mAdsRepo.AssertExpectations(t)
+}
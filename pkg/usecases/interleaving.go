@@ -0,0 +1,145 @@
+package usecases
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// Interleavings maps the carousels whose results are interleaved to the
+// two configurations compared, each one a carousel of the suggestion
+// params, ex: {"post_adreply_inmo": ["post_adreply_inmo", "post_adreply_inmo_v2"]}
+type Interleavings map[string][2]string
+
+// Validate checks both configurations of every interleaving are different
+// configured carousels
+func (in Interleavings) Validate(suggestionsParams map[string]map[string][]interface{}) error {
+	for carousel, configs := range in {
+		if configs[0] == configs[1] {
+			return fmt.Errorf("interleaving %s must compare two different carousels", carousel)
+		}
+		for _, config := range configs {
+			if _, ok := suggestionsParams[config]; !ok {
+				return fmt.Errorf("carousel %s of interleaving %s is not configured", config, carousel)
+			}
+		}
+	}
+	return nil
+}
+
+// getInterleavedSuggestions gets the suggestions of both configurations
+// for the source ad and merges them with team-draft interleaving, each ad
+// tagged with the configuration that picked it. When one configuration
+// fails the other one is returned alone. Interleaved results have no cursor
+func (interactor *GetSuggestions) getInterleavedSuggestions(
+	request SuggestionsRequest, configs [2]string,
+) (result SuggestionsResult, err error) {
+	result.Ads = []domain.Ad{}
+	size := interactor.getSize(request.Size)
+	for _, config := range configs {
+		if err = interactor.checkCarousel(config); err != nil {
+			return
+		}
+	}
+	sourceAd, err := interactor.SuggestionsRepo.GetAd(request.ListID)
+	if err != nil {
+		interactor.Logger.ErrorGettingAd(request.ListID, err)
+		return
+	}
+	queries := make([]AdsQuery, len(configs))
+	for i, config := range configs {
+		queries[i].Params = interactor.getCarouselParameters(sourceAd, config)
+		queries[i].Params.SourceIncludes = getSourceIncludes(
+			interactor.SuggestionsParams, config, request.OptionalParams)
+		queries[i].Params.exclude(request.Exclusions)
+		queries[i].Size = size
+		queries[i].From = request.From
+	}
+	results, err := interactor.SuggestionsRepo.MultiGetAds(strconv.FormatInt(sourceAd.AdID, 10), queries)
+	if err != nil {
+		interactor.Logger.ErrorGettingAds(nil, nil, nil, err)
+		return
+	}
+	var rankings [2][]domain.Ad
+	failed := 0
+	for i := range results {
+		if results[i].Err != nil {
+			params := queries[i].Params
+			interactor.Logger.ErrorGettingAds(params.Musts, params.Shoulds, params.MustsNot, results[i].Err)
+			err = results[i].Err
+			failed++
+			continue
+		}
+		rankings[i] = results[i].Ads
+	}
+	if failed == len(configs) {
+		return
+	}
+	err = nil
+	ads := teamDraftInterleave(rankings, configs, size, interleavingCoin(request))
+	if len(ads) < interactor.MinDisplayedAds {
+		interactor.Logger.NotEnoughAds(request.ListID, len(ads))
+		return
+	}
+	ads, errContact := interactor.getAdsContact(ads, request.OptionalParams)
+	if errContact != nil {
+		interactor.Logger.ErrorGettingAdsContact(request.ListID, errContact)
+	}
+	result.Ads = interactor.getAdsDistance(sourceAd, ads, request.OptionalParams)
+	return result, nil
+}
+
+// interleavingCoin returns the coin deciding which configuration picks
+// first on tied rounds. It is seeded by the request, so the same request
+// is always interleaved the same way and can be cached
+func interleavingCoin(request SuggestionsRequest) func() bool {
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "%s/%s/%d", request.CarouselType, request.ListID, request.From)
+	random := rand.New(rand.NewSource(int64(hash.Sum64()))) // nolint: gosec
+	return func() bool {
+		return random.Intn(2) == 0
+	}
+}
+
+// teamDraftInterleave merges two rankings with team-draft interleaving: on
+// each turn the team with fewer picks, or the coin winner on ties, picks
+// its best ranked ad not picked yet. Ads are tagged with the source of the
+// team that picked them. When a ranking runs out the other one keeps picking
+func teamDraftInterleave(rankings [2][]domain.Ad, sources [2]string, size int, coin func() bool) []domain.Ad {
+	out := make([]domain.Ad, 0, size)
+	picked := make(map[int64]bool, size)
+	var picks, next [2]int
+	for len(out) < size {
+		team := 1
+		if picks[0] < picks[1] || (picks[0] == picks[1] && coin()) {
+			team = 0
+		}
+		ad, ok := nextUnpicked(rankings[team], &next[team], picked)
+		if !ok {
+			team = 1 - team
+			if ad, ok = nextUnpicked(rankings[team], &next[team], picked); !ok {
+				break
+			}
+		}
+		ad.Source = sources[team]
+		picked[ad.ListID] = true
+		picks[team]++
+		out = append(out, ad)
+	}
+	return out
+}
+
+// nextUnpicked returns the first ad of the ranking from next not picked yet
+func nextUnpicked(ranking []domain.Ad, next *int, picked map[int64]bool) (domain.Ad, bool) {
+	for *next < len(ranking) {
+		ad := ranking[*next]
+		*next++
+		if !picked[ad.ListID] {
+			return ad, true
+		}
+	}
+	return domain.Ad{}, false
+}
@@ -0,0 +1,147 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// adsOf returns ads with the given list ids
+func adsOf(listIDs ...int64) []domain.Ad {
+	ads := make([]domain.Ad, len(listIDs))
+	for i, listID := range listIDs {
+		ads[i] = domain.Ad{ListID: listID}
+	}
+	return ads
+}
+
+// sourcesOf returns the list id and source of each ad
+func sourcesOf(ads []domain.Ad) []string {
+	out := make([]string, len(ads))
+	for i, ad := range ads {
+		out[i] = fmt.Sprintf("%d:%s", ad.ListID, ad.Source)
+	}
+	return out
+}
+
+func TestTeamDraftInterleave(t *testing.T) {
+	coins := []bool{true, false, true}
+	coin := func() bool {
+		heads := coins[0]
+		coins = coins[1:]
+		return heads
+	}
+	ads := teamDraftInterleave(
+		[2][]domain.Ad{adsOf(1, 2, 3, 4), adsOf(2, 5, 1, 6)}, [2]string{"a", "b"}, 6, coin)
+	// a wins the first round, b the second and a the third. Ads picked by
+	// the other team are skipped
+	assert.Equal(t, []string{"1:a", "2:b", "5:b", "3:a", "4:a", "6:b"}, sourcesOf(ads))
+	assert.Empty(t, coins)
+}
+
+func TestTeamDraftInterleaveExhausted(t *testing.T) {
+	ads := teamDraftInterleave(
+		[2][]domain.Ad{adsOf(1), adsOf(2, 3, 4)}, [2]string{"a", "b"}, 10, func() bool { return true })
+	assert.Equal(t, []string{"1:a", "2:b", "3:b", "4:b"}, sourcesOf(ads))
+
+	ads = teamDraftInterleave([2][]domain.Ad{adsOf(1, 2), nil}, [2]string{"a", "b"}, 1, func() bool { return false })
+	assert.Equal(t, []string{"1:a"}, sourcesOf(ads))
+}
+
+func TestInterleavingCoin(t *testing.T) {
+	request := SuggestionsRequest{CarouselType: "default", ListID: "1"}
+	first, second := interleavingCoin(request), interleavingCoin(request)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first(), second())
+	}
+}
+
+func TestInterleavingsValidate(t *testing.T) {
+	params := map[string]map[string][]interface{}{"default": {}, "default_v2": {}}
+	assert.NoError(t, Interleavings{"default": {"default", "default_v2"}}.Validate(params))
+	assert.EqualError(t, Interleavings{"default": {"default", "default"}}.Validate(params),
+		"interleaving default must compare two different carousels")
+	assert.EqualError(t, Interleavings{"default": {"default", "default_v3"}}.Validate(params),
+		"carousel default_v3 of interleaving default is not configured")
+}
+
+func interleavedInteractor(repo AdsRepository, logger GetSuggestionsLogger) GetSuggestions {
+	interactor := multiSuggestionsInteractor(repo, logger)
+	interactor.Interleavings = Interleavings{"default": {"pro", "similar"}}
+	return interactor
+}
+
+func TestGetSuggestionsInterleaved(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryParent: "cars"}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.MatchedBy(func(queries []AdsQuery) bool {
+		return len(queries) == 2 &&
+			queries[0].Params.Musts["categoryParent"] == "cars" && queries[0].From == 4 && queries[0].Size == 2 &&
+			queries[1].Params.Filters["categoryParent"] == "cars" && queries[1].From == 4
+	})).Return([]AdsQueryResult{
+		{Ads: adsOf(2, 3), Cursor: "ignored"},
+		{Ads: adsOf(3, 4)},
+	}, nil)
+	i := interleavedInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, From: 4, CarouselType: "default"})
+	assert.NoError(t, err)
+	assert.Len(t, output.Ads, 2)
+	assert.Empty(t, output.Cursor)
+	sources := map[string]int{}
+	for _, ad := range output.Ads {
+		sources[ad.Source]++
+	}
+	assert.Equal(t, map[string]int{"pro": 1, "similar": 1}, sources)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsInterleavedPartialError(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.Anything).Return([]AdsQueryResult{
+		{Err: fmt.Errorf("err")},
+		{Ads: adsOf(3, 4)},
+	}, nil)
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, fmt.Errorf("err"))
+	i := interleavedInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3:similar", "4:similar"}, sourcesOf(output.Ads))
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetSuggestionsInterleavedError(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.Anything).Return([]AdsQueryResult{
+		{Err: fmt.Errorf("err")},
+		{Err: fmt.Errorf("err")},
+	}, nil)
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, fmt.Errorf("err"))
+	i := interleavedInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default"})
+	assert.EqualError(t, err, "err")
+	assert.Empty(t, output.Ads)
+}
+
+func TestGetSuggestionsInterleavedNotEnoughAds(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("MultiGetAds", "10", mock.Anything).Return([]AdsQueryResult{
+		{Ads: adsOf(3)},
+		{Ads: adsOf(3)},
+	}, nil)
+	mLogger.On("NotEnoughAds", "1", 1)
+	i := interleavedInteractor(&mAdsRepo, &mLogger)
+	output, err := i.GetSuggestions(SuggestionsRequest{ListID: "1", Size: 2, CarouselType: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Ad{}, output.Ads)
+	mLogger.AssertExpectations(t)
+}
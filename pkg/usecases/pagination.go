@@ -0,0 +1,49 @@
+package usecases
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// pageCursor is the cursor returned to clients, the repository cursor of
+// the next page along with the carousel position of its first ad, so the
+// ads of every page are attributed their position. The repository cursor
+// continues after the last content ad shown, it is empty when no content
+// ad was shown yet, as on first pages filled with co-viewed or sponsored ads
+type pageCursor struct {
+	Cursor string `json:"c,omitempty"`
+	Offset int    `json:"o"`
+}
+
+// encodePageCursor returns the url safe cursor of the page starting at
+// offset, empty when there is no next page
+func encodePageCursor(cursor string, offset int) string {
+	if cursor == "" {
+		return ""
+	}
+	return encodeCursor(pageCursor{Cursor: cursor, Offset: offset})
+}
+
+// encodeFirstContentCursor returns the cursor of the page starting at
+// offset whose content ads start from the first one
+func encodeFirstContentCursor(offset int) string {
+	return encodeCursor(pageCursor{Offset: offset})
+}
+
+func encodeCursor(cursor pageCursor) string {
+	content, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// decodePageCursor returns the repository cursor and the offset of the
+// page. Other cursors, as the ones issued before offsets were carried, are
+// passed to the repository as they are and their pages start at zero
+func decodePageCursor(cursor string) (string, int) {
+	var decoded pageCursor
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(content, &decoded) != nil || decoded.Offset < 0 ||
+		decoded.Cursor == "" && decoded.Offset == 0 {
+		return cursor, 0
+	}
+	return decoded.Cursor, decoded.Offset
+}
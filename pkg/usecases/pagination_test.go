@@ -0,0 +1,27 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageCursor(t *testing.T) {
+	cursor := encodePageCursor("eyJzIjpbMi41XSwidCI6MX0", 20)
+	assert.Regexp(t, "^[A-Za-z0-9_-]+$", cursor)
+	repoCursor, offset := decodePageCursor(cursor)
+	assert.Equal(t, "eyJzIjpbMi41XSwidCI6MX0", repoCursor)
+	assert.Equal(t, 20, offset)
+	assert.Empty(t, encodePageCursor("", 20))
+	repoCursor, offset = decodePageCursor(encodeFirstContentCursor(4))
+	assert.Empty(t, repoCursor)
+	assert.Equal(t, 4, offset)
+
+	// repository cursors are passed as they are
+	repoCursor, offset = decodePageCursor("eyJzIjpbMi41XSwidCI6MX0")
+	assert.Equal(t, "eyJzIjpbMi41XSwidCI6MX0", repoCursor)
+	assert.Equal(t, 0, offset)
+	repoCursor, offset = decodePageCursor("current")
+	assert.Equal(t, "current", repoCursor)
+	assert.Equal(t, 0, offset)
+}
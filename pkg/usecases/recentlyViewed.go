@@ -0,0 +1,98 @@
+package usecases
+
+import (
+	"strconv"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// viewedSourceIncludes are the fields retrieved to like the viewed ads
+var viewedSourceIncludes = []string{"adId", "listId"} // nolint: gochecknoglobals
+
+// RecentlyViewed keeps the ads opened on each device, so suggestions can
+// reflect the session interests without clients sending them
+type RecentlyViewed struct {
+	Repository ViewedAdsRepository
+	Logger     RecentlyViewedLogger
+}
+
+// RecentlyViewedLogger defines the logger methods that will be used for this usecase
+type RecentlyViewedLogger interface {
+	ErrorGettingViewedAds(deviceID string, err error)
+	ErrorAddingViewedAds(deviceID string, err error)
+}
+
+// Merge returns the viewed ads followed by the ones stored for the device,
+// without repetitions. Stored ads are ignored when they cannot be retrieved
+func (interactor *RecentlyViewed) Merge(deviceID string, viewed []int64) []int64 {
+	merged := make([]int64, 0, len(viewed))
+	seen := make(map[int64]bool, len(viewed))
+	add := func(listIDs []int64) {
+		for _, listID := range listIDs {
+			if !seen[listID] {
+				seen[listID] = true
+				merged = append(merged, listID)
+			}
+		}
+	}
+	add(viewed)
+	if deviceID == "" {
+		return merged
+	}
+	stored, err := interactor.Repository.GetViewed(deviceID)
+	if err != nil {
+		interactor.Logger.ErrorGettingViewedAds(deviceID, err)
+	}
+	add(stored)
+	return merged
+}
+
+// Add stores the ads, most recent first, as viewed on the device. Ads
+// without device are not stored
+func (interactor *RecentlyViewed) Add(deviceID string, listIDs []int64) {
+	if deviceID == "" || len(listIDs) == 0 {
+		return
+	}
+	if err := interactor.Repository.AddViewed(deviceID, listIDs); err != nil {
+		interactor.Logger.ErrorAddingViewedAds(deviceID, err)
+	}
+}
+
+// setViewedParameters excludes the ads viewed on the session and likes
+// the most recent ones along with the source ad, on carousels with a
+// viewed conf as "viewed": [{"likes": "3"}]. Zero likes only excludes them
+func (interactor *GetSuggestions) setViewedParameters(
+	params *SuggestionParameters,
+	sourceAd domain.Ad,
+	carouselType string,
+	viewed []int64,
+) {
+	conf := getValues(interactor.SuggestionsParams, carouselType, "viewed")
+	if len(conf) == 0 || len(viewed) == 0 {
+		return
+	}
+	params.ExcludedListIDs = append(params.ExcludedListIDs, viewed...)
+	likes, _ := strconv.Atoi(conf["likes"])
+	if likes <= 0 || len(params.Fields) == 0 {
+		return
+	}
+	// the viewed ads are liked by document id, which is the ad id
+	liked := make([]int64, 0, likes)
+	for _, listID := range viewed {
+		if len(liked) == likes {
+			break
+		}
+		if listID != sourceAd.ListID {
+			liked = append(liked, listID)
+		}
+	}
+	ads, err := interactor.SuggestionsRepo.GetAdsByListIDs(
+		liked, SuggestionParameters{SourceIncludes: viewedSourceIncludes})
+	if err != nil {
+		interactor.Logger.ErrorGettingAds(nil, nil, nil, err)
+		return
+	}
+	for _, ad := range ads {
+		params.Likes = append(params.Likes, strconv.FormatInt(ad.AdID, 10))
+	}
+}
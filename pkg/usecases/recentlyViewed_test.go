@@ -0,0 +1,203 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockViewedAdsRepository struct {
+	mock.Mock
+}
+
+func (m *mockViewedAdsRepository) GetViewed(deviceID string) ([]int64, error) {
+	args := m.Called(deviceID)
+	viewed, _ := args.Get(0).([]int64)
+	return viewed, args.Error(1)
+}
+
+func (m *mockViewedAdsRepository) AddViewed(deviceID string, listIDs []int64) error {
+	return m.Called(deviceID, listIDs).Error(0)
+}
+
+type mockRecentlyViewedLogger struct {
+	mock.Mock
+}
+
+func (m *mockRecentlyViewedLogger) ErrorGettingViewedAds(deviceID string, err error) {
+	m.Called(deviceID, err)
+}
+
+func (m *mockRecentlyViewedLogger) ErrorAddingViewedAds(deviceID string, err error) {
+	m.Called(deviceID, err)
+}
+
+func TestRecentlyViewedMerge(t *testing.T) {
+	repo := &mockViewedAdsRepository{}
+	repo.On("GetViewed", "device").Return([]int64{3, 2, 1}, nil)
+	interactor := RecentlyViewed{Repository: repo}
+
+	assert.Equal(t, []int64{5, 2, 3, 1}, interactor.Merge("device", []int64{5, 2}))
+	assert.Equal(t, []int64{5, 2}, interactor.Merge("", []int64{5, 2, 5}))
+	repo.AssertNumberOfCalls(t, "GetViewed", 1)
+}
+
+func TestRecentlyViewedMergeErr(t *testing.T) {
+	repo := &mockViewedAdsRepository{}
+	logger := &mockRecentlyViewedLogger{}
+	repo.On("GetViewed", "device").Return(nil, fmt.Errorf("unavailable"))
+	logger.On("ErrorGettingViewedAds", "device", mock.Anything).Once()
+	interactor := RecentlyViewed{Repository: repo, Logger: logger}
+
+	assert.Equal(t, []int64{5}, interactor.Merge("device", []int64{5}))
+	logger.AssertExpectations(t)
+}
+
+func TestRecentlyViewedAdd(t *testing.T) {
+	repo := &mockViewedAdsRepository{}
+	logger := &mockRecentlyViewedLogger{}
+	repo.On("AddViewed", "device", []int64{5}).Return(fmt.Errorf("unavailable"))
+	logger.On("ErrorAddingViewedAds", "device", mock.Anything).Once()
+	interactor := RecentlyViewed{Repository: repo, Logger: logger}
+
+	interactor.Add("device", []int64{5})
+	interactor.Add("", []int64{6})
+	interactor.Add("device", nil)
+	repo.AssertNumberOfCalls(t, "AddViewed", 1)
+	logger.AssertExpectations(t)
+}
+
+func TestTrackEventsAddViewed(t *testing.T) {
+	repo := &mockTrackingEventsRepository{}
+	repo.On("Save", mock.Anything).Return(nil)
+	viewed := &mockViewedAdsRepository{}
+	viewed.On("AddViewed", "a", []int64{4, 2}).Return(nil).Once()
+	viewed.On("AddViewed", "b", []int64{3}).Return(nil).Once()
+	interactor := TrackEvents{Repository: repo, RecentlyViewed: &RecentlyViewed{Repository: viewed}}
+
+	err := interactor.TrackEvents([]domain.TrackingEvent{
+		{Type: domain.ClickEvent, ListID: 2, DeviceID: "a"},
+		{Type: domain.ImpressionEvent, ListID: 5, DeviceID: "a"},
+		{Type: domain.ClickEvent, ListID: 3, DeviceID: "b"},
+		{Type: domain.ReplyEvent, ListID: 4, DeviceID: "a"},
+		{Type: domain.ClickEvent, ListID: 6},
+	})
+	assert.NoError(t, err)
+	viewed.AssertExpectations(t)
+}
+
+func viewedInteractor(repo AdsRepository, logger GetSuggestionsLogger, likes string) GetSuggestions {
+	return GetSuggestions{
+		SuggestionsRepo: repo,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default": {"fields": {"subject"}},
+			"suggested-ads": {
+				"fields": {"subject"},
+				"viewed": {map[string]interface{}{"likes": likes}},
+			},
+		},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 2,
+		RequestedAdsQty: 2,
+		Logger:          logger,
+	}
+}
+
+func TestGetSuggestionsViewed(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{5, 4}, SuggestionParameters{SourceIncludes: viewedSourceIncludes}).
+		Return([]domain.Ad{{ListID: 5, AdID: 50}, {ListID: 4, AdID: 40}}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{5, 1, 4, 3}, params.ExcludedListIDs) &&
+			assert.ObjectsAreEqual([]string{"50", "40"}, params.Likes)
+	}), 2, 0).Return(adsOf(6, 7), "", nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "2")
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{
+		ListID: "1", CarouselType: "suggested-ads", Size: 2, Viewed: []int64{5, 1, 4, 3}})
+	assert.NoError(t, err)
+	assert.Len(t, result.Ads, 2)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsViewedExcludeOnly(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{5}, params.ExcludedListIDs) && len(params.Likes) == 0
+	}), 2, 0).Return(adsOf(6, 7), "", nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "0")
+
+	_, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "suggested-ads", Size: 2, Viewed: []int64{5}})
+	assert.NoError(t, err)
+	mAdsRepo.AssertNotCalled(t, "GetAdsByListIDs", mock.Anything, mock.Anything)
+}
+
+func TestGetSuggestionsViewedNotConfigured(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return len(params.ExcludedListIDs) == 0 && len(params.Likes) == 0
+	}), 2, 0).Return(adsOf(6, 7), "", nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "2")
+
+	_, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "default", Size: 2, Viewed: []int64{5}})
+	assert.NoError(t, err)
+	mAdsRepo.AssertExpectations(t)
+}
+
+func TestGetSuggestionsViewedLikesErr(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{5}, mock.Anything).Return(nil, fmt.Errorf("timeout"))
+	mLogger.On("ErrorGettingAds", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Once()
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{5}, params.ExcludedListIDs) && len(params.Likes) == 0
+	}), 2, 0).Return(adsOf(6, 7), "", nil)
+	interactor := viewedInteractor(&mAdsRepo, &mLogger, "2")
+
+	_, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "suggested-ads", Size: 2, Viewed: []int64{5}})
+	assert.NoError(t, err)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetFeedViewed(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{5}, SuggestionParameters{SourceIncludes: viewedSourceIncludes}).
+		Return([]domain.Ad{{ListID: 5, AdID: 50}}, nil)
+	// only the section with a viewed conf uses the viewed ads
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{5, 3}, params.ExcludedListIDs) &&
+			assert.ObjectsAreEqual([]string{"50"}, params.Likes)
+	}), 2, 0).Return(adsOf(6, 7), "", nil)
+	mAdsRepo.On("GetAds", "10", mock.MatchedBy(func(params SuggestionParameters) bool {
+		return assert.ObjectsAreEqual([]int64{3}, params.ExcludedListIDs) && len(params.Likes) == 0
+	}), 4, 0).Return(adsOf(6, 8, 9), "", nil)
+	suggestions := viewedInteractor(&mAdsRepo, &mLogger, "1")
+	feed := GetFeed{
+		Suggestions: &suggestions,
+		Layout: FeedLayout{Sections: []FeedSection{
+			{Carousel: "suggested-ads", Size: 2},
+			{Carousel: "default", Size: 2},
+		}},
+		Logger: &mockGetFeedLogger{},
+	}
+	feed.Logger.(*mockGetFeedLogger).On("DuplicatedAds", "default", 1)
+
+	result, err := feed.GetFeed(FeedRequest{
+		ListID: "1", Viewed: []int64{5}, Exclusions: domain.Exclusions{ListIDs: []int64{3}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, result.Sections, 2)
+	mAdsRepo.AssertExpectations(t)
+}
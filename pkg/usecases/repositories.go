@@ -1,11 +1,37 @@
 package usecases
 
-import "gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+import (
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
 
 // AdsRepository defines the methods that are available for ad repository
 type AdsRepository interface {
 	GetAd(listID string) (ad domain.Ad, err error)
-	GetAds(listID string, params SuggestionParameters, size, from int) ([]domain.Ad, error)
+	// GetAds returns the suggested ads along with the cursor to get the next page
+	GetAds(listID string, params SuggestionParameters, size, from int) ([]domain.Ad, string, error)
+	// MultiGetAds returns the suggested ads of every query on a single search
+	// request, results are returned in the same order as queries
+	MultiGetAds(listID string, queries []AdsQuery) ([]AdsQueryResult, error)
+	// GetAdsByListIDs returns the ads of listIDs matching the carousel
+	// constraints, in the same order as listIDs
+	GetAdsByListIDs(listIDs []int64, params SuggestionParameters) ([]domain.Ad, error)
+}
+
+// AdsQuery holds the parameters of one of the searches sent by MultiGetAds
+type AdsQuery struct {
+	Params SuggestionParameters
+	Size   int
+	From   int
+}
+
+// AdsQueryResult holds the ads and next page cursor of one of the
+// MultiGetAds queries, or the error of that query
+type AdsQueryResult struct {
+	Ads    []domain.Ad
+	Cursor string
+	Err    error
 }
 
 // AdContactRepo implements ad contact repository functions
@@ -15,5 +41,59 @@ type AdContactRepo interface {
 
 // IndicatorsRepository defines the methods that a Indicators repository should have
 type IndicatorsRepository interface {
-	GetUF() (float64, error)
+	// GetIndicator returns the value in pesos of the indicator identified by
+	// code (uf, dolar, utm, ...) for the given date
+	GetIndicator(code string, date time.Time) (float64, error)
+}
+
+// CommunesRepository defines the methods that a communes repository should have
+type CommunesRepository interface {
+	// GetCoordinates returns the coordinates of the commune center
+	GetCoordinates(communeID int64) (domain.GeoPoint, error)
+}
+
+// CoviewRepository defines the methods that a co-view repository should have
+type CoviewRepository interface {
+	// GetNeighbours returns up to size ads viewed by the users that viewed
+	// the ad, by descending score
+	GetNeighbours(listID int64, size int) ([]domain.Neighbour, error)
+}
+
+// ViewedAdsRepository defines the methods that a viewed ads repository should have
+type ViewedAdsRepository interface {
+	// GetViewed returns the ads viewed on the device, most recent first
+	GetViewed(deviceID string) ([]int64, error)
+	// AddViewed adds the ads, most recent first, to the ones viewed on the device
+	AddViewed(deviceID string, listIDs []int64) error
+}
+
+// TrackingEventsRepository defines the methods that a tracking events
+// repository should have
+type TrackingEventsRepository interface {
+	// Save stores the events, it may return before they are persisted
+	Save(events []domain.TrackingEvent) error
+}
+
+// HiddenAdsRepository defines the methods that a hidden ads repository should have
+type HiddenAdsRepository interface {
+	// GetHidden returns the ads and sellers hidden on the device
+	GetHidden(deviceID string) (domain.Exclusions, error)
+	// AddHidden adds the ads and sellers to the ones hidden on the device
+	AddHidden(deviceID string, hidden domain.Exclusions) error
+}
+
+// SponsoredAdsRepository defines the methods that a sponsored ads repository should have
+type SponsoredAdsRepository interface {
+	// GetSponsoredAds returns the sponsored ads eligible on the category
+	// and region, by descending priority
+	GetSponsoredAds(categoryID, regionID int64) ([]domain.SponsoredAd, error)
+}
+
+// FrequencyCapRepository defines the methods that a frequency cap repository should have
+type FrequencyCapRepository interface {
+	// GetServed returns how many times each ad was served to the unit on
+	// the cap window
+	GetServed(unitID string, listIDs []int64) (map[int64]int, error)
+	// AddServed counts the ads as served once more to the unit
+	AddServed(unitID string, listIDs []int64) error
 }
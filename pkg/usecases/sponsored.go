@@ -0,0 +1,182 @@
+package usecases
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// sponsoredCandidates is how many sponsored ads are requested for each
+// slot, since some of them may not be published anymore
+const sponsoredCandidates = 2
+
+// sponsoredSlots returns the positions of the first page served with
+// sponsored ads, set on the carousel as "sponsored": [{"slots": "2,6"}].
+// Positions start at zero, as the ones of the tracked events
+func (interactor *GetSuggestions) sponsoredSlots(carouselType string) []int {
+	if interactor.SponsoredRepo == nil {
+		return nil
+	}
+	conf := getValues(interactor.SuggestionsParams, carouselType, "sponsored")
+	var slots []int
+	for _, value := range strings.Split(conf["slots"], ",") {
+		slot, err := strconv.Atoi(strings.TrimSpace(value))
+		if err == nil && slot >= 0 && !containsSlot(slots, slot) {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Ints(slots)
+	return slots
+}
+
+// FrequencyCapped tells whether the carousel responses depend on the
+// sponsored ads already served to each user or device
+func (interactor *GetSuggestions) FrequencyCapped(carouselType string) bool {
+	return interactor.FrequencyCaps != nil && len(interactor.sponsoredSlots(carouselType)) > 0
+}
+
+// getSponsoredAds returns the sponsored ads eligible on the source ad
+// category and region, by descending priority, up to one for each slot of
+// the page. The source ad, excluded ads and sellers and ads that reached
+// their frequency cap for the unit are not returned
+func (interactor *GetSuggestions) getSponsoredAds(
+	sourceAd domain.Ad,
+	parameters SuggestionParameters,
+	slots []int,
+	size int,
+	unitID string,
+) []domain.Ad {
+	available := 0
+	for available < len(slots) && slots[available] < size {
+		available++
+	}
+	if available == 0 {
+		return nil
+	}
+	listID := strconv.FormatInt(sourceAd.ListID, 10)
+	sponsored, err := interactor.SponsoredRepo.GetSponsoredAds(sourceAd.CategoryID, sourceAd.RegionID)
+	if err != nil {
+		interactor.Logger.ErrorGettingSponsoredAds(listID, err)
+		return nil
+	}
+	served := interactor.getServed(unitID, sponsored)
+	skipped := map[int64]bool{sourceAd.ListID: true}
+	for _, excluded := range parameters.ExcludedListIDs {
+		skipped[excluded] = true
+	}
+	listIDs := make([]int64, 0, available*sponsoredCandidates)
+	for _, ad := range sponsored {
+		if len(listIDs) == available*sponsoredCandidates {
+			break
+		}
+		if skipped[ad.ListID] || ad.FrequencyCap > 0 && served[ad.ListID] >= ad.FrequencyCap {
+			continue
+		}
+		skipped[ad.ListID] = true
+		listIDs = append(listIDs, ad.ListID)
+	}
+	if len(listIDs) == 0 {
+		return nil
+	}
+	// sponsored ads are not constrained by the carousel params, only by
+	// the ads and sellers excluded for the user
+	ads, err := interactor.SuggestionsRepo.GetAdsByListIDs(listIDs, SuggestionParameters{
+		SourceIncludes:  parameters.SourceIncludes,
+		ExcludedUserIDs: parameters.ExcludedUserIDs,
+	})
+	if err != nil {
+		interactor.Logger.ErrorGettingSponsoredAds(listID, err)
+		return nil
+	}
+	if len(ads) > available {
+		ads = ads[:available]
+	}
+	for i := range ads {
+		ads[i].Sponsored = true
+	}
+	return ads
+}
+
+// getServed returns how many times each sponsored ad was served to the
+// unit, requests without unit or frequency caps are not capped
+func (interactor *GetSuggestions) getServed(unitID string, sponsored []domain.SponsoredAd) map[int64]int {
+	if interactor.FrequencyCaps == nil || unitID == "" {
+		return nil
+	}
+	var capped []int64
+	for _, ad := range sponsored {
+		if ad.FrequencyCap > 0 {
+			capped = append(capped, ad.ListID)
+		}
+	}
+	if len(capped) == 0 {
+		return nil
+	}
+	served, err := interactor.FrequencyCaps.GetServed(unitID, capped)
+	if err != nil {
+		interactor.Logger.ErrorCappingSponsoredAds(unitID, err)
+	}
+	return served
+}
+
+// addServed counts the sponsored ads of the page as served to the unit
+func (interactor *GetSuggestions) addServed(unitID string, ads []domain.Ad) {
+	if interactor.FrequencyCaps == nil || unitID == "" {
+		return
+	}
+	var listIDs []int64
+	for _, ad := range ads {
+		if ad.Sponsored {
+			listIDs = append(listIDs, ad.ListID)
+		}
+	}
+	if len(listIDs) == 0 {
+		return
+	}
+	if err := interactor.FrequencyCaps.AddServed(unitID, listIDs); err != nil {
+		interactor.Logger.ErrorCappingSponsoredAds(unitID, err)
+	}
+}
+
+// placeSponsoredAds places the sponsored ads on their slots, by priority,
+// and the organic ones on the rest. Sponsored ads also found on the organic
+// ones are skipped, and so are slots past the organic ads, so sponsored
+// ads never fill a page on their own
+func placeSponsoredAds(organic, sponsored []domain.Ad, slots []int) []domain.Ad {
+	organicIDs := make(map[int64]bool, len(organic))
+	for _, ad := range organic {
+		organicIDs[ad.ListID] = true
+	}
+	placed := make([]domain.Ad, 0, len(sponsored))
+	for _, ad := range sponsored {
+		if !organicIDs[ad.ListID] {
+			placed = append(placed, ad)
+		}
+	}
+	ads := make([]domain.Ad, 0, len(organic)+len(placed))
+	slot := 0
+	for _, ad := range organic {
+		for slot < len(slots) && len(placed) > 0 && slots[slot] == len(ads) {
+			ads = append(ads, placed[0])
+			placed = placed[1:]
+			slot++
+		}
+		ads = append(ads, ad)
+	}
+	if slot < len(slots) && len(placed) > 0 && slots[slot] == len(ads) {
+		ads = append(ads, placed[0])
+	}
+	return ads
+}
+
+// containsSlot returns true when slot is one of the slots
+func containsSlot(slots []int, slot int) bool {
+	for _, value := range slots {
+		if value == slot {
+			return true
+		}
+	}
+	return false
+}
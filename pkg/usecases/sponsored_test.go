@@ -0,0 +1,194 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockSponsoredAdsRepository struct {
+	mock.Mock
+}
+
+func (m *mockSponsoredAdsRepository) GetSponsoredAds(categoryID, regionID int64) ([]domain.SponsoredAd, error) {
+	args := m.Called(categoryID, regionID)
+	ads, _ := args.Get(0).([]domain.SponsoredAd)
+	return ads, args.Error(1)
+}
+
+type mockFrequencyCapRepository struct {
+	mock.Mock
+}
+
+func (m *mockFrequencyCapRepository) GetServed(unitID string, listIDs []int64) (map[int64]int, error) {
+	args := m.Called(unitID, listIDs)
+	served, _ := args.Get(0).(map[int64]int)
+	return served, args.Error(1)
+}
+
+func (m *mockFrequencyCapRepository) AddServed(unitID string, listIDs []int64) error {
+	return m.Called(unitID, listIDs).Error(0)
+}
+
+// sponsoredOf returns the list ids of the ads, sponsored ones followed by *
+func sponsoredOf(ads []domain.Ad) []string {
+	out := make([]string, len(ads))
+	for i, ad := range ads {
+		out[i] = fmt.Sprint(ad.ListID)
+		if ad.Sponsored {
+			out[i] += "*"
+		}
+	}
+	return out
+}
+
+func sponsoredAdsOf(listIDs ...int64) []domain.Ad {
+	ads := adsOf(listIDs...)
+	for i := range ads {
+		ads[i].Sponsored = true
+	}
+	return ads
+}
+
+func TestPlaceSponsoredAds(t *testing.T) {
+	ads := placeSponsoredAds(adsOf(1, 2, 3, 4), sponsoredAdsOf(8, 9), []int{0, 2})
+	assert.Equal(t, []string{"8*", "1", "9*", "2", "3", "4"}, sponsoredOf(ads))
+
+	// duplicates of organic ads are skipped, their slot goes to the next one
+	ads = placeSponsoredAds(adsOf(1, 2, 3), sponsoredAdsOf(2, 9), []int{1, 3})
+	assert.Equal(t, []string{"1", "9*", "2", "3"}, sponsoredOf(ads))
+
+	// slots right after the organic ads are filled, the ones past them are not
+	ads = placeSponsoredAds(adsOf(1, 2), sponsoredAdsOf(8, 9), []int{2, 4})
+	assert.Equal(t, []string{"1", "2", "8*"}, sponsoredOf(ads))
+	assert.Empty(t, placeSponsoredAds(nil, sponsoredAdsOf(8), []int{1}))
+}
+
+func TestSponsoredSlots(t *testing.T) {
+	interactor := GetSuggestions{
+		SponsoredRepo: &mockSponsoredAdsRepository{},
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default":   {},
+			"sponsored": {"sponsored": {map[string]interface{}{"slots": "6, 2,x,-1,2"}}},
+		},
+	}
+	assert.Equal(t, []int{2, 6}, interactor.sponsoredSlots("sponsored"))
+	assert.Empty(t, interactor.sponsoredSlots("default"))
+	assert.False(t, interactor.FrequencyCapped("sponsored"))
+	interactor.FrequencyCaps = &mockFrequencyCapRepository{}
+	assert.True(t, interactor.FrequencyCapped("sponsored"))
+	assert.False(t, interactor.FrequencyCapped("default"))
+	interactor.SponsoredRepo = nil
+	assert.Empty(t, interactor.sponsoredSlots("sponsored"))
+}
+
+func sponsoredInteractor(
+	repo AdsRepository, sponsored SponsoredAdsRepository, caps FrequencyCapRepository, logger GetSuggestionsLogger,
+) GetSuggestions {
+	return GetSuggestions{
+		SuggestionsRepo: repo,
+		SponsoredRepo:   sponsored,
+		FrequencyCaps:   caps,
+		SuggestionsParams: map[string]map[string][]interface{}{
+			"default": {"source": {"listId"}},
+			"sponsored": {
+				"source":    {"listId"},
+				"sponsored": {map[string]interface{}{"slots": "1,3"}},
+			},
+		},
+		MinDisplayedAds: 2,
+		MaxDisplayedAds: 5,
+		RequestedAdsQty: 5,
+		Logger:          logger,
+	}
+}
+
+func TestGetSuggestionsSponsored(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mSponsored := mockSponsoredAdsRepository{}
+	mCaps := mockFrequencyCapRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10, CategoryID: 2020, RegionID: 13}, nil)
+	mSponsored.On("GetSponsoredAds", int64(2020), int64(13)).Return([]domain.SponsoredAd{
+		{ListID: 1, Priority: 9},
+		{ListID: 20, Priority: 8, FrequencyCap: 2},
+		{ListID: 21, Priority: 7},
+		{ListID: 22, Priority: 6, FrequencyCap: 2},
+		{ListID: 23, Priority: 5},
+		{ListID: 24, Priority: 4},
+		{ListID: 25, Priority: 3},
+	}, nil)
+	mCaps.On("GetServed", "device", []int64{20, 22}).Return(map[int64]int{20: 2, 22: 1}, nil)
+	// the source ad, capped and excluded ads are skipped, two candidates
+	// are requested for each slot
+	mAdsRepo.On("GetAdsByListIDs", []int64{22, 23, 24, 25}, SuggestionParameters{
+		SourceIncludes: []string{"listId"}, ExcludedUserIDs: []int64{7},
+	}).Return(adsOf(22, 24, 25), nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 3, 0).Return(adsOf(2, 3, 4), "next", nil)
+	mCaps.On("AddServed", "device", []int64{22, 24}).Return(nil)
+	interactor := sponsoredInteractor(&mAdsRepo, &mSponsored, &mCaps, &mLogger)
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{
+		ListID: "1", CarouselType: "sponsored", UnitID: "device", Size: 5,
+		Exclusions: domain.Exclusions{ListIDs: []int64{21}, UserIDs: []int64{7}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "22*", "3", "24*", "4"}, sponsoredOf(result.Ads))
+	assert.Equal(t, encodePageCursor("next", 5), result.Cursor)
+	mAdsRepo.AssertExpectations(t)
+	mCaps.AssertExpectations(t)
+}
+
+func TestGetSuggestionsSponsoredUncapped(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mSponsored := mockSponsoredAdsRepository{}
+	mCaps := mockFrequencyCapRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mSponsored.On("GetSponsoredAds", int64(0), int64(0)).Return([]domain.SponsoredAd{
+		{ListID: 20, FrequencyCap: 1},
+	}, nil)
+	mAdsRepo.On("GetAdsByListIDs", []int64{20}, mock.Anything).Return(adsOf(20), nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 4, 0).Return(adsOf(2, 3, 4, 5), "", nil)
+	interactor := sponsoredInteractor(&mAdsRepo, &mSponsored, &mCaps, &mLogger)
+
+	// requests without user or device are not capped
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "sponsored", Size: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "20*", "3", "4", "5"}, sponsoredOf(result.Ads))
+	mCaps.AssertNotCalled(t, "GetServed", mock.Anything, mock.Anything)
+	mCaps.AssertNotCalled(t, "AddServed", mock.Anything, mock.Anything)
+}
+
+func TestGetSuggestionsSponsoredErr(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mSponsored := mockSponsoredAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mSponsored.On("GetSponsoredAds", int64(0), int64(0)).Return(nil, fmt.Errorf("unavailable"))
+	mLogger.On("ErrorGettingSponsoredAds", "1", mock.Anything).Once()
+	mAdsRepo.On("GetAds", "10", mock.Anything, 5, 0).Return(adsOf(2, 3, 4, 5, 6), "", nil)
+	interactor := sponsoredInteractor(&mAdsRepo, &mSponsored, nil, &mLogger)
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "sponsored", Size: 5})
+	assert.NoError(t, err)
+	assert.Len(t, result.Ads, 5)
+	mLogger.AssertExpectations(t)
+}
+
+func TestGetSuggestionsSponsoredNextPage(t *testing.T) {
+	mAdsRepo := mockAdsRepository{}
+	mSponsored := mockSponsoredAdsRepository{}
+	mLogger := mockGetSuggestionsLogger{}
+	mAdsRepo.On("GetAd", "1").Return(domain.Ad{ListID: 1, AdID: 10}, nil)
+	mAdsRepo.On("GetAds", "10", mock.Anything, 5, 5).Return(adsOf(2, 3, 4, 5, 6), "", nil)
+	interactor := sponsoredInteractor(&mAdsRepo, &mSponsored, nil, &mLogger)
+
+	result, err := interactor.GetSuggestions(SuggestionsRequest{ListID: "1", CarouselType: "sponsored", Size: 5, From: 5})
+	assert.NoError(t, err)
+	assert.Len(t, result.Ads, 5)
+	mSponsored.AssertNotCalled(t, "GetSponsoredAds", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+// TrackEvents stores the impressions, clicks and replies of recommended
+// ads, so the carousels can be compared by how they drive replies
+type TrackEvents struct {
+	Repository TrackingEventsRepository
+	Logger     TrackEventsLogger
+	// Tokens is optional, without it attribution tokens are not verified
+	Tokens AttributionVerifier
+	// RecentlyViewed is optional, it stores the ads clicked or replied on
+	// each device as viewed
+	RecentlyViewed *RecentlyViewed
+	// Now returns the time events are received at, time.Now when nil
+	Now func() time.Time
+}
+
+// TrackEventsLogger defines the logger methods that will be used for this usecase
+type TrackEventsLogger interface {
+	ErrorSavingEvents(count int, err error)
+	InvalidAttributionToken(listID int64, err error)
+}
+
+// AttributionVerifier returns the attribution signed on a token
+type AttributionVerifier interface {
+	Verify(token string) (domain.Attribution, error)
+}
+
+// TrackEvents stamps the events with the time they are received, attributes
+// the ones with a valid token and saves them. The ads opened, clicked or
+// replied, are added to the ones viewed on their device
+func (interactor *TrackEvents) TrackEvents(events []domain.TrackingEvent) error {
+	now := time.Now
+	if interactor.Now != nil {
+		now = interactor.Now
+	}
+	receivedAt := now()
+	for i := range events {
+		events[i].Time = receivedAt
+		interactor.attribute(&events[i])
+	}
+	if err := interactor.Repository.Save(events); err != nil {
+		interactor.Logger.ErrorSavingEvents(len(events), err)
+		return domain.NewError(domain.UnavailableError, domain.ErrCodeEventsUnavailable, "events not saved", err)
+	}
+	interactor.addViewed(events)
+	return nil
+}
+
+// addViewed stores the ads opened on each device, most recent first
+func (interactor *TrackEvents) addViewed(events []domain.TrackingEvent) {
+	if interactor.RecentlyViewed == nil {
+		return
+	}
+	viewed := make(map[string][]int64)
+	var devices []string
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if event.Type == domain.ImpressionEvent || event.DeviceID == "" || event.ListID == 0 {
+			continue
+		}
+		if _, ok := viewed[event.DeviceID]; !ok {
+			devices = append(devices, event.DeviceID)
+		}
+		viewed[event.DeviceID] = append(viewed[event.DeviceID], event.ListID)
+	}
+	for _, deviceID := range devices {
+		interactor.RecentlyViewed.Add(deviceID, viewed[deviceID])
+	}
+}
+
+// attribute replaces the event carousel, source ad and position with the
+// ones signed on its token, so clients cannot misreport them. Events whose
+// token is invalid, expired or from another ad are kept unattributed
+func (interactor *TrackEvents) attribute(event *domain.TrackingEvent) {
+	if interactor.Tokens == nil || event.Token == "" {
+		return
+	}
+	attribution, err := interactor.Tokens.Verify(event.Token)
+	if err == nil && event.ListID != 0 && event.ListID != attribution.ListID {
+		err = fmt.Errorf("token of list id %d", attribution.ListID)
+	}
+	if err != nil {
+		interactor.Logger.InvalidAttributionToken(event.ListID, err)
+		return
+	}
+	event.Carousel = attribution.Carousel
+	event.ConfigVersion = attribution.ConfigVersion
+	event.SourceListID = attribution.SourceListID
+	event.ListID = attribution.ListID
+	event.Position = attribution.Position
+	event.Variant = attribution.Variant
+	event.Attributed = true
+}
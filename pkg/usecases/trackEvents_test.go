@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gitlab.com/yapo_team/legacy/mobile-apps/ads-recommender/pkg/domain"
+)
+
+type mockTrackingEventsRepository struct {
+	mock.Mock
+}
+
+func (m *mockTrackingEventsRepository) Save(events []domain.TrackingEvent) error {
+	return m.Called(events).Error(0)
+}
+
+type mockTrackEventsLogger struct {
+	mock.Mock
+}
+
+func (m *mockTrackEventsLogger) ErrorSavingEvents(count int, err error) {
+	m.Called(count, err)
+}
+
+func (m *mockTrackEventsLogger) InvalidAttributionToken(listID int64, err error) {
+	m.Called(listID, err)
+}
+
+type mockAttributionVerifier struct {
+	mock.Mock
+}
+
+func (m *mockAttributionVerifier) Verify(token string) (domain.Attribution, error) {
+	args := m.Called(token)
+	return args.Get(0).(domain.Attribution), args.Error(1)
+}
+
+func TestTrackEventsOK(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	repo := &mockTrackingEventsRepository{}
+	repo.On("Save", []domain.TrackingEvent{
+		{Type: domain.ClickEvent, Carousel: "default", SourceListID: 1, ListID: 2, Position: 3, RequestID: "r", Time: now},
+	}).Return(nil)
+	interactor := TrackEvents{Repository: repo, Now: func() time.Time { return now }}
+	err := interactor.TrackEvents([]domain.TrackingEvent{
+		{Type: domain.ClickEvent, Carousel: "default", SourceListID: 1, ListID: 2, Position: 3, RequestID: "r"},
+	})
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestTrackEventsError(t *testing.T) {
+	repo := &mockTrackingEventsRepository{}
+	saveErr := errors.New("buffer full")
+	repo.On("Save", mock.Anything).Return(saveErr)
+	logger := &mockTrackEventsLogger{}
+	logger.On("ErrorSavingEvents", 1, saveErr)
+	interactor := TrackEvents{Repository: repo, Logger: logger}
+	err := interactor.TrackEvents([]domain.TrackingEvent{{Type: domain.ImpressionEvent}})
+	assert.Equal(t, domain.UnavailableError, domain.ErrorKindOf(err))
+	assert.Equal(t, domain.ErrCodeEventsUnavailable, domain.ErrorCodeOf(err))
+	logger.AssertExpectations(t)
+}
+
+func TestTrackEventsAttribution(t *testing.T) {
+	now := time.Date(2021, 5, 12, 15, 0, 0, 0, time.UTC)
+	attribution := domain.Attribution{
+		Carousel: "default", ConfigVersion: "0a1b2c3d", SourceListID: 1, ListID: 2, Position: 3, Variant: "b",
+	}
+	tokenErr := errors.New("expired attribution token")
+	tokens := &mockAttributionVerifier{}
+	tokens.On("Verify", "valid").Return(attribution, nil)
+	tokens.On("Verify", "expired").Return(attribution, tokenErr)
+	logger := &mockTrackEventsLogger{}
+	logger.On("InvalidAttributionToken", int64(2), tokenErr).Once()
+	logger.On("InvalidAttributionToken", int64(5), mock.Anything).Once()
+	repo := &mockTrackingEventsRepository{}
+	repo.On("Save", []domain.TrackingEvent{
+		{
+			Type: domain.ClickEvent, Carousel: "default", ConfigVersion: "0a1b2c3d", SourceListID: 1, ListID: 2,
+			Position: 3, Variant: "b", RequestID: "r", Time: now, Token: "valid", Attributed: true,
+		},
+		{Type: domain.ClickEvent, Carousel: "other", ListID: 2, RequestID: "r", Time: now, Token: "expired"},
+		{Type: domain.ClickEvent, Carousel: "other", ListID: 5, RequestID: "r", Time: now, Token: "valid"},
+	}).Return(nil)
+	interactor := TrackEvents{Repository: repo, Logger: logger, Tokens: tokens, Now: func() time.Time { return now }}
+	err := interactor.TrackEvents([]domain.TrackingEvent{
+		{Type: domain.ClickEvent, RequestID: "r", Token: "valid"},
+		{Type: domain.ClickEvent, Carousel: "other", ListID: 2, RequestID: "r", Token: "expired"},
+		// tokens of other ads are not accepted
+		{Type: domain.ClickEvent, Carousel: "other", ListID: 5, RequestID: "r", Token: "valid"},
+	})
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	logger.AssertExpectations(t)
+}
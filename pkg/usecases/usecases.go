@@ -7,10 +7,106 @@ import (
 // GetSuggestionsInteractor defines the available methods for this interactor
 type GetSuggestionsInteractor interface {
 	// GetSuggestions will get all suggestions for the given listID
-	GetSuggestions(
-		listID string,
-		optionalParams []string,
-		size, from int,
-		carouselType string,
-	) (ads []domain.Ad, err error)
+	GetSuggestions(request SuggestionsRequest) (SuggestionsResult, error)
+}
+
+// SuggestionsRequest holds the input needed to get ads suggestions
+type SuggestionsRequest struct {
+	ListID         string
+	OptionalParams []string
+	Size           int
+	From           int
+	CarouselType   string
+	// Cursor is the opaque value returned on a previous page, when set
+	// the next page is retrieved and From is ignored
+	Cursor string
+	// UnitID identifies the user or device experiment variants are assigned to
+	UnitID string
+	// Viewed are the ads recently viewed on the session, most recent first
+	Viewed []int64
+	// Exclusions are the ads and sellers never suggested
+	Exclusions domain.Exclusions
+}
+
+// SuggestionsResult holds the suggested ads and the cursor to get the next page
+type SuggestionsResult struct {
+	Ads []domain.Ad
+	// Cursor is empty when there are no more pages
+	Cursor string
+	// Offset is the carousel position of the first ad, pages requested with
+	// a cursor follow the previous ones
+	Offset int
+	// Variant is the carousel that served the ads when the requested one
+	// is on experiment
+	Variant string
+}
+
+// GetMultiSuggestionsInteractor defines the methods to get the suggestions
+// of several carousels at once
+type GetMultiSuggestionsInteractor interface {
+	// GetMultiSuggestions will get the suggestions of every carousel for the
+	// given listID, keyed by carousel
+	GetMultiSuggestions(request MultiSuggestionsRequest) (map[string]SuggestionsResult, error)
+}
+
+// MultiSuggestionsRequest holds the input needed to get the suggestions of
+// several carousels for the same ad
+type MultiSuggestionsRequest struct {
+	ListID         string
+	OptionalParams []string
+	Size           int
+	CarouselTypes  []string
+	// UnitID identifies the user or device experiment variants are assigned to
+	UnitID string
+	// Exclusions are the ads and sellers never suggested
+	Exclusions domain.Exclusions
+}
+
+// GetFeedInteractor defines the methods to get the feed of an ad
+type GetFeedInteractor interface {
+	// GetFeed will get every section of the feed layout for the given listID
+	GetFeed(request FeedRequest) (FeedResult, error)
+}
+
+// FeedRequest holds the input needed to get the feed of an ad
+type FeedRequest struct {
+	ListID         string
+	OptionalParams []string
+	// Viewed are the ads recently viewed on the session, most recent first
+	Viewed []int64
+	// Exclusions are the ads and sellers never suggested
+	Exclusions domain.Exclusions
+}
+
+// FeedResult holds the feed sections with ads, in layout order
+type FeedResult struct {
+	Sections []FeedSectionResult
+}
+
+// FeedSectionResult holds the ads of a feed section
+type FeedSectionResult struct {
+	Carousel string
+	Ads      []domain.Ad
+}
+
+// HideAdsInteractor defines the methods to hide ads from the suggestions
+// of a device
+type HideAdsInteractor interface {
+	// HideAds hides the ad, or every ad of its seller, on the device
+	HideAds(request HideAdsRequest) error
+}
+
+// HideAdsRequest holds the ad hidden on a device, Seller hides every ad of
+// its seller instead
+type HideAdsRequest struct {
+	DeviceID string
+	ListID   int64
+	Seller   bool
+}
+
+// TrackEventsInteractor defines the methods to track the interactions with
+// recommended ads
+type TrackEventsInteractor interface {
+	// TrackEvents stores the events of a client
+	TrackEvents(events []domain.TrackingEvent) error
 }
@@ -2,7 +2,7 @@
 
 # Pact tests
 export PACT_TEST_ENABLED=true
-export MS_MAIN_FILE=cmd/${APPNAME}/main.go
+export MS_MAIN_FILE=cmd/${APPNAME}
 export MS_BINARY=${APPNAME}-pact
 export PACT_DIRECTORY=pact
 